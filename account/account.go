@@ -0,0 +1,237 @@
+// Package account models the users of the web app, their sign-in sessions and API tokens, and
+// which devices they can see and edit.
+package account
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/util"
+)
+
+// ErrNotFound is returned by Store methods when there's no matching entity.
+var ErrNotFound = errors.New("account: not found")
+
+// tokenPrefix starts every API token so that tokens are easy to recognize, e.g. by secret
+// scanners.
+const tokenPrefix = "est_"
+
+// User is someone who has signed in with the OIDC provider.
+type User struct {
+	// ID identifies the user. It's assigned when the user is stored.
+	ID string `datastore:"-"`
+
+	// Issuer and Subject identify the user to the OIDC provider they sign in with.
+	Issuer  string `datastore:"issuer"`
+	Subject string `datastore:"subject"`
+
+	// Email is the user's email address. Devices are owned by and shared with email addresses,
+	// but only if the OIDC provider has verified it, which EmailVerified records.
+	Email         string `datastore:"email"`
+	EmailVerified bool   `datastore:"email_verified,noindex"`
+	Name          string `datastore:"name,noindex"`
+
+	Created   time.Time `datastore:"created,noindex"`
+	LastLogin time.Time `datastore:"last_login,noindex"`
+}
+
+// VerifiedEmail returns the user's email address if it's been verified, or the empty string
+// otherwise. It's what's used to decide whether the user is an admin and which devices they own
+// or are shared with.
+func (u User) VerifiedEmail() string {
+	if !u.EmailVerified {
+		return ""
+	}
+	return u.Email
+}
+
+// Validate returns an error if u is not valid.
+func (u User) Validate() error {
+	if u.Issuer == "" || u.Subject == "" {
+		return errors.New("account: issuer and subject must be set")
+	}
+	return nil
+}
+
+// Session is a signed-in browser session. The session token itself isn't stored, only its
+// hash, which is the session's ID.
+type Session struct {
+	// ID is the hash of the session token as returned by HashToken.
+	ID string `datastore:"-"`
+
+	UserID  string    `datastore:"user_id"`
+	Created time.Time `datastore:"created,noindex"`
+	Expires time.Time `datastore:"expires,noindex"`
+}
+
+// Expired reports whether s has expired at time now.
+func (s Session) Expired(now time.Time) bool {
+	return !now.Before(s.Expires)
+}
+
+// APIToken is a token that a user creates to call the web app's API from scripts. It acts as
+// the user who created it. The token itself isn't stored, only its hash, so it can't be
+// recovered if it's lost.
+type APIToken struct {
+	// ID identifies the token. It's assigned when the token is stored.
+	ID string `datastore:"-"`
+
+	UserID string `datastore:"user_id"`
+
+	// Name describes what the token is for.
+	Name string `datastore:"name,noindex"`
+
+	// Hash is the hash of the token as returned by HashToken.
+	Hash string `datastore:"hash"`
+
+	Created time.Time `datastore:"created,noindex"`
+}
+
+// Validate returns an error if t is not valid.
+func (t APIToken) Validate() error {
+	if t.UserID == "" {
+		return errors.New("account: user ID must be set")
+	}
+	if t.Name == "" {
+		return errors.New("account: name must be set")
+	}
+	if len(t.Hash) != hex.EncodedLen(sha256.Size) {
+		return errors.New("account: hash must be a hex SHA-256 hash")
+	}
+	return nil
+}
+
+// Store stores users, sessions, and API tokens.
+type Store interface {
+	// User gets the user with the given ID. It returns ErrNotFound if there's none.
+	User(ctx context.Context, id string) (User, error)
+
+	// UserBySubject gets the user with the given OIDC issuer and subject. It returns
+	// ErrNotFound if there's none.
+	UserBySubject(ctx context.Context, issuer, subject string) (User, error)
+
+	// PutUser validates and stores u, assigning it an ID if it doesn't have one. It returns
+	// the stored user.
+	PutUser(ctx context.Context, u User) (User, error)
+
+	// Session gets the session with the given ID. It returns ErrNotFound if there's none.
+	// Expired sessions are returned too.
+	Session(ctx context.Context, id string) (Session, error)
+
+	// PutSession stores s, which must have an ID.
+	PutSession(ctx context.Context, s Session) error
+
+	// DeleteSession deletes the session with the given ID. It's not an error if there's none.
+	DeleteSession(ctx context.Context, id string) error
+
+	// APITokens gets the given user's API tokens.
+	APITokens(ctx context.Context, userID string) ([]APIToken, error)
+
+	// APITokenByHash gets the token with the given hash. It returns ErrNotFound if there's none.
+	APITokenByHash(ctx context.Context, hash string) (APIToken, error)
+
+	// PutAPIToken validates and stores t, assigning it an ID if it doesn't have one. It returns
+	// the stored token.
+	PutAPIToken(ctx context.Context, t APIToken) (APIToken, error)
+
+	// DeleteAPIToken deletes the token with the given ID. It returns ErrNotFound if there's none.
+	DeleteAPIToken(ctx context.Context, id string) error
+}
+
+// HashToken returns the hash of a session or API token. Tokens are long and random, so a fast
+// hash is enough to keep them from being recovered from the store.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewSession starts a session for the given user that expires after ttl. It returns the session
+// token, which goes in the session cookie, and a Session ready to be stored.
+func NewSession(userID string, ttl time.Duration, now time.Time) (string, Session, error) {
+	token, err := randomString(32)
+	if err != nil {
+		return "", Session{}, err
+	}
+
+	return token, Session{
+		ID:      HashToken(token),
+		UserID:  userID,
+		Created: now,
+		Expires: now.Add(ttl),
+	}, nil
+}
+
+// NewAPIToken generates a new API token for the given user. It returns the token, which must be
+// given to the user because it can't be recovered, and an APIToken holding its hash, ready to be
+// stored.
+func NewAPIToken(userID, name string) (string, APIToken, error) {
+	s, err := randomString(32)
+	if err != nil {
+		return "", APIToken{}, err
+	}
+	token := tokenPrefix + s
+
+	t := APIToken{
+		UserID:  userID,
+		Name:    name,
+		Hash:    HashToken(token),
+		Created: time.Now().UTC(),
+	}
+	return token, t, t.Validate()
+}
+
+// IsAPIToken reports whether token looks like an API token rather than some other bearer
+// token, such as an OIDC ID token.
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, tokenPrefix)
+}
+
+// PrepareUser readies u to be stored. It validates u and assigns it an ID if it doesn't have
+// one. Store implementations call it from PutUser.
+func PrepareUser(u User) (User, error) {
+	if err := u.Validate(); err != nil {
+		return u, err
+	}
+
+	if u.ID == "" {
+		id, err := util.NewID()
+		if err != nil {
+			return u, err
+		}
+		u.ID = id
+	}
+
+	return u, nil
+}
+
+// PrepareAPIToken readies t to be stored. It validates t and assigns it an ID if it doesn't
+// have one. Store implementations call it from PutAPIToken.
+func PrepareAPIToken(t APIToken) (APIToken, error) {
+	if err := t.Validate(); err != nil {
+		return t, err
+	}
+
+	if t.ID == "" {
+		id, err := util.NewID()
+		if err != nil {
+			return t, err
+		}
+		t.ID = id
+	}
+
+	return t, nil
+}
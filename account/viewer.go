@@ -0,0 +1,126 @@
+package account
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/mtraver/environmental-sensor/device"
+)
+
+// Viewer is whoever is making a request: a signed-in user, or an anonymous caller if User has
+// no ID.
+type Viewer struct {
+	User User
+
+	// Admin is true if the viewer can see and edit every device and use the debug pages.
+	Admin bool
+}
+
+// SignedIn reports whether the viewer is a signed-in user.
+func (v Viewer) SignedIn() bool {
+	return v.User.ID != ""
+}
+
+// CanView reports whether the viewer can see d and its measurements.
+func (v Viewer) CanView(d device.Device) bool {
+	if v.Admin || d.IsOwnedBy(v.User.VerifiedEmail()) {
+		return true
+	}
+
+	switch d.EffectiveVisibility() {
+	case device.Public:
+		return true
+	case device.Private:
+		return d.IsSharedWith(v.User.VerifiedEmail())
+	default:
+		return false
+	}
+}
+
+// CanEdit reports whether the viewer can change or delete d, and the alert rules and
+// calibration profiles that apply to it.
+func (v Viewer) CanEdit(d device.Device) bool {
+	return v.Admin || d.IsOwnedBy(v.User.VerifiedEmail())
+}
+
+// DeviceScope is the set of device IDs whose measurements a viewer can read. A nil scope allows
+// every device ID, including those of devices that aren't registered.
+type DeviceScope map[string]struct{}
+
+// Scope returns the device IDs whose measurements v can read: every ID of every device in reg
+// that v can see. Admins can read every device ID.
+func (v Viewer) Scope(ctx context.Context, reg device.Registry) (DeviceScope, error) {
+	if v.Admin {
+		return nil, nil
+	}
+
+	devices, err := reg.Devices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := make(DeviceScope)
+	for _, d := range devices {
+		if !v.CanView(d) {
+			continue
+		}
+		for _, id := range d.DeviceIDs() {
+			scope[id] = struct{}{}
+		}
+	}
+
+	return scope, nil
+}
+
+// Allows reports whether the scope includes the given device ID.
+func (s DeviceScope) Allows(deviceID string) bool {
+	if s == nil {
+		return true
+	}
+
+	_, ok := s[deviceID]
+	return ok
+}
+
+// Restrict returns the device IDs to query given the IDs a caller asked for. IDs outside the
+// scope are dropped, and if the caller didn't ask for any then it's every ID in the scope, sorted.
+// ok is false if there's nothing to query. A nil result with ok true means every device.
+func (s DeviceScope) Restrict(ids []string) ([]string, bool) {
+	if s == nil {
+		return ids, true
+	}
+
+	var allowed []string
+	if len(ids) == 0 {
+		allowed = slices.Sorted(maps.Keys(s))
+	} else {
+		allowed = slices.DeleteFunc(slices.Clone(ids), func(id string) bool {
+			return !s.Allows(id)
+		})
+	}
+
+	return allowed, len(allowed) > 0
+}
+
+// IsAdmin reports whether the given email address is one of admins. Email addresses are
+// compared case-insensitively. The address must have been verified; see User.VerifiedEmail.
+func IsAdmin(email string, admins []string) bool {
+	return email != "" && slices.ContainsFunc(admins, func(a string) bool {
+		return strings.EqualFold(a, email)
+	})
+}
+
+type viewerKey struct{}
+
+// NewContext returns a copy of ctx that carries v.
+func NewContext(ctx context.Context, v Viewer) context.Context {
+	return context.WithValue(ctx, viewerKey{}, v)
+}
+
+// FromContext returns the viewer carried by ctx. It's an anonymous viewer if ctx carries none.
+func FromContext(ctx context.Context) Viewer {
+	v, _ := ctx.Value(viewerKey{}).(Viewer)
+	return v
+}
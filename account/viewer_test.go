@@ -0,0 +1,132 @@
+package account
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mtraver/environmental-sensor/device"
+)
+
+func TestViewerAccess(t *testing.T) {
+	alice := Viewer{User: User{ID: "1", Email: "alice@example.com", EmailVerified: true}}
+	bob := Viewer{User: User{ID: "2", Email: "bob@example.com", EmailVerified: true}}
+	admin := Viewer{User: User{ID: "3", Email: "admin@example.com", EmailVerified: true}, Admin: true}
+	unverified := Viewer{User: User{ID: "4", Email: "alice@example.com"}}
+	anonymous := Viewer{}
+
+	private := device.Device{DeviceID: "foo", Owner: "Alice@example.com", SharedWith: []string{"bob@example.com"}}
+	public := device.Device{DeviceID: "foo", Owner: "alice@example.com", Visibility: device.Public}
+	hidden := device.Device{DeviceID: "foo", Owner: "alice@example.com", Visibility: device.Hidden, SharedWith: []string{"bob@example.com"}}
+	unowned := device.Device{DeviceID: "foo"}
+
+	cases := []struct {
+		name    string
+		viewer  Viewer
+		d       device.Device
+		canView bool
+		canEdit bool
+	}{
+		{"owner_private", alice, private, true, true},
+		{"shared_private", bob, private, true, false},
+		{"admin_private", admin, private, true, true},
+		{"anonymous_private", anonymous, private, false, false},
+		{"anonymous_public", anonymous, public, true, false},
+		{"other_public", bob, public, true, false},
+		{"owner_hidden", alice, hidden, true, true},
+		{"shared_hidden", bob, hidden, false, false},
+		{"admin_hidden", admin, hidden, true, true},
+		{"anonymous_unowned", anonymous, unowned, true, false},
+		{"user_unowned", alice, unowned, true, false},
+		{"admin_unowned", admin, unowned, true, true},
+		{"unverified_owner_private", unverified, private, false, false},
+		{"unverified_owner_public", unverified, public, true, false},
+		{"unverified_shared_private", Viewer{User: User{ID: "5", Email: "bob@example.com"}}, private, false, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.viewer.CanView(tc.d); got != tc.canView {
+				t.Errorf("CanView: got %v, want %v", got, tc.canView)
+			}
+			if got := tc.viewer.CanEdit(tc.d); got != tc.canEdit {
+				t.Errorf("CanEdit: got %v, want %v", got, tc.canEdit)
+			}
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if v := FromContext(context.Background()); v.SignedIn() || v.Admin {
+		t.Errorf("got %+v, want anonymous viewer", v)
+	}
+
+	want := Viewer{User: User{ID: "1", Email: "alice@example.com"}}
+	if got := FromContext(NewContext(context.Background(), want)); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestNewAPIToken(t *testing.T) {
+	token, tok, err := NewAPIToken("1", "script")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !IsAPIToken(token) {
+		t.Errorf("IsAPIToken(%q) = false, want true", token)
+	}
+	if tok.Hash != HashToken(token) {
+		t.Errorf("got hash %q, want %q", tok.Hash, HashToken(token))
+	}
+
+	if _, _, err := NewAPIToken("1", ""); err == nil {
+		t.Error("Expected error for token without a name, got nil")
+	}
+}
+
+// fakeRegistry is a Registry that only lists devices.
+type fakeRegistry struct {
+	device.Registry
+	devices []device.Device
+}
+
+func (r fakeRegistry) Devices(ctx context.Context) ([]device.Device, error) {
+	return r.devices, nil
+}
+
+func TestScope(t *testing.T) {
+	reg := fakeRegistry{devices: []device.Device{
+		{DeviceID: "mine", Aliases: []string{"old"}, Owner: "alice@example.com"},
+		{DeviceID: "public", Visibility: device.Public},
+		{DeviceID: "private", Owner: "bob@example.com"},
+	}}
+	alice := Viewer{User: User{ID: "1", Email: "alice@example.com", EmailVerified: true}}
+
+	scope, err := alice.Scope(context.Background(), reg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ids, ok := scope.Restrict(nil)
+	if diff := cmp.Diff(ids, []string{"mine", "old", "public"}); !ok || diff != "" {
+		t.Errorf("Restrict(nil) mismatch (-got +want):\n%s", diff)
+	}
+
+	ids, ok = scope.Restrict([]string{"private", "old"})
+	if diff := cmp.Diff(ids, []string{"old"}); !ok || diff != "" {
+		t.Errorf("Restrict mismatch (-got +want):\n%s", diff)
+	}
+
+	if _, ok := scope.Restrict([]string{"private"}); ok {
+		t.Error("Restrict: expected nothing to query")
+	}
+
+	admin, err := Viewer{Admin: true}.Scope(context.Background(), reg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !admin.Allows("unregistered") {
+		t.Error("Admin scope doesn't allow unregistered device IDs")
+	}
+}
@@ -0,0 +1,203 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/device"
+	"github.com/mtraver/environmental-sensor/measurement"
+)
+
+// Database gets the most recent measurements of devices, which absence rules need.
+type Database interface {
+	Latest(ctx context.Context, deviceIDs []string) (map[string]measurement.StorableMeasurement, error)
+}
+
+// DefaultCacheTTL is how long an Evaluator uses the rules it has read before reading them again.
+const DefaultCacheTTL = 30 * time.Second
+
+// Evaluator evaluates rules and sends notifications when alerts start firing or resolve.
+type Evaluator struct {
+	store    Store
+	database Database
+	registry device.Registry
+	channels map[string]Notifier
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	rules   []Rule
+	fetched time.Time
+}
+
+// NewEvaluator returns an Evaluator that reads rules from and saves states to store, and sends
+// notifications to the given channels. registry is used to find the devices to which absence
+// rules that don't name a device apply. Observe reads the rules at most once per ttl, so changes
+// to them take effect within ttl rather than right away.
+func NewEvaluator(store Store, database Database, registry device.Registry, channels map[string]Notifier, ttl time.Duration) *Evaluator {
+	return &Evaluator{
+		store:    store,
+		database: database,
+		registry: registry,
+		channels: channels,
+		ttl:      ttl,
+		now:      time.Now,
+	}
+}
+
+// cachedRules returns the rules, reading them from the store if the cached ones are stale.
+func (e *Evaluator) cachedRules(ctx context.Context) ([]Rule, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	if e.rules != nil && now.Sub(e.fetched) < e.ttl {
+		return e.rules, nil
+	}
+
+	rules, err := e.store.AlertRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if rules == nil {
+		rules = []Rule{}
+	}
+
+	e.rules, e.fetched = rules, now
+	return rules, nil
+}
+
+// Observe evaluates every rule that applies to the device that reported sm. It's called as
+// measurements arrive. The state of a threshold or AQI category rule is only read if sm has the
+// value that the rule checks.
+func (e *Evaluator) Observe(ctx context.Context, sm measurement.StorableMeasurement) error {
+	rules, err := e.cachedRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, r := range rules {
+		if !r.AppliesTo(sm.DeviceID) {
+			continue
+		}
+
+		met, value, ok := r.Condition(sm)
+		if !ok && r.Kind != Absence {
+			continue
+		}
+
+		state, err := e.store.AlertState(ctx, r.ID, sm.DeviceID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		var next State
+		if r.Kind == Absence {
+			// Any measurement may resolve an absence alert, so don't ignore late arrivals.
+			next = state.nextAbsence(r, sm.Timestamp, e.now())
+		} else {
+			if sm.Timestamp.Before(state.Evaluated) {
+				continue
+			}
+			next = state.next(r, met, value, sm.Timestamp)
+		}
+
+		if err := e.update(ctx, r, state, next); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// CheckAbsence evaluates every absence rule. It's called on a schedule, so it reads the rules
+// from the store rather than using the cached ones.
+func (e *Evaluator) CheckAbsence(ctx context.Context) error {
+	rules, err := e.store.AlertRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := e.now()
+
+	var errs []error
+	for _, r := range rules {
+		if r.Kind != Absence || !r.Enabled {
+			continue
+		}
+
+		ids := []string{r.DeviceID}
+		if r.DeviceID == "" {
+			devices, err := e.registry.Devices(ctx)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			ids = make([]string, len(devices))
+			for i, d := range devices {
+				ids[i] = d.DeviceID
+			}
+		}
+
+		latest, err := e.database.Latest(ctx, ids)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		// Devices that have never reported a measurement aren't considered absent.
+		for id, sm := range latest {
+			state, err := e.store.AlertState(ctx, r.ID, id)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			if err := e.update(ctx, r, state, state.nextAbsence(r, sm.Timestamp, now)); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// update saves next and sends notifications if the alert started firing or resolved.
+func (e *Evaluator) update(ctx context.Context, r Rule, prev, next State) error {
+	if next == prev {
+		return nil
+	}
+
+	if err := e.store.PutAlertState(ctx, next); err != nil {
+		return err
+	}
+
+	if next.Status == prev.Status || (next.Status != Firing && next.Status != Resolved) {
+		return nil
+	}
+
+	return e.notify(ctx, Notification{Rule: r, State: next})
+}
+
+func (e *Evaluator) notify(ctx context.Context, n Notification) error {
+	var errs []error
+	for _, name := range n.Rule.Channels {
+		notifier, ok := e.channels[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("alert: rule %q uses unknown channel %q", n.Rule.Name, name))
+			continue
+		}
+
+		if err := notifier.Notify(ctx, n); err != nil {
+			errs = append(errs, fmt.Errorf("alert: failed to notify channel %q: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
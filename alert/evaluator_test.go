@@ -0,0 +1,254 @@
+package alert
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mtraver/environmental-sensor/device"
+	"github.com/mtraver/environmental-sensor/measurement"
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+type fakeStore struct {
+	rules  []Rule
+	states map[string]State
+
+	// ruleReads and stateReads count calls to AlertRules and AlertState.
+	ruleReads  int
+	stateReads int
+}
+
+func (s *fakeStore) AlertRules(ctx context.Context) ([]Rule, error) {
+	s.ruleReads++
+	return s.rules, nil
+}
+
+func (s *fakeStore) AlertRule(ctx context.Context, id string) (Rule, error) {
+	for _, r := range s.rules {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return Rule{}, ErrNotFound
+}
+
+func (s *fakeStore) PutAlertRule(ctx context.Context, r Rule) (Rule, error) {
+	s.rules = append(s.rules, r)
+	return r, nil
+}
+
+func (s *fakeStore) DeleteAlertRule(ctx context.Context, id string) error {
+	return nil
+}
+
+func (s *fakeStore) AlertStates(ctx context.Context) ([]State, error) {
+	var states []State
+	for _, st := range s.states {
+		states = append(states, st)
+	}
+	return states, nil
+}
+
+func (s *fakeStore) AlertState(ctx context.Context, ruleID, deviceID string) (State, error) {
+	s.stateReads++
+	st, ok := s.states[NewState(ruleID, deviceID).DBKey()]
+	if !ok {
+		return NewState(ruleID, deviceID), nil
+	}
+	return st, nil
+}
+
+func (s *fakeStore) PutAlertState(ctx context.Context, st State) error {
+	if s.states == nil {
+		s.states = make(map[string]State)
+	}
+	s.states[st.DBKey()] = st
+	return nil
+}
+
+type fakeDatabase map[string]measurement.StorableMeasurement
+
+func (db fakeDatabase) Latest(ctx context.Context, deviceIDs []string) (map[string]measurement.StorableMeasurement, error) {
+	latest := make(map[string]measurement.StorableMeasurement)
+	for _, id := range deviceIDs {
+		if sm, ok := db[id]; ok {
+			latest[id] = sm
+		}
+	}
+	return latest, nil
+}
+
+type fakeRegistry struct {
+	device.Registry
+	devices []device.Device
+}
+
+func (r fakeRegistry) Devices(ctx context.Context) ([]device.Device, error) {
+	return r.devices, nil
+}
+
+type recordingNotifier struct {
+	notifications []Notification
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, notification Notification) error {
+	n.notifications = append(n.notifications, notification)
+	return nil
+}
+
+func statuses(notifications []Notification) []Status {
+	var s []Status
+	for _, n := range notifications {
+		s = append(s, n.State.Status)
+	}
+	return s
+}
+
+func TestEvaluatorObserve(t *testing.T) {
+	t0 := time.Date(2018, time.March, 25, 0, 0, 0, 0, time.UTC)
+
+	store := &fakeStore{
+		rules: []Rule{
+			{ID: "co2", Name: "High CO2", Kind: Threshold, Metric: metric.CO2, Op: GreaterThan, Threshold: 1200, For: 10 * time.Minute, Channels: []string{"rec"}, Enabled: true},
+			{ID: "other", Name: "Other device", DeviceID: "bar", Kind: Threshold, Metric: metric.CO2, Op: GreaterThan, Threshold: 0, Channels: []string{"rec"}, Enabled: true},
+			{ID: "disabled", Name: "Disabled", Kind: Threshold, Metric: metric.CO2, Op: GreaterThan, Threshold: 0, Channels: []string{"rec"}},
+		},
+	}
+	rec := &recordingNotifier{}
+	e := NewEvaluator(store, fakeDatabase{}, fakeRegistry{}, map[string]Notifier{"rec": rec}, DefaultCacheTTL)
+
+	observations := []struct {
+		at  time.Duration
+		co2 float32
+	}{
+		{0, 1500},
+		{5 * time.Minute, 1600},
+		{10 * time.Minute, 1700},
+		{15 * time.Minute, 1800},
+		// A late arrival that would resolve the alert if it weren't ignored.
+		{12 * time.Minute, 800},
+		{20 * time.Minute, 900},
+	}
+	for _, o := range observations {
+		sm := measurement.StorableMeasurement{DeviceID: "foo", Timestamp: t0.Add(o.at), CO2: floatPtr(o.co2)}
+		if err := e.Observe(context.Background(), sm); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if diff := cmp.Diff(statuses(rec.notifications), []Status{Firing, Resolved}); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+
+	got, _ := store.AlertState(context.Background(), "co2", "foo")
+	want := State{
+		RuleID:     "co2",
+		DeviceID:   "foo",
+		Status:     Resolved,
+		Since:      t0,
+		FiredAt:    t0.Add(10 * time.Minute),
+		ResolvedAt: t0.Add(20 * time.Minute),
+		Value:      900,
+		Evaluated:  t0.Add(20 * time.Minute),
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("state mismatch (-got +want):\n%s", diff)
+	}
+}
+
+func TestEvaluatorObserveReads(t *testing.T) {
+	t0 := time.Date(2018, time.March, 25, 0, 0, 0, 0, time.UTC)
+
+	store := &fakeStore{
+		rules: []Rule{
+			{ID: "co2", Name: "High CO2", Kind: Threshold, Metric: metric.CO2, Op: GreaterThan, Threshold: 1200, Enabled: true},
+			{ID: "temp", Name: "Hot", Kind: Threshold, Metric: metric.Temp, Op: GreaterThan, Threshold: 30, Enabled: true},
+			{ID: "aqi", Name: "Unhealthy", Kind: AQICategory, Category: "Unhealthy", Enabled: true},
+			{ID: "other", Name: "Other device", DeviceID: "bar", Kind: Threshold, Metric: metric.CO2, Op: GreaterThan, Threshold: 0, Enabled: true},
+			{ID: "dead", Name: "Dead", Kind: Absence, For: 30 * time.Minute, Enabled: true},
+		},
+	}
+	now := t0
+	e := NewEvaluator(store, fakeDatabase{}, fakeRegistry{}, nil, time.Minute)
+	e.now = func() time.Time { return now }
+
+	observe := func() {
+		t.Helper()
+		sm := measurement.StorableMeasurement{DeviceID: "foo", Timestamp: now, CO2: floatPtr(500)}
+		if err := e.Observe(context.Background(), sm); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// Only the CO2 and absence rules apply to a measurement of only CO2 from foo.
+	observe()
+	observe()
+	if store.ruleReads != 1 || store.stateReads != 4 {
+		t.Errorf("got %d rule reads and %d state reads, want 1 and 4", store.ruleReads, store.stateReads)
+	}
+
+	now = now.Add(time.Minute)
+	observe()
+	if store.ruleReads != 2 {
+		t.Errorf("got %d rule reads after the TTL, want 2", store.ruleReads)
+	}
+}
+
+func TestEvaluatorCheckAbsence(t *testing.T) {
+	t0 := time.Date(2018, time.March, 25, 0, 0, 0, 0, time.UTC)
+
+	store := &fakeStore{
+		rules: []Rule{
+			{ID: "dead", Name: "Dead", Kind: Absence, For: 30 * time.Minute, Channels: []string{"rec"}, Enabled: true},
+		},
+	}
+	database := fakeDatabase{
+		"foo": {DeviceID: "foo", Timestamp: t0},
+		"bar": {DeviceID: "bar", Timestamp: t0.Add(50 * time.Minute)},
+	}
+	registry := fakeRegistry{devices: []device.Device{{DeviceID: "foo"}, {DeviceID: "bar"}, {DeviceID: "never"}}}
+	rec := &recordingNotifier{}
+
+	e := NewEvaluator(store, database, registry, map[string]Notifier{"rec": rec}, DefaultCacheTTL)
+	e.now = func() time.Time { return t0.Add(time.Hour) }
+
+	if err := e.CheckAbsence(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rec.notifications) != 1 || rec.notifications[0].State.DeviceID != "foo" || rec.notifications[0].State.Status != Firing {
+		t.Fatalf("got notifications %+v, want foo firing", rec.notifications)
+	}
+
+	// Checking again doesn't notify again.
+	if err := e.CheckAbsence(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rec.notifications) != 1 {
+		t.Fatalf("got %d notifications, want 1", len(rec.notifications))
+	}
+
+	// The device reports again, resolving the alert.
+	sm := measurement.StorableMeasurement{DeviceID: "foo", Timestamp: t0.Add(time.Hour)}
+	if err := e.Observe(context.Background(), sm); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(statuses(rec.notifications), []Status{Firing, Resolved}); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+}
+
+func TestEvaluatorUnknownChannel(t *testing.T) {
+	store := &fakeStore{
+		rules: []Rule{
+			{ID: "co2", Name: "High CO2", Kind: Threshold, Metric: metric.CO2, Op: GreaterThan, Threshold: 0, Channels: []string{"missing"}, Enabled: true},
+		},
+	}
+	e := NewEvaluator(store, fakeDatabase{}, fakeRegistry{}, nil, DefaultCacheTTL)
+
+	sm := measurement.StorableMeasurement{DeviceID: "foo", Timestamp: time.Now(), CO2: floatPtr(500)}
+	if err := e.Observe(context.Background(), sm); err == nil {
+		t.Error("Expected error, got no error")
+	}
+}
@@ -0,0 +1,194 @@
+// Package alert evaluates alert rules against incoming measurements, tracks the state of each
+// alert, and sends notifications when alerts start firing and when they resolve.
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/aqi"
+	"github.com/mtraver/environmental-sensor/measurement"
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+var ErrNotFound = errors.New("alert: not found")
+
+type Kind string
+
+const (
+	// Threshold rules compare a metric to a threshold, e.g. "co2 > 1200".
+	Threshold Kind = "threshold"
+
+	// AQICategory rules fire when the AQI category is at least as bad as the rule's category.
+	AQICategory Kind = "aqi_category"
+
+	// Absence rules fire when a device hasn't reported a measurement for the rule's duration.
+	Absence Kind = "absence"
+)
+
+type Op string
+
+const (
+	GreaterThan        Op = ">"
+	GreaterThanOrEqual Op = ">="
+	LessThan           Op = "<"
+	LessThanOrEqual    Op = "<="
+)
+
+// Valid reports whether op is a known operator.
+func (op Op) Valid() bool {
+	return slices.Contains([]Op{GreaterThan, GreaterThanOrEqual, LessThan, LessThanOrEqual}, op)
+}
+
+// Compare reports whether v op threshold holds, e.g. whether v > threshold.
+func (op Op) Compare(v, threshold float64) bool {
+	switch op {
+	case GreaterThan:
+		return v > threshold
+	case GreaterThanOrEqual:
+		return v >= threshold
+	case LessThan:
+		return v < threshold
+	case LessThanOrEqual:
+		return v <= threshold
+	default:
+		return false
+	}
+}
+
+type Rule struct {
+	// ID identifies the rule. It's assigned when the rule is stored.
+	ID string `datastore:"-"`
+
+	Name string `datastore:"name,noindex"`
+
+	// DeviceID is the device the rule applies to. If empty, the rule applies to every device.
+	DeviceID string `datastore:"device_id"`
+
+	Kind Kind `datastore:"kind"`
+
+	// Metric, Op, and Threshold are used by Threshold rules.
+	Metric    metric.Key `datastore:"metric,noindex"`
+	Op        Op         `datastore:"op,noindex"`
+	Threshold float64    `datastore:"threshold,noindex"`
+
+	// Category is used by AQICategory rules. It's the name of one of the categories of the
+	// rule's AQI standard.
+	Category string `datastore:"category,noindex"`
+
+	// AQIStandard is the ID of the aqi.Standard that AQI thresholds and categories are on. If
+	// empty, the US EPA AQI is used.
+	AQIStandard string `datastore:"aqi_standard,noindex"`
+
+	// For Threshold and AQICategory rules, For is how long the condition must hold before the
+	// alert fires; until then it's pending. For Absence rules it's how long a device must be
+	// silent before the alert fires.
+	For time.Duration `datastore:"for,noindex"`
+
+	// Channels are the names of the notification channels to notify.
+	Channels []string `datastore:"channels,noindex"`
+
+	Enabled bool `datastore:"enabled"`
+}
+
+// Validate returns an error if r is not valid.
+func (r Rule) Validate() error {
+	if r.Name == "" {
+		return errors.New("alert: rule name must be set")
+	}
+
+	if r.For < 0 {
+		return errors.New("alert: rule duration must not be negative")
+	}
+
+	std, ok := aqi.Lookup(r.AQIStandard)
+	if !ok {
+		return fmt.Errorf("alert: unknown AQI standard %q", r.AQIStandard)
+	}
+
+	switch r.Kind {
+	case Threshold:
+		if _, ok := metric.All[r.Metric]; !ok {
+			return fmt.Errorf("alert: unknown metric %q", r.Metric)
+		}
+
+		if !r.Op.Valid() {
+			return fmt.Errorf("alert: unknown operator %q", r.Op)
+		}
+	case AQICategory:
+		if aqi.CategoryIndex(std, r.Category) < 0 {
+			return fmt.Errorf("alert: unknown %s category %q", std.Name(), r.Category)
+		}
+	case Absence:
+		if r.For == 0 {
+			return errors.New("alert: absence rules must have a duration")
+		}
+	default:
+		return fmt.Errorf("alert: unknown rule kind %q", r.Kind)
+	}
+
+	return nil
+}
+
+// AppliesTo reports whether r should be evaluated for the given device.
+func (r Rule) AppliesTo(deviceID string) bool {
+	return r.Enabled && (r.DeviceID == "" || r.DeviceID == deviceID)
+}
+
+// Condition reports whether sm meets the rule's condition, and the value that was checked.
+// ok is false if sm doesn't have the value the rule checks, or if r is an Absence rule,
+// which doesn't depend on the values of measurements.
+func (r Rule) Condition(sm measurement.StorableMeasurement) (met bool, value float64, ok bool) {
+	std, found := aqi.Lookup(r.AQIStandard)
+	if !found {
+		return false, 0, false
+	}
+	sm.FillDerivedMetrics(std)
+
+	switch r.Kind {
+	case Threshold:
+		v := sm.Value(r.Metric)
+		if v == nil {
+			return false, 0, false
+		}
+
+		return r.Op.Compare(float64(*v), r.Threshold), float64(*v), true
+	case AQICategory:
+		if sm.AQI == nil {
+			return false, 0, false
+		}
+
+		category := aqi.CategoryOf(std, int(*sm.AQI))
+		met := aqi.CategoryIndex(std, category.Name) >= aqi.CategoryIndex(std, r.Category)
+		return met, float64(*sm.AQI), true
+	default:
+		return false, 0, false
+	}
+}
+
+func (r Rule) String() string {
+	device := "any device"
+	if r.DeviceID != "" {
+		device = r.DeviceID
+	}
+
+	var cond string
+	switch r.Kind {
+	case Threshold:
+		cond = fmt.Sprintf("%s %s %g", r.Metric, r.Op, r.Threshold)
+	case AQICategory:
+		cond = fmt.Sprintf("AQI category >= %s", r.Category)
+		if std, ok := aqi.Lookup(r.AQIStandard); ok && std.ID() != aqi.USEPA.ID() {
+			cond = fmt.Sprintf("%s category >= %s", std.Name(), r.Category)
+		}
+	case Absence:
+		return fmt.Sprintf("%s: no data from %s for %v", r.Name, device, r.For)
+	}
+
+	if r.For > 0 {
+		cond += fmt.Sprintf(" for %v", r.For)
+	}
+	return fmt.Sprintf("%s: %s on %s", r.Name, cond, device)
+}
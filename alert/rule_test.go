@@ -0,0 +1,154 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/measurement"
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+func floatPtr(f float32) *float32 {
+	return &f
+}
+
+func TestRuleValidate(t *testing.T) {
+	cases := []struct {
+		name  string
+		r     Rule
+		valid bool
+	}{
+		{"threshold", Rule{Name: "co2", Kind: Threshold, Metric: metric.CO2, Op: GreaterThan, Threshold: 1200, For: 10 * time.Minute}, true},
+		{"threshold_derived", Rule{Name: "aqi", Kind: Threshold, Metric: metric.AQI, Op: GreaterThanOrEqual, Threshold: 100}, true},
+		{"threshold_dew_point", Rule{Name: "muggy", Kind: Threshold, Metric: metric.DewPoint, Op: GreaterThan, Threshold: 18}, true},
+		{"threshold_unknown_metric", Rule{Name: "x", Kind: Threshold, Metric: "radon", Op: GreaterThan}, false},
+		{"threshold_bad_op", Rule{Name: "x", Kind: Threshold, Metric: metric.CO2, Op: "=="}, false},
+		{"aqi_category", Rule{Name: "aqi", Kind: AQICategory, Category: "Unhealthy"}, true},
+		{"aqi_category_unknown", Rule{Name: "aqi", Kind: AQICategory, Category: "Meh"}, false},
+		{"aqi_category_standard", Rule{Name: "aqi", Kind: AQICategory, Category: "Very poor", AQIStandard: "eu_eaqi"}, true},
+		{"aqi_category_wrong_standard", Rule{Name: "aqi", Kind: AQICategory, Category: "Unhealthy", AQIStandard: "eu_eaqi"}, false},
+		{"aqi_standard_unknown", Rule{Name: "aqi", Kind: AQICategory, Category: "Unhealthy", AQIStandard: "nope"}, false},
+		{"absence", Rule{Name: "dead", Kind: Absence, For: 30 * time.Minute}, true},
+		{"absence_no_duration", Rule{Name: "dead", Kind: Absence}, false},
+		{"no_name", Rule{Kind: Absence, For: time.Minute}, false},
+		{"negative_duration", Rule{Name: "x", Kind: AQICategory, Category: "Good", For: -time.Minute}, false},
+		{"unknown_kind", Rule{Name: "x", Kind: "vibes"}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.r.Validate()
+			if err != nil && tc.valid {
+				t.Errorf("Unexpected error: %v", err)
+			} else if err == nil && !tc.valid {
+				t.Error("Expected error, got no error")
+			}
+		})
+	}
+}
+
+func TestRuleCondition(t *testing.T) {
+	cases := []struct {
+		name      string
+		r         Rule
+		sm        measurement.StorableMeasurement
+		wantMet   bool
+		wantValue float64
+		wantOK    bool
+	}{
+		{
+			name:      "threshold_met",
+			r:         Rule{Kind: Threshold, Metric: metric.CO2, Op: GreaterThan, Threshold: 1200},
+			sm:        measurement.StorableMeasurement{CO2: floatPtr(1500)},
+			wantMet:   true,
+			wantValue: 1500,
+			wantOK:    true,
+		},
+		{
+			name:      "threshold_not_met",
+			r:         Rule{Kind: Threshold, Metric: metric.CO2, Op: GreaterThan, Threshold: 1200},
+			sm:        measurement.StorableMeasurement{CO2: floatPtr(800)},
+			wantValue: 800,
+			wantOK:    true,
+		},
+		{
+			name: "threshold_missing_metric",
+			r:    Rule{Kind: Threshold, Metric: metric.CO2, Op: GreaterThan, Threshold: 1200},
+			sm:   measurement.StorableMeasurement{Temp: floatPtr(20)},
+		},
+		{
+			name:      "threshold_derived",
+			r:         Rule{Kind: Threshold, Metric: metric.AQI, Op: LessThan, Threshold: 10},
+			sm:        measurement.StorableMeasurement{PM25: floatPtr(0)},
+			wantMet:   true,
+			wantValue: 0,
+			wantOK:    true,
+		},
+		{
+			name:      "threshold_humidity_derived",
+			r:         Rule{Kind: Threshold, Metric: metric.VPD, Op: LessThan, Threshold: 0.5},
+			sm:        measurement.StorableMeasurement{Temp: floatPtr(20), RH: floatPtr(100)},
+			wantMet:   true,
+			wantValue: 0,
+			wantOK:    true,
+		},
+		{
+			name:      "aqi_category_worse",
+			r:         Rule{Kind: AQICategory, Category: "Unhealthy for Sensitive Groups"},
+			sm:        measurement.StorableMeasurement{PM25: floatPtr(100)},
+			wantMet:   true,
+			wantValue: 182,
+			wantOK:    true,
+		},
+		{
+			name:      "aqi_category_better",
+			r:         Rule{Kind: AQICategory, Category: "Unhealthy"},
+			sm:        measurement.StorableMeasurement{PM25: floatPtr(5)},
+			wantValue: 28,
+			wantOK:    true,
+		},
+		{
+			name:      "aqi_category_standard",
+			r:         Rule{Kind: AQICategory, Category: "Poor", AQIStandard: "eu_eaqi"},
+			sm:        measurement.StorableMeasurement{PM25: floatPtr(30)},
+			wantMet:   true,
+			wantValue: 4,
+			wantOK:    true,
+		},
+		{
+			name: "absence",
+			r:    Rule{Kind: Absence, For: time.Minute},
+			sm:   measurement.StorableMeasurement{PM25: floatPtr(5)},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			met, value, ok := tc.r.Condition(tc.sm)
+			if met != tc.wantMet || ok != tc.wantOK {
+				t.Errorf("got met=%v, ok=%v, want met=%v, ok=%v", met, ok, tc.wantMet, tc.wantOK)
+			}
+			if ok && value != tc.wantValue {
+				t.Errorf("got value %v, want %v", value, tc.wantValue)
+			}
+		})
+	}
+}
+
+func TestRuleString(t *testing.T) {
+	cases := []struct {
+		r    Rule
+		want string
+	}{
+		{Rule{Name: "High CO2", Kind: Threshold, Metric: metric.CO2, Op: GreaterThan, Threshold: 1200, For: 10 * time.Minute}, "High CO2: co2 > 1200 for 10m0s on any device"},
+		{Rule{Name: "Smoke", DeviceID: "kitchen", Kind: AQICategory, Category: "Unhealthy"}, "Smoke: AQI category >= Unhealthy on kitchen"},
+		{Rule{Name: "Smoke", Kind: AQICategory, Category: "Poor", AQIStandard: "eu_eaqi"}, "Smoke: European EAQI category >= Poor on any device"},
+		{Rule{Name: "Dead", DeviceID: "kitchen", Kind: Absence, For: 30 * time.Minute}, "Dead: no data from kitchen for 30m0s"},
+	}
+
+	for _, tc := range cases {
+		if got := tc.r.String(); got != tc.want {
+			t.Errorf("got %q, want %q", got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package alert
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/util"
+)
+
+// Used for separating substrings in database keys. The octothorpe is fine for this because
+// rule IDs and device IDs can't contain it.
+const keySep = "#"
+
+type Status string
+
+const (
+	// Inactive alerts' conditions don't hold.
+	Inactive Status = "inactive"
+
+	// Pending alerts' conditions hold but haven't held for the rule's duration yet.
+	Pending Status = "pending"
+
+	// Firing alerts' conditions have held for at least the rule's duration.
+	Firing Status = "firing"
+
+	// Resolved alerts were firing but their conditions no longer hold.
+	Resolved Status = "resolved"
+)
+
+// State is the state of one rule for one device.
+type State struct {
+	RuleID   string `datastore:"rule_id"`
+	DeviceID string `datastore:"device_id"`
+	Status   Status `datastore:"status"`
+
+	// Since is when the rule's condition started to hold. For absence rules it's when the
+	// device was last seen.
+	Since      time.Time `datastore:"since,noindex"`
+	FiredAt    time.Time `datastore:"fired_at,noindex"`
+	ResolvedAt time.Time `datastore:"resolved_at,noindex"`
+
+	// Value is the most recently checked value.
+	Value float64 `datastore:"value,noindex"`
+
+	// Evaluated is the time of the most recent evaluation. Measurements from before it are
+	// ignored so that late arrivals don't make alerts flap.
+	Evaluated time.Time `datastore:"evaluated,noindex"`
+}
+
+// NewState returns an inactive state for the given rule and device.
+func NewState(ruleID, deviceID string) State {
+	return State{
+		RuleID:   ruleID,
+		DeviceID: deviceID,
+		Status:   Inactive,
+	}
+}
+
+// DBKey returns a string key suitable for Datastore.
+func (s State) DBKey() string {
+	return strings.Join([]string{s.RuleID, s.DeviceID}, keySep)
+}
+
+// next returns the state after the rule's condition was checked against a value measured at
+// time at.
+func (s State) next(r Rule, met bool, value float64, at time.Time) State {
+	s.Value = value
+	s.Evaluated = at
+
+	if !met {
+		switch s.Status {
+		case Pending:
+			s.Status = Inactive
+		case Firing:
+			s.Status = Resolved
+			s.ResolvedAt = at
+		}
+		return s
+	}
+
+	switch s.Status {
+	case Pending:
+		if at.Sub(s.Since) >= r.For {
+			s.Status = Firing
+			s.FiredAt = at
+		}
+	case Firing:
+	default:
+		s.Since = at
+		s.Status = Pending
+		if r.For == 0 {
+			s.Status = Firing
+			s.FiredAt = at
+		}
+	}
+
+	return s
+}
+
+// nextAbsence returns the state after an absence rule was checked at time now for a device
+// that was last seen at lastSeen.
+func (s State) nextAbsence(r Rule, lastSeen time.Time, now time.Time) State {
+	s.Evaluated = now
+
+	absent := now.Sub(lastSeen) >= r.For
+	switch {
+	case absent && s.Status != Firing:
+		s.Status = Firing
+		s.Since = lastSeen
+		s.FiredAt = now
+	case !absent && s.Status == Firing:
+		s.Status = Resolved
+		s.ResolvedAt = now
+	}
+
+	return s
+}
+
+// Store stores alert rules and states.
+type Store interface {
+	AlertRules(ctx context.Context) ([]Rule, error)
+
+	// AlertRule gets the rule with the given ID. It returns ErrNotFound if there's none.
+	AlertRule(ctx context.Context, id string) (Rule, error)
+
+	// PutAlertRule validates and stores r, assigning it an ID if it doesn't have one. It
+	// returns the stored rule.
+	PutAlertRule(ctx context.Context, r Rule) (Rule, error)
+
+	// DeleteAlertRule deletes the rule with the given ID and all of its states. It returns
+	// ErrNotFound if there's none.
+	DeleteAlertRule(ctx context.Context, id string) error
+
+	AlertStates(ctx context.Context) ([]State, error)
+
+	// AlertState gets the state of the given rule for the given device. If there's none it
+	// returns an inactive state.
+	AlertState(ctx context.Context, ruleID, deviceID string) (State, error)
+
+	PutAlertState(ctx context.Context, s State) error
+}
+
+// PrepareRule readies r to be stored. It validates r and assigns it an ID if it doesn't have
+// one. Store implementations call it from PutAlertRule.
+func PrepareRule(r Rule) (Rule, error) {
+	if err := r.Validate(); err != nil {
+		return r, err
+	}
+
+	if r.ID == "" {
+		id, err := util.NewID()
+		if err != nil {
+			return r, err
+		}
+		r.ID = id
+	}
+
+	return r, nil
+}
@@ -0,0 +1,89 @@
+package alert
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStateNext(t *testing.T) {
+	t0 := time.Date(2018, time.March, 25, 0, 0, 0, 0, time.UTC)
+	r := Rule{For: 10 * time.Minute}
+
+	type step struct {
+		met  bool
+		at   time.Duration
+		want Status
+	}
+
+	cases := []struct {
+		name  string
+		r     Rule
+		steps []step
+	}{
+		{
+			name: "fires_after_duration",
+			r:    r,
+			steps: []step{
+				{true, 0, Pending},
+				{true, 5 * time.Minute, Pending},
+				{true, 10 * time.Minute, Firing},
+				{true, 15 * time.Minute, Firing},
+				{false, 20 * time.Minute, Resolved},
+				{false, 25 * time.Minute, Resolved},
+				{true, 30 * time.Minute, Pending},
+			},
+		},
+		{
+			name: "pending_clears",
+			r:    r,
+			steps: []step{
+				{true, 0, Pending},
+				{false, 5 * time.Minute, Inactive},
+				{true, 6 * time.Minute, Pending},
+				{true, 15 * time.Minute, Pending},
+				{true, 16 * time.Minute, Firing},
+			},
+		},
+		{
+			name: "no_duration",
+			r:    Rule{},
+			steps: []step{
+				{false, 0, Inactive},
+				{true, time.Minute, Firing},
+				{false, 2 * time.Minute, Resolved},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewState("rule", "foo")
+			for i, st := range tc.steps {
+				s = s.next(tc.r, st.met, 0, t0.Add(st.at))
+				if s.Status != st.want {
+					t.Fatalf("step %d: got %s, want %s", i, s.Status, st.want)
+				}
+			}
+		})
+	}
+}
+
+func TestStateNextAbsence(t *testing.T) {
+	t0 := time.Date(2018, time.March, 25, 0, 0, 0, 0, time.UTC)
+	r := Rule{Kind: Absence, For: 30 * time.Minute}
+
+	s := NewState("rule", "foo").nextAbsence(r, t0, t0.Add(10*time.Minute))
+	if s.Status != Inactive {
+		t.Errorf("got %s, want %s", s.Status, Inactive)
+	}
+
+	s = s.nextAbsence(r, t0, t0.Add(30*time.Minute))
+	if s.Status != Firing || !s.Since.Equal(t0) {
+		t.Errorf("got %s since %v, want %s since %v", s.Status, s.Since, Firing, t0)
+	}
+
+	s = s.nextAbsence(r, t0.Add(40*time.Minute), t0.Add(41*time.Minute))
+	if s.Status != Resolved {
+		t.Errorf("got %s, want %s", s.Status, Resolved)
+	}
+}
@@ -0,0 +1,55 @@
+// Package apiauth authenticates and authorizes calls to the gRPC API. Callers present either an
+// API key, which is stored hashed and may be limited to certain devices, or an OIDC ID token
+// from a trusted issuer. Devices may instead present an X.509 client certificate signed by a
+// trusted device CA. Calls are rate limited per caller.
+package apiauth
+
+import (
+	"context"
+	"slices"
+)
+
+// Principal is an authenticated caller.
+type Principal struct {
+	// ID identifies the caller for rate limiting and logging, e.g. "key:0123abcd".
+	ID string
+
+	// Name is a human-readable name for the caller.
+	Name string
+
+	// DeviceIDs are the devices whose measurements the caller may read. If it's empty then the
+	// caller may read measurements from every device.
+	DeviceIDs []string
+
+	// Device is the device ID of the caller if it's a device that authenticated with its
+	// certificate. Only devices may ingest measurements, and only their own, and devices may do
+	// nothing else.
+	Device string
+
+	// RateLimit is the number of calls per second the caller may make. If it's zero then the
+	// server's default is used.
+	RateLimit float64
+}
+
+// Scoped reports whether the principal may only read measurements from some devices.
+func (p Principal) Scoped() bool {
+	return len(p.DeviceIDs) > 0
+}
+
+// CanAccess reports whether the principal may read measurements from the given device.
+func (p Principal) CanAccess(deviceID string) bool {
+	return !p.Scoped() || slices.Contains(p.DeviceIDs, deviceID)
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx that carries p.
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal carried by ctx, if there is one.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
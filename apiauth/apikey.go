@@ -0,0 +1,125 @@
+package apiauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/util"
+)
+
+// ErrNotFound is returned by KeyStore methods when there's no matching key.
+var ErrNotFound = errors.New("apiauth: not found")
+
+// keyPrefix starts every API key so that keys are easy to recognize, e.g. by secret scanners.
+const keyPrefix = "esk_"
+
+// APIKey is a stored API key. The key itself isn't stored, only its hash, so it can't be
+// recovered if it's lost.
+type APIKey struct {
+	// ID identifies the key. It's assigned when the key is stored.
+	ID string `datastore:"-"`
+
+	// Name describes who or what the key is for.
+	Name string `datastore:"name,noindex"`
+
+	// Hash is the hash of the key as returned by HashKey.
+	Hash string `datastore:"hash"`
+
+	// DeviceIDs are the devices whose measurements the key can read. If it's empty then the key
+	// can read measurements from every device.
+	DeviceIDs []string `datastore:"device_ids,noindex"`
+
+	// RateLimit is the number of calls per second the key may make. If it's zero then the
+	// server's default is used.
+	RateLimit float64 `datastore:"rate_limit,noindex"`
+
+	Created time.Time `datastore:"created,noindex"`
+}
+
+// Validate returns an error if k is not valid.
+func (k APIKey) Validate() error {
+	if k.Name == "" {
+		return errors.New("apiauth: name must be set")
+	}
+	if len(k.Hash) != hex.EncodedLen(sha256.Size) {
+		return errors.New("apiauth: hash must be a hex SHA-256 hash")
+	}
+	if k.RateLimit < 0 {
+		return errors.New("apiauth: rate limit must not be negative")
+	}
+	return nil
+}
+
+// Principal returns the principal that authenticates with k.
+func (k APIKey) Principal() Principal {
+	return Principal{
+		ID:        "key:" + k.ID,
+		Name:      k.Name,
+		DeviceIDs: k.DeviceIDs,
+		RateLimit: k.RateLimit,
+	}
+}
+
+// KeyStore stores API keys.
+type KeyStore interface {
+	APIKeys(ctx context.Context) ([]APIKey, error)
+
+	// APIKeyByHash gets the key with the given hash. It returns ErrNotFound if there's none.
+	APIKeyByHash(ctx context.Context, hash string) (APIKey, error)
+
+	// PutAPIKey validates and stores k, assigning it an ID if it doesn't have one. It returns
+	// the stored key.
+	PutAPIKey(ctx context.Context, k APIKey) (APIKey, error)
+
+	// DeleteAPIKey deletes the key with the given ID. It returns ErrNotFound if there's none.
+	DeleteAPIKey(ctx context.Context, id string) error
+}
+
+// HashKey returns the hash of an API key. API keys are long and random, so a fast hash is
+// enough to keep them from being recovered from the store.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewKey generates a new API key. It returns the key, which must be given to the caller because
+// it can't be recovered, and an APIKey holding its hash, ready to be stored.
+func NewKey(name string, deviceIDs []string, rateLimit float64) (string, APIKey, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", APIKey{}, err
+	}
+	key := keyPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	k := APIKey{
+		Name:      name,
+		Hash:      HashKey(key),
+		DeviceIDs: deviceIDs,
+		RateLimit: rateLimit,
+		Created:   time.Now().UTC(),
+	}
+	return key, k, k.Validate()
+}
+
+// PrepareAPIKey readies k to be stored. It validates k and assigns it an ID if it doesn't have
+// one. KeyStore implementations call it from PutAPIKey.
+func PrepareAPIKey(k APIKey) (APIKey, error) {
+	if err := k.Validate(); err != nil {
+		return k, err
+	}
+
+	if k.ID == "" {
+		id, err := util.NewID()
+		if err != nil {
+			return k, err
+		}
+		k.ID = id
+	}
+
+	return k, nil
+}
@@ -0,0 +1,317 @@
+package apiauth
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/maypok86/otter/v2"
+	"github.com/mtraver/environmental-sensor/device"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	// apiKeyHeader and authorizationHeader are the metadata keys that API keys and ID tokens are
+	// sent in. gRPC metadata keys are lowercase.
+	apiKeyHeader        = "x-api-key"
+	authorizationHeader = "authorization"
+
+	// keyCacheTTL is how long API key lookups are cached, and so how long a deleted key may
+	// continue to work.
+	keyCacheTTL = time.Minute
+
+	// deviceIDField is the name of the request field that selects devices.
+	deviceIDField = "device_id"
+)
+
+// deviceMethods are the full names of the methods that devices may call.
+var deviceMethods = []string{mpb.MeasurementService_Ingest_FullMethodName}
+
+// Authenticator authenticates gRPC calls, limits their rate, and checks that they only select
+// devices the caller may read. Use its interceptors with grpc.NewServer.
+type Authenticator struct {
+	keys      KeyStore
+	oidc      *OIDCVerifier
+	deviceCAs *x509.CertPool
+
+	rateLimit float64
+	burst     int
+
+	// keyCache maps key hashes to keys. Unknown keys are cached as keys with an empty ID.
+	keyCache *otter.Cache[string, APIKey]
+
+	// limiters maps principal IDs to their rate limiters. A limiter is evicted once it has been
+	// idle for long enough to refill, when a new one would behave the same.
+	mu       sync.Mutex
+	limiters *otter.Cache[string, *rate.Limiter]
+}
+
+// NewAuthenticator returns an Authenticator that accepts API keys in keys and, if oidc is
+// non-nil, ID tokens it verifies. If deviceCAs is non-nil then calls with neither are accepted
+// from devices whose TLS client certificate is signed by one of its CAs. Each caller may make
+// rateLimit calls per second, with bursts of up to burst calls, unless its key sets its own
+// limit. If rateLimit is zero then calls are not rate limited.
+func NewAuthenticator(keys KeyStore, oidc *OIDCVerifier, deviceCAs *x509.CertPool, rateLimit float64, burst int) *Authenticator {
+	return &Authenticator{
+		keys:      keys,
+		oidc:      oidc,
+		deviceCAs: deviceCAs,
+		rateLimit: rateLimit,
+		burst:     max(burst, 1),
+		keyCache: otter.Must(&otter.Options[string, APIKey]{
+			MaximumSize:      1_000,
+			ExpiryCalculator: otter.ExpiryWriting[string, APIKey](keyCacheTTL),
+		}),
+		limiters: otter.Must(&otter.Options[string, *rate.Limiter]{
+			MaximumSize:      10_000,
+			ExpiryCalculator: otter.ExpiryAccessingFunc(limiterIdleTTL),
+		}),
+	}
+}
+
+// limiterIdleTTL returns how long the limiter must be idle before its bucket is full again.
+func limiterIdleTTL(e otter.Entry[string, *rate.Limiter]) time.Duration {
+	l := e.Value
+	return time.Duration(float64(l.Burst()) / float64(l.Limit()) * float64(time.Second))
+}
+
+// Authenticate returns the caller of the call whose incoming context is ctx.
+func (a *Authenticator) Authenticate(ctx context.Context) (Principal, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if keys := md.Get(apiKeyHeader); len(keys) > 0 {
+		return a.authenticateKey(ctx, keys[0])
+	}
+
+	if auths := md.Get(authorizationHeader); len(auths) > 0 {
+		token, ok := strings.CutPrefix(auths[0], "Bearer ")
+		if !ok {
+			return Principal{}, status.Error(codes.Unauthenticated, "apiauth: authorization must be a bearer token")
+		}
+		if a.oidc == nil {
+			return Principal{}, status.Error(codes.Unauthenticated, "apiauth: ID tokens are not accepted")
+		}
+
+		claims, err := a.oidc.Verify(ctx, token)
+		if err != nil {
+			return Principal{}, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return claims.Principal(), nil
+	}
+
+	if a.deviceCAs != nil {
+		if cert, ok := peerCertificate(ctx); ok {
+			return a.authenticateDevice(cert)
+		}
+	}
+
+	return Principal{}, status.Errorf(codes.Unauthenticated, "apiauth: an API key (%s), ID token (%s), or device certificate is required", apiKeyHeader, authorizationHeader)
+}
+
+func (a *Authenticator) authenticateKey(ctx context.Context, key string) (Principal, error) {
+	hash := HashKey(key)
+
+	k, ok := a.keyCache.GetIfPresent(hash)
+	if !ok {
+		var err error
+		k, err = a.keys.APIKeyByHash(ctx, hash)
+		if errors.Is(err, ErrNotFound) {
+			k = APIKey{}
+		} else if err != nil {
+			return Principal{}, status.Errorf(codes.Unavailable, "apiauth: failed to look up API key: %v", err)
+		}
+		a.keyCache.Set(hash, k)
+	}
+
+	if k.ID == "" {
+		return Principal{}, status.Error(codes.Unauthenticated, "apiauth: unknown API key")
+	}
+	return k.Principal(), nil
+}
+
+// peerCertificate returns the certificate chain that the caller presented over TLS, if any.
+func peerCertificate(ctx context.Context) ([]*x509.Certificate, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return nil, false
+	}
+	return info.State.PeerCertificates, true
+}
+
+// authenticateDevice returns the device that presented the given certificate chain, leaf first.
+// The chain is verified here rather than trusted from the handshake because the server may also
+// accept client certificates from other CAs.
+func (a *Authenticator) authenticateDevice(chain []*x509.Certificate) (Principal, error) {
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         a.deviceCAs,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return Principal{}, status.Errorf(codes.Unauthenticated, "apiauth: untrusted device certificate: %v", err)
+	}
+
+	id, err := device.CertificateDeviceID(chain[0])
+	if err != nil {
+		return Principal{}, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return Principal{
+		ID:        "device:" + id,
+		Name:      "device " + id,
+		DeviceIDs: []string{id},
+		Device:    id,
+	}, nil
+}
+
+// allow reports whether p may make a call now.
+func (a *Authenticator) allow(p Principal) bool {
+	limit := p.RateLimit
+	if limit == 0 {
+		limit = a.rateLimit
+	}
+	if limit == 0 {
+		return true
+	}
+
+	a.mu.Lock()
+	l, ok := a.limiters.GetIfPresent(p.ID)
+	if !ok || l.Limit() != rate.Limit(limit) {
+		l = rate.NewLimiter(rate.Limit(limit), a.burst)
+		a.limiters.Set(p.ID, l)
+	}
+	a.mu.Unlock()
+
+	return l.Allow()
+}
+
+// admit authenticates and rate limits a call to the given method, returning a context that
+// carries the caller.
+func (a *Authenticator) admit(ctx context.Context, method string) (context.Context, Principal, error) {
+	p, err := a.Authenticate(ctx)
+	if err != nil {
+		return ctx, p, err
+	}
+
+	if p.Device != "" && !slices.Contains(deviceMethods, method) {
+		return ctx, p, status.Errorf(codes.PermissionDenied, "apiauth: %s may not call %s", p.Name, method)
+	}
+
+	if !a.allow(p) {
+		return ctx, p, status.Errorf(codes.ResourceExhausted, "apiauth: rate limit exceeded for %s", p.Name)
+	}
+
+	return NewContext(ctx, p), p, nil
+}
+
+// Authorize checks that req only selects devices that p may read. If req can select devices but
+// selects none, meaning all devices, and p is limited to some devices, then Authorize selects
+// those devices in req.
+func Authorize(p Principal, req any) error {
+	m, ok := req.(proto.Message)
+	if !ok {
+		return nil
+	}
+
+	msg := m.ProtoReflect()
+	field := msg.Descriptor().Fields().ByName(deviceIDField)
+	if field == nil || field.Kind() != protoreflect.StringKind {
+		return nil
+	}
+
+	if !field.IsList() {
+		if id := msg.Get(field).String(); id != "" && !p.CanAccess(id) {
+			return status.Errorf(codes.PermissionDenied, "apiauth: %s may not read device %q", p.Name, id)
+		}
+		return nil
+	}
+
+	list := msg.Get(field).List()
+	if list.Len() == 0 && p.Scoped() {
+		list = msg.Mutable(field).List()
+		for _, id := range p.DeviceIDs {
+			list.Append(protoreflect.ValueOfString(id))
+		}
+		return nil
+	}
+
+	for i := range list.Len() {
+		if id := list.Get(i).String(); !p.CanAccess(id) {
+			return status.Errorf(codes.PermissionDenied, "apiauth: %s may not read device %q", p.Name, id)
+		}
+	}
+	return nil
+}
+
+// UnaryInterceptor returns an interceptor that authenticates, rate limits, and authorizes unary
+// calls. Devices may only call the methods in deviceMethods.
+func (a *Authenticator) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, p, err := a.admit(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := Authorize(p, req); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// authorizedStream is a server stream that carries the caller in its context and authorizes
+// each message it receives.
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	principal Principal
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *authorizedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return Authorize(s.principal, m)
+}
+
+// StreamInterceptor returns an interceptor that authenticates, rate limits, and authorizes
+// streaming calls. Each call counts once against the rate limit, however long it streams. Devices
+// may only call the methods in deviceMethods.
+func (a *Authenticator) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, p, err := a.admit(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx, principal: p})
+	}
+}
@@ -0,0 +1,444 @@
+package apiauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// memoryKeyStore is a KeyStore that holds keys in a map keyed by hash.
+type memoryKeyStore map[string]APIKey
+
+func (s memoryKeyStore) APIKeys(ctx context.Context) ([]APIKey, error) {
+	var keys []APIKey
+	for _, k := range s {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (s memoryKeyStore) APIKeyByHash(ctx context.Context, hash string) (APIKey, error) {
+	k, ok := s[hash]
+	if !ok {
+		return k, ErrNotFound
+	}
+	return k, nil
+}
+
+func (s memoryKeyStore) PutAPIKey(ctx context.Context, k APIKey) (APIKey, error) {
+	k, err := PrepareAPIKey(k)
+	if err == nil {
+		s[k.Hash] = k
+	}
+	return k, err
+}
+
+func (s memoryKeyStore) DeleteAPIKey(ctx context.Context, id string) error {
+	for h, k := range s {
+		if k.ID == id {
+			delete(s, h)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// newKey stores a new key and returns it.
+func newKey(t *testing.T, store KeyStore, deviceIDs []string, rateLimit float64) string {
+	t.Helper()
+
+	key, k, err := NewKey("test", deviceIDs, rateLimit)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := store.PutAPIKey(context.Background(), k); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return key
+}
+
+func incoming(kv ...string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(kv...))
+}
+
+func TestAuthenticate(t *testing.T) {
+	store := memoryKeyStore{}
+	key := newKey(t, store, []string{"foo"}, 0)
+	a := NewAuthenticator(store, nil, nil, 0, 0)
+
+	p, err := a.Authenticate(incoming("x-api-key", key))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"foo"}, p.DeviceIDs); diff != "" {
+		t.Errorf("Unexpected device IDs (-want +got):\n%s", diff)
+	}
+
+	cases := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"no_credentials", context.Background()},
+		{"unknown_key", incoming("x-api-key", "esk_spam")},
+		{"not_bearer", incoming("authorization", "Basic c3BhbTplZ2dz")},
+		{"id_tokens_not_accepted", incoming("authorization", "Bearer a.b.c")},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := a.Authenticate(c.ctx)
+			if got := status.Code(err); got != codes.Unauthenticated {
+				t.Errorf("Got code %v, expected %v (error: %v)", got, codes.Unauthenticated, err)
+			}
+		})
+	}
+}
+
+func TestAuthenticateOIDC(t *testing.T) {
+	iss := newTestIssuer(t)
+	a := NewAuthenticator(memoryKeyStore{}, NewOIDCVerifier(iss.server.URL, testAudience, nil), nil, 0, 0)
+
+	token := iss.sign(t, "ES256", "ec", iss.claims(nil))
+	p, err := a.Authenticate(incoming("authorization", "Bearer "+token))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if p.Name != "alice@example.com" {
+		t.Errorf("Got name %q, expected %q", p.Name, "alice@example.com")
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	scoped := Principal{Name: "scoped", DeviceIDs: []string{"foo", "bar"}}
+	unscoped := Principal{Name: "unscoped"}
+
+	cases := []struct {
+		name     string
+		p        Principal
+		req      any
+		want     any
+		wantCode codes.Code
+	}{
+		{
+			name: "single_allowed",
+			p:    scoped,
+			req:  &mpb.GetLatestRequest{DeviceId: "foo"},
+			want: &mpb.GetLatestRequest{DeviceId: "foo"},
+		},
+		{
+			name:     "single_denied",
+			p:        scoped,
+			req:      &mpb.GetLatestRequest{DeviceId: "baz"},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "list_denied",
+			p:        scoped,
+			req:      &mpb.ListMeasurementsRequest{DeviceId: []string{"foo", "baz"}},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name: "empty_list_scoped",
+			p:    scoped,
+			req:  &mpb.BatchGetLatestRequest{},
+			want: &mpb.BatchGetLatestRequest{DeviceId: []string{"foo", "bar"}},
+		},
+		{
+			name: "empty_list_unscoped",
+			p:    unscoped,
+			req:  &mpb.AggregateRequest{},
+			want: &mpb.AggregateRequest{},
+		},
+		{
+			name: "no_device_field",
+			p:    scoped,
+			req:  &emptypb.Empty{},
+			want: &emptypb.Empty{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := Authorize(c.p, c.req)
+			if got := status.Code(err); got != c.wantCode {
+				t.Fatalf("Got code %v, expected %v (error: %v)", got, c.wantCode, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(c.want, c.req, protocmp.Transform()); diff != "" {
+				t.Errorf("Unexpected request (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	store := memoryKeyStore{}
+	key := newKey(t, store, []string{"foo"}, 0)
+	limited := newKey(t, store, nil, 0.001)
+	a := NewAuthenticator(store, nil, nil, 100, 2)
+	interceptor := a.UnaryInterceptor()
+
+	var got Principal
+	handler := func(ctx context.Context, req any) (any, error) {
+		got, _ = FromContext(ctx)
+		return req, nil
+	}
+
+	_, err := interceptor(incoming("x-api-key", key), &mpb.GetLatestRequest{DeviceId: "foo"}, &grpc.UnaryServerInfo{}, handler)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.Name != "test" {
+		t.Errorf("Handler got principal %+v", got)
+	}
+
+	_, err = interceptor(incoming("x-api-key", key), &mpb.GetLatestRequest{DeviceId: "bar"}, &grpc.UnaryServerInfo{}, handler)
+	if code := status.Code(err); code != codes.PermissionDenied {
+		t.Errorf("Got code %v, expected %v (error: %v)", code, codes.PermissionDenied, err)
+	}
+
+	// The key's own rate limit overrides the default, and the burst allows two calls.
+	for i, want := range []codes.Code{codes.OK, codes.OK, codes.ResourceExhausted} {
+		_, err = interceptor(incoming("x-api-key", limited), &emptypb.Empty{}, &grpc.UnaryServerInfo{}, handler)
+		if code := status.Code(err); code != want {
+			t.Errorf("Call %d: got code %v, expected %v (error: %v)", i, code, want, err)
+		}
+	}
+}
+
+func TestLimiterEviction(t *testing.T) {
+	store := memoryKeyStore{}
+	fast := newKey(t, store, nil, 1000)
+	slow := newKey(t, store, nil, 0.001)
+	a := NewAuthenticator(store, nil, nil, 0, 1)
+
+	for _, key := range []string{fast, slow} {
+		if _, _, err := a.admit(incoming("x-api-key", key), ""); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// The fast key's limiter refills in a millisecond, so it's evicted once idle for that long.
+	// The slow key's limiter is kept because it's still empty.
+	time.Sleep(50 * time.Millisecond)
+	for key, want := range map[string]bool{fast: false, slow: true} {
+		p, err := a.Authenticate(incoming("x-api-key", key))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, ok := a.limiters.GetIfPresent(p.ID); ok != want {
+			t.Errorf("Limiter of %s present: got %t, want %t", p.ID, ok, want)
+		}
+	}
+
+	if _, _, err := a.admit(incoming("x-api-key", slow), ""); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Got error %v, expected %v", err, codes.ResourceExhausted)
+	}
+}
+
+// fakeStream is a server stream that receives one request.
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+	req *mpb.StreamMeasurementsRequest
+}
+
+func (s *fakeStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeStream) RecvMsg(m any) error {
+	proto.Merge(m.(proto.Message), s.req)
+	return nil
+}
+
+func TestStreamInterceptor(t *testing.T) {
+	store := memoryKeyStore{}
+	key := newKey(t, store, []string{"foo"}, 0)
+	a := NewAuthenticator(store, nil, nil, 0, 0)
+	interceptor := a.StreamInterceptor()
+
+	cases := []struct {
+		name     string
+		req      *mpb.StreamMeasurementsRequest
+		wantCode codes.Code
+		want     []string
+	}{
+		{"scoped", &mpb.StreamMeasurementsRequest{}, codes.OK, []string{"foo"}},
+		{"denied", &mpb.StreamMeasurementsRequest{DeviceId: []string{"bar"}}, codes.PermissionDenied, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got []string
+			handler := func(srv any, ss grpc.ServerStream) error {
+				if _, ok := FromContext(ss.Context()); !ok {
+					t.Error("Stream context has no principal")
+				}
+
+				req := &mpb.StreamMeasurementsRequest{}
+				if err := ss.RecvMsg(req); err != nil {
+					return err
+				}
+				got = req.GetDeviceId()
+				return nil
+			}
+
+			err := interceptor(nil, &fakeStream{ctx: incoming("x-api-key", key), req: c.req}, &grpc.StreamServerInfo{}, handler)
+			if code := status.Code(err); code != c.wantCode {
+				t.Fatalf("Got code %v, expected %v (error: %v)", code, c.wantCode, err)
+			}
+			if diff := cmp.Diff(c.want, got); diff != "" {
+				t.Errorf("Unexpected device IDs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// newCert returns a certificate with the given Common Name signed by parent, or self-signed if
+// parent is nil, and its key.
+func newCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return cert, key
+}
+
+func withPeerCert(ctx context.Context, cert *x509.Certificate) context.Context {
+	return peer.NewContext(ctx, &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}},
+	})
+}
+
+func TestAuthenticateDevice(t *testing.T) {
+	ca, caKey := newCert(t, "device CA", nil, nil)
+	otherCA, otherCAKey := newCert(t, "other CA", nil, nil)
+	deviceCAs := x509.NewCertPool()
+	deviceCAs.AddCert(ca)
+
+	foo, _ := newCert(t, "foo", ca, caKey)
+	noCN, _ := newCert(t, "", ca, caKey)
+	untrusted, _ := newCert(t, "foo", otherCA, otherCAKey)
+
+	store := memoryKeyStore{}
+	key := newKey(t, store, []string{"bar"}, 0)
+	a := NewAuthenticator(store, nil, deviceCAs, 0, 0)
+
+	p, err := a.Authenticate(withPeerCert(context.Background(), foo))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(Principal{ID: "device:foo", Name: "device foo", DeviceIDs: []string{"foo"}, Device: "foo"}, p); diff != "" {
+		t.Errorf("Unexpected principal (-want +got):\n%s", diff)
+	}
+
+	// An API key takes precedence over a certificate.
+	p, err = a.Authenticate(withPeerCert(incoming("x-api-key", key), foo))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if p.Device != "" {
+		t.Errorf("Got device %q, expected none", p.Device)
+	}
+
+	for name, cert := range map[string]*x509.Certificate{"no_cn": noCN, "untrusted": untrusted} {
+		t.Run(name, func(t *testing.T) {
+			_, err := a.Authenticate(withPeerCert(context.Background(), cert))
+			if got := status.Code(err); got != codes.Unauthenticated {
+				t.Errorf("Got code %v, expected %v (error: %v)", got, codes.Unauthenticated, err)
+			}
+		})
+	}
+
+	// Certificates aren't accepted without device CAs.
+	_, err = NewAuthenticator(store, nil, nil, 0, 0).Authenticate(withPeerCert(context.Background(), foo))
+	if got := status.Code(err); got != codes.Unauthenticated {
+		t.Errorf("Got code %v, expected %v (error: %v)", got, codes.Unauthenticated, err)
+	}
+}
+
+func TestDeviceMethods(t *testing.T) {
+	ca, caKey := newCert(t, "device CA", nil, nil)
+	deviceCAs := x509.NewCertPool()
+	deviceCAs.AddCert(ca)
+	foo, _ := newCert(t, "foo", ca, caKey)
+
+	a := NewAuthenticator(memoryKeyStore{}, nil, deviceCAs, 0, 0)
+	ctx := withPeerCert(context.Background(), foo)
+
+	_, err := a.UnaryInterceptor()(ctx, &mpb.GetLatestRequest{DeviceId: "foo"}, &grpc.UnaryServerInfo{FullMethod: mpb.MeasurementService_GetLatest_FullMethodName}, func(ctx context.Context, req any) (any, error) {
+		return req, nil
+	})
+	if code := status.Code(err); code != codes.PermissionDenied {
+		t.Errorf("GetLatest: got code %v, expected %v (error: %v)", code, codes.PermissionDenied, err)
+	}
+
+	cases := []struct {
+		method   string
+		wantCode codes.Code
+	}{
+		{mpb.MeasurementService_Ingest_FullMethodName, codes.OK},
+		{mpb.MeasurementService_StreamMeasurements_FullMethodName, codes.PermissionDenied},
+	}
+
+	for _, c := range cases {
+		t.Run(c.method, func(t *testing.T) {
+			handler := func(srv any, ss grpc.ServerStream) error {
+				return nil
+			}
+
+			err := a.StreamInterceptor()(nil, &fakeStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: c.method}, handler)
+			if code := status.Code(err); code != c.wantCode {
+				t.Errorf("Got code %v, expected %v (error: %v)", code, c.wantCode, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,386 @@
+package apiauth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// clockSkew is how far token expiry and not-before times may be off.
+	clockSkew = time.Minute
+
+	// keysTTL is how long the issuer's signing keys are used before they're fetched again.
+	keysTTL = time.Hour
+
+	// minRefreshInterval limits how often the keys are fetched because a token was signed with
+	// an unknown key, so that bad tokens can't make the verifier hammer the issuer.
+	minRefreshInterval = time.Minute
+)
+
+// Claims are the claims of a verified ID token that the verifier uses.
+type Claims struct {
+	Issuer   string   `json:"iss"`
+	Subject  string   `json:"sub"`
+	Audience audience `json:"aud"`
+	Email    string   `json:"email"`
+	Name     string   `json:"name"`
+
+	// EmailVerified is true if the issuer has verified that the subject controls Email.
+	EmailVerified verified `json:"email_verified"`
+
+	// Nonce is the nonce given in the authentication request that the token was issued for, if
+	// there was one. It's up to the caller to check it.
+	Nonce string `json:"nonce"`
+
+	Expiry    int64 `json:"exp"`
+	NotBefore int64 `json:"nbf"`
+}
+
+// audience is the "aud" claim, which may be a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+
+	var ss []string
+	if err := json.Unmarshal(b, &ss); err != nil {
+		return err
+	}
+	*a = ss
+	return nil
+}
+
+// verified is the "email_verified" claim. It's a boolean, but some issuers send it as a string.
+type verified bool
+
+func (v *verified) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*v = verified(strings.EqualFold(s, "true"))
+		return nil
+	}
+
+	var bl bool
+	if err := json.Unmarshal(b, &bl); err != nil {
+		return err
+	}
+	*v = verified(bl)
+	return nil
+}
+
+// VerifiedEmail returns the subject's email address if the issuer has verified it, or the empty
+// string otherwise. Unverified email addresses mustn't be used to decide what the subject can do,
+// since anyone could claim them.
+func (c Claims) VerifiedEmail() string {
+	if !c.EmailVerified {
+		return ""
+	}
+	return c.Email
+}
+
+// Principal returns the principal that authenticates with an ID token that has these claims.
+// ID token principals can read measurements from every device.
+func (c Claims) Principal() Principal {
+	name := c.VerifiedEmail()
+	if name == "" {
+		name = c.Subject
+	}
+
+	return Principal{
+		ID:   "oidc:" + c.Issuer + "#" + c.Subject,
+		Name: name,
+	}
+}
+
+// OIDCVerifier verifies OIDC ID tokens (JWTs) issued by one issuer for one audience. Tokens must
+// be signed with RS256 or ES256 using one of the keys the issuer publishes.
+type OIDCVerifier struct {
+	issuer   string
+	audience string
+
+	// If non-empty, only tokens whose subject or verified email is in allowed are accepted.
+	allowed []string
+
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetched   time.Time
+	lastFetch time.Time
+}
+
+// NewOIDCVerifier returns a verifier of tokens issued by issuer, e.g.
+// "https://accounts.google.com", with the given audience. If allowed is non-empty then only
+// tokens whose subject or verified email is in it are accepted.
+func NewOIDCVerifier(issuer, audience string, allowed []string) *OIDCVerifier {
+	return &OIDCVerifier{
+		issuer:   strings.TrimSuffix(issuer, "/"),
+		audience: audience,
+		allowed:  allowed,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+func decodeSegment(s string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Verify verifies token and returns its claims.
+func (v *OIDCVerifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, errors.New("apiauth: malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, fmt.Errorf("apiauth: malformed token header: %v", err)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, fmt.Errorf("apiauth: malformed token signature: %v", err)
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return Claims{}, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return Claims{}, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, fmt.Errorf("apiauth: malformed token claims: %v", err)
+	}
+
+	return claims, v.checkClaims(claims, time.Now())
+}
+
+func (v *OIDCVerifier) checkClaims(c Claims, now time.Time) error {
+	if c.Issuer != v.issuer {
+		return fmt.Errorf("apiauth: token issuer is %q, not %q", c.Issuer, v.issuer)
+	}
+	if !slices.Contains(c.Audience, v.audience) {
+		return fmt.Errorf("apiauth: token audience %q doesn't include %q", c.Audience, v.audience)
+	}
+	if c.Expiry == 0 || now.Add(-clockSkew).After(time.Unix(c.Expiry, 0)) {
+		return errors.New("apiauth: token is expired")
+	}
+	if c.NotBefore != 0 && now.Add(clockSkew).Before(time.Unix(c.NotBefore, 0)) {
+		return errors.New("apiauth: token is not valid yet")
+	}
+	if c.Subject == "" {
+		return errors.New("apiauth: token has no subject")
+	}
+
+	if email := c.VerifiedEmail(); len(v.allowed) > 0 && !slices.Contains(v.allowed, c.Subject) && (email == "" || !slices.Contains(v.allowed, email)) {
+		return fmt.Errorf("apiauth: %s is not allowed", c.Principal().Name)
+	}
+
+	return nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+
+	switch alg {
+	case "RS256":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("apiauth: token key is not an RSA key")
+		}
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig); err != nil {
+			return errors.New("apiauth: bad token signature")
+		}
+	case "ES256":
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return errors.New("apiauth: token key is not a P-256 key")
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(k, digest[:], r, s) {
+			return errors.New("apiauth: bad token signature")
+		}
+	default:
+		return fmt.Errorf("apiauth: unsupported token algorithm %q", alg)
+	}
+
+	return nil
+}
+
+// key returns the issuer's signing key with the given ID, fetching the issuer's keys if they're
+// stale or the key is unknown.
+func (v *OIDCVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := time.Now()
+	key, ok := v.keys[kid]
+	stale := now.Sub(v.fetched) > keysTTL
+	if ok && !stale {
+		return key, nil
+	}
+
+	if stale || now.Sub(v.lastFetch) > minRefreshInterval {
+		v.lastFetch = now
+		keys, err := v.fetchKeys(ctx)
+		if err != nil {
+			return nil, err
+		}
+		v.keys, v.fetched = keys, now
+	}
+
+	key, ok = v.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("apiauth: unknown token key %q", kid)
+	}
+	return key, nil
+}
+
+func (v *OIDCVerifier) getJSON(ctx context.Context, url string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("apiauth: failed to fetch %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("apiauth: failed to fetch %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Discovery is the part of an issuer's OIDC discovery document that's used.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Discover fetches the issuer's OIDC discovery document.
+func (v *OIDCVerifier) Discover(ctx context.Context) (Discovery, error) {
+	var discovery Discovery
+	err := v.getJSON(ctx, v.issuer+"/.well-known/openid-configuration", &discovery)
+	return discovery, err
+}
+
+// fetchKeys fetches the issuer's signing keys using OIDC discovery.
+func (v *OIDCVerifier) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	discovery, err := v.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if discovery.JWKSURI == "" {
+		return nil, errors.New("apiauth: issuer has no jwks_uri")
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := v.getJSON(ctx, discovery.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		// Keys of other types are skipped rather than failing so that the issuer can add them.
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		// Parse the point as an uncompressed SEC 1 point so that it's checked to be on the curve.
+		point := append([]byte{4}, append(leftPad(x, 32), leftPad(y, 32)...)...)
+		return ecdsa.ParseUncompressedPublicKey(elliptic.P256(), point)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func leftPad(b []byte, n int) []byte {
+	if len(b) >= n {
+		return b
+	}
+	return append(bytes.Repeat([]byte{0}, n-len(b)), b...)
+}
@@ -0,0 +1,185 @@
+package apiauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAudience = "environmental-sensor-api"
+
+// testIssuer is an OIDC issuer that serves discovery and keys, and signs tokens.
+type testIssuer struct {
+	server *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	iss := &testIssuer{rsaKey: rsaKey, ecKey: ecKey}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   iss.server.URL,
+			"jwks_uri": iss.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		ecPub, _ := ecKey.PublicKey.Bytes()
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{
+				{"kty": "RSA", "kid": "rsa", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+				{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecPub[1:33]), "y": b64(ecPub[33:])},
+				{"kty": "oct", "kid": "symmetric", "k": "c2VjcmV0"},
+			},
+		})
+	})
+	iss.server = httptest.NewServer(mux)
+	t.Cleanup(iss.server.Close)
+
+	return iss
+}
+
+func (iss *testIssuer) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	var err error
+	switch alg {
+	case "RS256":
+		sig, err = rsa.SignPKCS1v15(rand.Reader, iss.rsaKey, crypto.SHA256, digest[:])
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, iss.ecKey, digest[:])
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	return signed + "." + b64(sig)
+}
+
+func (iss *testIssuer) claims(mods map[string]any) map[string]any {
+	c := map[string]any{
+		"iss":            iss.server.URL,
+		"sub":            "1234",
+		"aud":            testAudience,
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range mods {
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+	}
+	return c
+}
+
+func TestOIDCVerifier(t *testing.T) {
+	iss := newTestIssuer(t)
+
+	cases := []struct {
+		name    string
+		alg     string
+		kid     string
+		mods    map[string]any
+		allowed []string
+		wantErr bool
+	}{
+		{name: "rs256", alg: "RS256", kid: "rsa"},
+		{name: "es256", alg: "ES256", kid: "ec"},
+		{name: "audience_list", alg: "RS256", kid: "rsa", mods: map[string]any{"aud": []string{"other", testAudience}}},
+		{name: "allowed_email", alg: "RS256", kid: "rsa", allowed: []string{"alice@example.com"}},
+		{name: "allowed_subject", alg: "RS256", kid: "rsa", allowed: []string{"1234"}},
+		{name: "allowed_email_verified_string", alg: "RS256", kid: "rsa", mods: map[string]any{"email_verified": "true"}, allowed: []string{"alice@example.com"}},
+		{name: "not_allowed", alg: "RS256", kid: "rsa", allowed: []string{"bob@example.com"}, wantErr: true},
+		{name: "allowed_email_unverified", alg: "RS256", kid: "rsa", mods: map[string]any{"email_verified": false}, allowed: []string{"alice@example.com"}, wantErr: true},
+		{name: "allowed_email_no_verified_claim", alg: "RS256", kid: "rsa", mods: map[string]any{"email_verified": nil}, allowed: []string{"alice@example.com"}, wantErr: true},
+		{name: "wrong_key_type", alg: "RS256", kid: "ec", wantErr: true},
+		{name: "unknown_key", alg: "RS256", kid: "spam", wantErr: true},
+		{name: "symmetric_key", alg: "HS256", kid: "symmetric", wantErr: true},
+		{name: "wrong_issuer", alg: "RS256", kid: "rsa", mods: map[string]any{"iss": "https://example.com"}, wantErr: true},
+		{name: "wrong_audience", alg: "RS256", kid: "rsa", mods: map[string]any{"aud": "other"}, wantErr: true},
+		{name: "expired", alg: "RS256", kid: "rsa", mods: map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}, wantErr: true},
+		{name: "no_expiry", alg: "RS256", kid: "rsa", mods: map[string]any{"exp": nil}, wantErr: true},
+		{name: "not_yet_valid", alg: "RS256", kid: "rsa", mods: map[string]any{"nbf": time.Now().Add(time.Hour).Unix()}, wantErr: true},
+		{name: "no_subject", alg: "RS256", kid: "rsa", mods: map[string]any{"sub": nil}, wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v := NewOIDCVerifier(iss.server.URL, testAudience, c.allowed)
+			token := iss.sign(t, c.alg, c.kid, iss.claims(c.mods))
+
+			claims, err := v.Verify(context.Background(), token)
+			if c.wantErr {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			want := Principal{ID: "oidc:" + iss.server.URL + "#1234", Name: "alice@example.com"}
+			if got := claims.Principal(); got.ID != want.ID || got.Name != want.Name || got.Scoped() {
+				t.Errorf("Got principal %+v, expected %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestOIDCVerifierTampered(t *testing.T) {
+	iss := newTestIssuer(t)
+	v := NewOIDCVerifier(iss.server.URL, testAudience, nil)
+
+	token := iss.sign(t, "RS256", "rsa", iss.claims(nil))
+	parts := strings.Split(token, ".")
+	payload, _ := json.Marshal(iss.claims(map[string]any{"sub": "5678"}))
+	tampered := parts[0] + "." + b64(payload) + "." + parts[2]
+
+	if _, err := v.Verify(context.Background(), tampered); err == nil {
+		t.Error("Expected error for tampered token, got nil")
+	}
+	if _, err := v.Verify(context.Background(), "not.a-token"); err == nil {
+		t.Error("Expected error for malformed token, got nil")
+	}
+}
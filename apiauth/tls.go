@@ -0,0 +1,99 @@
+package apiauth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// appendCerts adds the PEM-encoded CA certificates in a file to pool.
+func appendCerts(pool *x509.CertPool, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if !pool.AppendCertsFromPEM(b) {
+		return fmt.Errorf("apiauth: no certificates found in %s", path)
+	}
+	return nil
+}
+
+// LoadCertPool loads a pool of PEM-encoded CA certificates from a file.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if err := appendCerts(pool, path); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// ServerTLSConfig returns a TLS config for a server with the given certificate and key. If
+// clientCAFile is non-empty then clients must present a certificate signed by one of the CAs in
+// it (mutual TLS). If deviceCAFile is non-empty then clients may also present a certificate
+// signed by one of the CAs in it; devices authenticate that way.
+func ServerTLSConfig(certFile, keyFile, clientCAFile, deviceCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile == "" && deviceCAFile == "" {
+		return config, nil
+	}
+
+	config.ClientCAs = x509.NewCertPool()
+	for _, path := range []string{clientCAFile, deviceCAFile} {
+		if path == "" {
+			continue
+		}
+		if err := appendCerts(config.ClientCAs, path); err != nil {
+			return nil, err
+		}
+	}
+
+	// Without a client CA, callers that aren't devices present API keys or ID tokens instead.
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	if clientCAFile != "" {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// ClientTLSConfig returns a TLS config for a client. If caFile is non-empty then the server's
+// certificate must be signed by one of the CAs in it, and otherwise by one of the system's. If
+// certFile and keyFile are non-empty then the client presents that certificate (mutual TLS).
+func ClientTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if caFile != "" {
+		var err error
+		config.RootCAs, err = LoadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("apiauth: a client certificate and key must be given together")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
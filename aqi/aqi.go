@@ -1,8 +1,14 @@
-// Package aqi computes US EPA Air Quality Index values for PM2.5 and PM10.
-// See https://www.airnow.gov/sites/default/files/2020-05/aqi-technical-assistance-document-sept2018.pdf.
+// Package aqi computes air quality indexes for PM2.5 and PM10 under several standards: the US EPA
+// AQI, using the breakpoints from the 2024 revision of the PM2.5 standard, and the European,
+// UK, Canadian, and Chinese indexes. It also computes the NowCast weighted average of recent hours.
+// See https://document.airnow.gov/technical-assistance-document-for-the-reporting-of-daily-air-quailty.pdf.
 package aqi
 
-import "math"
+import (
+	"math"
+
+	"github.com/mtraver/environmental-sensor/metric"
+)
 
 type bucket struct {
 	lowerLimit float32
@@ -13,13 +19,12 @@ type bucket struct {
 
 var (
 	pm25Buckets = []bucket{
-		{0, 12.0, 0, 50},
-		{12.1, 35.4, 51, 100},
+		{0, 9.0, 0, 50},
+		{9.1, 35.4, 51, 100},
 		{35.5, 55.4, 101, 150},
-		{55.5, 150.4, 151, 200},
-		{150.5, 250.4, 201, 300},
-		{250.5, 350.4, 301, 400},
-		{350.5, 500.4, 401, 500},
+		{55.5, 125.4, 151, 200},
+		{125.5, 225.4, 201, 300},
+		{225.5, 325.4, 301, 500},
 	}
 
 	pm10Buckets = []bucket{
@@ -28,8 +33,7 @@ var (
 		{155, 254, 101, 150},
 		{255, 354, 151, 200},
 		{355, 424, 201, 300},
-		{425, 504, 301, 400},
-		{505, 604, 401, 500},
+		{425, 604, 301, 500},
 	}
 )
 
@@ -37,56 +41,39 @@ func scale(pm float32, b bucket) float32 {
 	return ((b.upperIndex-b.lowerIndex)/(b.upperLimit-b.lowerLimit))*(pm-b.lowerLimit) + b.lowerIndex
 }
 
-func aqi(pm float32, buckets []bucket) int {
-	if pm < buckets[0].lowerLimit {
-		return 0
-	}
-
-	for _, b := range buckets {
-		if pm <= b.upperLimit {
-			return int(math.Round(float64(scale(pm, b))))
-		}
-	}
-
-	return 500
+// truncate truncates v to the given number of decimal places, as the EPA specifies before
+// looking up breakpoints. The small offset keeps values like 35.4, which float32 can't
+// represent exactly, from being truncated to 35.3.
+func truncate(v float32, places int) float32 {
+	p := math.Pow10(places)
+	return float32(math.Floor(float64(v)*p+1e-6) / p)
 }
 
+// PM25 returns the AQI for the given PM2.5 concentration in μg/m³.
 func PM25(pm float32) int {
-	return aqi(pm, pm25Buckets)
+	return interpolate(truncate(pm, 1), pm25Buckets, math.Round, false)
 }
 
+// PM10 returns the AQI for the given PM10 concentration in μg/m³.
 func PM10(pm float32) int {
-	return aqi(pm, pm10Buckets)
+	return interpolate(truncate(pm, 0), pm10Buckets, math.Round, false)
 }
 
+// Pollutants contains every pollutant considered by any of Standards.
+var Pollutants = []metric.Key{metric.PM25, metric.PM10}
+
+// Overall returns the overall US EPA AQI given the concentrations of any of its pollutants, and
+// the dominant pollutant. See Compute.
+func Overall(concentrations map[metric.Key]float32) (index int, dominant metric.Key, ok bool) {
+	return Compute(USEPA, concentrations)
+}
+
+// String returns the name of the US EPA category of aqi.
 func String(aqi int) string {
-	if aqi <= 50 {
-		return "Good"
-	} else if aqi <= 100 {
-		return "Moderate"
-	} else if aqi <= 150 {
-		return "Unhealthy for Sensitive Groups"
-	} else if aqi <= 200 {
-		return "Unhealthy"
-	} else if aqi <= 300 {
-		return "Very Unhealthy"
-	} else {
-		return "Hazardous"
-	}
+	return CategoryOf(USEPA, aqi).Name
 }
 
+// Abbrv returns the abbreviated name of the US EPA category of aqi.
 func Abbrv(aqi int) string {
-	if aqi <= 50 {
-		return "G"
-	} else if aqi <= 100 {
-		return "M"
-	} else if aqi <= 150 {
-		return "USG"
-	} else if aqi <= 200 {
-		return "U"
-	} else if aqi <= 300 {
-		return "VU"
-	} else {
-		return "H"
-	}
+	return CategoryOf(USEPA, aqi).Abbrv
 }
@@ -3,6 +3,8 @@ package aqi
 import (
 	"fmt"
 	"testing"
+
+	"github.com/mtraver/environmental-sensor/metric"
 )
 
 func TestPM25(t *testing.T) {
@@ -12,13 +14,16 @@ func TestPM25(t *testing.T) {
 	}{
 		{-10, 0},
 		{0, 0},
-		{12, 50},
+		{9, 50},
+		// Concentrations are truncated to one decimal place before looking up breakpoints.
+		{9.05, 50},
+		{9.1, 51},
+		{12, 56},
 		{35.4, 100},
 		{55.4, 150},
-		{150.4, 200},
-		{250.4, 300},
-		{350.4, 400},
-		{500.4, 500},
+		{125.4, 200},
+		{225.4, 300},
+		{325.4, 500},
 		{650, 500},
 	}
 
@@ -42,8 +47,10 @@ func TestPM10(t *testing.T) {
 		{154, 100},
 		{254, 150},
 		{354, 200},
+		// Concentrations are truncated to integers before looking up breakpoints.
+		{354.9, 200},
 		{424, 300},
-		{504, 400},
+		{504, 389},
 		{604, 500},
 		{650, 500},
 	}
@@ -57,6 +64,33 @@ func TestPM10(t *testing.T) {
 	}
 }
 
+func TestOverall(t *testing.T) {
+	cases := []struct {
+		name           string
+		concentrations map[metric.Key]float32
+		wantIndex      int
+		wantDominant   metric.Key
+		wantOK         bool
+	}{
+		{"none", map[metric.Key]float32{}, 0, "", false},
+		{"unsupported", map[metric.Key]float32{metric.PM1: 100}, 0, "", false},
+		{"pm25_only", map[metric.Key]float32{metric.PM25: 35.4}, 100, metric.PM25, true},
+		{"pm10_only", map[metric.Key]float32{metric.PM10: 154}, 100, metric.PM10, true},
+		{"pm25_dominant", map[metric.Key]float32{metric.PM25: 55.4, metric.PM10: 154}, 150, metric.PM25, true},
+		{"pm10_dominant", map[metric.Key]float32{metric.PM25: 9, metric.PM10: 254}, 150, metric.PM10, true},
+		{"tie", map[metric.Key]float32{metric.PM25: 35.4, metric.PM10: 154}, 100, metric.PM25, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			index, dominant, ok := Overall(c.concentrations)
+			if index != c.wantIndex || dominant != c.wantDominant || ok != c.wantOK {
+				t.Errorf("got (%v, %q, %v), want (%v, %q, %v)", index, dominant, ok, c.wantIndex, c.wantDominant, c.wantOK)
+			}
+		})
+	}
+}
+
 func TestString(t *testing.T) {
 	cases := []struct {
 		aqi  int
@@ -0,0 +1,100 @@
+package aqi
+
+import (
+	"math"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+const (
+	// NowCastWindow is the length of history that NowCast averages over.
+	NowCastWindow = 12 * time.Hour
+
+	// The minimum weight factor for particulate matter. Lower weights would let the most recent
+	// hour dominate.
+	nowCastMinWeight = 0.5
+)
+
+// Sample is a concentration measured at a point in time.
+type Sample struct {
+	Time  time.Time
+	Value float32
+}
+
+// NowCast returns the EPA NowCast concentration at time now from the given samples. It averages
+// the samples into the 12 hours preceding now, where hour 1 is (now-1h, now], and weights each
+// hour i by w^(i-1), where w is the ratio of the lowest to the highest hourly average, but no
+// less than 0.5. Hours without samples are left out. Samples outside of the 12 hours are ignored.
+//
+// ok is false if fewer than two of the three most recent hours have samples.
+func NowCast(samples []Sample, now time.Time) (concentration float32, ok bool) {
+	hours := int(NowCastWindow / time.Hour)
+	sums := make([]float64, hours)
+	counts := make([]int, hours)
+
+	for _, s := range samples {
+		age := now.Sub(s.Time)
+		if age < 0 || age >= NowCastWindow {
+			continue
+		}
+
+		i := int(age / time.Hour)
+		sums[i] += float64(s.Value)
+		counts[i]++
+	}
+
+	recent := 0
+	for i := range 3 {
+		if counts[i] > 0 {
+			recent++
+		}
+	}
+	if recent < 2 {
+		return 0, false
+	}
+
+	minAvg, maxAvg := math.Inf(1), math.Inf(-1)
+	avgs := make([]float64, hours)
+	for i := range hours {
+		if counts[i] == 0 {
+			continue
+		}
+
+		avgs[i] = sums[i] / float64(counts[i])
+		minAvg = min(minAvg, avgs[i])
+		maxAvg = max(maxAvg, avgs[i])
+	}
+
+	w := 1.0
+	if maxAvg > 0 {
+		w = max(minAvg/maxAvg, nowCastMinWeight)
+	}
+
+	var num, den float64
+	for i := range hours {
+		if counts[i] == 0 {
+			continue
+		}
+
+		weight := math.Pow(w, float64(i))
+		num += weight * avgs[i]
+		den += weight
+	}
+
+	return float32(num / den), true
+}
+
+// NowCastIndex returns the overall index under s of the NowCast concentrations at time now, given
+// samples of any of s's pollutants, and the dominant pollutant. ok is false if NowCast can't be
+// computed for any pollutant.
+func NowCastIndex(s Standard, samples map[metric.Key][]Sample, now time.Time) (index int, dominant metric.Key, ok bool) {
+	concentrations := make(map[metric.Key]float32)
+	for p, s := range samples {
+		if c, ok := NowCast(s, now); ok {
+			concentrations[p] = c
+		}
+	}
+
+	return Compute(s, concentrations)
+}
@@ -0,0 +1,96 @@
+package aqi
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+var now = time.Date(2018, time.March, 25, 12, 0, 0, 0, time.UTC)
+
+// hourly returns one sample per hour ending at now, most recent first. NaN values are skipped.
+func hourly(values ...float32) []Sample {
+	var samples []Sample
+	for i, v := range values {
+		if math.IsNaN(float64(v)) {
+			continue
+		}
+		samples = append(samples, Sample{Time: now.Add(-time.Duration(i)*time.Hour - time.Minute), Value: v})
+	}
+	return samples
+}
+
+func TestNowCast(t *testing.T) {
+	nan := float32(math.NaN())
+
+	cases := []struct {
+		name    string
+		samples []Sample
+		want    float32
+		wantOK  bool
+	}{
+		{"empty", nil, 0, false},
+		{"constant", hourly(10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10), 10, true},
+		{"zero", hourly(0, 0, 0), 0, true},
+		{
+			// The weight factor is 0.5 because the ratio of the minimum to the maximum,
+			// 12.9/53.0, is lower than that.
+			name:    "minimum_weight",
+			samples: hourly(13.3, 12.9, 14.3, 22.2, 28.4, 27.1, 31.4, 32.2, 29.1, 30.4, 33.8, 53.0),
+			want:    14.85,
+			wantOK:  true,
+		},
+		{
+			// With w = 0.8, the first two hours have weights 1 and 0.8.
+			name:    "weighted",
+			samples: hourly(10, 8, nan),
+			want:    (10 + 0.8*8) / 1.8,
+			wantOK:  true,
+		},
+		{"missing_recent_hours", hourly(nan, nan, 10, 10, 10), 0, false},
+		{"one_recent_hour_missing", hourly(10, nan, 10), 10, true},
+		{
+			name: "several_samples_per_hour",
+			samples: []Sample{
+				{now.Add(-10 * time.Minute), 10},
+				{now.Add(-20 * time.Minute), 20},
+				{now.Add(-70 * time.Minute), 15},
+				// Outside of the window.
+				{now.Add(-13 * time.Hour), 1000},
+				{now.Add(time.Minute), 1000},
+			},
+			want:   15,
+			wantOK: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, ok := NowCast(c.samples, now)
+			if ok != c.wantOK {
+				t.Fatalf("got ok=%v, want %v", ok, c.wantOK)
+			}
+			if math.Abs(float64(got-c.want)) > 0.05 {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestNowCastIndex(t *testing.T) {
+	samples := map[metric.Key][]Sample{
+		metric.PM25: hourly(5, 5, 5),
+		metric.PM10: hourly(200, 200, 200),
+	}
+
+	index, dominant, ok := NowCastIndex(USEPA, samples, now)
+	if !ok || index != PM10(200) || dominant != metric.PM10 {
+		t.Errorf("got (%v, %q, %v), want (%v, %q, true)", index, dominant, ok, PM10(200), metric.PM10)
+	}
+
+	if _, _, ok := NowCastIndex(USEPA, map[metric.Key][]Sample{metric.PM25: hourly(5)}, now); ok {
+		t.Error("got ok=true with too few samples, want false")
+	}
+}
@@ -0,0 +1,146 @@
+package aqi
+
+import (
+	"math"
+
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+// EUCAQI is the hourly Common Air Quality Index used across Europe, which runs from 0 to 100 and
+// beyond. It has no upper bound, so values beyond the last breakpoint are extrapolated.
+// See https://www.airqualitynow.eu/about_indices_definition.php.
+var EUCAQI Standard = standard{
+	id:         "eu_caqi",
+	name:       "European CAQI",
+	pollutants: []metric.Key{metric.PM25, metric.PM10},
+	index: map[metric.Key]func(float32) int{
+		metric.PM25: func(pm float32) int {
+			return interpolate(pm, []bucket{
+				{0, 15, 0, 25},
+				{15, 30, 25, 50},
+				{30, 55, 50, 75},
+				{55, 110, 75, 100},
+			}, math.Round, true)
+		},
+		metric.PM10: func(pm float32) int {
+			return interpolate(pm, []bucket{
+				{0, 25, 0, 25},
+				{25, 50, 25, 50},
+				{50, 90, 50, 75},
+				{90, 180, 75, 100},
+			}, math.Round, true)
+		},
+	},
+	categories: []Category{
+		{"Very low", "VL", "#79BC6A", 25},
+		{"Low", "L", "#BBCF4C", 50},
+		{"Medium", "M", "#EEC20B", 75},
+		{"High", "H", "#F29305", 100},
+		{"Very high", "VH", "#E8416F", math.MaxInt},
+	},
+}
+
+// EUEAQI is the European Environment Agency's European Air Quality Index, which has six bands
+// numbered 1 to 6.
+// See https://airindex.eea.europa.eu/AQI/index.html.
+var EUEAQI Standard = standard{
+	id:         "eu_eaqi",
+	name:       "European EAQI",
+	pollutants: []metric.Key{metric.PM25, metric.PM10},
+	index: map[metric.Key]func(float32) int{
+		metric.PM25: func(pm float32) int { return band(pm, []float32{10, 20, 25, 50, 75}) },
+		metric.PM10: func(pm float32) int { return band(pm, []float32{20, 40, 50, 100, 150}) },
+	},
+	categories: []Category{
+		{"Good", "G", "#50F0E6", 1},
+		{"Fair", "F", "#50CCAA", 2},
+		{"Moderate", "M", "#F0E641", 3},
+		{"Poor", "P", "#FF5050", 4},
+		{"Very poor", "VP", "#960032", 5},
+		{"Extremely poor", "EP", "#7D2181", math.MaxInt},
+	},
+}
+
+// UKDAQI is the UK Daily Air Quality Index, which runs from 1 to 10 and is defined on 24-hour
+// mean concentrations.
+// See https://uk-air.defra.gov.uk/air-pollution/daqi.
+var UKDAQI Standard = standard{
+	id:         "uk_daqi",
+	name:       "UK DAQI",
+	pollutants: []metric.Key{metric.PM25, metric.PM10},
+	index: map[metric.Key]func(float32) int{
+		metric.PM25: func(pm float32) int { return band(pm, []float32{11, 23, 35, 41, 47, 53, 58, 64, 70}) },
+		metric.PM10: func(pm float32) int { return band(pm, []float32{16, 33, 50, 58, 66, 75, 83, 91, 100}) },
+	},
+	categories: []Category{
+		{"Low", "L", "#31FF00", 3},
+		{"Moderate", "M", "#FFCF00", 6},
+		{"High", "H", "#FF0000", 9},
+		{"Very High", "VH", "#CE30FF", math.MaxInt},
+	},
+}
+
+// CanadaAQHI is Canada's Air Quality Health Index. The full AQHI also depends on ozone and
+// nitrogen dioxide, which our sensors don't measure, so this is AQHI+, the PM2.5-only variant
+// that Canada uses for wildfire smoke. It runs from 1 to 10, and 11 means "10+".
+// See https://www.canada.ca/en/environment-climate-change/services/air-quality-health-index.html.
+var CanadaAQHI Standard = standard{
+	id:         "ca_aqhi",
+	name:       "Canada AQHI+",
+	pollutants: []metric.Key{metric.PM25},
+	index: map[metric.Key]func(float32) int{
+		metric.PM25: func(pm float32) int { return band(pm, []float32{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}) },
+	},
+	categories: []Category{
+		{"Low risk", "L", "#0099CC", 3},
+		{"Moderate risk", "M", "#FFCC00", 6},
+		{"High risk", "H", "#FF0000", 10},
+		{"Very high risk", "VH", "#660000", math.MaxInt},
+	},
+}
+
+// ceil rounds x up, ignoring the float32 error in interpolated values so that exact
+// breakpoints aren't rounded up to the next integer.
+func ceil(x float64) float64 {
+	return math.Ceil(x - 1e-4)
+}
+
+// ChinaAQI is China's Air Quality Index (HJ 633-2012), which runs from 0 to 500. Individual
+// indexes are rounded up.
+var ChinaAQI Standard = standard{
+	id:         "cn_aqi",
+	name:       "China AQI",
+	pollutants: []metric.Key{metric.PM25, metric.PM10},
+	index: map[metric.Key]func(float32) int{
+		metric.PM25: func(pm float32) int {
+			return interpolate(pm, []bucket{
+				{0, 35, 0, 50},
+				{35, 75, 50, 100},
+				{75, 115, 100, 150},
+				{115, 150, 150, 200},
+				{150, 250, 200, 300},
+				{250, 350, 300, 400},
+				{350, 500, 400, 500},
+			}, ceil, false)
+		},
+		metric.PM10: func(pm float32) int {
+			return interpolate(pm, []bucket{
+				{0, 50, 0, 50},
+				{50, 150, 50, 100},
+				{150, 250, 100, 150},
+				{250, 350, 150, 200},
+				{350, 420, 200, 300},
+				{420, 500, 300, 400},
+				{500, 600, 400, 500},
+			}, ceil, false)
+		},
+	},
+	categories: []Category{
+		{"Excellent", "E", "#00E400", 50},
+		{"Good", "G", "#FFFF00", 100},
+		{"Lightly Polluted", "LP", "#FF7E00", 150},
+		{"Moderately Polluted", "MP", "#FF0000", 200},
+		{"Heavily Polluted", "HP", "#99004C", 300},
+		{"Severely Polluted", "SP", "#7E0023", math.MaxInt},
+	},
+}
@@ -0,0 +1,168 @@
+package aqi
+
+import (
+	"math"
+	"slices"
+
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+// Category is a range of index values with a name and a color for display.
+type Category struct {
+	Name  string
+	Abbrv string
+
+	// Color is a CSS hex color, e.g. "#00E400".
+	Color string
+
+	// Max is the highest index value in the category. It's math.MaxInt for the last category.
+	Max int
+}
+
+// Standard is an air quality index, such as the US EPA AQI or the UK DAQI. Standards only
+// consider the pollutants that our sensors measure, which are particulate matter.
+//
+// Standards define the averaging period of the concentrations they're computed from, e.g. an
+// hour or a day. Indexes are computed from whatever concentrations they're given, so it's up to
+// the caller to average them if that matters.
+type Standard interface {
+	// ID is a short, stable identifier, e.g. "us_epa".
+	ID() string
+	Name() string
+
+	// Pollutants returns the pollutants the standard considers, in the order used to break ties
+	// when choosing the dominant pollutant.
+	Pollutants() []metric.Key
+
+	// Index returns the index for the given concentration of pollutant. ok is false if the
+	// standard doesn't consider pollutant.
+	Index(pollutant metric.Key, concentration float32) (index int, ok bool)
+
+	// Categories returns the standard's categories from best to worst.
+	Categories() []Category
+}
+
+// standard implements Standard using a function that indexes each pollutant.
+type standard struct {
+	id         string
+	name       string
+	pollutants []metric.Key
+	index      map[metric.Key]func(float32) int
+	categories []Category
+}
+
+func (s standard) ID() string               { return s.id }
+func (s standard) Name() string             { return s.name }
+func (s standard) Pollutants() []metric.Key { return s.pollutants }
+func (s standard) Categories() []Category   { return s.categories }
+
+func (s standard) Index(pollutant metric.Key, concentration float32) (int, bool) {
+	f, ok := s.index[pollutant]
+	if !ok {
+		return 0, false
+	}
+	return f(concentration), true
+}
+
+// interpolate linearly interpolates the index of pm within buckets and rounds it with round.
+// Concentrations below the first bucket have the first bucket's lower index. Concentrations
+// above the last bucket have its upper index, unless extrapolate is true, in which case the last
+// bucket's scale is extended.
+func interpolate(pm float32, buckets []bucket, round func(float64) float64, extrapolate bool) int {
+	if pm < buckets[0].lowerLimit {
+		return int(buckets[0].lowerIndex)
+	}
+
+	for _, b := range buckets {
+		if pm <= b.upperLimit {
+			return int(round(float64(scale(pm, b))))
+		}
+	}
+
+	last := buckets[len(buckets)-1]
+	if extrapolate {
+		return int(round(float64(scale(pm, last))))
+	}
+	return int(last.upperIndex)
+}
+
+// band returns the 1-based index of the band that pm is in, given the inclusive upper bounds of
+// every band except the last, which is unbounded.
+func band(pm float32, upperBounds []float32) int {
+	i := 0
+	for i < len(upperBounds) && pm > upperBounds[i] {
+		i++
+	}
+	return i + 1
+}
+
+// Compute returns the overall index under s given the concentrations of any of its pollutants,
+// which is the highest of the pollutants' indexes, and the pollutant with that index. ok is
+// false if none of s's pollutants is in concentrations.
+func Compute(s Standard, concentrations map[metric.Key]float32) (index int, dominant metric.Key, ok bool) {
+	for _, p := range s.Pollutants() {
+		c, present := concentrations[p]
+		if !present {
+			continue
+		}
+
+		i, _ := s.Index(p, c)
+		if !ok || i > index {
+			index, dominant, ok = i, p, true
+		}
+	}
+
+	return index, dominant, ok
+}
+
+// CategoryOf returns the category of s that contains index.
+func CategoryOf(s Standard, index int) Category {
+	categories := s.Categories()
+	for _, c := range categories {
+		if index <= c.Max {
+			return c
+		}
+	}
+	return categories[len(categories)-1]
+}
+
+// CategoryIndex returns the position of the category with the given name in s's categories, or
+// -1 if there's none.
+func CategoryIndex(s Standard, name string) int {
+	return slices.IndexFunc(s.Categories(), func(c Category) bool { return c.Name == name })
+}
+
+// Lookup returns the standard with the given ID. The empty ID is US EPA, the default.
+func Lookup(id string) (Standard, bool) {
+	if id == "" {
+		return USEPA, true
+	}
+
+	i := slices.IndexFunc(Standards, func(s Standard) bool { return s.ID() == id })
+	if i < 0 {
+		return nil, false
+	}
+	return Standards[i], true
+}
+
+// Standards contains every supported standard.
+var Standards = []Standard{USEPA, EUCAQI, EUEAQI, UKDAQI, CanadaAQHI, ChinaAQI}
+
+// USEPA is the US EPA Air Quality Index, using the 2024 PM2.5 breakpoints.
+var USEPA Standard = standard{
+	id:         "us_epa",
+	name:       "US EPA AQI",
+	pollutants: []metric.Key{metric.PM25, metric.PM10},
+	index: map[metric.Key]func(float32) int{
+		metric.PM25: PM25,
+		metric.PM10: PM10,
+	},
+	categories: []Category{
+		{"Good", "G", "#00E400", 50},
+		{"Moderate", "M", "#FFFF00", 100},
+		{"Unhealthy for Sensitive Groups", "USG", "#FF7E00", 150},
+		{"Unhealthy", "U", "#FF0000", 200},
+		{"Very Unhealthy", "VU", "#8F3F97", 300},
+		{"Hazardous", "H", "#7E0023", math.MaxInt},
+	},
+}
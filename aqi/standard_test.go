@@ -0,0 +1,153 @@
+package aqi
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+func TestStandardIndex(t *testing.T) {
+	cases := []struct {
+		s         Standard
+		pollutant metric.Key
+		pm        float32
+		want      int
+	}{
+		{USEPA, metric.PM25, 35.4, 100},
+		{USEPA, metric.PM10, 154, 100},
+
+		{EUCAQI, metric.PM25, 0, 0},
+		{EUCAQI, metric.PM25, 15, 25},
+		{EUCAQI, metric.PM25, 42.5, 63},
+		{EUCAQI, metric.PM25, 110, 100},
+		// Extrapolated beyond the last breakpoint.
+		{EUCAQI, metric.PM25, 165, 125},
+		{EUCAQI, metric.PM10, 90, 75},
+
+		{EUEAQI, metric.PM25, 0, 1},
+		{EUEAQI, metric.PM25, 10, 1},
+		{EUEAQI, metric.PM25, 10.1, 2},
+		{EUEAQI, metric.PM25, 30, 4},
+		{EUEAQI, metric.PM25, 800, 6},
+		{EUEAQI, metric.PM10, 45, 3},
+
+		{UKDAQI, metric.PM25, 5, 1},
+		{UKDAQI, metric.PM25, 36, 4},
+		{UKDAQI, metric.PM25, 71, 10},
+		{UKDAQI, metric.PM10, 100, 9},
+		{UKDAQI, metric.PM10, 101, 10},
+
+		{CanadaAQHI, metric.PM25, 0, 1},
+		{CanadaAQHI, metric.PM25, 10, 1},
+		{CanadaAQHI, metric.PM25, 35, 4},
+		{CanadaAQHI, metric.PM25, 150, 11},
+
+		{ChinaAQI, metric.PM25, 35, 50},
+		{ChinaAQI, metric.PM25, 36, 52},
+		{ChinaAQI, metric.PM25, 75, 100},
+		{ChinaAQI, metric.PM25, 900, 500},
+		{ChinaAQI, metric.PM10, 150, 100},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%s_%s_%v", c.s.ID(), c.pollutant, c.pm), func(t *testing.T) {
+			got, ok := c.s.Index(c.pollutant, c.pm)
+			if !ok {
+				t.Fatalf("%s doesn't consider %s", c.s.ID(), c.pollutant)
+			}
+			if got != c.want {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestStandardIndexUnsupportedPollutant(t *testing.T) {
+	if _, ok := CanadaAQHI.Index(metric.PM10, 10); ok {
+		t.Error("got ok=true for a pollutant the standard doesn't consider, want false")
+	}
+}
+
+func TestStandardCategories(t *testing.T) {
+	for _, s := range Standards {
+		t.Run(s.ID(), func(t *testing.T) {
+			categories := s.Categories()
+			for i, c := range categories {
+				if c.Name == "" || c.Abbrv == "" || c.Color == "" {
+					t.Errorf("category %d is incomplete: %+v", i, c)
+				}
+				if i > 0 && c.Max <= categories[i-1].Max {
+					t.Errorf("category %q doesn't come after %q", c.Name, categories[i-1].Name)
+				}
+			}
+
+			if last := categories[len(categories)-1]; last.Max != math.MaxInt {
+				t.Errorf("last category %q is bounded", last.Name)
+			}
+		})
+	}
+}
+
+func TestCompute(t *testing.T) {
+	concentrations := map[metric.Key]float32{metric.PM25: 20, metric.PM10: 120}
+
+	cases := []struct {
+		s            Standard
+		wantIndex    int
+		wantDominant metric.Key
+	}{
+		{USEPA, 83, metric.PM10},
+		{EUEAQI, 5, metric.PM10},
+		{CanadaAQHI, 2, metric.PM25},
+		{ChinaAQI, 85, metric.PM10},
+	}
+
+	for _, c := range cases {
+		t.Run(c.s.ID(), func(t *testing.T) {
+			index, dominant, ok := Compute(c.s, concentrations)
+			if !ok || index != c.wantIndex || dominant != c.wantDominant {
+				t.Errorf("got (%v, %q, %v), want (%v, %q, true)", index, dominant, ok, c.wantIndex, c.wantDominant)
+			}
+		})
+	}
+}
+
+func TestCategoryOf(t *testing.T) {
+	cases := []struct {
+		s     Standard
+		index int
+		want  string
+	}{
+		{USEPA, 0, "Good"},
+		{USEPA, 101, "Unhealthy for Sensitive Groups"},
+		{EUCAQI, 125, "Very high"},
+		{EUEAQI, 3, "Moderate"},
+		{UKDAQI, 7, "High"},
+		{CanadaAQHI, 11, "Very high risk"},
+		{ChinaAQI, 250, "Heavily Polluted"},
+	}
+
+	for _, c := range cases {
+		if got := CategoryOf(c.s, c.index).Name; got != c.want {
+			t.Errorf("CategoryOf(%s, %d): got %q, want %q", c.s.ID(), c.index, got, c.want)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, s := range Standards {
+		if got, ok := Lookup(s.ID()); !ok || got.ID() != s.ID() {
+			t.Errorf("Lookup(%q) = %v, %v", s.ID(), got, ok)
+		}
+	}
+
+	if got, ok := Lookup(""); !ok || got.ID() != USEPA.ID() {
+		t.Errorf("Lookup(\"\") = %v, %v, want US EPA", got, ok)
+	}
+
+	if _, ok := Lookup("nope"); ok {
+		t.Error("Lookup(\"nope\") succeeded, want failure")
+	}
+}
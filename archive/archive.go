@@ -0,0 +1,195 @@
+// Package archive writes measurements to compressed files for long-term storage outside
+// of the database, either on the local filesystem or in Google Cloud Storage.
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mtraver/environmental-sensor/measurement"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"google.golang.org/api/googleapi"
+	storage "google.golang.org/api/storage/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const gcsScheme = "gs://"
+
+var ErrNotFound = errors.New("archive: not found")
+
+// Sink stores named archive files.
+type Sink interface {
+	// Read opens the file with the given name. It returns ErrNotFound if there's none.
+	Read(ctx context.Context, name string) (io.ReadCloser, error)
+
+	// Write stores the contents of r under the given name, which may contain slashes.
+	// An existing file with the same name is overwritten.
+	Write(ctx context.Context, name string, r io.Reader) error
+}
+
+// NewSink returns a Sink for the given destination. Destinations of the form
+// gs://bucket/prefix are written to Google Cloud Storage, and anything else is treated
+// as a directory on the local filesystem.
+func NewSink(ctx context.Context, dest string) (Sink, error) {
+	if !strings.HasPrefix(dest, gcsScheme) {
+		return LocalSink{Dir: dest}, nil
+	}
+
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(dest, gcsScheme), "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("archive: no bucket in destination %q", dest)
+	}
+
+	svc, err := storage.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("archive: failed to make storage client: %w", err)
+	}
+
+	return &GCSSink{Bucket: bucket, Prefix: prefix, service: svc}, nil
+}
+
+// LocalSink writes files to a directory on the local filesystem.
+type LocalSink struct {
+	Dir string
+}
+
+func (s LocalSink) Read(ctx context.Context, name string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(s.Dir, filepath.FromSlash(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("archive: failed to open %s: %w", name, err)
+	}
+	return f, nil
+}
+
+// Write writes the file atomically so that a partially-written archive is never left
+// in place if the process is interrupted.
+func (s LocalSink) Write(ctx context.Context, name string, r io.Reader) error {
+	path := filepath.Join(s.Dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("archive: failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("archive: failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("archive: failed to write temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("archive: failed to close temp file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("archive: failed to rename temp file into place: %w", err)
+	}
+
+	return nil
+}
+
+// GCSSink writes files to a Google Cloud Storage bucket, with names prefixed by Prefix.
+type GCSSink struct {
+	Bucket string
+	Prefix string
+
+	service *storage.Service
+}
+
+// objectName returns the name of the object that holds the file with the given name.
+func (s *GCSSink) objectName(name string) string {
+	return strings.TrimPrefix(strings.TrimSuffix(s.Prefix, "/")+"/"+name, "/")
+}
+
+func (s *GCSSink) Read(ctx context.Context, name string) (io.ReadCloser, error) {
+	obj := s.objectName(name)
+	resp, err := s.service.Objects.Get(s.Bucket, obj).Context(ctx).Download()
+	if gerr := (*googleapi.Error)(nil); errors.As(err, &gerr) && gerr.Code == http.StatusNotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("archive: failed to read gs://%s/%s: %w", s.Bucket, obj, err)
+	}
+	return resp.Body, nil
+}
+
+func (s *GCSSink) Write(ctx context.Context, name string, r io.Reader) error {
+	obj := &storage.Object{
+		Name:        s.objectName(name),
+		ContentType: "application/gzip",
+	}
+
+	if _, err := s.service.Objects.Insert(s.Bucket, obj).Media(r).Context(ctx).Do(); err != nil {
+		return fmt.Errorf("archive: failed to write gs://%s/%s: %w", s.Bucket, obj.Name, err)
+	}
+
+	return nil
+}
+
+// WriteJSONL writes the measurements to w as gzipped JSON Lines. Each line is a Measurement
+// encoded with the canonical protobuf JSON mapping, so archives can be read back with
+// protojson.Unmarshal (see ReadJSONL).
+func WriteJSONL(w io.Writer, sms []measurement.StorableMeasurement) error {
+	gz := gzip.NewWriter(w)
+
+	opts := protojson.MarshalOptions{}
+	for _, sm := range sms {
+		m, err := measurement.NewMeasurement(&sm)
+		if err != nil {
+			return err
+		}
+
+		b, err := opts.Marshal(m)
+		if err != nil {
+			return err
+		}
+
+		if _, err := gz.Write(append(b, '\n')); err != nil {
+			return err
+		}
+	}
+
+	return gz.Close()
+}
+
+// ReadJSONL reads measurements written by WriteJSONL.
+func ReadJSONL(r io.Reader) ([]*mpb.Measurement, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var ms []*mpb.Measurement
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		m := &mpb.Measurement{}
+		if err := protojson.Unmarshal(line, m); err != nil {
+			return nil, fmt.Errorf("archive: line %d: %w", len(ms)+1, err)
+		}
+		ms = append(ms, m)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
@@ -0,0 +1,102 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mtraver/environmental-sensor/measurement"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/testutil"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestJSONLRoundTrip(t *testing.T) {
+	want := []*mpb.Measurement{
+		testutil.FullyPopulatedMeasurementProto(),
+		{
+			DeviceId:        "bar",
+			Timestamp:       testutil.TimestampProto,
+			UploadTimestamp: testutil.TimestampProto2,
+		},
+	}
+
+	var sms []measurement.StorableMeasurement
+	for _, m := range want {
+		sm, err := measurement.NewStorableMeasurement(m)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		sms = append(sms, sm)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJSONL(&buf, sms); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got, err := ReadJSONL(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if diff := cmp.Diff(got, want, protocmp.Transform()); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+}
+
+func TestLocalSink(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewSink(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, content := range []string{"first", "second"} {
+		if err := sink.Write(context.Background(), "2018/03/2018-03-25.jsonl.gz", strings.NewReader(content)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "2018", "03", "2018-03-25.jsonl.gz"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := string(b); got != "second" {
+		t.Errorf("got %q, want %q", got, "second")
+	}
+
+	rc, err := sink.Read(context.Background(), "2018/03/2018-03-25.jsonl.gz")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer rc.Close()
+	if b, err := io.ReadAll(rc); err != nil || string(b) != "second" {
+		t.Errorf("Read: got %q, %v, want %q", b, err, "second")
+	}
+
+	if _, err := sink.Read(context.Background(), "2018/03/2018-03-26.jsonl.gz"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v for missing file, want %v", err, ErrNotFound)
+	}
+
+	// Only the archive itself should be left behind, not any temp files.
+	entries, err := os.ReadDir(filepath.Join(dir, "2018", "03"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d files, want 1", len(entries))
+	}
+}
+
+func TestNewSinkBadGCSDest(t *testing.T) {
+	if _, err := NewSink(context.Background(), "gs://"); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
@@ -0,0 +1,120 @@
+// Package broker delivers newly received measurements to live subscribers, such as GraphQL
+// subscriptions. Each server instance has one Broker. When there's more than one instance,
+// a Fanout relays measurements between them so that subscribers see measurements received
+// by any instance.
+package broker
+
+import (
+	"context"
+	"sync"
+
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+)
+
+// Measurements are buffered for each subscriber. If a subscriber falls this far behind then
+// further measurements are dropped for it rather than blocking delivery to everyone else.
+const subscriberBufferSize = 16
+
+// Fanout relays measurements between server instances.
+type Fanout interface {
+	// Publish sends m to the other instances.
+	Publish(ctx context.Context, m *mpb.Measurement) error
+
+	// Receive calls fn with each measurement published by the other instances. It blocks
+	// until ctx is done or an unrecoverable error occurs.
+	Receive(ctx context.Context, fn func(m *mpb.Measurement)) error
+}
+
+type subscriber struct {
+	deviceIDs map[string]struct{}
+	ch        chan *mpb.Measurement
+}
+
+func (s *subscriber) wants(m *mpb.Measurement) bool {
+	if len(s.deviceIDs) == 0 {
+		return true
+	}
+
+	_, ok := s.deviceIDs[m.GetDeviceId()]
+	return ok
+}
+
+type Broker struct {
+	fanout Fanout
+
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+}
+
+// New returns a Broker that relays measurements to other instances using fanout. fanout may
+// be nil, in which case measurements are only delivered to subscribers of this Broker.
+func New(fanout Fanout) *Broker {
+	return &Broker{
+		fanout:      fanout,
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+// Subscribe returns a channel on which measurements from the given devices are delivered, or
+// measurements from all devices if deviceIDs is empty. The channel is closed when ctx is done.
+// Delivered measurements are shared between subscribers and must not be modified.
+func (b *Broker) Subscribe(ctx context.Context, deviceIDs []string) <-chan *mpb.Measurement {
+	s := &subscriber{
+		deviceIDs: make(map[string]struct{}, len(deviceIDs)),
+		ch:        make(chan *mpb.Measurement, subscriberBufferSize),
+	}
+	for _, id := range deviceIDs {
+		s.deviceIDs[id] = struct{}{}
+	}
+
+	b.mu.Lock()
+	b.subscribers[s] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, s)
+		close(s.ch)
+	}()
+
+	return s.ch
+}
+
+// Publish delivers m to this Broker's subscribers and, if there's a Fanout, to other instances.
+func (b *Broker) Publish(ctx context.Context, m *mpb.Measurement) error {
+	b.deliver(m)
+
+	if b.fanout == nil {
+		return nil
+	}
+	return b.fanout.Publish(ctx, m)
+}
+
+// Run delivers measurements published by other instances to this Broker's subscribers. It
+// blocks until ctx is done or the Fanout fails. If there's no Fanout it returns immediately.
+func (b *Broker) Run(ctx context.Context) error {
+	if b.fanout == nil {
+		return nil
+	}
+	return b.fanout.Receive(ctx, b.deliver)
+}
+
+func (b *Broker) deliver(m *mpb.Measurement) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subscribers {
+		if !s.wants(m) {
+			continue
+		}
+
+		select {
+		case s.ch <- m:
+		default:
+			// The subscriber isn't keeping up. Drop the measurement for it.
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package broker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+const timeout = 5 * time.Second
+
+func receive(t *testing.T, ch <-chan *mpb.Measurement) *mpb.Measurement {
+	t.Helper()
+
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(timeout):
+		t.Fatal("timed out waiting for measurement")
+		return nil
+	}
+}
+
+func expectNothing(t *testing.T, ch <-chan *mpb.Measurement) {
+	t.Helper()
+
+	select {
+	case m := <-ch:
+		t.Errorf("got unexpected measurement %v", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBrokerSubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := New(nil)
+	all := b.Subscribe(ctx, nil)
+	foo := b.Subscribe(ctx, []string{"foo"})
+
+	for _, id := range []string{"foo", "bar"} {
+		if err := b.Publish(ctx, &mpb.Measurement{DeviceId: id}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if got := receive(t, all).GetDeviceId(); got != "foo" {
+		t.Errorf("got %q, want %q", got, "foo")
+	}
+	if got := receive(t, all).GetDeviceId(); got != "bar" {
+		t.Errorf("got %q, want %q", got, "bar")
+	}
+
+	if got := receive(t, foo).GetDeviceId(); got != "foo" {
+		t.Errorf("got %q, want %q", got, "foo")
+	}
+	expectNothing(t, foo)
+}
+
+func TestBrokerUnsubscribe(t *testing.T) {
+	b := New(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := b.Subscribe(ctx, nil)
+	cancel()
+
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("got measurement, want closed channel")
+		}
+	case <-time.After(timeout):
+		t.Fatal("timed out waiting for channel to close")
+	}
+
+	// Publishing after the subscriber is gone must not panic.
+	if err := b.Publish(context.Background(), &mpb.Measurement{DeviceId: "foo"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestBrokerSlowSubscriber(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := New(nil)
+	ch := b.Subscribe(ctx, nil)
+
+	// Publishing more than the buffer size must not block.
+	for range subscriberBufferSize + 1 {
+		if err := b.Publish(ctx, &mpb.Measurement{DeviceId: "foo"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if got := len(ch); got != subscriberBufferSize {
+		t.Errorf("got %d buffered, want %d", got, subscriberBufferSize)
+	}
+}
+
+func TestBrokerFanout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hub := NewMemoryHub()
+	a := New(hub.NewFanout())
+	b := New(hub.NewFanout())
+	go a.Run(ctx)
+	go b.Run(ctx)
+
+	aCh := a.Subscribe(ctx, nil)
+	bCh := b.Subscribe(ctx, nil)
+
+	want := &mpb.Measurement{DeviceId: "foo"}
+	if err := a.Publish(ctx, want); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, ch := range []<-chan *mpb.Measurement{aCh, bCh} {
+		if diff := cmp.Diff(receive(t, ch), want, protocmp.Transform()); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	}
+
+	// Each instance should get the measurement exactly once.
+	expectNothing(t, aCh)
+	expectNothing(t, bCh)
+}
@@ -0,0 +1,71 @@
+package broker
+
+import (
+	"context"
+	"sync"
+
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"google.golang.org/protobuf/proto"
+)
+
+// MemoryHub is an in-memory stand-in for a message bus shared by server instances. Each Fanout
+// returned by NewFanout acts as one instance. It's intended for tests and local development.
+type MemoryHub struct {
+	mu      sync.Mutex
+	fanouts []*memoryFanout
+}
+
+func NewMemoryHub() *MemoryHub {
+	return &MemoryHub{}
+}
+
+// NewFanout returns a Fanout connected to every other Fanout of the hub.
+func (h *MemoryHub) NewFanout() Fanout {
+	f := &memoryFanout{
+		hub: h,
+		ch:  make(chan *mpb.Measurement, subscriberBufferSize),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fanouts = append(h.fanouts, f)
+
+	return f
+}
+
+type memoryFanout struct {
+	hub *MemoryHub
+	ch  chan *mpb.Measurement
+}
+
+func (f *memoryFanout) Publish(ctx context.Context, m *mpb.Measurement) error {
+	f.hub.mu.Lock()
+	others := make([]*memoryFanout, 0, len(f.hub.fanouts))
+	for _, o := range f.hub.fanouts {
+		if o != f {
+			others = append(others, o)
+		}
+	}
+	f.hub.mu.Unlock()
+
+	for _, o := range others {
+		select {
+		case o.ch <- proto.Clone(m).(*mpb.Measurement):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func (f *memoryFanout) Receive(ctx context.Context, fn func(m *mpb.Measurement)) error {
+	for {
+		select {
+		case m := <-f.ch:
+			fn(m)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
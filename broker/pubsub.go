@@ -0,0 +1,107 @@
+package broker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+	"cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// The Pub/Sub message attribute that identifies the instance that published a message, so that
+// an instance can ignore its own messages.
+const originAttribute = "origin"
+
+// PubSubFanout relays measurements between instances using a Cloud Pub/Sub topic. Each instance
+// has its own subscription to the topic so that every instance receives every measurement.
+type PubSubFanout struct {
+	client       *pubsub.Client
+	publisher    *pubsub.Publisher
+	subscription string
+	origin       string
+}
+
+// NewPubSubFanout creates a subscription to the given topic for this instance. Call Close to
+// delete it. If the instance exits without calling Close, the subscription expires after a day.
+func NewPubSubFanout(ctx context.Context, client *pubsub.Client, topicID string) (*PubSubFanout, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	origin := hex.EncodeToString(b)
+
+	topic := fmt.Sprintf("projects/%s/topics/%s", client.Project(), topicID)
+	subscription := fmt.Sprintf("projects/%s/subscriptions/%s-%s", client.Project(), topicID, origin)
+
+	_, err := client.SubscriptionAdminClient.CreateSubscription(ctx, &pubsubpb.Subscription{
+		Name:  subscription,
+		Topic: topic,
+
+		// Live measurements are only useful for a short time.
+		MessageRetentionDuration: durationpb.New(10 * time.Minute),
+		ExpirationPolicy: &pubsubpb.ExpirationPolicy{
+			Ttl: durationpb.New(24 * time.Hour),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("broker: failed to create subscription: %w", err)
+	}
+
+	return &PubSubFanout{
+		client:       client,
+		publisher:    client.Publisher(topic),
+		subscription: subscription,
+		origin:       origin,
+	}, nil
+}
+
+func (f *PubSubFanout) Publish(ctx context.Context, m *mpb.Measurement) error {
+	data, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	r := f.publisher.Publish(ctx, &pubsub.Message{
+		Data: data,
+		Attributes: map[string]string{
+			originAttribute: f.origin,
+		},
+	})
+
+	_, err = r.Get(ctx)
+	return err
+}
+
+func (f *PubSubFanout) Receive(ctx context.Context, fn func(m *mpb.Measurement)) error {
+	return f.client.Subscriber(f.subscription).Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+		// There's nothing to retry, so ack everything.
+		msg.Ack()
+
+		if msg.Attributes[originAttribute] == f.origin {
+			return
+		}
+
+		m := &mpb.Measurement{}
+		if err := proto.Unmarshal(msg.Data, m); err != nil {
+			log.Printf("broker: failed to unmarshal protobuf: %v", err)
+			return
+		}
+
+		fn(m)
+	})
+}
+
+// Close stops publishing and deletes this instance's subscription.
+func (f *PubSubFanout) Close(ctx context.Context) error {
+	f.publisher.Stop()
+	return f.client.SubscriptionAdminClient.DeleteSubscription(ctx, &pubsubpb.DeleteSubscriptionRequest{
+		Subscription: f.subscription,
+	})
+}
@@ -0,0 +1,217 @@
+// Package calibration corrects sensor readings using per-device, per-metric calibration
+// profiles. Corrections are applied when measurements are read; stored values never change, so
+// profiles can be added, fixed, or removed at any time.
+package calibration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/measurement"
+	"github.com/mtraver/environmental-sensor/metric"
+	"github.com/mtraver/environmental-sensor/util"
+)
+
+var ErrNotFound = errors.New("calibration: not found")
+
+type Kind string
+
+const (
+	// Linear profiles correct a value v to Scale*v + Offset.
+	Linear Kind = "linear"
+
+	// EPAHumidity profiles apply the US EPA's correction for low-cost PM2.5 sensors, which read
+	// high in humid air. It needs the measurement's relative humidity, so values from
+	// measurements without it are left uncorrected.
+	EPAHumidity Kind = "epa_humidity"
+)
+
+// Profile corrects the values of one metric reported by one device.
+type Profile struct {
+	// ID identifies the profile. It's assigned when the profile is stored.
+	ID string `datastore:"-"`
+
+	// DeviceID is the device ID that the device reports in its measurements.
+	DeviceID string     `datastore:"device_id"`
+	Metric   metric.Key `datastore:"metric"`
+	Kind     Kind       `datastore:"kind"`
+
+	// Scale and Offset are used by Linear profiles.
+	Scale  float64 `datastore:"scale,noindex"`
+	Offset float64 `datastore:"offset,noindex"`
+
+	// The profile applies to measurements with timestamps in [ValidFrom, ValidUntil). A zero
+	// time leaves that end of the range open.
+	ValidFrom  time.Time `datastore:"valid_from,noindex"`
+	ValidUntil time.Time `datastore:"valid_until,noindex"`
+
+	// Note describes where the profile came from, e.g. the reference it was fit against.
+	Note string `datastore:"note,noindex"`
+}
+
+// Validate returns an error if p is not valid.
+func (p Profile) Validate() error {
+	if p.DeviceID == "" {
+		return errors.New("calibration: device ID must be set")
+	}
+
+	if _, ok := (measurement.StorableMeasurement{}).ValueMap()[p.Metric]; !ok {
+		return fmt.Errorf("calibration: %q is not a metric reported by sensors", p.Metric)
+	}
+
+	switch p.Kind {
+	case Linear:
+		if p.Scale == 0 {
+			return errors.New("calibration: linear profiles must have a non-zero scale")
+		}
+	case EPAHumidity:
+		if p.Metric != metric.PM25 {
+			return fmt.Errorf("calibration: %s profiles only apply to %s", p.Kind, metric.PM25)
+		}
+	default:
+		return fmt.Errorf("calibration: unknown profile kind %q", p.Kind)
+	}
+
+	if !p.ValidFrom.IsZero() && !p.ValidUntil.IsZero() && !p.ValidUntil.After(p.ValidFrom) {
+		return errors.New("calibration: profile must be valid until after it's valid from")
+	}
+
+	return nil
+}
+
+// AppliesTo reports whether p corrects values reported by the given device at time t.
+func (p Profile) AppliesTo(deviceID string, t time.Time) bool {
+	if p.DeviceID != deviceID {
+		return false
+	}
+
+	return (p.ValidFrom.IsZero() || !t.Before(p.ValidFrom)) && (p.ValidUntil.IsZero() || t.Before(p.ValidUntil))
+}
+
+// correct returns the corrected value of v, which was reported in a measurement with the given
+// raw values. ok is false if v can't be corrected.
+func (p Profile) correct(v float32, values map[metric.Key]*float32) (corrected float32, ok bool) {
+	switch p.Kind {
+	case Linear:
+		return float32(p.Scale*float64(v) + p.Offset), true
+	case EPAHumidity:
+		rh := values[metric.RH]
+		if rh == nil {
+			return 0, false
+		}
+		return epaHumidity(v, *rh), true
+	default:
+		return 0, false
+	}
+}
+
+// epaHumidity applies the US EPA's extended correction for PM2.5 from low-cost sensors, which is
+// piecewise linear in pm and rh with smooth transitions at 30–50 μg/m³ and 210–260 μg/m³, and
+// quadratic in pm above that to correct for the sensors' response to dense smoke.
+// See https://document.airnow.gov/airnow-fire-and-smoke-map-sensor-data-correction.pdf.
+func epaHumidity(pm, rh float32) float32 {
+	x, h := float64(pm), float64(rh)
+
+	var y float64
+	switch {
+	case x < 30:
+		y = 0.524*x - 0.0862*h + 5.75
+	case x < 50:
+		w := x/20 - 1.5
+		y = (0.786*w+0.524*(1-w))*x - 0.0862*h + 5.75
+	case x < 210:
+		y = 0.786*x - 0.0862*h + 5.75
+	case x < 260:
+		w := x/50 - 4.2
+		y = (0.69*w+0.786*(1-w))*x - 0.0862*h*(1-w) + 2.966*w + 5.75*(1-w) + 8.84e-4*x*x*w
+	default:
+		y = 2.966 + 0.69*x + 8.84e-4*x*x
+	}
+
+	return float32(max(y, 0))
+}
+
+// Profiles is a set of calibration profiles.
+type Profiles []Profile
+
+// Apply corrects each value in sm for which there's a profile for sm's device at sm's time, and
+// records the original values in sm.Raw. If more than one profile applies to a metric then the
+// one that became valid most recently is used. Every correction is computed from the original
+// values, so corrections that depend on other metrics, like EPAHumidity, aren't affected by the
+// order in which they're applied.
+func (ps Profiles) Apply(sm *measurement.StorableMeasurement) {
+	values := sm.ValueMap()
+
+	chosen := make(map[metric.Key]Profile)
+	for _, p := range ps {
+		if !p.AppliesTo(sm.DeviceID, sm.Timestamp) || values[p.Metric] == nil {
+			continue
+		}
+
+		if c, ok := chosen[p.Metric]; !ok || p.ValidFrom.After(c.ValidFrom) {
+			chosen[p.Metric] = p
+		}
+	}
+
+	for key, p := range chosen {
+		v := *values[key]
+		corrected, ok := p.correct(v, values)
+		if !ok {
+			continue
+		}
+
+		if sm.Raw == nil {
+			sm.Raw = make(map[metric.Key]float32)
+		}
+		sm.Raw[key] = v
+		sm.SetValue(key, corrected)
+	}
+}
+
+// ApplyAll applies ps to each of sms.
+func (ps Profiles) ApplyAll(sms []measurement.StorableMeasurement) {
+	if len(ps) == 0 {
+		return
+	}
+
+	for i := range sms {
+		ps.Apply(&sms[i])
+	}
+}
+
+// Store stores calibration profiles.
+type Store interface {
+	CalibrationProfiles(ctx context.Context) ([]Profile, error)
+
+	// CalibrationProfile gets the profile with the given ID. It returns ErrNotFound if there's
+	// none.
+	CalibrationProfile(ctx context.Context, id string) (Profile, error)
+
+	// PutCalibrationProfile validates and stores p, assigning it an ID if it doesn't have one.
+	// It returns the stored profile.
+	PutCalibrationProfile(ctx context.Context, p Profile) (Profile, error)
+
+	// DeleteCalibrationProfile deletes the profile with the given ID. It returns ErrNotFound if
+	// there's none.
+	DeleteCalibrationProfile(ctx context.Context, id string) error
+}
+
+// PrepareProfile readies p to be stored. It validates p and assigns it an ID if it doesn't have
+// one. Store implementations call it from PutCalibrationProfile.
+func PrepareProfile(p Profile) (Profile, error) {
+	if err := p.Validate(); err != nil {
+		return p, err
+	}
+
+	if p.ID == "" {
+		id, err := util.NewID()
+		if err != nil {
+			return p, err
+		}
+		p.ID = id
+	}
+
+	return p, nil
+}
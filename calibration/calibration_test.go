@@ -0,0 +1,144 @@
+package calibration
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mtraver/environmental-sensor/measurement"
+	"github.com/mtraver/environmental-sensor/metric"
+	"github.com/mtraver/environmental-sensor/testutil"
+)
+
+func floatPtr(f float32) *float32 {
+	return &f
+}
+
+func TestProfileValidate(t *testing.T) {
+	cases := []struct {
+		name  string
+		p     Profile
+		valid bool
+	}{
+		{"linear", Profile{DeviceID: "foo", Metric: metric.Temp, Kind: Linear, Scale: 1, Offset: -1.5}, true},
+		{"epa_humidity", Profile{DeviceID: "foo", Metric: metric.PM25, Kind: EPAHumidity}, true},
+		{"no_device", Profile{Metric: metric.Temp, Kind: Linear, Scale: 1}, false},
+		{"derived_metric", Profile{DeviceID: "foo", Metric: metric.AQI, Kind: Linear, Scale: 1}, false},
+		{"zero_scale", Profile{DeviceID: "foo", Metric: metric.Temp, Kind: Linear}, false},
+		{"epa_humidity_wrong_metric", Profile{DeviceID: "foo", Metric: metric.PM10, Kind: EPAHumidity}, false},
+		{"unknown_kind", Profile{DeviceID: "foo", Metric: metric.Temp, Kind: "magic"}, false},
+		{
+			"empty_range",
+			Profile{DeviceID: "foo", Metric: metric.Temp, Kind: Linear, Scale: 1, ValidFrom: testutil.Timestamp, ValidUntil: testutil.Timestamp},
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.p.Validate()
+			if err != nil && tc.valid {
+				t.Errorf("expected no error, got %v", err)
+			} else if err == nil && !tc.valid {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestEPAHumidity(t *testing.T) {
+	cases := []struct {
+		pm, rh float32
+		want   float32
+	}{
+		{0, 50, 1.44},
+		{10, 40, 7.542},
+		// The segments meet at the ends of the transitions.
+		{30, 50, 17.16},
+		{50, 50, 40.74},
+		{210, 50, 166.50},
+		{260, 50, 242.13},
+		{500, 50, 568.97},
+		// The correction never goes negative.
+		{0, 100, 0},
+	}
+
+	for _, c := range cases {
+		if got := epaHumidity(c.pm, c.rh); math.Abs(float64(got-c.want)) > 0.01 {
+			t.Errorf("epaHumidity(%v, %v) = %v, want %v", c.pm, c.rh, got, c.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	at := func(d time.Duration) time.Time { return testutil.Timestamp.Add(d) }
+
+	profiles := Profiles{
+		{DeviceID: "foo", Metric: metric.Temp, Kind: Linear, Scale: 1, Offset: -2, ValidUntil: at(time.Hour)},
+		// This one supersedes the first from when it becomes valid.
+		{DeviceID: "foo", Metric: metric.Temp, Kind: Linear, Scale: 2, Offset: 0, ValidFrom: at(30 * time.Minute)},
+		{DeviceID: "foo", Metric: metric.PM25, Kind: EPAHumidity},
+		// This corrects RH, but the PM2.5 correction must use the reported RH.
+		{DeviceID: "foo", Metric: metric.RH, Kind: Linear, Scale: 1, Offset: 50},
+	}
+
+	cases := []struct {
+		name string
+		sm   measurement.StorableMeasurement
+		want measurement.StorableMeasurement
+	}{
+		{
+			name: "other_device",
+			sm:   measurement.StorableMeasurement{DeviceID: "bar", Timestamp: at(0), Temp: floatPtr(20)},
+			want: measurement.StorableMeasurement{DeviceID: "bar", Timestamp: at(0), Temp: floatPtr(20)},
+		},
+		{
+			name: "linear",
+			sm:   measurement.StorableMeasurement{DeviceID: "foo", Timestamp: at(0), Temp: floatPtr(20)},
+			want: measurement.StorableMeasurement{
+				DeviceID:  "foo",
+				Timestamp: at(0),
+				Temp:      floatPtr(18),
+				Raw:       map[metric.Key]float32{metric.Temp: 20},
+			},
+		},
+		{
+			name: "latest_profile_wins",
+			sm:   measurement.StorableMeasurement{DeviceID: "foo", Timestamp: at(45 * time.Minute), Temp: floatPtr(20)},
+			want: measurement.StorableMeasurement{
+				DeviceID:  "foo",
+				Timestamp: at(45 * time.Minute),
+				Temp:      floatPtr(40),
+				Raw:       map[metric.Key]float32{metric.Temp: 20},
+			},
+		},
+		{
+			name: "uses_raw_inputs",
+			sm:   measurement.StorableMeasurement{DeviceID: "foo", Timestamp: at(0), PM25: floatPtr(10), RH: floatPtr(40)},
+			want: measurement.StorableMeasurement{
+				DeviceID:  "foo",
+				Timestamp: at(0),
+				PM25:      floatPtr(7.542),
+				RH:        floatPtr(90),
+				Raw:       map[metric.Key]float32{metric.PM25: 10, metric.RH: 40},
+			},
+		},
+		{
+			name: "missing_humidity",
+			sm:   measurement.StorableMeasurement{DeviceID: "foo", Timestamp: at(0), PM25: floatPtr(10)},
+			want: measurement.StorableMeasurement{DeviceID: "foo", Timestamp: at(0), PM25: floatPtr(10)},
+		},
+	}
+
+	approx := cmp.Comparer(func(a, b float32) bool { return math.Abs(float64(a-b)) < 0.01 })
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sm := tc.sm
+			profiles.Apply(&sm)
+			if diff := cmp.Diff(sm, tc.want, approx); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
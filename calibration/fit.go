@@ -0,0 +1,124 @@
+package calibration
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/measurement"
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+// Point is a pair of co-located readings of the same metric: X from the device being calibrated
+// and Y from the reference.
+type Point struct {
+	X, Y float64
+}
+
+// Pair pairs each of sms's values of m with the reference's value of m that's closest in time,
+// as long as they're no more than maxSkew apart. Both slices must be sorted by timestamp.
+func Pair(sms, reference []measurement.StorableMeasurement, m metric.Key, maxSkew time.Duration) []Point {
+	var points []Point
+	for _, sm := range sms {
+		x := sm.Value(m)
+		if x == nil {
+			continue
+		}
+
+		// Find the reference measurements on either side of sm and use the closer of the two.
+		i, _ := slices.BinarySearchFunc(reference, sm.Timestamp, func(ref measurement.StorableMeasurement, t time.Time) int {
+			return ref.Timestamp.Compare(t)
+		})
+
+		var best *float32
+		bestSkew := maxSkew + 1
+		for _, j := range []int{i - 1, i} {
+			if j < 0 || j >= len(reference) {
+				continue
+			}
+
+			y := reference[j].Value(m)
+			skew := reference[j].Timestamp.Sub(sm.Timestamp).Abs()
+			if y != nil && skew <= maxSkew && skew < bestSkew {
+				best, bestSkew = y, skew
+			}
+		}
+
+		if best != nil {
+			points = append(points, Point{X: float64(*x), Y: float64(*best)})
+		}
+	}
+
+	return points
+}
+
+// Fit is a linear fit of reference values to device values.
+type Fit struct {
+	Scale  float64
+	Offset float64
+
+	// R2 is the coefficient of determination: the fraction of the variance in the reference
+	// values that the fit explains.
+	R2 float64
+
+	// N is the number of points fit.
+	N int
+}
+
+func (f Fit) String() string {
+	return fmt.Sprintf("scale=%.4f offset=%.4f r²=%.4f n=%d", f.Scale, f.Offset, f.R2, f.N)
+}
+
+// Profile returns a Linear profile that applies f to the given device's values of m.
+func (f Fit) Profile(deviceID string, m metric.Key) Profile {
+	return Profile{
+		DeviceID: deviceID,
+		Metric:   m,
+		Kind:     Linear,
+		Scale:    f.Scale,
+		Offset:   f.Offset,
+	}
+}
+
+// FitLinear fits Y = Scale*X + Offset to points by ordinary least squares.
+func FitLinear(points []Point) (Fit, error) {
+	n := float64(len(points))
+	if len(points) < 2 {
+		return Fit{}, errors.New("calibration: at least two points are needed to fit")
+	}
+
+	var meanX, meanY float64
+	for _, p := range points {
+		meanX += p.X
+		meanY += p.Y
+	}
+	meanX /= n
+	meanY /= n
+
+	var sxx, sxy, syy float64
+	for _, p := range points {
+		dx, dy := p.X-meanX, p.Y-meanY
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+
+	if sxx == 0 {
+		return Fit{}, errors.New("calibration: device values don't vary, so they can't be fit")
+	}
+
+	f := Fit{
+		Scale: sxy / sxx,
+		N:     len(points),
+	}
+	f.Offset = meanY - f.Scale*meanX
+
+	// A constant reference is fit exactly by the constant line.
+	f.R2 = 1
+	if syy > 0 {
+		f.R2 = sxy * sxy / (sxx * syy)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,71 @@
+package calibration
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mtraver/environmental-sensor/measurement"
+	"github.com/mtraver/environmental-sensor/metric"
+	"github.com/mtraver/environmental-sensor/testutil"
+)
+
+func TestPair(t *testing.T) {
+	at := func(d time.Duration) time.Time { return testutil.Timestamp.Add(d) }
+
+	sms := []measurement.StorableMeasurement{
+		{Timestamp: at(0), Temp: floatPtr(20)},
+		{Timestamp: at(time.Minute), Temp: floatPtr(21)},
+		// No reference measurement is close enough.
+		{Timestamp: at(10 * time.Minute), Temp: floatPtr(22)},
+		{Timestamp: at(11 * time.Minute)},
+	}
+	reference := []measurement.StorableMeasurement{
+		{Timestamp: at(-20 * time.Second), Temp: floatPtr(19)},
+		{Timestamp: at(10 * time.Second), Temp: floatPtr(19.5)},
+		{Timestamp: at(70 * time.Second), Temp: floatPtr(20.5)},
+		{Timestamp: at(5 * time.Minute), Temp: floatPtr(30)},
+	}
+
+	got := Pair(sms, reference, metric.Temp, 30*time.Second)
+	want := []Point{{20, 19.5}, {21, 20.5}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+}
+
+func TestFitLinear(t *testing.T) {
+	// The device reads 10% high and 1 unit low, plus or minus a little noise.
+	var points []Point
+	for i := range 20 {
+		y := float64(i)
+		noise := 0.05 * float64(i%3-1)
+		points = append(points, Point{X: 1.1*y - 1 + noise, Y: y})
+	}
+
+	f, err := FitLinear(points)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if math.Abs(f.Scale-1/1.1) > 0.01 || math.Abs(f.Offset-1/1.1) > 0.05 {
+		t.Errorf("got %v, want scale≈%.4f offset≈%.4f", f, 1/1.1, 1/1.1)
+	}
+	if f.R2 < 0.99 || f.R2 > 1 {
+		t.Errorf("got r² %v, want close to 1", f.R2)
+	}
+	if f.N != len(points) {
+		t.Errorf("got n=%d, want %d", f.N, len(points))
+	}
+}
+
+func TestFitLinearErrors(t *testing.T) {
+	if _, err := FitLinear([]Point{{1, 1}}); err == nil {
+		t.Error("expected error for one point, got nil")
+	}
+
+	if _, err := FitLinear([]Point{{1, 1}, {1, 2}}); err == nil {
+		t.Error("expected error for constant device values, got nil")
+	}
+}
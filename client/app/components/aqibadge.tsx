@@ -2,8 +2,18 @@ import type { JSX } from "react";
 import { Badge } from "@mantine/core";
 import { aqiCategory } from "../lib/aqi";
 
-export function AQIBadge({ aqi }: { aqi: number }): JSX.Element {
-  const aqiCat = aqiCategory(aqi);
+// category is the category computed by the server on the measurement's AQI standard. If it's
+// missing then the US EPA category is used.
+export function AQIBadge({
+  aqi,
+  category,
+}: {
+  aqi: number;
+  category?: { name: string; color: string } | null;
+}): JSX.Element {
+  const aqiCat = category
+    ? { label: category.name, color: category.color }
+    : aqiCategory(aqi);
   return (
     <Badge color={aqiCat.color} variant="light-with-border">
       {aqi} ({aqiCat.label})
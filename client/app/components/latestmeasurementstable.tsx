@@ -46,7 +46,9 @@ function MetricCellContent({
 
   const config = METRICS[metric];
   if (config.cellRenderer === "aqiBadge") {
-    return <AQIBadge aqi={value as number} />;
+    return (
+      <AQIBadge aqi={value as number} category={measurement.aqiCategory} />
+    );
   }
 
   return <Text size="sm">{(value as number).toFixed(config.decimals)}</Text>;
@@ -33,6 +33,11 @@ const MEASUREMENT_FIELDS: TypedDocumentNode<MeasurementFieldsFragment> = gql`
     pm4
     pm10
     aqi
+    aqiCategory {
+      name
+      abbrv
+      color
+    }
     rh
     co2
     vocIndex
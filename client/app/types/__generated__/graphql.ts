@@ -15,37 +15,563 @@ export type Scalars = {
   DateTime: { input: string; output: string; }
 };
 
+export type AqiCategory = {
+  __typename: 'AQICategory';
+  abbrv: Scalars['String']['output'];
+  color: Scalars['String']['output'];
+  max: Maybe<Scalars['Int']['output']>;
+  name: Scalars['String']['output'];
+};
+
+export type AqiStandard = {
+  __typename: 'AQIStandard';
+  categories: Array<AqiCategory>;
+  id: Scalars['ID']['output'];
+  name: Scalars['String']['output'];
+  pollutants: Array<Scalars['String']['output']>;
+};
+
+export type Alert = {
+  __typename: 'Alert';
+  deviceId: Scalars['String']['output'];
+  firedAt: Maybe<Scalars['DateTime']['output']>;
+  resolvedAt: Maybe<Scalars['DateTime']['output']>;
+  rule: AlertRule;
+  since: Maybe<Scalars['DateTime']['output']>;
+  status: AlertStatus;
+  value: Maybe<Scalars['Float']['output']>;
+};
+
+export type AlertRule = {
+  __typename: 'AlertRule';
+  aqiCategory: Maybe<Scalars['String']['output']>;
+  aqiStandard: Maybe<Scalars['String']['output']>;
+  channels: Array<Scalars['String']['output']>;
+  deviceId: Maybe<Scalars['String']['output']>;
+  enabled: Scalars['Boolean']['output'];
+  for: Scalars['String']['output'];
+  id: Scalars['ID']['output'];
+  kind: AlertRuleKind;
+  metric: Maybe<Scalars['String']['output']>;
+  name: Scalars['String']['output'];
+  op: Maybe<Scalars['String']['output']>;
+  threshold: Maybe<Scalars['Float']['output']>;
+};
+
+export type AlertRuleInput = {
+  aqiCategory?: InputMaybe<Scalars['String']['input']>;
+  aqiStandard?: InputMaybe<Scalars['String']['input']>;
+  channels?: InputMaybe<Array<Scalars['String']['input']>>;
+  deviceId?: InputMaybe<Scalars['String']['input']>;
+  enabled?: InputMaybe<Scalars['Boolean']['input']>;
+  for?: InputMaybe<Scalars['String']['input']>;
+  kind: AlertRuleKind;
+  metric?: InputMaybe<Scalars['String']['input']>;
+  name: Scalars['String']['input'];
+  op?: InputMaybe<Scalars['String']['input']>;
+  threshold?: InputMaybe<Scalars['Float']['input']>;
+};
+
+export enum AlertRuleKind {
+  Absence = 'ABSENCE',
+  AqiCategory = 'AQI_CATEGORY',
+  Threshold = 'THRESHOLD'
+}
+
+export enum AlertStatus {
+  Firing = 'FIRING',
+  Inactive = 'INACTIVE',
+  Pending = 'PENDING',
+  Resolved = 'RESOLVED'
+}
+
+export type ApiToken = {
+  __typename: 'ApiToken';
+  createdAt: Scalars['DateTime']['output'];
+  id: Scalars['ID']['output'];
+  name: Scalars['String']['output'];
+};
+
+export enum CalibrationKind {
+  EpaHumidity = 'EPA_HUMIDITY',
+  Linear = 'LINEAR'
+}
+
+export type CalibrationProfile = {
+  __typename: 'CalibrationProfile';
+  deviceId: Scalars['String']['output'];
+  id: Scalars['ID']['output'];
+  kind: CalibrationKind;
+  metric: Scalars['String']['output'];
+  note: Maybe<Scalars['String']['output']>;
+  offset: Maybe<Scalars['Float']['output']>;
+  scale: Maybe<Scalars['Float']['output']>;
+  validFrom: Maybe<Scalars['DateTime']['output']>;
+  validUntil: Maybe<Scalars['DateTime']['output']>;
+};
+
+export type CalibrationProfileInput = {
+  deviceId: Scalars['String']['input'];
+  kind: CalibrationKind;
+  metric: Scalars['String']['input'];
+  note?: InputMaybe<Scalars['String']['input']>;
+  offset?: InputMaybe<Scalars['Float']['input']>;
+  scale?: InputMaybe<Scalars['Float']['input']>;
+  validFrom?: InputMaybe<Scalars['DateTime']['input']>;
+  validUntil?: InputMaybe<Scalars['DateTime']['input']>;
+};
+
+export type Device = {
+  __typename: 'Device';
+  aliases: Array<Scalars['String']['output']>;
+  aqiStandard: Maybe<Scalars['String']['output']>;
+  awsThingArn: Maybe<Scalars['String']['output']>;
+  createdAt: Scalars['DateTime']['output'];
+  deviceId: Scalars['String']['output'];
+  displayName: Maybe<Scalars['String']['output']>;
+  hasPushToken: Scalars['Boolean']['output'];
+  id: Scalars['ID']['output'];
+  latest: Maybe<Measurement>;
+  location: Maybe<Scalars['String']['output']>;
+  name: Scalars['String']['output'];
+  owner: Maybe<Scalars['String']['output']>;
+  reporting: DeviceReporting;
+  sensors: Array<Scalars['String']['output']>;
+  sharedWith: Array<Scalars['String']['output']>;
+  tags: Array<Scalars['String']['output']>;
+  timezone: Maybe<Scalars['String']['output']>;
+  updatedAt: Scalars['DateTime']['output'];
+  visibility: Visibility;
+};
+
+
+export type DeviceLatestArgs = {
+  aqiStandard?: InputMaybe<Scalars['String']['input']>;
+};
+
+export type DeviceInput = {
+  aliases?: InputMaybe<Array<Scalars['String']['input']>>;
+  aqiStandard?: InputMaybe<Scalars['String']['input']>;
+  deviceId?: InputMaybe<Scalars['String']['input']>;
+  displayName?: InputMaybe<Scalars['String']['input']>;
+  location?: InputMaybe<Scalars['String']['input']>;
+  owner?: InputMaybe<Scalars['String']['input']>;
+  sensors?: InputMaybe<Array<Scalars['String']['input']>>;
+  sharedWith?: InputMaybe<Array<Scalars['String']['input']>>;
+  tags?: InputMaybe<Array<Scalars['String']['input']>>;
+  timezone?: InputMaybe<Scalars['String']['input']>;
+  visibility?: InputMaybe<Visibility>;
+};
+
+export type DeviceReporting = {
+  __typename: 'DeviceReporting';
+  cadence: Maybe<Scalars['String']['output']>;
+  gaps: Array<GapBucket>;
+  lastSeen: Maybe<Scalars['DateTime']['output']>;
+  stale: Scalars['Boolean']['output'];
+  uptime: Array<Uptime>;
+};
+
+export type GapBucket = {
+  __typename: 'GapBucket';
+  count: Scalars['Int']['output'];
+  max: Maybe<Scalars['String']['output']>;
+};
+
 export type Measurement = {
   __typename: 'Measurement';
+  absHumidity: Maybe<Scalars['Float']['output']>;
   aqi: Maybe<Scalars['Float']['output']>;
+  aqiCategory: Maybe<AqiCategory>;
+  aqiNowCast: Maybe<Scalars['Float']['output']>;
+  aqiPollutant: Maybe<Scalars['String']['output']>;
+  aqiStandard: Maybe<Scalars['String']['output']>;
+  calibrated: Array<Scalars['String']['output']>;
   co2: Maybe<Scalars['Float']['output']>;
   deviceId: Scalars['String']['output'];
+  dewPoint: Maybe<Scalars['Float']['output']>;
   hcho: Maybe<Scalars['Float']['output']>;
+  heatIndex: Maybe<Scalars['Float']['output']>;
+  humidex: Maybe<Scalars['Float']['output']>;
   noxIndex: Maybe<Scalars['Float']['output']>;
   pm1: Maybe<Scalars['Float']['output']>;
   pm4: Maybe<Scalars['Float']['output']>;
   pm10: Maybe<Scalars['Float']['output']>;
   pm25: Maybe<Scalars['Float']['output']>;
+  raw: RawValues;
   rh: Maybe<Scalars['Float']['output']>;
   temp: Maybe<Scalars['Float']['output']>;
   timestamp: Scalars['DateTime']['output'];
   uploadTimestamp: Scalars['DateTime']['output'];
   vocIndex: Maybe<Scalars['Float']['output']>;
+  vpd: Maybe<Scalars['Float']['output']>;
+};
+
+
+export type MeasurementCo2Args = {
+  unit?: InputMaybe<Unit>;
+};
+
+
+export type MeasurementDewPointArgs = {
+  unit?: InputMaybe<Unit>;
+};
+
+
+export type MeasurementHchoArgs = {
+  unit?: InputMaybe<Unit>;
+};
+
+
+export type MeasurementHeatIndexArgs = {
+  unit?: InputMaybe<Unit>;
+};
+
+
+export type MeasurementTempArgs = {
+  unit?: InputMaybe<Unit>;
+};
+
+export type MeasurementConnection = {
+  __typename: 'MeasurementConnection';
+  edges: Array<MeasurementEdge>;
+  pageInfo: PageInfo;
+};
+
+export type MeasurementEdge = {
+  __typename: 'MeasurementEdge';
+  cursor: Scalars['String']['output'];
+  node: Measurement;
+};
+
+export type Metric = {
+  __typename: 'Metric';
+  derived: Scalars['Boolean']['output'];
+  key: Scalars['String']['output'];
+  name: Scalars['String']['output'];
+  unit: Scalars['String']['output'];
+  units: Array<Unit>;
+};
+
+export type Mutation = {
+  __typename: 'Mutation';
+  createAlertRule: AlertRule;
+  createApiToken: NewApiToken;
+  createCalibrationProfile: CalibrationProfile;
+  createDevicePushToken: Scalars['String']['output'];
+  createRoutingRule: RoutingRule;
+  deleteAlertRule: Scalars['Boolean']['output'];
+  deleteApiToken: Scalars['Boolean']['output'];
+  deleteCalibrationProfile: Scalars['Boolean']['output'];
+  deleteDevice: Scalars['Boolean']['output'];
+  deleteDevicePushToken: Scalars['Boolean']['output'];
+  deleteRoutingRule: Scalars['Boolean']['output'];
+  registerDevice: Device;
+  syncDevicesFromAWS: Array<Device>;
+  updateAlertRule: AlertRule;
+  updateCalibrationProfile: CalibrationProfile;
+  updateDevice: Device;
+  updateRoutingRule: RoutingRule;
+};
+
+
+export type MutationCreateAlertRuleArgs = {
+  input: AlertRuleInput;
+};
+
+
+export type MutationCreateApiTokenArgs = {
+  name: Scalars['String']['input'];
+};
+
+
+export type MutationCreateCalibrationProfileArgs = {
+  input: CalibrationProfileInput;
+};
+
+
+export type MutationCreateDevicePushTokenArgs = {
+  id: Scalars['ID']['input'];
+};
+
+
+export type MutationCreateRoutingRuleArgs = {
+  input: RoutingRuleInput;
+};
+
+
+export type MutationDeleteAlertRuleArgs = {
+  id: Scalars['ID']['input'];
+};
+
+
+export type MutationDeleteApiTokenArgs = {
+  id: Scalars['ID']['input'];
+};
+
+
+export type MutationDeleteCalibrationProfileArgs = {
+  id: Scalars['ID']['input'];
+};
+
+
+export type MutationDeleteDeviceArgs = {
+  id: Scalars['ID']['input'];
+};
+
+
+export type MutationDeleteDevicePushTokenArgs = {
+  id: Scalars['ID']['input'];
+};
+
+
+export type MutationDeleteRoutingRuleArgs = {
+  id: Scalars['ID']['input'];
+};
+
+
+export type MutationRegisterDeviceArgs = {
+  input: DeviceInput;
+};
+
+
+export type MutationUpdateAlertRuleArgs = {
+  id: Scalars['ID']['input'];
+  input: AlertRuleInput;
+};
+
+
+export type MutationUpdateCalibrationProfileArgs = {
+  id: Scalars['ID']['input'];
+  input: CalibrationProfileInput;
+};
+
+
+export type MutationUpdateDeviceArgs = {
+  id: Scalars['ID']['input'];
+  input: DeviceInput;
+};
+
+
+export type MutationUpdateRoutingRuleArgs = {
+  id: Scalars['ID']['input'];
+  input: RoutingRuleInput;
+};
+
+export type NewApiToken = {
+  __typename: 'NewApiToken';
+  apiToken: ApiToken;
+  token: Scalars['String']['output'];
+};
+
+export type PageInfo = {
+  __typename: 'PageInfo';
+  endCursor: Maybe<Scalars['String']['output']>;
+  hasNextPage: Scalars['Boolean']['output'];
+  hasPreviousPage: Scalars['Boolean']['output'];
+  startCursor: Maybe<Scalars['String']['output']>;
 };
 
 export type Query = {
   __typename: 'Query';
+  alertRules: Array<AlertRule>;
+  alerts: Array<Alert>;
+  aqiStandards: Array<AqiStandard>;
+  calibrationProfiles: Array<CalibrationProfile>;
+  device: Maybe<Device>;
+  devices: Array<Device>;
   latest: Array<Measurement>;
   measurements: Array<Measurement>;
+  measurementsConnection: MeasurementConnection;
+  metrics: Array<Metric>;
+  rollups: Array<Rollup>;
+  routingRules: Array<RoutingRule>;
+  viewer: Maybe<Viewer>;
+};
+
+
+export type QueryAlertsArgs = {
+  status?: InputMaybe<AlertStatus>;
+};
+
+
+export type QueryCalibrationProfilesArgs = {
+  deviceId?: InputMaybe<Scalars['String']['input']>;
+};
+
+
+export type QueryDeviceArgs = {
+  id: Scalars['ID']['input'];
+};
+
+
+export type QueryDevicesArgs = {
+  location?: InputMaybe<Scalars['String']['input']>;
+  owner?: InputMaybe<Scalars['String']['input']>;
+  tag?: InputMaybe<Scalars['String']['input']>;
+};
+
+
+export type QueryLatestArgs = {
+  aqiStandard?: InputMaybe<Scalars['String']['input']>;
 };
 
 
 export type QueryMeasurementsArgs = {
+  aqiStandard?: InputMaybe<Scalars['String']['input']>;
+  deviceIds?: InputMaybe<Array<Scalars['String']['input']>>;
   endTime?: InputMaybe<Scalars['DateTime']['input']>;
+  limit?: InputMaybe<Scalars['Int']['input']>;
+  metrics?: InputMaybe<Array<Scalars['String']['input']>>;
   startTime: Scalars['DateTime']['input'];
 };
 
-export type MeasurementFieldsFragment = { __typename: 'Measurement', deviceId: string, timestamp: string, uploadTimestamp: string, temp: number | null, pm1: number | null, pm25: number | null, pm4: number | null, pm10: number | null, aqi: number | null, rh: number | null, co2: number | null, vocIndex: number | null, noxIndex: number | null, hcho: number | null };
+
+export type QueryMeasurementsConnectionArgs = {
+  after?: InputMaybe<Scalars['String']['input']>;
+  aqiStandard?: InputMaybe<Scalars['String']['input']>;
+  deviceIds?: InputMaybe<Array<Scalars['String']['input']>>;
+  endTime?: InputMaybe<Scalars['DateTime']['input']>;
+  first?: InputMaybe<Scalars['Int']['input']>;
+  metrics?: InputMaybe<Array<Scalars['String']['input']>>;
+  startTime: Scalars['DateTime']['input'];
+};
+
+
+export type QueryRollupsArgs = {
+  endTime?: InputMaybe<Scalars['DateTime']['input']>;
+  resolution: Resolution;
+  startTime: Scalars['DateTime']['input'];
+};
+
+export type RawValues = {
+  __typename: 'RawValues';
+  co2: Maybe<Scalars['Float']['output']>;
+  hcho: Maybe<Scalars['Float']['output']>;
+  noxIndex: Maybe<Scalars['Float']['output']>;
+  pm1: Maybe<Scalars['Float']['output']>;
+  pm4: Maybe<Scalars['Float']['output']>;
+  pm10: Maybe<Scalars['Float']['output']>;
+  pm25: Maybe<Scalars['Float']['output']>;
+  rh: Maybe<Scalars['Float']['output']>;
+  temp: Maybe<Scalars['Float']['output']>;
+  vocIndex: Maybe<Scalars['Float']['output']>;
+};
+
+
+export type RawValuesCo2Args = {
+  unit?: InputMaybe<Unit>;
+};
+
+
+export type RawValuesHchoArgs = {
+  unit?: InputMaybe<Unit>;
+};
+
+
+export type RawValuesTempArgs = {
+  unit?: InputMaybe<Unit>;
+};
+
+export enum Resolution {
+  Daily = 'DAILY',
+  Hourly = 'HOURLY'
+}
+
+export type Rollup = {
+  __typename: 'Rollup';
+  count: Scalars['Int']['output'];
+  deviceId: Scalars['String']['output'];
+  max: Scalars['Float']['output'];
+  mean: Scalars['Float']['output'];
+  metric: Scalars['String']['output'];
+  min: Scalars['Float']['output'];
+  resolution: Resolution;
+  startTime: Scalars['DateTime']['output'];
+};
+
+export enum RoutingAction {
+  Drop = 'DROP',
+  Rename = 'RENAME',
+  Route = 'ROUTE',
+  Tag = 'TAG'
+}
+
+export type RoutingRule = {
+  __typename: 'RoutingRule';
+  action: RoutingAction;
+  devicePattern: Maybe<Scalars['String']['output']>;
+  enabled: Scalars['Boolean']['output'];
+  id: Scalars['ID']['output'];
+  metric: Maybe<Scalars['String']['output']>;
+  name: Scalars['String']['output'];
+  op: Maybe<Scalars['String']['output']>;
+  priority: Scalars['Int']['output'];
+  renameTo: Maybe<Scalars['String']['output']>;
+  sinks: Array<Scalars['String']['output']>;
+  source: Maybe<Scalars['String']['output']>;
+  tags: Array<Scalars['String']['output']>;
+  threshold: Maybe<Scalars['Float']['output']>;
+};
+
+export type RoutingRuleInput = {
+  action: RoutingAction;
+  devicePattern?: InputMaybe<Scalars['String']['input']>;
+  enabled?: InputMaybe<Scalars['Boolean']['input']>;
+  metric?: InputMaybe<Scalars['String']['input']>;
+  name: Scalars['String']['input'];
+  op?: InputMaybe<Scalars['String']['input']>;
+  priority?: InputMaybe<Scalars['Int']['input']>;
+  renameTo?: InputMaybe<Scalars['String']['input']>;
+  sinks?: InputMaybe<Array<Scalars['String']['input']>>;
+  source?: InputMaybe<Scalars['String']['input']>;
+  tags?: InputMaybe<Array<Scalars['String']['input']>>;
+  threshold?: InputMaybe<Scalars['Float']['input']>;
+};
+
+export type Subscription = {
+  __typename: 'Subscription';
+  measurementAdded: Measurement;
+};
+
+
+export type SubscriptionMeasurementAddedArgs = {
+  aqiStandard?: InputMaybe<Scalars['String']['input']>;
+  deviceIds?: InputMaybe<Array<Scalars['String']['input']>>;
+};
+
+export enum Unit {
+  Celsius = 'CELSIUS',
+  Fahrenheit = 'FAHRENHEIT',
+  Kelvin = 'KELVIN',
+  MgPerM3 = 'MG_PER_M3',
+  Ppb = 'PPB',
+  Ppm = 'PPM',
+  UgPerM3 = 'UG_PER_M3'
+}
+
+export type Uptime = {
+  __typename: 'Uptime';
+  percent: Maybe<Scalars['Float']['output']>;
+  window: Scalars['String']['output'];
+};
+
+export type Viewer = {
+  __typename: 'Viewer';
+  admin: Scalars['Boolean']['output'];
+  apiTokens: Array<ApiToken>;
+  email: Maybe<Scalars['String']['output']>;
+  id: Scalars['ID']['output'];
+  name: Maybe<Scalars['String']['output']>;
+};
+
+export enum Visibility {
+  Hidden = 'HIDDEN',
+  Private = 'PRIVATE',
+  Public = 'PUBLIC'
+}
+
+export type MeasurementFieldsFragment = { __typename: 'Measurement', deviceId: string, timestamp: string, uploadTimestamp: string, temp: number | null, pm1: number | null, pm25: number | null, pm4: number | null, pm10: number | null, aqi: number | null, aqiCategory: { __typename: 'AQICategory', name: string, abbrv: string, color: string } | null, rh: number | null, co2: number | null, vocIndex: number | null, noxIndex: number | null, hcho: number | null };
 
 export type GetMeasurementsQueryVariables = Exact<{
   startTime: Scalars['DateTime']['input'];
@@ -53,9 +579,9 @@ export type GetMeasurementsQueryVariables = Exact<{
 }>;
 
 
-export type GetMeasurementsQuery = { measurements: Array<{ __typename: 'Measurement', deviceId: string, timestamp: string, uploadTimestamp: string, temp: number | null, pm1: number | null, pm25: number | null, pm4: number | null, pm10: number | null, aqi: number | null, rh: number | null, co2: number | null, vocIndex: number | null, noxIndex: number | null, hcho: number | null }> };
+export type GetMeasurementsQuery = { measurements: Array<{ __typename: 'Measurement', deviceId: string, timestamp: string, uploadTimestamp: string, temp: number | null, pm1: number | null, pm25: number | null, pm4: number | null, pm10: number | null, aqi: number | null, aqiCategory: { __typename: 'AQICategory', name: string, abbrv: string, color: string } | null, rh: number | null, co2: number | null, vocIndex: number | null, noxIndex: number | null, hcho: number | null }> };
 
 export type LatestQueryVariables = Exact<{ [key: string]: never; }>;
 
 
-export type LatestQuery = { latest: Array<{ __typename: 'Measurement', deviceId: string, timestamp: string, uploadTimestamp: string, temp: number | null, pm1: number | null, pm25: number | null, pm4: number | null, pm10: number | null, aqi: number | null, rh: number | null, co2: number | null, vocIndex: number | null, noxIndex: number | null, hcho: number | null }> };
+export type LatestQuery = { latest: Array<{ __typename: 'Measurement', deviceId: string, timestamp: string, uploadTimestamp: string, temp: number | null, pm1: number | null, pm25: number | null, pm4: number | null, pm10: number | null, aqi: number | null, aqiCategory: { __typename: 'AQICategory', name: string, abbrv: string, color: string } | null, rh: number | null, co2: number | null, vocIndex: number | null, noxIndex: number | null, hcho: number | null }> };
@@ -3,6 +3,7 @@ package main
 
 import (
 	"context"
+	"crypto/x509"
 	"flag"
 	"fmt"
 	"log"
@@ -10,77 +11,68 @@ import (
 	"os"
 
 	"cloud.google.com/go/compute/metadata"
-	"github.com/mtraver/environmental-sensor/device"
-	"github.com/mtraver/environmental-sensor/measurement"
+	"cloud.google.com/go/pubsub/v2"
+	"github.com/mtraver/environmental-sensor/alert"
+	"github.com/mtraver/environmental-sensor/apiauth"
+	"github.com/mtraver/environmental-sensor/broker"
+	"github.com/mtraver/environmental-sensor/ingest"
 	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/routing"
+	"github.com/mtraver/environmental-sensor/util"
 	"github.com/mtraver/environmental-sensor/web/db"
 	"github.com/mtraver/envtools"
 	"google.golang.org/grpc"
-	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/grpc/credentials"
 )
 
 const (
 	datastoreKind = "measurement"
 
-	// awsRoleARNEnvVar is the name of the env var that should contain the ARN of the
-	// AWS role that we'll assume and use to authenticate with AWS IoT to fetch the
-	// list of devices.
-	awsRoleARNEnvVar = "AWS_ROLE_ARN"
+	// liveMeasurementsTopicEnvVar is the name of the env var that may contain the ID of the
+	// Pub/Sub topic that the web app relays live measurements on. If it's not set then
+	// StreamMeasurements is unavailable.
+	liveMeasurementsTopicEnvVar = "LIVE_MEASUREMENTS_TOPIC"
 
-	awsRegionEnvVar = "AWS_REGION"
+	// The names of the env vars that configure ingestion, which match those of the web app.
+	// ALERT_CHANNELS is a comma-separated list, and measurements are only saved to InfluxDB if
+	// INFLUXDB_SERVER is set.
+	alertChannelsEnvVar  = "ALERT_CHANNELS"
+	influxDBServerEnvVar = "INFLUXDB_SERVER"
 )
 
 var (
 	port int
-)
-
-type Database interface {
-	Latest(ctx context.Context, deviceIDs []string) (map[string]measurement.StorableMeasurement, error)
-}
-
-type apiServer struct {
-	mpb.UnimplementedMeasurementServiceServer
-	projectID  string
-	awsRoleARN string
-	awsRegion  string
-	database   Database
-}
-
-func (s *apiServer) GetDevices(ctx context.Context, in *emptypb.Empty) (*mpb.GetDevicesResponse, error) {
-	deviceIDs, err := device.GetDeviceIDsAWS(ctx, s.awsRoleARN, s.awsRegion)
-	if err != nil {
-		return nil, err
-	}
-
-	return &mpb.GetDevicesResponse{
-		DeviceId: deviceIDs,
-	}, nil
-}
 
-func (s *apiServer) GetLatest(ctx context.Context, r *mpb.GetLatestRequest) (*mpb.Measurement, error) {
-	latest, err := s.database.Latest(ctx, []string{r.GetDeviceId()})
-	if err != nil {
-		return nil, err
-	}
-
-	sm, ok := latest[r.GetDeviceId()]
-	if !ok {
-		return nil, fmt.Errorf("api: device ID %q not found", r.GetDeviceId())
-	}
-
-	m, err := measurement.NewMeasurement(&sm)
-	if err != nil {
-		return nil, err
-	}
-
-	return m, nil
-}
+	tlsCert     string
+	tlsKey      string
+	clientCA    string
+	deviceCA    string
+	oidcIssuer  string
+	oidcAud     string
+	oidcAllowed string
+	rateLimit   float64
+	rateBurst   int
+)
 
 func init() {
 	flag.IntVar(&port, "p", 9090, "port on which the gRPC server will listen")
+	flag.StringVar(&tlsCert, "tls-cert", "", "PEM certificate file; if set with -tls-key, the server uses TLS")
+	flag.StringVar(&tlsKey, "tls-key", "", "PEM private key file for -tls-cert")
+	flag.StringVar(&clientCA, "client-ca", "", "PEM file of CAs that must have signed client certificates (mutual TLS); requires -tls-cert")
+	flag.StringVar(&deviceCA, "device-ca", "", "PEM file of CAs that sign device certificates; devices that present one may call Ingest (default Ingest is unavailable); requires -tls-cert")
+	flag.StringVar(&oidcIssuer, "oidc-issuer", "", "issuer of accepted OIDC ID tokens, e.g. https://accounts.google.com (default no ID tokens are accepted)")
+	flag.StringVar(&oidcAud, "oidc-audience", "", "audience that accepted ID tokens must be issued for")
+	flag.StringVar(&oidcAllowed, "oidc-allowed", "", "comma-separated subjects or verified emails of accepted ID tokens (default any)")
+	flag.Float64Var(&rateLimit, "rate-limit", 10, "calls per second allowed per API key or ID token subject, unless the key sets its own; 0 means no limit")
+	flag.IntVar(&rateBurst, "rate-burst", 20, "number of calls allowed at once above the rate limit")
 
 	flag.Usage = func() {
-		message := `usage: api
+		message := `usage: api [options]
+
+Calls must present an API key in the x-api-key metadata key or an OIDC ID token
+as a bearer token in the authorization metadata key. Manage API keys with the
+apikey tool. Devices instead present their X.509 certificate, whose Common Name
+is their device ID, and may only call Ingest.
 
 Options:
 `
@@ -104,27 +96,107 @@ func main() {
 		}
 	}
 
-	roleARN := os.Getenv(awsRoleARNEnvVar)
-	if roleARN == "" && onGCE {
-		log.Printf("On GCE and $%s is not set. Fetching devices will probably fail.", awsRoleARNEnvVar)
-	}
-
 	database, err := db.NewDatastoreDB(projectID, datastoreKind)
 	if err != nil {
 		log.Fatalf("Failed to make datastore DB: %v", err)
 	}
 
+	var liveBroker *broker.Broker
+	if topic := os.Getenv(liveMeasurementsTopicEnvVar); topic != "" {
+		ctx := context.Background()
+
+		client, err := pubsub.NewClient(ctx, projectID)
+		if err != nil {
+			log.Fatalf("Failed to make Pub/Sub client: %v", err)
+		}
+
+		// The subscription isn't deleted on exit. It expires on its own once it's unused.
+		fanout, err := broker.NewPubSubFanout(ctx, client, topic)
+		if err != nil {
+			log.Fatalf("Failed to make live measurement fan-out: %v", err)
+		}
+
+		liveBroker = broker.New(fanout)
+		go func() {
+			if err := liveBroker.Run(ctx); err != nil {
+				log.Printf("Live measurement fan-out stopped: %v", err)
+			}
+		}()
+		log.Printf("Streaming live measurements from Pub/Sub topic %q", topic)
+	} else {
+		log.Printf("%s is not set, so StreamMeasurements is unavailable", liveMeasurementsTopicEnvVar)
+	}
+
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		log.Fatalf("Failed to listen: %v", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	if oidcIssuer != "" && oidcAud == "" {
+		log.Fatalf("-oidc-audience is required with -oidc-issuer")
+	}
+	var verifier *apiauth.OIDCVerifier
+	if oidcIssuer != "" {
+		verifier = apiauth.NewOIDCVerifier(oidcIssuer, oidcAud, util.SplitList(oidcAllowed))
+		log.Printf("Accepting ID tokens issued by %s for %s", oidcIssuer, oidcAud)
+	}
+
+	var deviceCAs *x509.CertPool
+	var pipeline *ingest.Pipeline
+	if deviceCA != "" {
+		deviceCAs, err = apiauth.LoadCertPool(deviceCA)
+		if err != nil {
+			log.Fatalf("Failed to load device CAs: %v", err)
+		}
+
+		channels, err := alert.ParseChannels(os.Getenv(alertChannelsEnvVar))
+		if err != nil {
+			log.Fatalf("Failed to parse $%s: %v", alertChannelsEnvVar, err)
+		}
+
+		pipeline = &ingest.Pipeline{
+			Database:  database,
+			Dedupe:    database,
+			Broker:    liveBroker,
+			Alerts:    alert.NewEvaluator(database, database, database, channels, alert.DefaultCacheTTL),
+			Router:    routing.NewRouter(database, routing.DefaultCacheTTL),
+			MaxAge:    ingest.DefaultMaxAge,
+			MaxFuture: ingest.DefaultMaxFuture,
+		}
+		if server := os.Getenv(influxDBServerEnvVar); server != "" {
+			pipeline.InfluxDB = db.NewInfluxDB(server, envtools.MustGetenv("INFLUXDB_TOKEN"), envtools.MustGetenv("INFLUXDB_ORG"), envtools.MustGetenv("INFLUXDB_BUCKET"))
+		}
+		log.Printf("Devices may ingest measurements")
+	}
+
+	auth := apiauth.NewAuthenticator(database, verifier, deviceCAs, rateLimit, rateBurst)
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(auth.UnaryInterceptor()),
+		grpc.ChainStreamInterceptor(auth.StreamInterceptor()),
+	}
+
+	if tlsCert != "" || tlsKey != "" {
+		config, err := apiauth.ServerTLSConfig(tlsCert, tlsKey, clientCA, deviceCA)
+		if err != nil {
+			log.Fatalf("Failed to load TLS config: %v", err)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(config)))
+
+		if clientCA != "" {
+			log.Printf("Using mutual TLS")
+		} else {
+			log.Printf("Using TLS")
+		}
+	} else if clientCA != "" || deviceCA != "" {
+		log.Fatalf("-client-ca and -device-ca require -tls-cert and -tls-key")
+	}
+
+	grpcServer := grpc.NewServer(opts...)
 	mpb.RegisterMeasurementServiceServer(grpcServer, &apiServer{
-		projectID:  projectID,
-		awsRoleARN: roleARN,
-		awsRegion:  envtools.MustGetenv(awsRegionEnvVar),
-		database:   database,
+		projectID: projectID,
+		database:  database,
+		broker:    liveBroker,
+		ingest:    pipeline,
 	})
 
 	log.Printf("gRPC server listening on port %d", port)
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/apiauth"
+	"github.com/mtraver/environmental-sensor/broker"
+	"github.com/mtraver/environmental-sensor/database"
+	"github.com/mtraver/environmental-sensor/device"
+	"github.com/mtraver/environmental-sensor/ingest"
+	"github.com/mtraver/environmental-sensor/measurement"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/metric"
+	"github.com/mtraver/environmental-sensor/rollup"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	tspb "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+type Database interface {
+	Devices(ctx context.Context) ([]device.Device, error)
+	Latest(ctx context.Context, deviceIDs []string) (map[string]measurement.StorableMeasurement, error)
+	Query(ctx context.Context, q database.Query) (database.Page, error)
+	Rollups(ctx context.Context, res rollup.Resolution, deviceIDs []string, startTime time.Time, endTime time.Time) (map[string][]rollup.Bucket, error)
+}
+
+type apiServer struct {
+	mpb.UnimplementedMeasurementServiceServer
+	projectID string
+	database  Database
+
+	// broker delivers live measurements for StreamMeasurements. If it's nil then
+	// StreamMeasurements is unavailable.
+	broker *broker.Broker
+
+	// ingest saves measurements for Ingest. If it's nil then Ingest is unavailable.
+	ingest *ingest.Pipeline
+}
+
+func (s *apiServer) GetDevices(ctx context.Context, in *emptypb.Empty) (*mpb.GetDevicesResponse, error) {
+	deviceIDs, err := s.deviceIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Callers that may only read some devices only see those devices.
+	if p, ok := apiauth.FromContext(ctx); ok {
+		deviceIDs = slices.DeleteFunc(deviceIDs, func(id string) bool {
+			return !p.CanAccess(id)
+		})
+	}
+
+	return &mpb.GetDevicesResponse{
+		DeviceId: deviceIDs,
+	}, nil
+}
+
+func (s *apiServer) deviceIDs(ctx context.Context) ([]string, error) {
+	devices, err := s.database.Devices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceIDs := make([]string, len(devices))
+	for i, d := range devices {
+		deviceIDs[i] = d.DeviceID
+	}
+	return deviceIDs, nil
+}
+
+func (s *apiServer) GetLatest(ctx context.Context, r *mpb.GetLatestRequest) (*mpb.Measurement, error) {
+	latest, err := s.database.Latest(ctx, []string{r.GetDeviceId()})
+	if err != nil {
+		return nil, err
+	}
+
+	sm, ok := latest[r.GetDeviceId()]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "api: device ID %q not found", r.GetDeviceId())
+	}
+
+	m, err := measurement.NewMeasurement(&sm)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (s *apiServer) BatchGetLatest(ctx context.Context, r *mpb.BatchGetLatestRequest) (*mpb.BatchGetLatestResponse, error) {
+	deviceIDs := r.GetDeviceId()
+	if len(deviceIDs) == 0 {
+		var err error
+		deviceIDs, err = s.deviceIDs(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	latest, err := s.database.Latest(ctx, deviceIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &mpb.BatchGetLatestResponse{
+		Measurements: make(map[string]*mpb.Measurement, len(latest)),
+	}
+	for id, sm := range latest {
+		m, err := measurement.NewMeasurement(&sm)
+		if err != nil {
+			return nil, err
+		}
+		resp.Measurements[id] = m
+	}
+
+	return resp, nil
+}
+
+// parseMetrics converts metric keys given in a request. Only metrics that are stored, not
+// derived, can be selected.
+func parseMetrics(keys []string) ([]metric.Key, error) {
+	stored := (measurement.StorableMeasurement{}).ValueMap()
+
+	metrics := make([]metric.Key, len(keys))
+	for i, k := range keys {
+		if _, ok := stored[metric.Key(k)]; !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "api: unknown metric %q", k)
+		}
+		metrics[i] = metric.Key(k)
+	}
+	return metrics, nil
+}
+
+// parseTimeRange converts the start and end times given in a request. start is required. If end
+// isn't given then defaultEnd is returned.
+func parseTimeRange(start, end *tspb.Timestamp, defaultEnd time.Time) (time.Time, time.Time, error) {
+	if start == nil {
+		return time.Time{}, time.Time{}, status.Error(codes.InvalidArgument, "api: start_time is required")
+	}
+	if err := start.CheckValid(); err != nil {
+		return time.Time{}, time.Time{}, status.Errorf(codes.InvalidArgument, "api: bad start_time: %v", err)
+	}
+
+	endTime := defaultEnd
+	if end != nil {
+		if err := end.CheckValid(); err != nil {
+			return time.Time{}, time.Time{}, status.Errorf(codes.InvalidArgument, "api: bad end_time: %v", err)
+		}
+		endTime = end.AsTime()
+
+		if endTime.Before(start.AsTime()) {
+			return time.Time{}, time.Time{}, status.Error(codes.InvalidArgument, "api: end_time is before start_time")
+		}
+	}
+
+	return start.AsTime(), endTime, nil
+}
+
+func (s *apiServer) ListMeasurements(ctx context.Context, r *mpb.ListMeasurementsRequest) (*mpb.ListMeasurementsResponse, error) {
+	start, end, err := parseTimeRange(r.GetStartTime(), r.GetEndTime(), time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	metrics, err := parseMetrics(r.GetMetric())
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := int(r.GetPageSize())
+	switch {
+	case pageSize < 0:
+		return nil, status.Error(codes.InvalidArgument, "api: page_size must not be negative")
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+
+	page, err := s.database.Query(ctx, database.Query{
+		StartTime: start,
+		EndTime:   end,
+		DeviceIDs: r.GetDeviceId(),
+		Metrics:   metrics,
+		Limit:     pageSize,
+		Cursor:    r.GetPageToken(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &mpb.ListMeasurementsResponse{
+		Measurements: make([]*mpb.Measurement, len(page.Measurements)),
+	}
+	for i := range page.Measurements {
+		resp.Measurements[i], err = measurement.NewMeasurement(&page.Measurements[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if page.HasNextPage {
+		resp.NextPageToken = page.EndCursor()
+	}
+
+	return resp, nil
+}
+
+func (s *apiServer) StreamMeasurements(r *mpb.StreamMeasurementsRequest, stream mpb.MeasurementService_StreamMeasurementsServer) error {
+	if s.broker == nil {
+		return status.Error(codes.Unavailable, "api: live measurements are not available")
+	}
+
+	metrics, err := parseMetrics(r.GetMetric())
+	if err != nil {
+		return err
+	}
+	q := database.Query{DeviceIDs: r.GetDeviceId(), Metrics: metrics}
+
+	ctx := stream.Context()
+	for m := range s.broker.Subscribe(ctx, r.GetDeviceId()) {
+		sm, err := measurement.NewStorableMeasurement(m)
+		if err != nil || !q.Match(&sm) {
+			continue
+		}
+
+		// Delivered measurements are shared between subscribers, so send a copy that only has
+		// the selected metrics.
+		filtered, err := measurement.NewMeasurement(&sm)
+		if err != nil {
+			continue
+		}
+		if err := stream.Send(filtered); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+func resolutionFromProto(r mpb.Resolution) (rollup.Resolution, error) {
+	switch r {
+	case mpb.Resolution_HOURLY:
+		return rollup.Hourly, nil
+	case mpb.Resolution_DAILY:
+		return rollup.Daily, nil
+	default:
+		return "", status.Errorf(codes.InvalidArgument, "api: unsupported resolution %v", r)
+	}
+}
+
+func bucketToProto(b rollup.Bucket, res mpb.Resolution) *mpb.Rollup {
+	return &mpb.Rollup{
+		DeviceId:   b.DeviceID,
+		Metric:     string(b.Metric),
+		Resolution: res,
+		StartTime:  tspb.New(b.Start),
+		Min:        b.Min,
+		Max:        b.Max,
+		Mean:       b.Mean(),
+		Count:      b.Count,
+	}
+}
+
+func (s *apiServer) Aggregate(ctx context.Context, r *mpb.AggregateRequest) (*mpb.AggregateResponse, error) {
+	res, err := resolutionFromProto(r.GetResolution())
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, err := parseTimeRange(r.GetStartTime(), r.GetEndTime(), time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	metrics, err := parseMetrics(r.GetMetric())
+	if err != nil {
+		return nil, err
+	}
+
+	deviceIDs := r.GetDeviceId()
+	buckets, err := s.database.Rollups(ctx, res, deviceIDs, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(deviceIDs) == 0 {
+		for id := range buckets {
+			deviceIDs = append(deviceIDs, id)
+		}
+	}
+	slices.Sort(deviceIDs)
+
+	resp := &mpb.AggregateResponse{}
+	for _, id := range slices.Compact(deviceIDs) {
+		bs := slices.Clone(buckets[id])
+		bs = slices.DeleteFunc(bs, func(b rollup.Bucket) bool {
+			return len(metrics) > 0 && !slices.Contains(metrics, b.Metric)
+		})
+		slices.SortFunc(bs, func(a, b rollup.Bucket) int {
+			if c := strings.Compare(string(a.Metric), string(b.Metric)); c != 0 {
+				return c
+			}
+			return a.Start.Compare(b.Start)
+		})
+
+		for _, b := range bs {
+			resp.Rollups = append(resp.Rollups, bucketToProto(b, r.GetResolution()))
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *apiServer) Ingest(stream mpb.MeasurementService_IngestServer) error {
+	if s.ingest == nil {
+		return status.Error(codes.Unavailable, "api: ingestion is not available")
+	}
+
+	ctx := stream.Context()
+	p, _ := apiauth.FromContext(ctx)
+	if p.Device == "" {
+		return status.Error(codes.PermissionDenied, "api: only devices authenticated by certificate may ingest measurements")
+	}
+
+	resp := &mpb.IngestResponse{}
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(resp)
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, m := range req.GetMeasurements() {
+			if m.GetDeviceId() != p.Device {
+				return status.Errorf(codes.PermissionDenied, "api: %s may not ingest measurements from device %q", p.Name, m.GetDeviceId())
+			}
+
+			switch err := s.ingest.Ingest(ctx, m); {
+			case errors.Is(err, ingest.ErrInvalid):
+				resp.Rejected++
+				resp.Errors = append(resp.Errors, err.Error())
+			case err != nil && !errors.Is(err, ingest.ErrIgnored) && !errors.Is(err, ingest.ErrDuplicate):
+				// Measurements that were accepted before this one are saved, and saving
+				// them again is harmless, so the device can retry the whole stream.
+				return status.Errorf(codes.Unavailable, "api: %v", err)
+			default:
+				resp.Accepted++
+			}
+		}
+	}
+}
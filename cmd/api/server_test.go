@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mtraver/environmental-sensor/apiauth"
+	"github.com/mtraver/environmental-sensor/broker"
+	"github.com/mtraver/environmental-sensor/database"
+	"github.com/mtraver/environmental-sensor/device"
+	"github.com/mtraver/environmental-sensor/ingest"
+	"github.com/mtraver/environmental-sensor/measurement"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/routing"
+	"github.com/mtraver/environmental-sensor/testutil"
+	"github.com/mtraver/environmental-sensor/web/db"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/emptypb"
+	tspb "google.golang.org/protobuf/types/known/timestamppb"
+	wpb "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func at(d time.Duration) *tspb.Timestamp {
+	return tspb.New(testutil.Timestamp.Add(d))
+}
+
+// newDatabase returns an in-memory database holding ms, with their devices registered.
+func newDatabase(t *testing.T, ms ...*mpb.Measurement) *db.MemoryDB {
+	t.Helper()
+	ctx := context.Background()
+
+	database := db.NewMemoryDB()
+	registered := make(map[string]bool)
+	for _, m := range ms {
+		if err := database.Save(ctx, m); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if !registered[m.GetDeviceId()] {
+			if _, err := database.PutDevice(ctx, device.Device{DeviceID: m.GetDeviceId()}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			registered[m.GetDeviceId()] = true
+		}
+	}
+
+	return database
+}
+
+// serve starts a gRPC server for srv and returns a client of it.
+func serve(t *testing.T, srv *apiServer, opts ...grpc.ServerOption) mpb.MeasurementServiceClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(opts...)
+	mpb.RegisterMeasurementServiceServer(server, srv)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return mpb.NewMeasurementServiceClient(conn)
+}
+
+// newClient starts a server backed by an in-memory database holding ms and returns a client
+// of it.
+func newClient(t *testing.T, b *broker.Broker, ms ...*mpb.Measurement) mpb.MeasurementServiceClient {
+	t.Helper()
+	return serve(t, &apiServer{database: newDatabase(t, ms...), broker: b})
+}
+
+var (
+	foo0 = &mpb.Measurement{DeviceId: "foo", Timestamp: at(0), Temp: wpb.Float(20), Rh: wpb.Float(50)}
+	foo1 = &mpb.Measurement{DeviceId: "foo", Timestamp: at(time.Minute), Temp: wpb.Float(22), Rh: wpb.Float(52)}
+	foo2 = &mpb.Measurement{DeviceId: "foo", Timestamp: at(2 * time.Hour), Temp: wpb.Float(24)}
+	bar0 = &mpb.Measurement{DeviceId: "bar", Timestamp: at(time.Minute), Pm25: wpb.Float(5)}
+)
+
+func TestGetLatestNotFound(t *testing.T) {
+	client := newClient(t, nil, foo0)
+
+	_, err := client.GetLatest(context.Background(), &mpb.GetLatestRequest{DeviceId: "baz"})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("Got code %v, expected %v (error: %v)", got, codes.NotFound, err)
+	}
+}
+
+func TestBatchGetLatest(t *testing.T) {
+	client := newClient(t, nil, foo0, foo1, bar0)
+
+	cases := []struct {
+		name      string
+		deviceIDs []string
+		want      map[string]*mpb.Measurement
+	}{
+		{"all", nil, map[string]*mpb.Measurement{"foo": foo1, "bar": bar0}},
+		{"some", []string{"foo", "baz"}, map[string]*mpb.Measurement{"foo": foo1}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp, err := client.BatchGetLatest(context.Background(), &mpb.BatchGetLatestRequest{DeviceId: c.deviceIDs})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff(c.want, resp.GetMeasurements(), protocmp.Transform()); diff != "" {
+				t.Errorf("Unexpected measurements (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestListMeasurements(t *testing.T) {
+	client := newClient(t, nil, foo0, foo1, foo2, bar0)
+	ctx := context.Background()
+
+	req := &mpb.ListMeasurementsRequest{
+		DeviceId:  []string{"foo"},
+		Metric:    []string{"rh"},
+		StartTime: at(0),
+		PageSize:  1,
+	}
+
+	var got []*mpb.Measurement
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("Too many pages")
+		}
+
+		resp, err := client.ListMeasurements(ctx, req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		got = append(got, resp.GetMeasurements()...)
+
+		if resp.GetNextPageToken() == "" {
+			break
+		}
+		req.PageToken = resp.GetNextPageToken()
+	}
+
+	want := []*mpb.Measurement{
+		{DeviceId: "foo", Timestamp: foo0.Timestamp, Rh: foo0.Rh},
+		{DeviceId: "foo", Timestamp: foo1.Timestamp, Rh: foo1.Rh},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("Unexpected measurements (-want +got):\n%s", diff)
+	}
+}
+
+func TestListMeasurementsInvalid(t *testing.T) {
+	client := newClient(t, nil)
+
+	cases := []struct {
+		name string
+		req  *mpb.ListMeasurementsRequest
+	}{
+		{"no_start_time", &mpb.ListMeasurementsRequest{}},
+		{"end_before_start", &mpb.ListMeasurementsRequest{StartTime: at(time.Hour), EndTime: at(0)}},
+		{"unknown_metric", &mpb.ListMeasurementsRequest{StartTime: at(0), Metric: []string{"spam"}}},
+		{"negative_page_size", &mpb.ListMeasurementsRequest{StartTime: at(0), PageSize: -1}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := client.ListMeasurements(context.Background(), c.req)
+			if got := status.Code(err); got != codes.InvalidArgument {
+				t.Errorf("Got code %v, expected %v (error: %v)", got, codes.InvalidArgument, err)
+			}
+		})
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	client := newClient(t, nil, foo0, foo1, foo2, bar0)
+
+	resp, err := client.Aggregate(context.Background(), &mpb.AggregateRequest{
+		Resolution: mpb.Resolution_HOURLY,
+		StartTime:  at(0),
+		EndTime:    at(3 * time.Hour),
+		DeviceId:   []string{"foo"},
+		Metric:     []string{"temp"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []*mpb.Rollup{
+		{DeviceId: "foo", Metric: "temp", Resolution: mpb.Resolution_HOURLY, StartTime: at(0), Min: 20, Max: 22, Mean: 21, Count: 2},
+		{DeviceId: "foo", Metric: "temp", Resolution: mpb.Resolution_HOURLY, StartTime: at(2 * time.Hour), Min: 24, Max: 24, Mean: 24, Count: 1},
+	}
+	if diff := cmp.Diff(want, resp.GetRollups(), protocmp.Transform()); diff != "" {
+		t.Errorf("Unexpected rollups (-want +got):\n%s", diff)
+	}
+
+	_, err = client.Aggregate(context.Background(), &mpb.AggregateRequest{StartTime: at(0)})
+	if got := status.Code(err); got != codes.InvalidArgument {
+		t.Errorf("Got code %v for unspecified resolution, expected %v", got, codes.InvalidArgument)
+	}
+}
+
+func TestStreamMeasurements(t *testing.T) {
+	b := broker.New(nil)
+	client := newClient(t, b)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.StreamMeasurements(ctx, &mpb.StreamMeasurementsRequest{DeviceId: []string{"foo"}, Metric: []string{"temp"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The subscription is made when the server handles the call, which may be after
+	// StreamMeasurements returns, so publish until something arrives.
+	received := make(chan *mpb.Measurement)
+	go func() {
+		m, err := stream.Recv()
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		received <- m
+	}()
+
+	var got *mpb.Measurement
+	for got == nil {
+		b.Publish(ctx, bar0)
+		b.Publish(ctx, foo0)
+
+		select {
+		case got = <-received:
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for a measurement")
+		}
+	}
+
+	want := &mpb.Measurement{DeviceId: "foo", Timestamp: foo0.Timestamp, Temp: foo0.Temp}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("Unexpected measurement (-want +got):\n%s", diff)
+	}
+}
+
+func TestStreamMeasurementsUnavailable(t *testing.T) {
+	client := newClient(t, nil)
+
+	stream, err := client.StreamMeasurements(context.Background(), &mpb.StreamMeasurementsRequest{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = stream.Recv()
+	if got := status.Code(err); got != codes.Unavailable {
+		t.Errorf("Got code %v, expected %v (error: %v)", got, codes.Unavailable, err)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	database := newDatabase(t, foo0, foo1, bar0)
+
+	key, k, err := apiauth.NewKey("test", []string{"foo"}, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := database.PutAPIKey(context.Background(), k); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	auth := apiauth.NewAuthenticator(database, nil, nil, 0, 0)
+	client := serve(t, &apiServer{database: database},
+		grpc.UnaryInterceptor(auth.UnaryInterceptor()),
+		grpc.StreamInterceptor(auth.StreamInterceptor()))
+
+	if _, err := client.GetDevices(context.Background(), &emptypb.Empty{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Got error %v without a key, expected code %v", err, codes.Unauthenticated)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", key)
+
+	devices, err := client.GetDevices(ctx, &emptypb.Empty{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"foo"}, devices.GetDeviceId()); diff != "" {
+		t.Errorf("Unexpected devices (-want +got):\n%s", diff)
+	}
+
+	latest, err := client.BatchGetLatest(ctx, &mpb.BatchGetLatestRequest{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(map[string]*mpb.Measurement{"foo": foo1}, latest.GetMeasurements(), protocmp.Transform()); diff != "" {
+		t.Errorf("Unexpected measurements (-want +got):\n%s", diff)
+	}
+
+	if _, err := client.GetLatest(ctx, &mpb.GetLatestRequest{DeviceId: "bar"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Got error %v for another device, expected code %v", err, codes.PermissionDenied)
+	}
+}
+
+// principalStream is a server stream whose context carries a principal.
+type principalStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *principalStream) Context() context.Context {
+	return s.ctx
+}
+
+// asDevice returns a server option that makes every call appear to come from the given device,
+// as if it had authenticated with its certificate.
+func asDevice(deviceID string) grpc.ServerOption {
+	p := apiauth.Principal{ID: "device:" + deviceID, Name: "device " + deviceID, DeviceIDs: []string{deviceID}, Device: deviceID}
+	return grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &principalStream{ServerStream: ss, ctx: apiauth.NewContext(ss.Context(), p)})
+	})
+}
+
+func TestIngest(t *testing.T) {
+	upper := &mpb.Measurement{DeviceId: "FOO", Timestamp: at(0), Temp: wpb.Float(20)}
+
+	cases := []struct {
+		name     string
+		opts     []grpc.ServerOption
+		rules    []routing.Rule
+		batches  [][]*mpb.Measurement
+		want     *mpb.IngestResponse
+		wantCode codes.Code
+		wantSave []*mpb.Measurement
+	}{
+		{
+			name:     "device",
+			opts:     []grpc.ServerOption{asDevice("foo")},
+			batches:  [][]*mpb.Measurement{{foo0, foo1}, {foo2}},
+			want:     &mpb.IngestResponse{Accepted: 3},
+			wantSave: []*mpb.Measurement{foo0, foo1, foo2},
+		},
+		{
+			name:    "dropped",
+			opts:    []grpc.ServerOption{asDevice("foo")},
+			rules:   []routing.Rule{{Name: "foo", DevicePattern: "foo", Action: routing.Drop, Enabled: true}},
+			batches: [][]*mpb.Measurement{{foo0}},
+			want:    &mpb.IngestResponse{Accepted: 1},
+		},
+		{
+			name:    "invalid",
+			opts:    []grpc.ServerOption{asDevice("FOO")},
+			batches: [][]*mpb.Measurement{{upper}},
+			want:    &mpb.IngestResponse{Rejected: 1, Errors: []string{`ingest: invalid measurement: measurementpbutil: invalid measurement: device_id: "FOO" is not a valid device ID`}},
+		},
+		{
+			name:     "other_device",
+			opts:     []grpc.ServerOption{asDevice("foo")},
+			batches:  [][]*mpb.Measurement{{bar0}},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "not_device",
+			batches:  [][]*mpb.Measurement{{foo0}},
+			wantCode: codes.PermissionDenied,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			store := db.NewMemoryDB()
+			for _, r := range c.rules {
+				if _, err := store.PutRoutingRule(context.Background(), r); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			pipeline := &ingest.Pipeline{Database: store, Router: routing.NewRouter(store, 0)}
+			client := serve(t, &apiServer{database: store, ingest: pipeline}, c.opts...)
+
+			stream, err := client.Ingest(context.Background())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for _, b := range c.batches {
+				if err := stream.Send(&mpb.IngestRequest{Measurements: b}); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+
+			got, err := stream.CloseAndRecv()
+			if code := status.Code(err); code != c.wantCode {
+				t.Fatalf("Got code %v, expected %v (error: %v)", code, c.wantCode, err)
+			}
+			if diff := cmp.Diff(c.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("Unexpected response (-want +got):\n%s", diff)
+			}
+
+			page, err := store.Query(context.Background(), database.Query{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var saved []*mpb.Measurement
+			for _, sm := range page.Measurements {
+				m, err := measurement.NewMeasurement(&sm)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				saved = append(saved, m)
+			}
+			if diff := cmp.Diff(c.wantSave, saved, protocmp.Transform()); diff != "" {
+				t.Errorf("Unexpected saved measurements (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestIngestUnavailable(t *testing.T) {
+	client := serve(t, &apiServer{database: db.NewMemoryDB()}, asDevice("foo"))
+
+	stream, err := client.Ingest(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = stream.CloseAndRecv()
+	if got := status.Code(err); got != codes.Unavailable {
+		t.Errorf("Got code %v, expected %v (error: %v)", got, codes.Unavailable, err)
+	}
+}
@@ -9,15 +9,23 @@ import (
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/types/known/emptypb"
 
+	"github.com/mtraver/environmental-sensor/apiauth"
 	mpb "github.com/mtraver/environmental-sensor/measurementpb"
 )
 
 var (
 	key   string
 	token string
+
+	useTLS  bool
+	caFile  string
+	cert    string
+	certKey string
 )
 
 func devices(ctx context.Context, client mpb.MeasurementServiceClient) (*mpb.GetDevicesResponse, error) {
@@ -26,15 +34,19 @@ func devices(ctx context.Context, client mpb.MeasurementServiceClient) (*mpb.Get
 	return client.GetDevices(ctx, &emptypb.Empty{})
 }
 
-func latest(ctx context.Context, client mpb.MeasurementServiceClient, deviceID string) (*mpb.Measurement, error) {
+func latest(ctx context.Context, client mpb.MeasurementServiceClient, deviceIDs []string) (*mpb.BatchGetLatestResponse, error) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	return client.GetLatest(ctx, &mpb.GetLatestRequest{DeviceId: deviceID})
+	return client.BatchGetLatest(ctx, &mpb.BatchGetLatestRequest{DeviceId: deviceIDs})
 }
 
 func init() {
 	flag.StringVar(&key, "k", "", "API key")
 	flag.StringVar(&token, "t", "", "JWT")
+	flag.BoolVar(&useTLS, "tls", false, "connect using TLS; implied by -ca and -cert")
+	flag.StringVar(&caFile, "ca", "", "PEM file of CAs that the server's certificate must be signed by (default the system's)")
+	flag.StringVar(&cert, "cert", "", "PEM client certificate file, for mutual TLS")
+	flag.StringVar(&certKey, "cert-key", "", "PEM private key file for -cert")
 
 	flag.Usage = func() {
 		message := `usage: apiclient [options] ip
@@ -63,13 +75,23 @@ func main() {
 	// Set up authentication metadata.
 	ctx := context.Background()
 	if key != "" {
-		ctx = metadata.NewOutgoingContext(ctx, metadata.Pairs("x-api-key", key))
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", key)
 	}
 	if token != "" {
-		ctx = metadata.NewOutgoingContext(ctx, metadata.Pairs("Authorization", fmt.Sprintf("Bearer %s", token)))
+		ctx = metadata.AppendToOutgoingContext(ctx, "Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+
+	creds := insecure.NewCredentials()
+	if useTLS || caFile != "" || cert != "" {
+		config, err := apiauth.ClientTLSConfig(caFile, cert, certKey)
+		if err != nil {
+			fmt.Printf("Failed to load TLS config: %v", err)
+			os.Exit(1)
+		}
+		creds = credentials.NewTLS(config)
 	}
 
-	conn, err := grpc.Dial(serverAddr, grpc.WithInsecure())
+	conn, err := grpc.NewClient(serverAddr, grpc.WithTransportCredentials(creds))
 	if err != nil {
 		fmt.Printf("Failed to dial: %v", err)
 		os.Exit(1)
@@ -87,12 +109,17 @@ func main() {
 
 	fmt.Println("")
 
-	fmt.Println("Calling GetLatest")
-	fmt.Println("-----------------")
-	for _, d := range devices.DeviceId {
-		m, err := latest(ctx, client, d)
-		if err != nil {
-			fmt.Printf("Failed to GetLatest for %q: %v", d, err)
+	fmt.Println("Calling BatchGetLatest")
+	fmt.Println("----------------------")
+	resp, err := latest(ctx, client, devices.GetDeviceId())
+	if err != nil {
+		fmt.Printf("Failed to BatchGetLatest: %v", err)
+	}
+	for _, d := range devices.GetDeviceId() {
+		m, ok := resp.GetMeasurements()[d]
+		if !ok {
+			fmt.Printf("%s: no measurements\n", d)
+			continue
 		}
 		fmt.Printf("%v\n", m)
 	}
@@ -0,0 +1,112 @@
+// Binary apikey creates, lists, and deletes the API keys accepted by the gRPC API server.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/apiauth"
+	"github.com/mtraver/environmental-sensor/util"
+	"github.com/mtraver/environmental-sensor/web/db"
+)
+
+const (
+	datastoreKind = "measurement"
+)
+
+var (
+	projectID string
+	name      string
+	devices   string
+	rateLimit float64
+)
+
+func init() {
+	flag.StringVar(&projectID, "project", os.Getenv("GOOGLE_CLOUD_PROJECT"), "Google Cloud project ID")
+	flag.StringVar(&name, "name", "", "with create, who or what the key is for")
+	flag.StringVar(&devices, "devices", "", "with create, comma-separated device IDs the key can read (default all devices)")
+	flag.Float64Var(&rateLimit, "rate-limit", 0, "with create, calls per second the key may make (default the server's limit)")
+
+	flag.Usage = func() {
+		message := `usage: apikey [options] create|list|delete [id]
+
+Manages the API keys accepted by the gRPC API server. Only a hash of each key is
+stored, so a key is printed once, when it's created, and can't be recovered.
+
+Commands:
+  create  creates a key named -name and prints it
+  list    lists keys
+  delete  deletes the key with the given ID
+
+Options:
+`
+
+		fmt.Fprint(flag.CommandLine.Output(), message)
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	if projectID == "" || flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	database, err := db.NewDatastoreDB(projectID, datastoreKind)
+	if err != nil {
+		log.Fatalf("Failed to make datastore DB: %v", err)
+	}
+
+	ctx := context.Background()
+	switch cmd := flag.Arg(0); cmd {
+	case "create":
+		key, k, err := apiauth.NewKey(name, util.SplitList(devices), rateLimit)
+		if err != nil {
+			log.Fatalf("Failed to make key: %v", err)
+		}
+
+		k, err = database.PutAPIKey(ctx, k)
+		if err != nil {
+			log.Fatalf("Failed to store key: %v", err)
+		}
+
+		log.Printf("Created key %s. Store it somewhere safe; it won't be shown again.", k.ID)
+		fmt.Println(key)
+	case "list":
+		keys, err := database.APIKeys(ctx)
+		if err != nil {
+			log.Fatalf("Failed to list keys: %v", err)
+		}
+
+		for _, k := range keys {
+			scope := "all devices"
+			if len(k.DeviceIDs) > 0 {
+				scope = strings.Join(k.DeviceIDs, ",")
+			}
+			limit := "default"
+			if k.RateLimit > 0 {
+				limit = fmt.Sprintf("%g/s", k.RateLimit)
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\tcreated %s\n", k.ID, k.Name, scope, limit, k.Created.Format(time.RFC3339))
+		}
+	case "delete":
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+
+		if err := database.DeleteAPIKey(ctx, flag.Arg(1)); err != nil {
+			log.Fatalf("Failed to delete key: %v", err)
+		}
+		log.Printf("Deleted key %s. The API server may accept it for up to a minute longer.", flag.Arg(1))
+	default:
+		log.Fatalf("Unknown command %q", cmd)
+	}
+}
@@ -0,0 +1,235 @@
+// Binary archiver enforces the retention policy for raw measurements. Raw measurements older
+// than the retention period are exported to gzipped JSON Lines files, one per UTC day, and
+// then deleted from the database. Rollups are kept, so long-range queries continue to work.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/archive"
+	"github.com/mtraver/environmental-sensor/database"
+	"github.com/mtraver/environmental-sensor/measurement"
+	"github.com/mtraver/environmental-sensor/rollup"
+	"github.com/mtraver/environmental-sensor/web/db"
+)
+
+const (
+	datastoreKind = "measurement"
+)
+
+var (
+	projectID     string
+	retentionDays int
+	dest          string
+	dryRun        bool
+)
+
+type archiver struct {
+	database database.Database
+	sink     archive.Sink
+	dryRun   bool
+}
+
+// archiveName returns the name of the archive file for the UTC day starting at day.
+func archiveName(day time.Time) string {
+	return day.Format("2006/01/2006-01-02") + ".jsonl.gz"
+}
+
+// run archives and deletes each whole UTC day of raw measurements before cutoff, oldest first.
+// It returns the number of measurements archived.
+func (a *archiver) run(ctx context.Context, cutoff time.Time) (int, error) {
+	cutoff = rollup.Daily.Truncate(cutoff)
+
+	oldest, found, err := a.database.Oldest(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, nil
+	}
+
+	total := 0
+	for day := rollup.Daily.Truncate(oldest.Timestamp); day.Before(cutoff); day = day.AddDate(0, 0, 1) {
+		n, err := a.archiveDay(ctx, day)
+		if err != nil {
+			return total, fmt.Errorf("failed to archive %s: %w", day.Format(time.DateOnly), err)
+		}
+
+		if n > 0 {
+			log.Printf("%s: archived %d measurements", day.Format(time.DateOnly), n)
+		}
+		total += n
+	}
+
+	return total, nil
+}
+
+// readArchive reads the measurements in the archive for the UTC day starting at day, if it's
+// already been archived, keyed by database key.
+func (a *archiver) readArchive(ctx context.Context, day time.Time) (map[string]measurement.StorableMeasurement, error) {
+	rc, err := a.sink.Read(ctx, archiveName(day))
+	if errors.Is(err, archive.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	ms, err := archive.ReadJSONL(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read existing archive: %w", err)
+	}
+
+	archived := make(map[string]measurement.StorableMeasurement, len(ms))
+	for _, m := range ms {
+		sm, err := measurement.NewStorableMeasurement(m)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read existing archive: %w", err)
+		}
+		archived[sm.DBKey()] = sm
+	}
+	return archived, nil
+}
+
+// archiveDay archives and deletes the raw measurements from the UTC day starting at day.
+// If the day was archived before, e.g. because late measurements arrived after it was, the
+// existing archive is merged with them so that nothing archived earlier is lost. Before
+// anything is deleted the day's rollups are rebuilt from the merged measurements, in case they
+// predate rollups, and the archive is written. A failure at any step leaves the raw data in
+// place.
+func (a *archiver) archiveDay(ctx context.Context, day time.Time) (int, error) {
+	byDevice, err := a.database.Between(ctx, day, day.Add(rollup.Daily.Duration()-time.Nanosecond))
+	if err != nil {
+		return 0, err
+	}
+
+	var sms []measurement.StorableMeasurement
+	for _, deviceSMs := range byDevice {
+		sms = append(sms, deviceSMs...)
+	}
+
+	if len(sms) == 0 {
+		return 0, nil
+	}
+
+	archived, err := a.readArchive(ctx, day)
+	if err != nil {
+		return 0, err
+	}
+
+	// Measurements still in the database replace archived ones with the same key.
+	merged := make(map[string][]measurement.StorableMeasurement)
+	for _, sm := range sms {
+		delete(archived, sm.DBKey())
+		merged[sm.DeviceID] = append(merged[sm.DeviceID], sm)
+	}
+	for _, sm := range archived {
+		merged[sm.DeviceID] = append(merged[sm.DeviceID], sm)
+	}
+
+	var all []measurement.StorableMeasurement
+	var buckets []rollup.Bucket
+	for _, id := range slices.Sorted(maps.Keys(merged)) {
+		deviceSMs := merged[id]
+		slices.SortFunc(deviceSMs, func(a, b measurement.StorableMeasurement) int {
+			return a.Timestamp.Compare(b.Timestamp)
+		})
+		all = append(all, deviceSMs...)
+		for _, res := range rollup.Resolutions {
+			buckets = append(buckets, rollup.Compute(deviceSMs, res)...)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := archive.WriteJSONL(&buf, all); err != nil {
+		return 0, err
+	}
+
+	if a.dryRun {
+		log.Printf("Dry run: would write %s (%d bytes, %d previously archived measurements), %d rollup buckets, and delete %d measurements",
+			archiveName(day), buf.Len(), len(archived), len(buckets), len(sms))
+		return len(sms), nil
+	}
+
+	if err := a.database.PutRollups(ctx, buckets); err != nil {
+		return 0, fmt.Errorf("failed to write rollups: %w", err)
+	}
+
+	if err := a.sink.Write(ctx, archiveName(day), &buf); err != nil {
+		return 0, err
+	}
+
+	if err := a.database.Delete(ctx, sms); err != nil {
+		return 0, fmt.Errorf("failed to delete archived measurements: %w", err)
+	}
+
+	return len(sms), nil
+}
+
+func init() {
+	flag.StringVar(&projectID, "project", os.Getenv("GOOGLE_CLOUD_PROJECT"), "Google Cloud project ID")
+	flag.IntVar(&retentionDays, "retention-days", 365, "number of days of raw measurements to keep")
+	flag.StringVar(&dest, "dest", "", "where to write archives: a local directory or gs://bucket/prefix")
+	flag.BoolVar(&dryRun, "n", false, "dry run: report what would be archived but don't write or delete anything")
+
+	flag.Usage = func() {
+		message := `usage: archiver -dest destination [options]
+
+Exports raw measurements older than the retention period to gzipped JSON Lines
+files, one per UTC day, then deletes them from the database. Hourly and daily
+rollups are kept. If a day has already been archived, e.g. because late
+measurements arrived after it was, they're merged into the existing file.
+
+Options:
+`
+
+		fmt.Fprint(flag.CommandLine.Output(), message)
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	if projectID == "" || dest == "" || retentionDays <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+
+	sink, err := archive.NewSink(ctx, dest)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	database, err := db.NewDatastoreDB(projectID, datastoreKind)
+	if err != nil {
+		log.Fatalf("Failed to make datastore DB: %v", err)
+	}
+
+	a := &archiver{
+		database: database,
+		sink:     sink,
+		dryRun:   dryRun,
+	}
+
+	cutoff := time.Now().UTC().AddDate(0, 0, -retentionDays)
+	log.Printf("Archiving raw measurements from before %s to %s", rollup.Daily.Truncate(cutoff).Format(time.DateOnly), dest)
+
+	n, err := a.run(ctx, cutoff)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Done. Archived %d measurements", n)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/archive"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/rollup"
+	"github.com/mtraver/environmental-sensor/web/db"
+	tspb "google.golang.org/protobuf/types/known/timestamppb"
+	wpb "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type memorySink map[string][]byte
+
+func (s memorySink) Read(ctx context.Context, name string) (io.ReadCloser, error) {
+	b, ok := s[name]
+	if !ok {
+		return nil, archive.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (s memorySink) Write(ctx context.Context, name string, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s[name] = b
+	return nil
+}
+
+func day(d int) time.Time {
+	return time.Date(2018, time.March, d, 0, 0, 0, 0, time.UTC)
+}
+
+func seed(t *testing.T, database *db.MemoryDB) {
+	t.Helper()
+
+	for _, ts := range []time.Time{
+		day(24).Add(13 * time.Hour),
+		day(25).Add(1 * time.Hour),
+		day(25).Add(2 * time.Hour),
+		day(27).Add(3 * time.Hour),
+	} {
+		if err := database.Save(context.Background(), &mpb.Measurement{
+			DeviceId:  "foo",
+			Timestamp: tspb.New(ts),
+			Temp:      wpb.Float(20),
+		}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+}
+
+func TestArchiveName(t *testing.T) {
+	want := "2018/03/2018-03-25.jsonl.gz"
+	if got := archiveName(day(25)); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	database := db.NewMemoryDB()
+	seed(t, database)
+
+	sink := memorySink{}
+	a := &archiver{database: database, sink: sink}
+
+	// The cutoff is partway through the 26th, so only the 24th and 25th are archived.
+	n, err := a.run(ctx, day(26).Add(12*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("got %d archived, want 3", n)
+	}
+
+	if len(sink) != 2 {
+		t.Errorf("got %d archives, want 2", len(sink))
+	}
+	archived, err := archive.ReadJSONL(bytes.NewReader(sink[archiveName(day(25))]))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(archived) != 2 {
+		t.Errorf("got %d measurements in archive, want 2", len(archived))
+	}
+
+	remaining, err := database.Since(ctx, time.Time{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(remaining["foo"]) != 1 {
+		t.Errorf("got %d remaining measurements, want 1", len(remaining["foo"]))
+	}
+
+	daily, err := database.Rollups(ctx, rollup.Daily, nil, day(25), day(25))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(daily["foo"]) != 1 || daily["foo"][0].Count != 2 {
+		t.Errorf("got daily rollups %v, want one bucket with count 2", daily["foo"])
+	}
+}
+
+func TestRunLateData(t *testing.T) {
+	ctx := context.Background()
+	database := db.NewMemoryDB()
+	seed(t, database)
+
+	sink := memorySink{}
+	a := &archiver{database: database, sink: sink}
+	if _, err := a.run(ctx, day(26)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// A measurement from the 25th arrives after the 25th has been archived.
+	if err := database.Save(ctx, &mpb.Measurement{
+		DeviceId:  "foo",
+		Timestamp: tspb.New(day(25).Add(3 * time.Hour)),
+		Temp:      wpb.Float(20),
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	n, err := a.run(ctx, day(26))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("got %d archived, want 1", n)
+	}
+
+	archived, err := archive.ReadJSONL(bytes.NewReader(sink[archiveName(day(25))]))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(archived) != 3 {
+		t.Errorf("got %d measurements in archive, want 3", len(archived))
+	}
+
+	daily, err := database.Rollups(ctx, rollup.Daily, nil, day(25), day(25))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(daily["foo"]) != 1 || daily["foo"][0].Count != 3 {
+		t.Errorf("got daily rollups %v, want one bucket with count 3", daily["foo"])
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	ctx := context.Background()
+	database := db.NewMemoryDB()
+	seed(t, database)
+
+	sink := memorySink{}
+	a := &archiver{database: database, sink: sink, dryRun: true}
+
+	n, err := a.run(ctx, day(28))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n != 4 {
+		t.Errorf("got %d archived, want 4", n)
+	}
+
+	if len(sink) != 0 {
+		t.Errorf("got %d archives written in dry run, want 0", len(sink))
+	}
+
+	remaining, err := database.Since(ctx, time.Time{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(remaining["foo"]) != 4 {
+		t.Errorf("got %d remaining measurements, want 4", len(remaining["foo"]))
+	}
+}
@@ -0,0 +1,119 @@
+// Binary calibrate fits a linear calibration profile for one device's values of a metric against
+// a co-located reference device.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/calibration"
+	"github.com/mtraver/environmental-sensor/metric"
+	"github.com/mtraver/environmental-sensor/web/db"
+)
+
+const (
+	datastoreKind = "measurement"
+
+	dateFormat = "2006-01-02"
+)
+
+var (
+	projectID   string
+	deviceID    string
+	referenceID string
+	metricKey   string
+	startDate   string
+	endDate     string
+	maxSkew     time.Duration
+	save        bool
+)
+
+func init() {
+	flag.StringVar(&projectID, "project", os.Getenv("GOOGLE_CLOUD_PROJECT"), "Google Cloud project ID")
+	flag.StringVar(&deviceID, "device", "", "ID of the device to calibrate")
+	flag.StringVar(&referenceID, "reference", "", "ID of the reference device")
+	flag.StringVar(&metricKey, "metric", "", "metric to calibrate, e.g. pm25")
+	flag.StringVar(&startDate, "start", "", "first day (UTC) of co-location, formatted like "+dateFormat)
+	flag.StringVar(&endDate, "end", "", "last day (UTC) of co-location, formatted like "+dateFormat+" (default today)")
+	flag.DurationVar(&maxSkew, "max-skew", time.Minute, "maximum time between paired measurements")
+	flag.BoolVar(&save, "save", false, "store the fit as a calibration profile valid from the start of co-location")
+
+	flag.Usage = func() {
+		message := `usage: calibrate -device id -reference id -metric key -start date [options]
+
+Pairs the device's measurements with the reference device's measurements taken
+at about the same time and fits reference = scale * device + offset by least
+squares. The fit is printed, and stored as a calibration profile if -save is set.
+
+Options:
+`
+
+		fmt.Fprint(flag.CommandLine.Output(), message)
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	if projectID == "" || deviceID == "" || referenceID == "" || metricKey == "" || startDate == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	m := metric.Key(metricKey)
+	if _, ok := metric.All[m]; !ok || m.Derived() {
+		log.Fatalf("Bad -metric: %q is not a reported metric", metricKey)
+	}
+
+	start, err := time.Parse(dateFormat, startDate)
+	if err != nil {
+		log.Fatalf("Bad -start: %v", err)
+	}
+
+	end := time.Now()
+	if endDate != "" {
+		end, err = time.Parse(dateFormat, endDate)
+		if err != nil {
+			log.Fatalf("Bad -end: %v", err)
+		}
+		end = end.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+
+	database, err := db.NewDatastoreDB(projectID, datastoreKind)
+	if err != nil {
+		log.Fatalf("Failed to make datastore DB: %v", err)
+	}
+
+	ctx := context.Background()
+	measurements, err := database.Between(ctx, start, end)
+	if err != nil {
+		log.Fatalf("Failed to get measurements: %v", err)
+	}
+
+	points := calibration.Pair(measurements[deviceID], measurements[referenceID], m, maxSkew)
+	fit, err := calibration.FitLinear(points)
+	if err != nil {
+		log.Fatalf("Failed to fit %s: %v", m, err)
+	}
+
+	fmt.Println(fit)
+
+	if !save {
+		return
+	}
+
+	p := fit.Profile(deviceID, m)
+	p.ValidFrom = start
+	p.Note = fmt.Sprintf("Fit against %s from %s (%s)", referenceID, start.Format(dateFormat), fit)
+	p, err = database.PutCalibrationProfile(ctx, p)
+	if err != nil {
+		log.Fatalf("Failed to save profile: %v", err)
+	}
+
+	log.Printf("Saved profile %s", p.ID)
+}
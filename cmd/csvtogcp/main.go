@@ -1,188 +0,0 @@
-package main
-
-import (
-	"bufio"
-	"context"
-	"encoding/csv"
-	"errors"
-	"fmt"
-	"io"
-	"os"
-	"path"
-	"strconv"
-	"time"
-
-	"cloud.google.com/go/pubsub/v2"
-	"cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
-	mpb "github.com/mtraver/environmental-sensor/measurementpb"
-	"google.golang.org/protobuf/proto"
-	tspb "google.golang.org/protobuf/types/known/timestamppb"
-	wpb "google.golang.org/protobuf/types/known/wrapperspb"
-)
-
-const usageStr = `usage: %v csv_file project_id topic_id device_id
-
-Reads lines from a CSV file, converts them into Measurement protobufs as defined
-in measurement.proto, and publishes them to Google Cloud Pub/Sub. It's expected
-that an instance of the web app is running on GCP to process the Pub/Sub
-messages.
-
-This program was written to migrate data stored in a Google Sheet to the
-storage back ends supported by the web app.
-
-The first line of the CSV file is expected to be column headers, followed by
-lines of this format:
-
-  timestamp,temp1,temp2,...
-
-The timestamp field must be formatted like this: %v
-
-There must be at least one temperature value. If there is more than one
-they are averaged before packing into the Measurement protobuf.
-
-Arguments:
-  csv_file: Path to the CSV file.
-  project_id: Google Cloud Platform project ID.
-  topic_id: Google Cloud Pub/Sub topic ID. This topic must be configured to
-            push to the web app's Pub/Sub endpoint URL.
-  device_id: The device ID to include in the Pub/Sub message. Data from multiple
-             devices can be saved and displayed by the web app, so this
-             must be a unique identifier for the device from which the data in
-             the CSV file came.
-`
-
-const timeFormat = "2006-01-02T15:04:05.999999"
-
-func strsToFloats(x []string) ([]float32, error) {
-	var numbers []float32
-	for _, v := range x {
-		f, err := strconv.ParseFloat(v, 32)
-		if err != nil {
-			return numbers, err
-		}
-		numbers = append(numbers, float32(f))
-	}
-	return numbers, nil
-}
-
-func mean(x []float32) float32 {
-	var total float32
-	for _, v := range x {
-		total += v
-	}
-	return total / float32(len(x))
-}
-
-func lineToProto(line []string, deviceID string) (*mpb.Measurement, error) {
-	if len(line) < 2 {
-		return nil, errors.New("Line length must be at least 2 (timestamp and one measurement)")
-	}
-
-	// Convert the timestamp string to a timestamp for packing into a protobuf
-	timestamp, err := time.Parse(timeFormat, line[0])
-	if err != nil {
-		return nil, err
-	}
-	timestampProto := tspb.New(timestamp)
-	if err := timestampProto.CheckValid(); err != nil {
-		return nil, err
-	}
-
-	temps, err := strsToFloats(line[1:])
-	if err != nil {
-		return nil, err
-	}
-
-	m := &mpb.Measurement{
-		DeviceId:  deviceID,
-		Timestamp: timestampProto,
-		Temp:      wpb.Float(mean(temps)),
-	}
-
-	return m, nil
-}
-
-func publishFromCSV(csvFile string, projectID string, pubsubTopic string, deviceID string) error {
-	f, err := os.Open(csvFile)
-	defer f.Close()
-	if err != nil {
-		return err
-	}
-	reader := csv.NewReader(bufio.NewReader(f))
-
-	// Set up the Pub/Sub client.
-	ctx := context.Background()
-	client, err := pubsub.NewClient(ctx, projectID)
-	if err != nil {
-		return err
-	}
-
-	// Confirm that the topic exists.
-	if _, err := client.TopicAdminClient.GetTopic(ctx, &pubsubpb.GetTopicRequest{
-		Topic: pubsubTopic,
-	}); err != nil {
-		return fmt.Errorf("Failed to fetch topic %q: %v", pubsubTopic, err)
-	}
-
-	publisher := client.Publisher(pubsubTopic)
-	defer publisher.Stop()
-
-	publisher.PublishSettings = pubsub.PublishSettings{
-		DelayThreshold: 10 * time.Millisecond,
-		CountThreshold: 50,
-	}
-
-	// Assume that the CSV file has column headers, and strip them off first.
-	if _, err := reader.Read(); err == io.EOF {
-		return err
-	}
-
-	for {
-		line, err := reader.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return err
-		}
-
-		// Make and marshal the protobuf
-		m, err := lineToProto(line, deviceID)
-		if err != nil {
-			return err
-		}
-		data, err := proto.Marshal(m)
-		if err != nil {
-			return err
-		}
-
-		publisher.Publish(ctx, &pubsub.Message{Data: data})
-	}
-
-	return nil
-}
-
-func fullyQualifiedTopic(projectID, topicID string) string {
-	return fmt.Sprintf("projects/%s/topics/%s", projectID, topicID)
-}
-
-func usage() {
-	fmt.Printf(usageStr, path.Base(os.Args[0]), timeFormat)
-}
-
-func main() {
-	if len(os.Args) != 5 {
-		usage()
-		os.Exit(2)
-	}
-
-	csvFile := os.Args[1]
-	projectID := os.Args[2]
-	topicID := os.Args[3]
-	deviceID := os.Args[4]
-	fullTopic := fullyQualifiedTopic(projectID, topicID)
-
-	if err := publishFromCSV(csvFile, projectID, fullTopic, deviceID); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-}
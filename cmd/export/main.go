@@ -0,0 +1,146 @@
+// Binary export writes measurement history from Datastore to a CSV, JSON Lines, or Parquet file.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/export"
+	"github.com/mtraver/environmental-sensor/metric"
+	"github.com/mtraver/environmental-sensor/util"
+	"github.com/mtraver/environmental-sensor/web/db"
+)
+
+const (
+	datastoreKind = "measurement"
+)
+
+var (
+	projectID string
+	startTime string
+	endTime   string
+	devices   string
+	metrics   string
+	format    string
+	bucket    time.Duration
+	timezone  string
+	outPath   string
+	raw       bool
+)
+
+func init() {
+	flag.StringVar(&projectID, "project", os.Getenv("GOOGLE_CLOUD_PROJECT"), "Google Cloud project ID")
+	flag.StringVar(&startTime, "start", "", "first timestamp to export, RFC 3339 or a date like 2006-01-02")
+	flag.StringVar(&endTime, "end", "", "last timestamp to export, RFC 3339 or a date like 2006-01-02 (default no limit)")
+	flag.StringVar(&devices, "devices", "", "comma-separated device IDs to export (default all devices)")
+	flag.StringVar(&metrics, "metrics", "", "comma-separated metrics to export (default all reported metrics)")
+	flag.StringVar(&format, "format", "", "csv, jsonl, or parquet (default from the extension of -o, or csv)")
+	flag.DurationVar(&bucket, "bucket", 0, "aggregate into buckets of this duration, e.g. 1h (default no aggregation)")
+	flag.StringVar(&timezone, "tz", "UTC", "IANA time zone that timestamps are written and buckets are aligned in")
+	flag.StringVar(&outPath, "o", "", "output file (default stdout)")
+	flag.BoolVar(&raw, "raw", false, "export stored values rather than calibrated values")
+
+	flag.Usage = func() {
+		message := `usage: export -start time [options]
+
+Exports measurements, a page at a time, as CSV, JSON Lines, or Parquet.
+
+Options:
+`
+
+		fmt.Fprint(flag.CommandLine.Output(), message)
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	if projectID == "" || startTime == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		log.Fatalf("Bad -tz: %v", err)
+	}
+
+	opts := export.Options{
+		DeviceIDs: util.SplitList(devices),
+		Bucket:    bucket,
+		Location:  loc,
+	}
+
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(outPath), ".")
+	}
+	if format == "" {
+		format = string(export.CSV)
+	}
+	opts.Format, err = export.ParseFormat(format)
+	if err != nil {
+		log.Fatalf("Bad -format: %v", err)
+	}
+
+	opts.StartTime, err = export.ParseTime(startTime, loc)
+	if err != nil {
+		log.Fatalf("Bad -start: %v", err)
+	}
+	if endTime != "" {
+		opts.EndTime, err = export.ParseTime(endTime, loc)
+		if err != nil {
+			log.Fatalf("Bad -end: %v", err)
+		}
+	}
+
+	for _, m := range util.SplitList(metrics) {
+		opts.Metrics = append(opts.Metrics, metric.Key(m))
+	}
+
+	if err := opts.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	database, err := db.NewDatastoreDB(projectID, datastoreKind)
+	if err != nil {
+		log.Fatalf("Failed to make datastore DB: %v", err)
+	}
+
+	ctx := context.Background()
+	if !raw {
+		opts.Profiles, err = database.CalibrationProfiles(ctx)
+		if err != nil {
+			log.Fatalf("Failed to get calibration profiles: %v", err)
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if outPath != "" {
+		f, err := os.Create(outPath)
+		if err != nil {
+			log.Fatalf("Failed to create output file: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := bufio.NewWriter(out)
+	n, err := export.Export(ctx, database, w, opts)
+	if err != nil {
+		log.Fatalf("Export failed after %d rows: %v", n, err)
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatalf("Failed to write output: %v", err)
+	}
+
+	log.Printf("Exported %d rows", n)
+}
@@ -0,0 +1,258 @@
+// Binary importer reads measurements from CSV, JSON Lines, or protobuf files and publishes them to
+// Pub/Sub or saves them directly to Datastore.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+	"cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
+	"github.com/mtraver/environmental-sensor/importer"
+	"github.com/mtraver/environmental-sensor/ingest"
+	"github.com/mtraver/environmental-sensor/web/db"
+)
+
+const (
+	toPubSub    = "pubsub"
+	toDatastore = "datastore"
+)
+
+// mappings is a flag that may be given more than once.
+type mappings []string
+
+func (m *mappings) String() string {
+	return strings.Join(*m, " ")
+}
+
+func (m *mappings) Set(s string) error {
+	*m = append(*m, s)
+	return nil
+}
+
+var (
+	format          string
+	mapSpecs        mappings
+	timestampColumn string
+	timeFormat      string
+	timezone        string
+	deviceID        string
+	deviceColumn    string
+	to              string
+	projectID       string
+	topicID         string
+	datastoreKind   string
+	dryRun          bool
+	batchSize       int
+	checkpointPath  string
+	resume          bool
+)
+
+func init() {
+	flag.StringVar(&format, "format", "", "csv, jsonl, or proto (default from the file extension)")
+	flag.Var(&mapSpecs, "map", "map a metric to CSV columns, e.g. pm25=PM2.5 or temp=temp1,temp2; may be repeated (default columns named after metrics)")
+	flag.StringVar(&timestampColumn, "timestamp-column", "", `CSV column holding timestamps (default "timestamp", or the first column)`)
+	flag.StringVar(&timeFormat, "time-format", "", "Go layout of CSV timestamps (default RFC 3339 or 2006-01-02T15:04:05.999999)")
+	flag.StringVar(&timezone, "tz", "UTC", "IANA time zone of CSV timestamps that don't include a UTC offset")
+	flag.StringVar(&deviceID, "device", "", "device ID of records that don't have one")
+	flag.StringVar(&deviceColumn, "device-column", "", `CSV column holding device IDs (default "device_id" if present)`)
+	flag.StringVar(&to, "to", toPubSub, fmt.Sprintf("where to write measurements: %s or %s", toPubSub, toDatastore))
+	flag.StringVar(&projectID, "project", os.Getenv("GOOGLE_CLOUD_PROJECT"), "Google Cloud project ID")
+	flag.StringVar(&topicID, "topic", "", "Pub/Sub topic ID, required with -to pubsub")
+	flag.StringVar(&datastoreKind, "kind", "measurement", "Datastore kind, used with -to datastore")
+	flag.BoolVar(&dryRun, "dry-run", false, "read and validate the input and print a report without writing anything")
+	flag.IntVar(&batchSize, "batch-size", importer.DefaultBatchSize, "number of measurements written at a time")
+	flag.StringVar(&checkpointPath, "checkpoint", "", "file that progress is recorded in so that a failed import can be resumed (default the input file plus .checkpoint)")
+	flag.BoolVar(&resume, "resume", false, "skip the records recorded as written in the checkpoint file")
+
+	flag.Usage = func() {
+		message := `usage: importer [options] file
+
+Reads measurements from a CSV, JSON Lines, or protobuf file, validates them, and
+either publishes them to Google Cloud Pub/Sub or saves them directly to Datastore.
+Gzipped files are decompressed.
+
+CSV files must have a header row. Each row is one measurement. Columns are
+mapped to metrics with -map, or by default by name (e.g. "pm25" or "PM2.5").
+If a metric is mapped to more than one column their values are averaged.
+
+JSON Lines files have one Measurement per line in protojson format, like those
+written by the archiver. Protobuf files are size-delimited binary Measurements.
+
+Invalid records, including those timestamped more than an hour in the future,
+and records with the same device ID and timestamp as an earlier record are
+skipped and counted in the report printed at the end. -dry-run checks records
+just as a real import does.
+
+With -to pubsub, the topic must push to the web app's /push-handlers/import
+route, which saves measurements just as the other routes do those from devices
+but accepts them whatever their age. Messages have the "source" attribute
+"importer". With -to datastore, measurements are saved directly; rollups are
+updated as they're saved, but alerts aren't triggered.
+
+Progress is recorded in the checkpoint file after each batch and the file is
+removed once the import is done. If an import fails, run it again with -resume.
+
+Options:
+`
+
+		fmt.Fprint(flag.CommandLine.Output(), message)
+		flag.PrintDefaults()
+	}
+}
+
+func readCheckpoint(path string) (int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// writeCheckpoint replaces the checkpoint file atomically so that it's never left half written.
+func writeCheckpoint(path string, committed int) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(committed)+"\n"), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func newSink(ctx context.Context) (importer.Sink, func(), error) {
+	switch to {
+	case toPubSub:
+		if topicID == "" {
+			return nil, nil, errors.New("-topic is required with -to pubsub")
+		}
+
+		client, err := pubsub.NewClient(ctx, projectID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		topic := fmt.Sprintf("projects/%s/topics/%s", projectID, topicID)
+		if _, err := client.TopicAdminClient.GetTopic(ctx, &pubsubpb.GetTopicRequest{Topic: topic}); err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch topic %q: %v", topic, err)
+		}
+
+		publisher := client.Publisher(topic)
+		publisher.PublishSettings = pubsub.PublishSettings{
+			DelayThreshold: 10 * time.Millisecond,
+			CountThreshold: 50,
+		}
+
+		return importer.PubSubSink{Publisher: publisher}, func() {
+			publisher.Stop()
+			client.Close()
+		}, nil
+	case toDatastore:
+		database, err := db.NewDatastoreDB(projectID, datastoreKind)
+		if err != nil {
+			return nil, nil, err
+		}
+		return importer.DatabaseSink{Database: database}, func() {}, nil
+	}
+	return nil, nil, fmt.Errorf("unknown -to %q", to)
+}
+
+func main() {
+	flag.Parse()
+
+	if flag.NArg() != 1 || (projectID == "" && !dryRun) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	inPath := flag.Arg(0)
+
+	if checkpointPath == "" {
+		checkpointPath = inPath + ".checkpoint"
+	}
+
+	var err error
+	f := importer.Format(format)
+	if format == "" {
+		f, err = importer.FormatFromPath(inPath)
+	} else {
+		f, err = importer.ParseFormat(format)
+	}
+	if err != nil {
+		log.Fatalf("Bad -format: %v", err)
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		log.Fatalf("Bad -tz: %v", err)
+	}
+
+	mapping, err := importer.ParseMapping(mapSpecs)
+	if err != nil {
+		log.Fatalf("Bad -map: %v", err)
+	}
+
+	in, err := os.Open(inPath)
+	if err != nil {
+		log.Fatalf("Failed to open input file: %v", err)
+	}
+	defer in.Close()
+
+	reader, err := importer.NewReader(in, f, importer.CSVOptions{
+		Mapping:         mapping,
+		TimestampColumn: timestampColumn,
+		TimeFormat:      timeFormat,
+		Location:        loc,
+		DeviceColumn:    deviceColumn,
+		DeviceID:        deviceID,
+	})
+	if err != nil {
+		log.Fatalf("Failed to read input file: %v", err)
+	}
+
+	// The web app's import route accepts measurements of any age but not those too far in the
+	// future, so the same limit applies here whether or not it's a dry run.
+	opts := importer.Options{
+		BatchSize: batchSize,
+		DryRun:    dryRun,
+		MaxFuture: ingest.DefaultMaxFuture,
+		Checkpoint: func(committed int) error {
+			return writeCheckpoint(checkpointPath, committed)
+		},
+	}
+	if resume {
+		opts.Skip, err = readCheckpoint(checkpointPath)
+		if err != nil {
+			log.Fatalf("Failed to read checkpoint: %v", err)
+		}
+		log.Printf("Resuming after record %d", opts.Skip)
+	}
+
+	ctx := context.Background()
+
+	var sink importer.Sink
+	if !dryRun {
+		var closeSink func()
+		sink, closeSink, err = newSink(ctx)
+		if err != nil {
+			log.Fatalf("Failed to set up -to %s: %v", to, err)
+		}
+		defer closeSink()
+	}
+
+	report, err := importer.Import(ctx, reader, sink, opts)
+	fmt.Print(report)
+	if err != nil {
+		log.Fatalf("Import failed; run again with -resume to continue after record %d: %v", report.Committed, err)
+	}
+
+	if !dryRun {
+		if err := os.Remove(checkpointPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to remove checkpoint: %v", err)
+		}
+	}
+}
@@ -3,12 +3,12 @@ package main
 import (
 	"crypto/tls"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"os"
 
 	aic "github.com/mtraver/awsiotcore"
 	"github.com/mtraver/environmental-sensor/awscerts"
+	"github.com/mtraver/environmental-sensor/device"
 )
 
 type DeviceConfig struct {
@@ -38,15 +38,13 @@ func parseDeviceFile(path string) (*aic.Device, error) {
 
 	// If the config doesn't have a device ID set then use the cert's Common Name (CN).
 	if config.DeviceID == "" {
-		commonName := cert.Leaf.Subject.CommonName
-		if commonName == "" {
-			return nil, errors.New("config has no device ID set and cert Common Name (CN) is empty")
+		config.DeviceID, err = device.CertificateDeviceID(cert.Leaf)
+		if err != nil {
+			return nil, fmt.Errorf("config has no device ID set: %w", err)
 		}
-
-		config.DeviceID = commonName
 	}
 
-	device := &aic.Device{
+	d := &aic.Device{
 		Endpoint:               config.Endpoint,
 		DeviceID:               config.DeviceID,
 		TelemetryTopicOverride: config.TelemetryTopicOverride,
@@ -54,5 +52,5 @@ func parseDeviceFile(path string) (*aic.Device, error) {
 		Cert:                   cert,
 	}
 
-	return device, nil
+	return d, nil
 }
@@ -64,8 +64,18 @@ func (j SenseJob) Run() {
 		log.Printf("Invalid timestamp: %v", err)
 		return
 	}
+
+	// The message ID stays with the measurement, so copies of it are recognized however many
+	// times it's delivered.
+	messageID, err := mpbutil.NewMessageID()
+	if err != nil {
+		log.Printf("Failed to make message ID: %v", err)
+		return
+	}
+
 	m := mpb.Measurement{
 		Timestamp: timepb,
+		MessageId: messageID,
 	}
 
 	count := 0
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	mpbutil "github.com/mtraver/environmental-sensor/measurementpbutil"
+	"google.golang.org/protobuf/proto"
+)
+
+// message is a marshaled Measurement to forward.
+type message struct {
+	// ID identifies the message to Lambda, e.g. it's the SQS message ID.
+	ID   string
+	Data []byte
+
+	// Invalid is why the message is invalid, if it is. Invalid messages are still forwarded,
+	// marked with it as their "invalid" attribute, so that the push handler quarantines them
+	// rather than them being lost.
+	Invalid string
+}
+
+// forwarder sends measurements on to the web app.
+type forwarder interface {
+	// Forward forwards msgs. It returns an error for each message, which is nil if the message
+	// was forwarded.
+	Forward(ctx context.Context, msgs []message) []error
+}
+
+// bridge forwards the measurements that devices send to AWS IoT Core.
+type bridge struct {
+	forwarder forwarder
+}
+
+// decode decodes and validates a message sent by a device. Messages are marshaled Measurements,
+// JSON-encoded as byte slices, so by the time they get here they're base64-encoded strings. If s
+// can't be decoded or isn't a valid Measurement then the error says why, and the bytes returned
+// are as much of it as could be decoded: s itself if it isn't base64.
+func decode(s string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return []byte(s), fmt.Errorf("failed to decode base64: %w", err)
+	}
+
+	// Unmarshal the protobuf to make sure that it is indeed a valid Measurement that we've received.
+	m := &mpb.Measurement{}
+	if err := proto.Unmarshal(b, m); err != nil {
+		return b, fmt.Errorf("failed to unmarshal protobuf: %w", err)
+	}
+	if err := mpbutil.Validate(m); err != nil {
+		return b, err
+	}
+
+	return b, nil
+}
+
+// newMessage decodes and validates s, the message with the given ID, for forwarding.
+func newMessage(id, s string) message {
+	data, err := decode(s)
+	if err != nil {
+		log.Printf("Forwarding invalid message %s to be quarantined: %v", id, err)
+		return message{ID: id, Data: data, Invalid: err.Error()}
+	}
+	return message{ID: id, Data: data}
+}
+
+// handle handles an invocation of the function. The event is either a single message passed on
+// by an AWS IoT rule, which is a JSON string, or a batch of messages from SQS.
+func (b bridge) handle(ctx context.Context, event json.RawMessage) (any, error) {
+	var s string
+	if err := json.Unmarshal(event, &s); err == nil {
+		return b.handleMessage(ctx, s)
+	}
+
+	var batch events.SQSEvent
+	if err := json.Unmarshal(event, &batch); err != nil || len(batch.Records) == 0 {
+		return nil, errors.New("event is neither a message nor an SQS batch")
+	}
+	return b.handleSQS(ctx, batch), nil
+}
+
+func (b bridge) handleMessage(ctx context.Context, s string) (string, error) {
+	var id string
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		id = lc.AwsRequestID
+	}
+
+	if err := b.forwarder.Forward(ctx, []message{newMessage(id, s)})[0]; err != nil {
+		log.Printf("Failed to forward message: %v", err)
+		return "error", err
+	}
+
+	return "ok", nil
+}
+
+// handleSQS forwards a batch of messages from SQS and reports the ones that should be retried.
+// Messages that can't be decoded or are invalid are forwarded marked as such, since retrying them
+// won't help.
+func (b bridge) handleSQS(ctx context.Context, batch events.SQSEvent) events.SQSEventResponse {
+	var msgs []message
+	for _, r := range batch.Records {
+		// The body is the message published by the device, which is a JSON string, unless the
+		// rule that sent it to SQS encoded it in base64 itself.
+		s := r.Body
+		if err := json.Unmarshal([]byte(r.Body), &s); err != nil {
+			s = r.Body
+		}
+
+		msgs = append(msgs, newMessage(r.MessageId, s))
+	}
+
+	var resp events.SQSEventResponse
+
+	for i, err := range b.forwarder.Forward(ctx, msgs) {
+		if err != nil {
+			log.Printf("Failed to forward SQS message %s: %v", msgs[i].ID, err)
+			resp.BatchItemFailures = append(resp.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: msgs[i].ID})
+		}
+	}
+	return resp
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/pubsub/v2"
+	"cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
+	"cloud.google.com/go/pubsub/v2/pstest"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/testutil"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	testProject = "test-project"
+	testTopic   = "telemetry"
+)
+
+// encode encodes m the way that it arrives from AWS IoT Core: marshaled and base64-encoded.
+func encode(t *testing.T, m *mpb.Measurement) string {
+	t.Helper()
+
+	b, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// jsonString encodes s as a JSON string, the way that Lambda receives messages from AWS IoT rules.
+func jsonString(t *testing.T, s string) json.RawMessage {
+	t.Helper()
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return b
+}
+
+func invalidMeasurement() *mpb.Measurement {
+	m := testutil.FullyPopulatedMeasurementProto()
+	m.DeviceId = "FOO"
+	return m
+}
+
+// newPubSub starts a fake Pub/Sub server with a topic and returns the server and a publisher
+// to the topic.
+func newPubSub(t *testing.T) (*pstest.Server, *pubsub.Publisher) {
+	t.Helper()
+	ctx := context.Background()
+
+	srv := pstest.NewServer()
+	t.Cleanup(func() { srv.Close() })
+
+	topic := fullyQualifiedTopic(testProject, testTopic)
+	if _, err := srv.GServer.CreateTopic(ctx, &pubsubpb.Topic{Name: topic}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	client, err := pubsub.NewClient(ctx, testProject,
+		option.WithEndpoint(srv.Addr),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	p := client.Publisher(topic)
+	t.Cleanup(p.Stop)
+	return srv, p
+}
+
+// fakeForwarder records the messages it forwards, and fails to forward those whose IDs are in
+// fail.
+type fakeForwarder struct {
+	fail      map[string]bool
+	forwarded []string
+
+	// invalid are the IDs of the forwarded messages that were marked as invalid.
+	invalid []string
+}
+
+func (f *fakeForwarder) Forward(ctx context.Context, msgs []message) []error {
+	errs := make([]error, len(msgs))
+	for i, m := range msgs {
+		if f.fail[m.ID] {
+			errs[i] = errors.New("unavailable")
+			continue
+		}
+		f.forwarded = append(f.forwarded, m.ID)
+		if m.Invalid != "" {
+			f.invalid = append(f.invalid, m.ID)
+		}
+	}
+	return errs
+}
+
+func TestDecode(t *testing.T) {
+	valid, err := proto.Marshal(testutil.FullyPopulatedMeasurementProto())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	invalid, err := proto.Marshal(invalidMeasurement())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		s       string
+		want    []byte
+		wantErr bool
+	}{
+		{"valid", encode(t, testutil.FullyPopulatedMeasurementProto()), valid, false},
+		{"not_base64", "not base64!", []byte("not base64!"), true},
+		{"not_protobuf", base64.StdEncoding.EncodeToString([]byte("spam")), []byte("spam"), true},
+		{"invalid", encode(t, invalidMeasurement()), invalid, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := decode(tc.s)
+			if tc.wantErr && err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// Invalid messages are still forwarded, so as much of them as could be decoded is
+			// returned.
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandlePubSub(t *testing.T) {
+	ctx := context.Background()
+	srv, p := newPubSub(t)
+	b := bridge{forwarder: pubSubForwarder{publisher: p}}
+
+	m := testutil.FullyPopulatedMeasurementProto()
+	got, err := b.handle(ctx, jsonString(t, encode(t, m)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != "ok" {
+		t.Errorf("got %v, want ok", got)
+	}
+
+	// Invalid measurements are rejected, but forwarded marked as invalid so that the push
+	// handler quarantines them.
+	if _, err := b.handle(ctx, jsonString(t, encode(t, invalidMeasurement()))); err != nil {
+		t.Errorf("Unexpected error for invalid measurement: %v", err)
+	}
+
+	msgs := srv.Messages()
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages published, want 2", len(msgs))
+	}
+
+	published := &mpb.Measurement{}
+	if err := proto.Unmarshal(msgs[0].Data, published); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !proto.Equal(published, m) {
+		t.Errorf("published %v, want %v", published, m)
+	}
+	if diff := cmp.Diff(map[string]string{"source": "AWS"}, msgs[0].Attributes); diff != "" {
+		t.Errorf("Unexpected attributes (-want +got):\n%s", diff)
+	}
+	if got := msgs[1].Attributes["invalid"]; !strings.Contains(got, "device_id") {
+		t.Errorf("got invalid attribute %q, want the reason that the device ID is invalid", got)
+	}
+}
+
+func TestHandleSQS(t *testing.T) {
+	valid := encode(t, testutil.FullyPopulatedMeasurementProto())
+
+	batch := events.SQSEvent{
+		Records: []events.SQSMessage{
+			{MessageId: "json", Body: string(jsonString(t, valid))},
+			{MessageId: "base64", Body: valid},
+			{MessageId: "invalid", Body: string(jsonString(t, encode(t, invalidMeasurement())))},
+			{MessageId: "garbage", Body: "spam"},
+			{MessageId: "unavailable", Body: valid},
+		},
+	}
+	event, err := json.Marshal(batch)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	f := &fakeForwarder{fail: map[string]bool{"unavailable": true}}
+	b := bridge{forwarder: f}
+
+	got, err := b.handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Invalid messages are forwarded marked as invalid, so that the push handler quarantines
+	// them. Only messages that failed to be forwarded are reported as failures.
+	want := events.SQSEventResponse{
+		BatchItemFailures: []events.SQSBatchItemFailure{{ItemIdentifier: "unavailable"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected response (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"json", "base64", "invalid", "garbage"}, f.forwarded); diff != "" {
+		t.Errorf("Unexpected forwarded messages (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"invalid", "garbage"}, f.invalid); diff != "" {
+		t.Errorf("Unexpected invalid messages (-want +got):\n%s", diff)
+	}
+
+	if _, err := b.handle(context.Background(), json.RawMessage(`{"foo": "bar"}`)); err == nil {
+		t.Error("expected error for unrecognized event, got nil")
+	}
+}
+
+func TestHTTPSForwarder(t *testing.T) {
+	var got []pushRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("token") != "secret" || r.Header.Get("Authorization") != "Bearer id-token" {
+			http.Error(w, "Bad token", http.StatusUnauthorized)
+			return
+		}
+
+		var req pushRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(req.Message.Data) == 0 {
+			http.Error(w, "Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		got = append(got, req)
+	}))
+	defer srv.Close()
+
+	f := httpsForwarder{
+		url:    srv.URL + "/push-handlers/telemetry?token=secret",
+		tokens: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "id-token"}),
+		client: srv.Client(),
+	}
+
+	errs := f.Forward(context.Background(), []message{
+		{ID: "1", Data: []byte("foo")},
+		{ID: "2"},
+	})
+	if errs[0] != nil {
+		t.Errorf("Unexpected error: %v", errs[0])
+	}
+	if errs[1] == nil {
+		t.Error("expected error, got nil")
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("got %d requests, want 1", len(got))
+	}
+	if got[0].Message.ID != "1" || string(got[0].Message.Data) != "foo" || got[0].Message.Attributes["source"] != "AWS" {
+		t.Errorf("Unexpected request: %+v", got[0])
+	}
+
+	f.tokens = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "wrong"})
+	if errs := f.Forward(context.Background(), []message{{ID: "3", Data: []byte("foo")}}); errs[0] == nil {
+		t.Error("expected error for bad token, got nil")
+	}
+}
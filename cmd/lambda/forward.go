@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+	"golang.org/x/oauth2"
+)
+
+// sourceAttribute is the value of the "source" attribute of forwarded messages, so that the push
+// handler can be told to ignore them if need be.
+const sourceAttribute = "AWS"
+
+// attributes returns the attributes of the forwarded message.
+func (m message) attributes() map[string]string {
+	attrs := map[string]string{"source": sourceAttribute}
+	if m.Invalid != "" {
+		attrs["invalid"] = m.Invalid
+	}
+	return attrs
+}
+
+// publisher is the part of *pubsub.Publisher used by pubSubForwarder.
+type publisher interface {
+	Publish(ctx context.Context, msg *pubsub.Message) *pubsub.PublishResult
+}
+
+// pubSubForwarder publishes measurements to a Pub/Sub topic that pushes to the web app's push
+// endpoint. The publisher should be made once and reused by every invocation of the function, so
+// that each invocation doesn't pay for connecting to Pub/Sub.
+type pubSubForwarder struct {
+	publisher publisher
+}
+
+// Forward implements forwarder. The messages are published in batches.
+func (f pubSubForwarder) Forward(ctx context.Context, msgs []message) []error {
+	results := make([]*pubsub.PublishResult, len(msgs))
+	for i, m := range msgs {
+		results[i] = f.publisher.Publish(ctx, &pubsub.Message{
+			Data:       m.Data,
+			Attributes: m.attributes(),
+		})
+	}
+
+	errs := make([]error, len(msgs))
+	for i, r := range results {
+		if _, err := r.Get(ctx); err != nil {
+			errs[i] = fmt.Errorf("failed to publish to Pub/Sub: %w", err)
+		}
+	}
+	return errs
+}
+
+// pushMessage and pushRequest are the form in which Pub/Sub pushes messages.
+// See https://cloud.google.com/pubsub/docs/push.
+type pushMessage struct {
+	ID          string            `json:"message_id"`
+	Data        []byte            `json:"data"`
+	Attributes  map[string]string `json:"attributes"`
+	PublishTime time.Time         `json:"publish_time"`
+}
+
+type pushRequest struct {
+	Message      pushMessage `json:"message"`
+	Subscription string      `json:"subscription"`
+}
+
+// httpsForwarder posts measurements straight to the web app's push endpoint in the form that
+// Pub/Sub pushes them, so that Pub/Sub isn't needed.
+type httpsForwarder struct {
+	// url is the URL of the push endpoint, including its verification token.
+	url string
+
+	// tokens gives the tokens that authenticate requests, e.g. Google-signed ID tokens whose
+	// audience is the endpoint's. They're sent as bearer tokens.
+	tokens oauth2.TokenSource
+
+	client *http.Client
+}
+
+func (f httpsForwarder) post(ctx context.Context, m message) error {
+	body, err := json.Marshal(pushRequest{
+		Message: pushMessage{
+			ID:          m.ID,
+			Data:        m.Data,
+			Attributes:  m.attributes(),
+			PublishTime: time.Now().UTC(),
+		},
+		Subscription: "lambda",
+	})
+	if err != nil {
+		return err
+	}
+
+	token, err := f.tokens.Token()
+	if err != nil {
+		return fmt.Errorf("failed to get token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	token.SetAuthHeader(req)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push endpoint returned %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	return nil
+}
+
+// Forward implements forwarder. The messages are posted one at a time.
+func (f httpsForwarder) Forward(ctx context.Context, msgs []message) []error {
+	errs := make([]error, len(msgs))
+	for i, m := range msgs {
+		errs[i] = f.post(ctx, m)
+	}
+	return errs
+}
@@ -1,11 +1,15 @@
-// Binary lambda is an AWS Lambda function that receives IoT telemetry messages and re-publishes them to Google Cloud Pub/Sub.
+// Binary lambda is an AWS Lambda function that receives IoT telemetry messages and forwards them
+// to the web app, either by publishing them to Google Cloud Pub/Sub or by posting them straight
+// to its push endpoint. It can be invoked by an AWS IoT rule with one message at a time, or by
+// SQS with batches of them.
 package main
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
 	"time"
 
 	"cloud.google.com/go/pubsub/v2"
@@ -13,40 +17,23 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
-	"github.com/maypok86/otter/v2"
-	mpb "github.com/mtraver/environmental-sensor/measurementpb"
 	"github.com/mtraver/envtools"
-	"golang.org/x/oauth2/google"
+	"google.golang.org/api/idtoken"
 	"google.golang.org/api/option"
-	"google.golang.org/protobuf/proto"
 )
 
 const (
-	gcpCredentialsScope = "https://www.googleapis.com/auth/pubsub"
+	// forwardToEnvVar is the name of the env var that says how to forward measurements:
+	// "pubsub" (the default) or "https".
+	forwardToEnvVar = "FORWARD_TO"
 
-	cacheTTL = 24 * 7 * time.Hour
+	pushTimeout = 30 * time.Second
 )
 
-var (
-	gcpProjectID    = envtools.MustGetenv("GCP_PROJECT_ID")
-	pubSubTopicName = envtools.MustGetenv("GCP_PUBSUB_TOPIC")
-
-	secretsManagerRegion = envtools.MustGetenv("AWS_SECRETS_MANAGER_REGION")
-	secretName           = envtools.MustGetenv("GCP_CREDENTIALS_SECRET_NAME")
-
-	cache = otter.Must(&otter.Options[string, string]{
-		MaximumSize:      1, // We only ever set or get the key secretName, which is a const.
-		ExpiryCalculator: otter.ExpiryWriting[string, string](cacheTTL),
-	})
-)
-
-func getServiceAccountKey(ctx context.Context) (*google.Credentials, error) {
-	entry, ok := cache.GetEntry(secretName)
-	if ok && entry.Value != "" {
-		return google.CredentialsFromJSON(ctx, []byte(entry.Value), gcpCredentialsScope)
-	}
-
-	config, err := config.LoadDefaultConfig(ctx, config.WithRegion(secretsManagerRegion))
+// getServiceAccountKey gets the JSON key of the GCP service account to authenticate as from
+// Secrets Manager.
+func getServiceAccountKey(ctx context.Context, region, secretName string) ([]byte, error) {
+	config, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
 	if err != nil {
 		return nil, err
 	}
@@ -62,66 +49,59 @@ func getServiceAccountKey(ctx context.Context) (*google.Credentials, error) {
 		return nil, err
 	}
 
-	// Decrypt the secret using the associated KMS key.
-	key := *result.SecretString
-
-	cache.Set(secretName, key)
-
-	return google.CredentialsFromJSON(ctx, []byte(key), gcpCredentialsScope)
+	return []byte(*result.SecretString), nil
 }
 
 func fullyQualifiedTopic(projectID, topicID string) string {
 	return fmt.Sprintf("projects/%s/topics/%s", projectID, topicID)
 }
 
-func handle(ctx context.Context, message string) (string, error) {
-	// message is unmarshaled from JSON before being passed into this function, and
-	// because on the other end the message was made by JSON-encoding a byte slice,
-	// the unmarshaled JSON here is a base64-encoded string. Decode from base64 to get
-	// the bytes of the marshaled protobuf.
-	protoBytes, err := base64.StdEncoding.DecodeString(message)
+// newForwarder makes the forwarder configured by the environment.
+func newForwarder(ctx context.Context) (forwarder, error) {
+	key, err := getServiceAccountKey(ctx, envtools.MustGetenv("AWS_SECRETS_MANAGER_REGION"), envtools.MustGetenv("GCP_CREDENTIALS_SECRET_NAME"))
 	if err != nil {
-		log.Printf("Failed to decode base64: %v", err)
-		return "error", err
-	}
-
-	// Unmarshal the protobuf to make sure that it is indeed a valid Measurement that we've received.
-	m := &mpb.Measurement{}
-	if err := proto.Unmarshal(protoBytes, m); err != nil {
-		log.Printf("Failed to unmarshal protobuf: %v", err)
-		return "error", err
+		return nil, fmt.Errorf("failed to get service account key from Secrets Manager: %w", err)
 	}
 
-	serviceAccountKey, err := getServiceAccountKey(ctx)
-	if err != nil {
-		log.Printf("Failed to get service account key from Secrets Manager: %v", err)
-		return "error", err
+	switch to := os.Getenv(forwardToEnvVar); to {
+	case "", "pubsub":
+		projectID := envtools.MustGetenv("GCP_PROJECT_ID")
+
+		// The client outlives ctx. It's closed when the function's execution environment is
+		// shut down.
+		client, err := pubsub.NewClient(context.Background(), projectID, option.WithAuthCredentialsJSON(option.ServiceAccount, key))
+		if err != nil {
+			return nil, fmt.Errorf("failed to make Pub/Sub client: %w", err)
+		}
+
+		return pubSubForwarder{
+			publisher: client.Publisher(fullyQualifiedTopic(projectID, envtools.MustGetenv("GCP_PUBSUB_TOPIC"))),
+		}, nil
+	case "https":
+		// The push endpoint accepts Google-signed ID tokens whose audience is its
+		// PUBSUB_AUDIENCE, which the service account can get for itself.
+		tokens, err := idtoken.NewTokenSource(context.Background(), envtools.MustGetenv("PUSH_AUDIENCE"), option.WithAuthCredentialsJSON(option.ServiceAccount, key))
+		if err != nil {
+			return nil, fmt.Errorf("failed to make ID token source: %w", err)
+		}
+
+		return httpsForwarder{
+			url:    envtools.MustGetenv("PUSH_URL"),
+			tokens: tokens,
+			client: &http.Client{Timeout: pushTimeout},
+		}, nil
+	default:
+		return nil, fmt.Errorf("$%s must be \"pubsub\" or \"https\", not %q", forwardToEnvVar, to)
 	}
+}
 
-	client, err := pubsub.NewClient(ctx, gcpProjectID, option.WithCredentials(serviceAccountKey))
+func main() {
+	// Make the forwarder once, when the execution environment starts, so that every invocation
+	// reuses it.
+	f, err := newForwarder(context.Background())
 	if err != nil {
-		log.Printf("Failed to make Pub/Sub client: %v", err)
-		return "error", err
-	}
-
-	publisher := client.Publisher(fullyQualifiedTopic(gcpProjectID, pubSubTopicName))
-	defer publisher.Stop()
-
-	r := publisher.Publish(ctx, &pubsub.Message{
-		Data: protoBytes,
-		Attributes: map[string]string{
-			"source": "AWS",
-		},
-	})
-
-	if _, err := r.Get(ctx); err != nil {
-		log.Printf("Failed to publish to Pub/Sub: %v", err)
-		return "error", err
+		log.Fatalf("Failed to set up forwarding: %v", err)
 	}
 
-	return "ok", nil
-}
-
-func main() {
-	lambda.Start(handle)
+	lambda.Start(bridge{forwarder: f}.handle)
 }
@@ -0,0 +1,182 @@
+// Binary mqttingest subscribes to the topics that devices publish measurements to on an MQTT
+// broker and saves the measurements, so that the backend can run without AWS Lambda or
+// Pub/Sub. Run as many as needed with the same -group; the broker splits messages between them.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/mtraver/environmental-sensor/alert"
+	"github.com/mtraver/environmental-sensor/apiauth"
+	"github.com/mtraver/environmental-sensor/ingest"
+	"github.com/mtraver/environmental-sensor/routing"
+	"github.com/mtraver/environmental-sensor/web/db"
+	"github.com/mtraver/envtools"
+)
+
+const (
+	datastoreKind = "measurement"
+
+	disconnectTimeout = 10 * time.Second
+
+	// The names of the env vars that configure ingestion, which match those of the web app.
+	alertChannelsEnvVar  = "ALERT_CHANNELS"
+	influxDBServerEnvVar = "INFLUXDB_SERVER"
+
+	// passwordEnvVar is the name of the env var that may contain the password to connect to the
+	// broker with.
+	passwordEnvVar = "MQTT_PASSWORD"
+)
+
+var (
+	brokerURL  string
+	topic      string
+	group      string
+	clientID   string
+	username   string
+	caFile     string
+	certFile   string
+	keyFile    string
+	retryDelay time.Duration
+)
+
+func init() {
+	flag.StringVar(&brokerURL, "broker", "", "URL of the MQTT broker, e.g. mqtts://broker.example.com:8883")
+	flag.StringVar(&topic, "topic", "", "topic filter that devices publish measurements to, e.g. devices/+/telemetry")
+	flag.StringVar(&group, "group", "mqttingest", "shared subscription group; if empty, the subscription isn't shared")
+	flag.StringVar(&clientID, "client-id", "", "MQTT client ID, which must be unique to this instance and the same each time it runs (default the hostname)")
+	flag.StringVar(&username, "username", "", "user name to connect with; the password is read from $"+passwordEnvVar)
+	flag.StringVar(&caFile, "ca", "", "PEM file of CAs that must have signed the broker's certificate (default the system's)")
+	flag.StringVar(&certFile, "cert", "", "PEM client certificate file to connect with")
+	flag.StringVar(&keyFile, "key", "", "PEM private key file for -cert")
+	flag.DurationVar(&retryDelay, "retry-delay", 10*time.Second, "how long to wait before trying again to save a measurement")
+
+	flag.Usage = func() {
+		message := `usage: mqttingest -broker URL -topic FILTER [options]
+
+Measurements are saved to Datastore, and to InfluxDB if $INFLUXDB_SERVER is set.
+Routing rules are applied, and alert rules are evaluated and notify the
+channels in $ALERT_CHANNELS, as in the web app.
+
+Options:
+`
+
+		fmt.Fprint(flag.CommandLine.Output(), message)
+		flag.PrintDefaults()
+	}
+}
+
+func parseFlags() error {
+	flag.Parse()
+
+	if brokerURL == "" {
+		return errors.New("-broker must be given")
+	}
+	if topic == "" {
+		return errors.New("-topic must be given")
+	}
+	if retryDelay <= 0 {
+		return errors.New("-retry-delay must be positive")
+	}
+
+	if clientID == "" {
+		var err error
+		clientID, err = os.Hostname()
+		if err != nil {
+			return fmt.Errorf("-client-id not given and failed to get hostname: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	if err := parseFlags(); err != nil {
+		fmt.Printf("argument error: %v\n", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	u, err := url.Parse(brokerURL)
+	if err != nil {
+		log.Fatalf("Failed to parse broker URL: %v", err)
+	}
+
+	projectID := os.Getenv("PROJECT_ID")
+	if projectID == "" && metadata.OnGCE() {
+		projectID, err = metadata.ProjectID()
+		if err != nil {
+			log.Fatalf("Failed to get project ID: %v", err)
+		}
+	}
+
+	database, err := db.NewDatastoreDB(projectID, datastoreKind)
+	if err != nil {
+		log.Fatalf("Failed to make datastore DB: %v", err)
+	}
+
+	channels, err := alert.ParseChannels(os.Getenv(alertChannelsEnvVar))
+	if err != nil {
+		log.Fatalf("Failed to parse $%s: %v", alertChannelsEnvVar, err)
+	}
+
+	sub := &subscriber{
+		pipeline: ingest.Pipeline{
+			Database:  database,
+			Dedupe:    database,
+			Alerts:    alert.NewEvaluator(database, database, database, channels, alert.DefaultCacheTTL),
+			Router:    routing.NewRouter(database, routing.DefaultCacheTTL),
+			MaxAge:    ingest.DefaultMaxAge,
+			MaxFuture: ingest.DefaultMaxFuture,
+		},
+		topic:      topic,
+		group:      group,
+		retryDelay: retryDelay,
+	}
+	if server := os.Getenv(influxDBServerEnvVar); server != "" {
+		sub.pipeline.InfluxDB = db.NewInfluxDB(server, envtools.MustGetenv("INFLUXDB_TOKEN"), envtools.MustGetenv("INFLUXDB_ORG"), envtools.MustGetenv("INFLUXDB_BUCKET"))
+	}
+
+	// We'll run until cancelled (e.g. ctrl-c). Measurements that are being retried then are
+	// left unacknowledged, so the broker delivers them again.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	config := sub.config(ctx, u, clientID)
+	config.ConnectUsername = username
+	if password := os.Getenv(passwordEnvVar); password != "" {
+		config.ConnectPassword = []byte(password)
+	}
+	if caFile != "" || certFile != "" || keyFile != "" {
+		config.TlsCfg, err = apiauth.ClientTLSConfig(caFile, certFile, keyFile)
+		if err != nil {
+			log.Fatalf("Failed to load TLS config: %v", err)
+		}
+	}
+
+	// Connect to the broker and reconnect until the context is cancelled.
+	cm, err := autopaho.NewConnection(ctx, config)
+	if err != nil {
+		log.Fatalf("Failed to create MQTT connection: %v", err)
+	}
+
+	<-ctx.Done()
+
+	log.Println("Disconnecting from MQTT broker...")
+	disconnectCtx, cancel := context.WithTimeout(context.Background(), disconnectTimeout)
+	defer cancel()
+	if err := cm.Disconnect(disconnectCtx); err != nil {
+		log.Printf("Error during disconnect: %v", err)
+	}
+}
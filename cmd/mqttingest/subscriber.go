@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/mtraver/environmental-sensor/ingest"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	subscribeTimeout = 10 * time.Second
+
+	// sessionExpiry is how long, in seconds, the broker keeps the subscriber's session, and
+	// so the messages it hasn't acknowledged, after it disconnects.
+	sessionExpiry = 60 * 60
+)
+
+// subscriber saves the measurements that devices publish to an MQTT broker.
+//
+// Messages are acknowledged only once their measurement is saved, or once it's clear that it
+// never can be, so delivery is at least once: if the subscriber stops before acknowledging a
+// message then the broker delivers it again. Subscribers that share a group split the messages
+// between them, so more can be run to keep up with more devices.
+type subscriber struct {
+	pipeline ingest.Pipeline
+
+	// topic is the topic filter that devices publish to, e.g. "devices/+/telemetry".
+	topic string
+
+	// group is the name of the shared subscription group. If it's empty then the subscription
+	// isn't shared and every subscriber receives every message.
+	group string
+
+	// retryDelay is how long to wait before trying again to save a measurement.
+	retryDelay time.Duration
+}
+
+// subscription returns the topic filter to subscribe to.
+func (s *subscriber) subscription() string {
+	if s.group == "" {
+		return s.topic
+	}
+	return fmt.Sprintf("$share/%s/%s", s.group, s.topic)
+}
+
+// config returns the config of a connection to the broker at u, with the given client ID, that
+// saves the measurements it receives until ctx is done. The client ID must be the same each time
+// the subscriber runs so that it resumes its session.
+func (s *subscriber) config(ctx context.Context, u *url.URL, clientID string) autopaho.ClientConfig {
+	return autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{u},
+		KeepAlive:                     20,
+		CleanStartOnInitialConnection: false,
+		SessionExpiryInterval:         sessionExpiry,
+		OnConnectionUp:                s.onConnectionUp,
+		OnConnectError: func(err error) {
+			log.Printf("Error while attempting to connect to MQTT broker: %v", err)
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID:                   clientID,
+			EnableManualAcknowledgment: true,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				func(pr paho.PublishReceived) (bool, error) {
+					return s.handle(ctx, pr)
+				},
+			},
+			OnClientError: func(err error) {
+				log.Printf("Client error: %v", err)
+			},
+		},
+	}
+}
+
+func (s *subscriber) onConnectionUp(cm *autopaho.ConnectionManager, connAck *paho.Connack) {
+	log.Println("Connected to MQTT broker")
+
+	// The subscription is part of the session, but subscribe anyway in case the session expired.
+	ctx, cancel := context.WithTimeout(context.Background(), subscribeTimeout)
+	defer cancel()
+	if _, err := cm.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{
+			{Topic: s.subscription(), QoS: 1},
+		},
+	}); err != nil {
+		log.Printf("Failed to subscribe to %q: %v", s.subscription(), err)
+		return
+	}
+	log.Printf("Subscribed to %q", s.subscription())
+}
+
+// decode decodes a payload published by iotcorelogger: a marshaled Measurement, JSON-encoded as
+// a byte slice (i.e. as a base64 string) because that's what AWS IoT Core passes on to Lambda.
+func decode(payload []byte) (*mpb.Measurement, error) {
+	var b []byte
+	if err := json.Unmarshal(payload, &b); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON: %w", err)
+	}
+
+	m := &mpb.Measurement{}
+	if err := proto.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal protobuf: %w", err)
+	}
+	return m, nil
+}
+
+// handle saves the measurement in a message and then acknowledges the message. Messages that
+// can't be decoded or that hold invalid measurements are acknowledged and dropped, because
+// delivering them again won't help. If the measurement can't be saved then handle tries again
+// until it's saved or ctx is done, in which case the message isn't acknowledged.
+func (s *subscriber) handle(ctx context.Context, pr paho.PublishReceived) (bool, error) {
+	if err := s.save(ctx, pr.Packet); err != nil {
+		return false, err
+	}
+
+	if err := pr.Client.Ack(pr.Packet); err != nil {
+		log.Printf("Failed to acknowledge message: %v", err)
+	}
+	return true, nil
+}
+
+func (s *subscriber) save(ctx context.Context, p *paho.Publish) error {
+	m, err := decode(p.Payload)
+	if err != nil {
+		log.Printf("Dropping message published to %q: %v", p.Topic, err)
+		return nil
+	}
+
+	for {
+		err := s.pipeline.Ingest(ctx, m)
+		switch {
+		case errors.Is(err, ingest.ErrInvalid):
+			log.Printf("Dropping message published to %q: %v", p.Topic, err)
+			return nil
+		case err == nil, errors.Is(err, ingest.ErrIgnored), errors.Is(err, ingest.ErrDuplicate):
+			return nil
+		}
+
+		log.Printf("Failed to save measurement from %q, retrying in %v: %v", m.GetDeviceId(), s.retryDelay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.retryDelay):
+		}
+	}
+}
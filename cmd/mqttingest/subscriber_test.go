@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/google/go-cmp/cmp"
+	"github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mtraver/environmental-sensor/database"
+	"github.com/mtraver/environmental-sensor/ingest"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/testutil"
+	"github.com/mtraver/environmental-sensor/web/db"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+	tspb "google.golang.org/protobuf/types/known/timestamppb"
+	wpb "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	testTopic    = "devices/foo/telemetry"
+	testClientID = "mqttingest-test"
+)
+
+var (
+	foo0 = &mpb.Measurement{DeviceId: "foo", Timestamp: tspb.New(testutil.Timestamp), Temp: wpb.Float(20)}
+	foo1 = &mpb.Measurement{DeviceId: "foo", Timestamp: tspb.New(testutil.Timestamp.Add(time.Minute)), Temp: wpb.Float(21)}
+)
+
+// payload encodes m the same way that iotcorelogger's Monitor.Publish does.
+func payload(t *testing.T, m *mpb.Measurement) []byte {
+	t.Helper()
+
+	b, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	b, err = json.Marshal(b)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return b
+}
+
+// flakySaver fails to save the first failures measurements, or every measurement if failures is
+// negative.
+type flakySaver struct {
+	ingest.Saver
+	failures int32
+	calls    atomic.Int32
+}
+
+func (s *flakySaver) Save(ctx context.Context, m *mpb.Measurement) error {
+	if n := s.calls.Add(1); s.failures < 0 || n <= s.failures {
+		return errors.New("spam")
+	}
+	return s.Saver.Save(ctx, m)
+}
+
+// newBroker starts an embedded MQTT broker and returns it and its URL.
+func newBroker(t *testing.T) (*mqtt.Server, *url.URL) {
+	t.Helper()
+
+	srv := mqtt.New(&mqtt.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err := srv.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: "127.0.0.1:0"})
+	if err := srv.AddListener(tcp); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.Serve(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	return srv, &url.URL{Scheme: "mqtt", Host: tcp.Address()}
+}
+
+// waitFor waits until cond is true.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// connect connects s to the broker and waits for it to subscribe.
+func connect(t *testing.T, ctx context.Context, s *subscriber, srv *mqtt.Server, u *url.URL) *autopaho.ConnectionManager {
+	t.Helper()
+
+	cm, err := autopaho.NewConnection(ctx, s.config(ctx, u, testClientID))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := cm.AwaitConnection(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	waitFor(t, "subscription", func() bool {
+		return len(srv.Topics.Subscribers(testTopic).Shared) > 0
+	})
+	return cm
+}
+
+func publish(t *testing.T, srv *mqtt.Server, b []byte) {
+	t.Helper()
+	if err := srv.Publish(testTopic, b, false, 1); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+// saved returns the database keys of the measurements saved to store.
+func saved(t *testing.T, store *db.MemoryDB) []string {
+	t.Helper()
+
+	page, err := store.Query(context.Background(), database.Query{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var keys []string
+	for _, sm := range page.Measurements {
+		keys = append(keys, sm.DBKey())
+	}
+	return keys
+}
+
+// unacknowledged returns the number of messages delivered to the subscriber that it hasn't
+// acknowledged.
+func unacknowledged(srv *mqtt.Server) int {
+	cl, ok := srv.Clients.Get(testClientID)
+	if !ok {
+		return 0
+	}
+	return cl.State.Inflight.Len()
+}
+
+func TestDecode(t *testing.T) {
+	got, err := decode(payload(t, foo0))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(foo0, got, protocmp.Transform()); diff != "" {
+		t.Errorf("Unexpected measurement (-want +got):\n%s", diff)
+	}
+
+	for _, b := range []string{`spam`, `"not base64!"`, `"c3BhbQ=="`} {
+		if _, err := decode([]byte(b)); err == nil {
+			t.Errorf("decode(%q): expected error, got nil", b)
+		}
+	}
+}
+
+func TestSubscriber(t *testing.T) {
+	srv, u := newBroker(t)
+	store := db.NewMemoryDB()
+	saver := &flakySaver{Saver: store, failures: 1}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := &subscriber{
+		pipeline:   ingest.Pipeline{Database: saver},
+		topic:      "devices/+/telemetry",
+		group:      "test",
+		retryDelay: 10 * time.Millisecond,
+	}
+	connect(t, ctx, s, srv, u)
+
+	// The first measurement is saved on the second try. Messages that will never be saved are
+	// acknowledged and dropped.
+	publish(t, srv, payload(t, foo0))
+	publish(t, srv, []byte("spam"))
+	publish(t, srv, payload(t, &mpb.Measurement{DeviceId: "FOO", Timestamp: foo0.Timestamp}))
+	publish(t, srv, payload(t, foo1))
+
+	waitFor(t, "measurements to be saved", func() bool {
+		return len(saved(t, store)) == 2
+	})
+	waitFor(t, "messages to be acknowledged", func() bool {
+		return unacknowledged(srv) == 0
+	})
+
+	if got := saver.calls.Load(); got != 3 {
+		t.Errorf("Got %d calls to Save, expected 3", got)
+	}
+}
+
+func TestSubscriberRedelivery(t *testing.T) {
+	srv, u := newBroker(t)
+	store := db.NewMemoryDB()
+
+	// The first subscriber can't save anything, so it never acknowledges the message and
+	// stops without doing so.
+	broken := &flakySaver{Saver: store, failures: -1}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &subscriber{
+		pipeline:   ingest.Pipeline{Database: broken},
+		topic:      testTopic,
+		group:      "test",
+		retryDelay: 10 * time.Millisecond,
+	}
+	cm := connect(t, ctx, s, srv, u)
+
+	publish(t, srv, payload(t, foo0))
+	waitFor(t, "a save attempt", func() bool {
+		return broken.calls.Load() > 0
+	})
+
+	cancel()
+	disconnectCtx, disconnectCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer disconnectCancel()
+	cm.Disconnect(disconnectCtx)
+
+	if got := unacknowledged(srv); got != 1 {
+		t.Fatalf("Got %d unacknowledged messages, expected 1", got)
+	}
+
+	// The broker delivers the message again when the subscriber resumes its session.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	s.pipeline.Database = store
+	connect(t, ctx, s, srv, u)
+
+	waitFor(t, "measurement to be saved", func() bool {
+		return len(saved(t, store)) == 1
+	})
+	waitFor(t, "message to be acknowledged", func() bool {
+		return unacknowledged(srv) == 0
+	})
+}
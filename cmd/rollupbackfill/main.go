@@ -0,0 +1,113 @@
+// Binary rollupbackfill rebuilds hourly and daily rollups from the raw measurements in Datastore.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/measurement"
+	"github.com/mtraver/environmental-sensor/rollup"
+	"github.com/mtraver/environmental-sensor/web/db"
+)
+
+const (
+	datastoreKind = "measurement"
+
+	dateFormat = "2006-01-02"
+)
+
+var (
+	projectID string
+	startDate string
+	endDate   string
+	dryRun    bool
+)
+
+type Database interface {
+	Between(ctx context.Context, startTime time.Time, endTime time.Time) (map[string][]measurement.StorableMeasurement, error)
+	PutRollups(ctx context.Context, buckets []rollup.Bucket) error
+}
+
+// backfillDay recomputes all rollups for the UTC day starting at day. Daily buckets are
+// aligned to UTC days, so each day's buckets are computed from that day's measurements
+// alone and stored buckets can simply be overwritten.
+func backfillDay(ctx context.Context, database Database, day time.Time) (int, error) {
+	measurements, err := database.Between(ctx, day, day.Add(rollup.Daily.Duration()-time.Nanosecond))
+	if err != nil {
+		return 0, err
+	}
+
+	var buckets []rollup.Bucket
+	for _, sms := range measurements {
+		for _, res := range rollup.Resolutions {
+			buckets = append(buckets, rollup.Compute(sms, res)...)
+		}
+	}
+
+	if dryRun || len(buckets) == 0 {
+		return len(buckets), nil
+	}
+
+	return len(buckets), database.PutRollups(ctx, buckets)
+}
+
+func init() {
+	flag.StringVar(&projectID, "project", os.Getenv("GOOGLE_CLOUD_PROJECT"), "Google Cloud project ID")
+	flag.StringVar(&startDate, "start", "", "first day (UTC) to backfill, formatted like "+dateFormat)
+	flag.StringVar(&endDate, "end", "", "last day (UTC) to backfill, formatted like "+dateFormat+" (default today)")
+	flag.BoolVar(&dryRun, "n", false, "dry run: compute rollups but don't write them")
+
+	flag.Usage = func() {
+		message := `usage: rollupbackfill -start date [options]
+
+Recomputes hourly and daily rollups from raw measurements, one day at a time,
+overwriting any existing rollups for those days.
+
+Options:
+`
+
+		fmt.Fprint(flag.CommandLine.Output(), message)
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	if projectID == "" || startDate == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	start, err := time.Parse(dateFormat, startDate)
+	if err != nil {
+		log.Fatalf("Bad -start: %v", err)
+	}
+
+	end := rollup.Daily.Truncate(time.Now())
+	if endDate != "" {
+		end, err = time.Parse(dateFormat, endDate)
+		if err != nil {
+			log.Fatalf("Bad -end: %v", err)
+		}
+	}
+
+	database, err := db.NewDatastoreDB(projectID, datastoreKind)
+	if err != nil {
+		log.Fatalf("Failed to make datastore DB: %v", err)
+	}
+
+	ctx := context.Background()
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		n, err := backfillDay(ctx, database, day)
+		if err != nil {
+			log.Fatalf("Failed to backfill %s: %v", day.Format(dateFormat), err)
+		}
+
+		log.Printf("%s: %d buckets", day.Format(dateFormat), n)
+	}
+}
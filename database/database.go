@@ -7,6 +7,7 @@ import (
 	"github.com/maypok86/otter/v2/stats"
 	"github.com/mtraver/environmental-sensor/measurement"
 	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/rollup"
 )
 
 type Database interface {
@@ -14,6 +15,11 @@ type Database interface {
 	Since(ctx context.Context, startTime time.Time) (map[string][]measurement.StorableMeasurement, error)
 	DelayedSince(ctx context.Context, startTime time.Time) (map[string][]measurement.StorableMeasurement, error)
 	Between(ctx context.Context, startTime time.Time, endTime time.Time) (map[string][]measurement.StorableMeasurement, error)
+	Query(ctx context.Context, q Query) (Page, error)
 	Latest(ctx context.Context, deviceIDs []string) (map[string]measurement.StorableMeasurement, error)
+	Oldest(ctx context.Context) (measurement.StorableMeasurement, bool, error)
+	Delete(ctx context.Context, measurements []measurement.StorableMeasurement) error
+	Rollups(ctx context.Context, res rollup.Resolution, deviceIDs []string, startTime time.Time, endTime time.Time) (map[string][]rollup.Bucket, error)
+	PutRollups(ctx context.Context, buckets []rollup.Bucket) error
 	CacheStats() stats.Stats
 }
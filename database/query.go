@@ -0,0 +1,74 @@
+package database
+
+import (
+	"slices"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/measurement"
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+// Query selects measurements, in timestamp order, for Database.Query.
+type Query struct {
+	// Only measurements with a timestamp greater than or equal to StartTime and less than or
+	// equal to EndTime are returned. A zero EndTime means there is no upper bound.
+	StartTime time.Time
+	EndTime   time.Time
+
+	// If non-empty, only measurements from these devices are returned.
+	DeviceIDs []string
+
+	// If non-empty, only measurements with a value for at least one of these metrics are
+	// returned, and all other metrics are cleared.
+	Metrics []metric.Key
+
+	// The maximum number of measurements to return. Zero means no limit.
+	Limit int
+
+	// If non-empty, the query resumes after the measurement with this cursor. Cursors are
+	// opaque and are only meaningful to the Database that returned them.
+	Cursor string
+}
+
+// Page is one page of the results of a Query.
+type Page struct {
+	Measurements []measurement.StorableMeasurement
+
+	// Cursors[i] is the cursor that resumes the query after Measurements[i].
+	Cursors []string
+
+	// HasNextPage is true if there are more results after the last measurement.
+	HasNextPage bool
+
+	// End, if non-empty, is the cursor that resumes the query after the page. It's set if the
+	// Database stopped reading before filling the page, so the next page starts after the
+	// measurements it read rather than after the last one it returned.
+	End string
+}
+
+// EndCursor returns the cursor that resumes the query after the page, or the empty string if
+// the page is empty and the query can't be resumed.
+func (p Page) EndCursor() string {
+	if p.End != "" {
+		return p.End
+	}
+	if len(p.Cursors) == 0 {
+		return ""
+	}
+
+	return p.Cursors[len(p.Cursors)-1]
+}
+
+// Match reports whether sm is selected by q's device and metric filters, not including the time
+// range. If q has a metric filter then Match clears the metrics of sm that aren't selected.
+func (q Query) Match(sm *measurement.StorableMeasurement) bool {
+	if len(q.DeviceIDs) > 0 && !slices.Contains(q.DeviceIDs, sm.DeviceID) {
+		return false
+	}
+
+	if len(q.Metrics) > 0 {
+		return sm.KeepOnly(q.Metrics)
+	}
+
+	return true
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mtraver/environmental-sensor/measurement"
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+func floatPtr(f float32) *float32 {
+	return &f
+}
+
+func TestQueryMatch(t *testing.T) {
+	sm := measurement.StorableMeasurement{
+		DeviceID: "foo",
+		Temp:     floatPtr(18.5),
+		RH:       floatPtr(55.0),
+	}
+
+	cases := []struct {
+		name      string
+		q         Query
+		wantMatch bool
+		want      measurement.StorableMeasurement
+	}{
+		{
+			name:      "no_filters",
+			q:         Query{},
+			wantMatch: true,
+			want:      sm,
+		},
+		{
+			name:      "device_match",
+			q:         Query{DeviceIDs: []string{"bar", "foo"}},
+			wantMatch: true,
+			want:      sm,
+		},
+		{
+			name:      "device_mismatch",
+			q:         Query{DeviceIDs: []string{"bar"}},
+			wantMatch: false,
+		},
+		{
+			name:      "metric_match",
+			q:         Query{Metrics: []metric.Key{metric.RH}},
+			wantMatch: true,
+			want:      measurement.StorableMeasurement{DeviceID: "foo", RH: floatPtr(55.0)},
+		},
+		{
+			name:      "metric_mismatch",
+			q:         Query{Metrics: []metric.Key{metric.CO2}},
+			wantMatch: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := sm
+			if match := tc.q.Match(&got); match != tc.wantMatch {
+				t.Fatalf("got match = %v, want %v", match, tc.wantMatch)
+			}
+
+			if !tc.wantMatch {
+				return
+			}
+
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPageEndCursor(t *testing.T) {
+	if got := (Page{}).EndCursor(); got != "" {
+		t.Errorf("got %q, want empty string", got)
+	}
+
+	if got := (Page{Cursors: []string{"a", "b"}}).EndCursor(); got != "b" {
+		t.Errorf("got %q, want %q", got, "b")
+	}
+
+	if got := (Page{Cursors: []string{"a", "b"}, End: "c"}).EndCursor(); got != "c" {
+		t.Errorf("got %q, want %q", got, "c")
+	}
+}
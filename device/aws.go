@@ -0,0 +1,130 @@
+package device
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	awsiot "github.com/aws/aws-sdk-go-v2/service/iot"
+	"github.com/aws/aws-sdk-go-v2/service/iot/types"
+	fedident "github.com/mtraver/environmental-sensor/federatedidentity"
+)
+
+// AWS IoT thing attributes that, if set, are used to fill in the corresponding fields of
+// newly synced devices.
+const (
+	awsAttrDisplayName = "displayName"
+	awsAttrLocation    = "location"
+	awsAttrTimezone    = "timezone"
+	awsAttrOwner       = "owner"
+)
+
+// GetDevicesAWS gets all devices (called "things" in AWS IoT Core).
+func GetDevicesAWS(ctx context.Context, roleARN, region string) ([]types.ThingAttribute, error) {
+	var cfg aws.Config
+
+	// If we're on GCE, assume AWS role and fetch credentials.
+	if metadata.OnGCE() {
+		creds, err := fedident.GetCredentialsForRole(ctx, roleARN, region)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg, err = config.LoadDefaultConfig(
+			ctx, config.WithRegion(region), config.WithCredentialsProvider(creds))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		cfg, err = config.LoadDefaultConfig(ctx, config.WithRegion(region))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return listThings(ctx, awsiot.NewFromConfig(cfg))
+}
+
+// listThings gets every page of things.
+func listThings(ctx context.Context, client awsiot.ListThingsAPIClient) ([]types.ThingAttribute, error) {
+	var things []types.ThingAttribute
+
+	paginator := awsiot.NewListThingsPaginator(client, &awsiot.ListThingsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		things = append(things, page.Things...)
+	}
+
+	return things, nil
+}
+
+// GetDeviceIDsAWS gets the IDs of all devices (called "things" in AWS IoT Core).
+func GetDeviceIDsAWS(ctx context.Context, roleARN, region string) ([]string, error) {
+	things, err := GetDevicesAWS(ctx, roleARN, region)
+	if err != nil {
+		return []string{}, err
+	}
+
+	ids := make([]string, len(things))
+	for i, t := range things {
+		ids[i] = aws.ToString(t.ThingName)
+	}
+
+	return ids, nil
+}
+
+// SyncAWS makes sure that every AWS IoT thing is in the registry. Things that aren't registered
+// are added, using their attributes to fill in metadata. Things that are already registered only
+// have their ARN updated, so metadata edited in the registry is never overwritten. Devices that
+// aren't AWS IoT things are left alone. It returns the devices that were added or changed.
+func SyncAWS(ctx context.Context, reg Registry, things []types.ThingAttribute) ([]Device, error) {
+	var changed []Device
+	for _, t := range things {
+		name := aws.ToString(t.ThingName)
+		if name == "" {
+			continue
+		}
+
+		d, found, err := reg.DeviceByDeviceID(ctx, name)
+		if err != nil {
+			return changed, err
+		}
+
+		if found {
+			if d.AWSThingARN == aws.ToString(t.ThingArn) {
+				continue
+			}
+			d.AWSThingARN = aws.ToString(t.ThingArn)
+		} else {
+			d = Device{
+				DeviceID:    name,
+				AWSThingARN: aws.ToString(t.ThingArn),
+				DisplayName: t.Attributes[awsAttrDisplayName],
+				Location:    t.Attributes[awsAttrLocation],
+				Owner:       t.Attributes[awsAttrOwner],
+			}
+
+			// An invalid timezone would make the device fail validation, so just leave it empty.
+			if _, err := time.LoadLocation(t.Attributes[awsAttrTimezone]); err == nil {
+				d.Timezone = t.Attributes[awsAttrTimezone]
+			}
+		}
+
+		d, err = reg.PutDevice(ctx, d)
+		if err != nil {
+			return changed, err
+		}
+		changed = append(changed, d)
+	}
+
+	slices.SortFunc(changed, compareDeviceIDs)
+	return changed, nil
+}
@@ -0,0 +1,107 @@
+package device
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsiot "github.com/aws/aws-sdk-go-v2/service/iot"
+	"github.com/aws/aws-sdk-go-v2/service/iot/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// fakeThingLister returns each element of pages as one page of ListThings results.
+type fakeThingLister struct {
+	pages [][]types.ThingAttribute
+}
+
+func (f fakeThingLister) ListThings(ctx context.Context, in *awsiot.ListThingsInput, opts ...func(*awsiot.Options)) (*awsiot.ListThingsOutput, error) {
+	i := 0
+	if in.NextToken != nil {
+		i = len(*in.NextToken)
+	}
+
+	out := &awsiot.ListThingsOutput{Things: f.pages[i]}
+	if i+1 < len(f.pages) {
+		// Encode the index of the next page as the length of the token.
+		out.NextToken = aws.String(string(make([]byte, i+1)))
+	}
+
+	return out, nil
+}
+
+func thing(name string, attrs map[string]string) types.ThingAttribute {
+	return types.ThingAttribute{
+		ThingName:  aws.String(name),
+		ThingArn:   aws.String("arn:aws:iot:us-west-2:123456789012:thing/" + name),
+		Attributes: attrs,
+	}
+}
+
+func TestListThingsPaginates(t *testing.T) {
+	lister := fakeThingLister{pages: [][]types.ThingAttribute{
+		{thing("a", nil), thing("b", nil)},
+		{thing("c", nil)},
+		{thing("d", nil)},
+	}}
+
+	things, err := listThings(context.Background(), lister)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, th := range things {
+		got = append(got, aws.ToString(th.ThingName))
+	}
+
+	if diff := cmp.Diff(got, []string{"a", "b", "c", "d"}); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+}
+
+func TestSyncAWS(t *testing.T) {
+	ctx := context.Background()
+	reg := fakeRegistry{}
+
+	// A device whose metadata was edited in the registry.
+	edited, err := reg.PutDevice(ctx, Device{DeviceID: "kitchen", DisplayName: "Kitchen", Location: "Downstairs"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	things := []types.ThingAttribute{
+		thing("kitchen", map[string]string{"displayName": "Not the kitchen"}),
+		thing("bedroom", map[string]string{"displayName": "Bedroom", "location": "Upstairs", "timezone": "America/Los_Angeles", "owner": "alice"}),
+		thing("garage", map[string]string{"timezone": "Nowhere/Special"}),
+	}
+
+	changed, err := SyncAWS(ctx, reg, things)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []Device{
+		{DeviceID: "bedroom", AWSThingARN: aws.ToString(things[1].ThingArn), DisplayName: "Bedroom", Location: "Upstairs", Timezone: "America/Los_Angeles", Owner: "alice"},
+		{DeviceID: "garage", AWSThingARN: aws.ToString(things[2].ThingArn)},
+		{DeviceID: "kitchen", AWSThingARN: aws.ToString(things[0].ThingArn), DisplayName: "Kitchen", Location: "Downstairs"},
+	}
+	opts := cmpopts.IgnoreFields(Device{}, "ID", "Created", "Updated")
+	if diff := cmp.Diff(changed, want, opts); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+
+	if changed[2].ID != edited.ID {
+		t.Errorf("got ID %q for existing device, want %q", changed[2].ID, edited.ID)
+	}
+
+	// Syncing again changes nothing.
+	changed, err = SyncAWS(ctx, reg, things)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(changed) != 0 {
+		t.Errorf("got %d changed devices, want 0", len(changed))
+	}
+}
@@ -1,54 +1,308 @@
+// Package device models the devices that report measurements and provides a registry of them.
 package device
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
 
-	"cloud.google.com/go/compute/metadata"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	awsiot "github.com/aws/aws-sdk-go-v2/service/iot"
-	fedident "github.com/mtraver/environmental-sensor/federatedidentity"
+	"github.com/mtraver/environmental-sensor/aqi"
+	"github.com/mtraver/environmental-sensor/util"
 )
 
-// GetDevicesAWS gets all devices (called "things" in AWS IoT Core).
-func GetDevicesAWS(ctx context.Context, roleARN, region string) (*awsiot.ListThingsOutput, error) {
-	var cfg aws.Config
+var ErrNotFound = errors.New("device: not found")
 
-	// If we're on GCE, assume AWS role and fetch credentials.
-	if metadata.OnGCE() {
-		creds, err := fedident.GetCredentialsForRole(ctx, roleARN, region)
-		if err != nil {
-			return nil, err
-		}
+// pushTokenPrefix starts every push token so that push tokens are easy to tell apart from other
+// bearer tokens.
+const pushTokenPrefix = "edp_"
 
-		cfg, err = config.LoadDefaultConfig(
-			ctx, config.WithRegion(region), config.WithCredentialsProvider(creds))
-		if err != nil {
-			return nil, err
+// Visibility controls who can see a device and its measurements besides its owner, the users
+// it's shared with, and admins.
+type Visibility string
+
+const (
+	// Private devices can only be seen by their owner, the users they're shared with, and
+	// admins. Owned devices with no visibility are private.
+	Private Visibility = "private"
+
+	// Public devices can be seen by anyone, including callers who aren't signed in. Devices with
+	// no owner and no visibility, such as those synced from AWS, are public.
+	Public Visibility = "public"
+
+	// Hidden devices can only be seen by their owner and admins, and are left out of lists of
+	// the latest measurements even for them. Measurements from hidden devices are still stored.
+	Hidden Visibility = "hidden"
+)
+
+// Device holds metadata about a device that reports measurements.
+type Device struct {
+	// ID identifies the device in the registry. It's assigned when the device is registered
+	// and never changes, even if the device starts reporting measurements under a new device ID.
+	ID string `datastore:"-"`
+
+	// DeviceID is the ID that the device reports in its measurements.
+	DeviceID string `datastore:"device_id"`
+
+	// Aliases are other device IDs that refer to this device, such as IDs it used to report
+	// measurements under before being renamed.
+	Aliases []string `datastore:"aliases"`
+
+	// AWSThingARN is the ARN of the device's AWS IoT thing, if it has one.
+	AWSThingARN string `datastore:"aws_thing_arn"`
+
+	DisplayName string `datastore:"display_name,noindex"`
+
+	// Location is where the device is installed, e.g. a room.
+	Location string `datastore:"location"`
+
+	// Timezone is the IANA time zone name of the device's location, e.g. "America/Los_Angeles".
+	Timezone string `datastore:"timezone,noindex"`
+
+	// Sensors are the sensors installed on the device, e.g. "SEN55".
+	Sensors []string `datastore:"sensors,noindex"`
+
+	// AQIStandard is the ID of the aqi.Standard used for the device's AQI unless a request
+	// asks for another. If empty, the US EPA AQI is used.
+	AQIStandard string `datastore:"aqi_standard,noindex"`
+
+	// Owner is the email address of the user who owns the device. The owner can see and edit
+	// the device.
+	Owner string   `datastore:"owner"`
+	Tags  []string `datastore:"tags"`
+
+	// Visibility is who else can see the device. If it's empty the device is private if it has
+	// an owner and public if it doesn't.
+	Visibility Visibility `datastore:"visibility,noindex"`
+
+	// SharedWith are the email addresses of users who can see the device but not edit it.
+	SharedWith []string `datastore:"shared_with"`
+
+	// PushTokenHash is the hash of the device's push token as returned by HashPushToken, or empty
+	// if it has none. The token lets the device post its measurements straight to the web app.
+	PushTokenHash string `datastore:"push_token_hash,noindex"`
+
+	Created time.Time `datastore:"created"`
+	Updated time.Time `datastore:"updated,noindex"`
+}
+
+// Registry stores devices.
+type Registry interface {
+	// Devices gets all registered devices, sorted by device ID.
+	Devices(ctx context.Context) ([]Device, error)
+
+	// Device gets the device with the given registry ID. It returns ErrNotFound if there's none.
+	Device(ctx context.Context, id string) (Device, error)
+
+	// DeviceByDeviceID gets the device that reports measurements with the given device ID,
+	// either as its current ID or as an alias. found is false if there's none.
+	DeviceByDeviceID(ctx context.Context, deviceID string) (d Device, found bool, err error)
+
+	// PutDevice validates and stores d, assigning it an ID if it doesn't have one. It returns
+	// the stored device.
+	PutDevice(ctx context.Context, d Device) (Device, error)
+
+	// DeleteDevice deletes the device with the given registry ID. It returns ErrNotFound if
+	// there's none.
+	DeleteDevice(ctx context.Context, id string) error
+}
+
+// NewPushToken generates a new push token for the device with the given registry ID. It returns
+// the token, which must be given to the device because it can't be recovered, and its hash, which
+// goes in the device's PushTokenHash.
+func NewPushToken(id string) (token, hash string, err error) {
+	if id == "" {
+		return "", "", errors.New("device: push token requires a registry ID")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token = pushTokenPrefix + id + "." + base64.RawURLEncoding.EncodeToString(b)
+	return token, HashPushToken(token), nil
+}
+
+// ParsePushToken returns the registry ID of the device that the push token belongs to. ok is
+// false if token isn't a push token. The token still has to be checked against the device's
+// PushTokenHash.
+func ParsePushToken(token string) (id string, ok bool) {
+	rest, ok := strings.CutPrefix(token, pushTokenPrefix)
+	if !ok {
+		return "", false
+	}
+
+	id, secret, ok := strings.Cut(rest, ".")
+	if !ok || id == "" || secret == "" {
+		return "", false
+	}
+	return id, true
+}
+
+// HashPushToken returns the hash of a push token. Tokens are long and random, so a fast hash is
+// enough to keep them from being recovered from the registry.
+func HashPushToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CertificateDeviceID returns the device ID that a device identifies itself with when it uses
+// the given X.509 certificate and isn't configured with a device ID: the certificate's Common
+// Name (CN).
+func CertificateDeviceID(cert *x509.Certificate) (string, error) {
+	if cert.Subject.CommonName == "" {
+		return "", errors.New("device: certificate Common Name (CN) is empty")
+	}
+
+	return cert.Subject.CommonName, nil
+}
+
+// Name returns the display name of the device, falling back to its device ID.
+func (d Device) Name() string {
+	if d.DisplayName != "" {
+		return d.DisplayName
+	}
+
+	return d.DeviceID
+}
+
+// DeviceIDs returns every device ID that refers to d: its current ID followed by its aliases.
+func (d Device) DeviceIDs() []string {
+	return append([]string{d.DeviceID}, d.Aliases...)
+}
+
+// HasTag reports whether d has the given tag.
+func (d Device) HasTag(tag string) bool {
+	return slices.Contains(d.Tags, tag)
+}
+
+// TimeLocation returns the device's time zone. It's UTC if the device has no time zone.
+func (d Device) TimeLocation() (*time.Location, error) {
+	return time.LoadLocation(d.Timezone)
+}
+
+// Standard returns the device's AQI standard. It's nil if the device's standard is unknown.
+func (d Device) Standard() aqi.Standard {
+	std, _ := aqi.Lookup(d.AQIStandard)
+	return std
+}
+
+// EffectiveVisibility returns the device's visibility. If it has none then it's Private if the
+// device has an owner and Public if it doesn't, so that devices registered before they had
+// owners stay visible to everyone until they're claimed.
+func (d Device) EffectiveVisibility() Visibility {
+	if d.Visibility == "" {
+		if d.Owner == "" {
+			return Public
 		}
-	} else {
-		var err error
-		cfg, err = config.LoadDefaultConfig(ctx, config.WithRegion(region))
-		if err != nil {
-			return nil, err
+		return Private
+	}
+
+	return d.Visibility
+}
+
+// IsOwnedBy reports whether the user with the given email address owns d. Email addresses are
+// compared case-insensitively. Only pass addresses that the identity provider has verified.
+func (d Device) IsOwnedBy(email string) bool {
+	return email != "" && strings.EqualFold(d.Owner, email)
+}
+
+// IsSharedWith reports whether d is shared with the user with the given email address. Only pass
+// addresses that the identity provider has verified.
+func (d Device) IsSharedWith(email string) bool {
+	if email == "" {
+		return false
+	}
+
+	return slices.ContainsFunc(d.SharedWith, func(s string) bool {
+		return strings.EqualFold(s, email)
+	})
+}
+
+// Validate returns an error if d is not valid.
+func (d Device) Validate() error {
+	if d.DeviceID == "" {
+		return errors.New("device: device ID must be set")
+	}
+
+	for _, id := range d.DeviceIDs() {
+		// The octothorpe is used to separate substrings in database keys.
+		if strings.Contains(id, "#") {
+			return fmt.Errorf("device: device ID %q must not contain '#'", id)
 		}
 	}
 
-	client := awsiot.NewFromConfig(cfg)
-	return client.ListThings(ctx, &awsiot.ListThingsInput{})
+	if slices.Contains(d.Aliases, d.DeviceID) {
+		return fmt.Errorf("device: device ID %q must not also be an alias", d.DeviceID)
+	}
+
+	if _, err := d.TimeLocation(); err != nil {
+		return fmt.Errorf("device: invalid timezone %q: %w", d.Timezone, err)
+	}
+
+	if _, ok := aqi.Lookup(d.AQIStandard); !ok {
+		return fmt.Errorf("device: unknown AQI standard %q", d.AQIStandard)
+	}
+
+	switch d.Visibility {
+	case "", Private, Public, Hidden:
+	default:
+		return fmt.Errorf("device: unknown visibility %q", d.Visibility)
+	}
+
+	return nil
 }
 
-// GetDeviceIDsAWS gets the IDs of all devices (called "things" in AWS IoT Core).
-func GetDeviceIDsAWS(ctx context.Context, roleARN, region string) ([]string, error) {
-	things, err := GetDevicesAWS(ctx, roleARN, region)
-	if err != nil {
-		return []string{}, err
+func compareDeviceIDs(a, b Device) int {
+	return strings.Compare(a.DeviceID, b.DeviceID)
+}
+
+// Sort sorts devices by device ID.
+func Sort(devices []Device) {
+	slices.SortFunc(devices, compareDeviceIDs)
+}
+
+// Prepare readies d to be stored in reg. It validates d, makes sure that none of its device IDs
+// belong to another device, and sets its ID and timestamps. If d has an ID then it must already
+// be registered. Registry implementations call it from PutDevice.
+func Prepare(ctx context.Context, reg Registry, d Device, now time.Time) (Device, error) {
+	if err := d.Validate(); err != nil {
+		return d, err
 	}
 
-	ids := make([]string, len(things.Things))
-	for i, t := range things.Things {
-		ids[i] = *t.ThingName
+	if d.ID == "" {
+		id, err := util.NewID()
+		if err != nil {
+			return d, err
+		}
+		d.ID = id
+		d.Created = now
+	} else {
+		existing, err := reg.Device(ctx, d.ID)
+		if err != nil {
+			return d, err
+		}
+		d.Created = existing.Created
+	}
+	d.Updated = now
+
+	for _, id := range d.DeviceIDs() {
+		other, found, err := reg.DeviceByDeviceID(ctx, id)
+		if err != nil {
+			return d, err
+		}
+		if found && other.ID != d.ID {
+			return d, fmt.Errorf("device: device ID %q already belongs to device %s", id, other.ID)
+		}
 	}
 
-	return ids, nil
+	return d, nil
 }
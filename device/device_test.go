@@ -0,0 +1,175 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeRegistry is a minimal in-memory Registry.
+type fakeRegistry map[string]Device
+
+func (r fakeRegistry) Devices(ctx context.Context) ([]Device, error) {
+	var devices []Device
+	for _, d := range r {
+		devices = append(devices, d)
+	}
+
+	Sort(devices)
+	return devices, nil
+}
+
+func (r fakeRegistry) Device(ctx context.Context, id string) (Device, error) {
+	d, ok := r[id]
+	if !ok {
+		return d, ErrNotFound
+	}
+	return d, nil
+}
+
+func (r fakeRegistry) DeviceByDeviceID(ctx context.Context, deviceID string) (Device, bool, error) {
+	for _, d := range r {
+		if slices.Contains(d.DeviceIDs(), deviceID) {
+			return d, true, nil
+		}
+	}
+	return Device{}, false, nil
+}
+
+func (r fakeRegistry) PutDevice(ctx context.Context, d Device) (Device, error) {
+	d, err := Prepare(ctx, r, d, time.Now())
+	if err != nil {
+		return d, err
+	}
+
+	r[d.ID] = d
+	return d, nil
+}
+
+func (r fakeRegistry) DeleteDevice(ctx context.Context, id string) error {
+	delete(r, id)
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name  string
+		d     Device
+		valid bool
+	}{
+		{"minimal", Device{DeviceID: "foo"}, true},
+		{"full", Device{DeviceID: "foo", Aliases: []string{"bar"}, Timezone: "America/Los_Angeles", Tags: []string{"indoor"}}, true},
+		{"no_device_id", Device{DisplayName: "Foo"}, false},
+		{"bad_timezone", Device{DeviceID: "foo", Timezone: "Mars/Olympus_Mons"}, false},
+		{"aqi_standard", Device{DeviceID: "foo", AQIStandard: "uk_daqi"}, true},
+		{"bad_aqi_standard", Device{DeviceID: "foo", AQIStandard: "mars"}, false},
+		{"alias_is_device_id", Device{DeviceID: "foo", Aliases: []string{"foo"}}, false},
+		{"separator_in_id", Device{DeviceID: "foo#bar"}, false},
+		{"separator_in_alias", Device{DeviceID: "foo", Aliases: []string{"foo#bar"}}, false},
+		{"public", Device{DeviceID: "foo", Visibility: Public}, true},
+		{"bad_visibility", Device{DeviceID: "foo", Visibility: "secret"}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.d.Validate()
+			if err != nil && tc.valid {
+				t.Errorf("Unexpected error: %v", err)
+			} else if err == nil && !tc.valid {
+				t.Error("Expected error, got no error")
+			}
+		})
+	}
+}
+
+func TestName(t *testing.T) {
+	if got := (Device{DeviceID: "foo"}).Name(); got != "foo" {
+		t.Errorf("got %q, want %q", got, "foo")
+	}
+
+	if got := (Device{DeviceID: "foo", DisplayName: "Kitchen"}).Name(); got != "Kitchen" {
+		t.Errorf("got %q, want %q", got, "Kitchen")
+	}
+}
+
+func TestEffectiveVisibility(t *testing.T) {
+	cases := []struct {
+		name string
+		d    Device
+		want Visibility
+	}{
+		{"unowned", Device{DeviceID: "foo"}, Public},
+		{"owned", Device{DeviceID: "foo", Owner: "alice@example.com"}, Private},
+		{"unowned_hidden", Device{DeviceID: "foo", Visibility: Hidden}, Hidden},
+		{"owned_public", Device{DeviceID: "foo", Owner: "alice@example.com", Visibility: Public}, Public},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.d.EffectiveVisibility(); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	ctx := context.Background()
+	reg := fakeRegistry{}
+
+	foo, err := reg.PutDevice(ctx, Device{DeviceID: "foo", Aliases: []string{"old-foo"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if foo.ID == "" || foo.Created.IsZero() || !foo.Created.Equal(foo.Updated) {
+		t.Errorf("got ID %q, created %v, updated %v; want ID and equal timestamps", foo.ID, foo.Created, foo.Updated)
+	}
+
+	// Updating keeps the creation time.
+	foo.DisplayName = "Kitchen"
+	updated, err := Prepare(ctx, reg, foo, foo.Created.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !updated.Created.Equal(foo.Created) || !updated.Updated.Equal(foo.Created.Add(time.Hour)) {
+		t.Errorf("got created %v, updated %v", updated.Created, updated.Updated)
+	}
+
+	// Another device can't claim foo's device ID or alias.
+	for _, id := range []string{"foo", "old-foo"} {
+		if _, err := Prepare(ctx, reg, Device{DeviceID: id}, time.Now()); err == nil {
+			t.Errorf("%s: expected error, got nil", id)
+		}
+	}
+
+	// Updating a device that isn't registered fails.
+	if _, err := Prepare(ctx, reg, Device{ID: "nope", DeviceID: "bar"}, time.Now()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestPushToken(t *testing.T) {
+	token, hash, err := NewPushToken("abc123")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if hash != HashPushToken(token) {
+		t.Errorf("got hash %q, want %q", hash, HashPushToken(token))
+	}
+
+	if id, ok := ParsePushToken(token); !ok || id != "abc123" {
+		t.Errorf("ParsePushToken(%q) = %q, %v, want %q, true", token, id, ok, "abc123")
+	}
+
+	for _, s := range []string{"", "est_abc", "edp_abc123", "edp_.secret", "edp_abc123."} {
+		if _, ok := ParsePushToken(s); ok {
+			t.Errorf("ParsePushToken(%q): got ok, want not ok", s)
+		}
+	}
+
+	if _, _, err := NewPushToken(""); err == nil {
+		t.Error("expected error for empty ID, got nil")
+	}
+}
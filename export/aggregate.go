@@ -0,0 +1,110 @@
+package export
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// bucket accumulates one device's rows over one bucket.
+type bucket struct {
+	deviceID   string
+	start, end time.Time
+
+	sums   []float64
+	counts []int
+	rows   int
+}
+
+func (b *bucket) row() Row {
+	r := Row{DeviceID: b.deviceID, Timestamp: b.start, Values: make([]*float32, len(b.sums)), Count: b.rows}
+	for i, sum := range b.sums {
+		if b.counts[i] > 0 {
+			mean := float32(sum / float64(b.counts[i]))
+			r.Values[i] = &mean
+		}
+	}
+	return r
+}
+
+// aggregator averages rows over buckets. Rows must be added in timestamp order, which lets it
+// emit each bucket as soon as the bucket ends, keeping at most one bucket per device open.
+type aggregator struct {
+	size       time.Duration
+	location   *time.Location
+	numMetrics int
+
+	open map[string]*bucket
+}
+
+func newAggregator(size time.Duration, loc *time.Location, numMetrics int) *aggregator {
+	return &aggregator{size: size, location: loc, numMetrics: numMetrics, open: make(map[string]*bucket)}
+}
+
+// bounds returns the start and end of the bucket containing t.
+func (a *aggregator) bounds(t time.Time) (time.Time, time.Time) {
+	local := t.In(a.location)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, a.location)
+	nextMidnight := midnight.AddDate(0, 0, 1)
+
+	start := midnight.Add(t.Sub(midnight) / a.size * a.size)
+	end := start.Add(a.size)
+	if end.After(nextMidnight) {
+		end = nextMidnight
+	}
+	return start, end
+}
+
+// add adds r and returns the rows of the buckets that it closes, i.e. those that end at or
+// before r's timestamp, ordered by start and then by device ID.
+func (a *aggregator) add(r Row) []Row {
+	closed := a.close(func(b *bucket) bool { return !b.end.After(r.Timestamp) })
+
+	b := a.open[r.DeviceID]
+	if b == nil {
+		start, end := a.bounds(r.Timestamp)
+		b = &bucket{
+			deviceID: r.DeviceID,
+			start:    start,
+			end:      end,
+			sums:     make([]float64, a.numMetrics),
+			counts:   make([]int, a.numMetrics),
+		}
+		a.open[r.DeviceID] = b
+	}
+
+	b.rows++
+	for i, v := range r.Values {
+		if v != nil {
+			b.sums[i] += float64(*v)
+			b.counts[i]++
+		}
+	}
+
+	return closed
+}
+
+// flush closes every open bucket and returns their rows.
+func (a *aggregator) flush() []Row {
+	return a.close(func(*bucket) bool { return true })
+}
+
+func (a *aggregator) close(done func(b *bucket) bool) []Row {
+	var buckets []*bucket
+	for id, b := range a.open {
+		if done(b) {
+			buckets = append(buckets, b)
+			delete(a.open, id)
+		}
+	}
+
+	slices.SortFunc(buckets, func(x, y *bucket) int {
+		return cmp.Or(x.start.Compare(y.start), cmp.Compare(x.deviceID, y.deviceID))
+	})
+
+	rows := make([]Row, len(buckets))
+	for i, b := range buckets {
+		rows[i] = b.row()
+	}
+	return rows
+}
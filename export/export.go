@@ -0,0 +1,291 @@
+// Package export writes measurement history as CSV, JSON Lines, or Parquet. Measurements are
+// read from the database a page at a time and written as they're read, so exports of long time
+// ranges don't have to fit in memory.
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/calibration"
+	"github.com/mtraver/environmental-sensor/database"
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+// pageSize is the number of measurements read from the database at a time.
+const pageSize = 1000
+
+// Format is an export file format.
+type Format string
+
+const (
+	CSV     Format = "csv"
+	JSONL   Format = "jsonl"
+	Parquet Format = "parquet"
+)
+
+// ParseFormat parses the name of a format, e.g. "csv".
+func ParseFormat(s string) (Format, error) {
+	f := Format(strings.ToLower(s))
+	switch f {
+	case CSV, JSONL, Parquet:
+		return f, nil
+	}
+	return "", fmt.Errorf("export: unknown format %q", s)
+}
+
+// ContentType returns the MIME type of files in the format.
+func (f Format) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case JSONL:
+		return "application/jsonl"
+	case Parquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "application/octet-stream"
+}
+
+// Extension returns the file name extension of files in the format, e.g. ".csv".
+func (f Format) Extension() string {
+	return "." + string(f)
+}
+
+// DefaultMetrics are the metrics exported if none are given: every metric that sensors report.
+var DefaultMetrics = []metric.Key{
+	metric.Temp,
+	metric.PM1,
+	metric.PM25,
+	metric.PM4,
+	metric.PM10,
+	metric.RH,
+	metric.VOCIndex,
+	metric.NOxIndex,
+	metric.HCHO,
+	metric.CO2,
+}
+
+// Options select the measurements to export and how to write them.
+type Options struct {
+	Format Format
+
+	// Measurements with timestamps in [StartTime, EndTime] are exported. A zero EndTime means
+	// there's no upper bound.
+	StartTime time.Time
+	EndTime   time.Time
+
+	// If non-empty, only these devices' measurements are exported.
+	DeviceIDs []string
+
+	// The metrics to export, in column order. Derived metrics such as the AQI may be included.
+	// If empty, DefaultMetrics are exported.
+	Metrics []metric.Key
+
+	// If non-zero, measurements are aggregated into buckets of this length, and each row has the
+	// mean of each metric over one device's measurements in one bucket. Buckets are aligned to
+	// midnight in Location, so Bucket must divide a day. A day's last bucket is cut short if the
+	// day is shorter than usual because of a daylight saving time transition.
+	Bucket time.Duration
+
+	// Timestamps in CSV and JSON Lines are written in Location, and buckets are aligned to days
+	// in Location. Parquet timestamps are always UTC. If it's nil then UTC is used.
+	Location *time.Location
+
+	// Profiles correct the measurements before they're written. Stored values are exported if
+	// it's empty.
+	Profiles calibration.Profiles
+}
+
+func (o Options) location() *time.Location {
+	if o.Location == nil {
+		return time.UTC
+	}
+	return o.Location
+}
+
+func (o Options) metrics() []metric.Key {
+	if len(o.Metrics) == 0 {
+		return DefaultMetrics
+	}
+	return o.Metrics
+}
+
+// Validate returns an error if the options are invalid.
+func (o Options) Validate() error {
+	if _, err := ParseFormat(string(o.Format)); err != nil {
+		return err
+	}
+
+	if !o.EndTime.IsZero() && o.EndTime.Before(o.StartTime) {
+		return fmt.Errorf("export: end time %v is before start time %v", o.EndTime, o.StartTime)
+	}
+
+	for _, m := range o.Metrics {
+		if _, ok := metric.All[m]; !ok {
+			return fmt.Errorf("export: unknown metric %q", m)
+		}
+	}
+
+	if o.Bucket < 0 || (o.Bucket > 0 && (o.Bucket < time.Second || 24*time.Hour%o.Bucket != 0)) {
+		return fmt.Errorf("export: bucket %v doesn't divide a day", o.Bucket)
+	}
+
+	return nil
+}
+
+// Row is one row of an export: a device's values of the exported metrics at a time.
+type Row struct {
+	DeviceID string
+
+	// Timestamp is the time of the measurement, or the start of the bucket if the export is
+	// aggregated.
+	Timestamp time.Time
+
+	// Values[i] is the value of the ith exported metric, or nil if there's none.
+	Values []*float32
+
+	// Count is the number of measurements in the bucket. It's only set if the export is
+	// aggregated.
+	Count int
+}
+
+// rowWriter writes rows in a format. Close must be called to finish the file.
+type rowWriter interface {
+	Write(r Row) error
+	Close() error
+}
+
+func newRowWriter(w io.Writer, opts Options) (rowWriter, error) {
+	c := columns{metrics: opts.metrics(), aggregated: opts.Bucket > 0, location: opts.location()}
+
+	switch opts.Format {
+	case CSV:
+		return newCSVWriter(w, c)
+	case JSONL:
+		return newJSONLWriter(w, c), nil
+	case Parquet:
+		return newParquetWriter(w, c)
+	}
+	return nil, fmt.Errorf("export: unknown format %q", opts.Format)
+}
+
+// columns describes the columns of an export.
+type columns struct {
+	metrics    []metric.Key
+	aggregated bool
+	location   *time.Location
+}
+
+// Database is the part of database.Database that exports read from.
+type Database interface {
+	Query(ctx context.Context, q database.Query) (database.Page, error)
+}
+
+// Export writes the measurements selected by opts to w, reading them from db a page at a time.
+// It returns the number of rows written.
+func Export(ctx context.Context, db Database, w io.Writer, opts Options) (int, error) {
+	if err := opts.Validate(); err != nil {
+		return 0, err
+	}
+
+	metrics := opts.metrics()
+
+	// Derived metrics are computed from their inputs, so query those too.
+	queried := slices.Clone(metrics)
+	derived := false
+	for _, k := range metrics {
+		if k.Derived() {
+			derived = true
+			queried = append(queried, metric.All[k].Inputs...)
+		}
+	}
+
+	q := database.Query{
+		StartTime: opts.StartTime,
+		EndTime:   opts.EndTime,
+		DeviceIDs: opts.DeviceIDs,
+		Metrics:   queried,
+		Limit:     pageSize,
+	}
+
+	rw, err := newRowWriter(w, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	var agg *aggregator
+	if opts.Bucket > 0 {
+		agg = newAggregator(opts.Bucket, opts.location(), len(metrics))
+	}
+
+	n := 0
+	write := func(rows ...Row) error {
+		for _, r := range rows {
+			if err := rw.Write(r); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	}
+
+	for {
+		page, err := db.Query(ctx, q)
+		if err != nil {
+			return n, err
+		}
+
+		opts.Profiles.ApplyAll(page.Measurements)
+		for _, sm := range page.Measurements {
+			if derived {
+				sm.FillDerivedMetrics(nil)
+			}
+
+			r := Row{DeviceID: sm.DeviceID, Timestamp: sm.Timestamp, Values: make([]*float32, len(metrics))}
+			for i, k := range metrics {
+				r.Values[i] = sm.Value(k)
+			}
+
+			if agg == nil {
+				err = write(r)
+			} else {
+				err = write(agg.add(r)...)
+			}
+			if err != nil {
+				return n, err
+			}
+		}
+
+		if !page.HasNextPage {
+			break
+		}
+		q.Cursor = page.EndCursor()
+	}
+
+	if agg != nil {
+		if err := write(agg.flush()...); err != nil {
+			return n, err
+		}
+	}
+
+	return n, rw.Close()
+}
+
+// ParseTime parses an RFC 3339 timestamp, or a date formatted like 2006-01-02, which is taken to
+// mean midnight in loc.
+func ParseTime(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation(time.DateOnly, s, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("export: %q is neither an RFC 3339 timestamp nor a date", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,198 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/metric"
+	"github.com/mtraver/environmental-sensor/testutil"
+	"github.com/mtraver/environmental-sensor/web/db"
+	tspb "google.golang.org/protobuf/types/known/timestamppb"
+	wpb "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func at(d time.Duration) time.Time {
+	return testutil.Timestamp.Add(d)
+}
+
+func seed(t *testing.T, ms ...*mpb.Measurement) *db.MemoryDB {
+	t.Helper()
+
+	database := db.NewMemoryDB()
+	for _, m := range ms {
+		if err := database.Save(context.Background(), m); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	return database
+}
+
+func export(t *testing.T, database Database, opts Options) (string, int) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	n, err := Export(context.Background(), database, &buf, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return buf.String(), n
+}
+
+func TestExportCSV(t *testing.T) {
+	database := seed(t,
+		&mpb.Measurement{DeviceId: "foo", Timestamp: tspb.New(at(0)), Temp: wpb.Float(20.5), Pm25: wpb.Float(12)},
+		&mpb.Measurement{DeviceId: "bar", Timestamp: tspb.New(at(time.Minute)), Temp: wpb.Float(18)},
+		&mpb.Measurement{DeviceId: "foo", Timestamp: tspb.New(at(2 * time.Minute)), Rh: wpb.Float(40)},
+	)
+
+	got, n := export(t, database, Options{
+		Format:    CSV,
+		StartTime: at(0),
+		Metrics:   []metric.Key{metric.Temp, metric.PM25},
+		Location:  time.FixedZone("", -7*60*60),
+	})
+
+	// The third measurement has none of the selected metrics.
+	want := `device_id,timestamp,temp,pm25
+foo,2018-03-24T17:00:00-07:00,20.5,12
+bar,2018-03-24T17:01:00-07:00,18,
+`
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected export (-want +got):\n%s", diff)
+	}
+	if n != 2 {
+		t.Errorf("got %d rows, want 2", n)
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	database := seed(t,
+		&mpb.Measurement{DeviceId: "foo", Timestamp: tspb.New(at(0)), Pm25: wpb.Float(35.4)},
+		&mpb.Measurement{DeviceId: "bar", Timestamp: tspb.New(at(time.Minute)), Pm25: wpb.Float(5)},
+	)
+
+	got, _ := export(t, database, Options{
+		Format:    JSONL,
+		StartTime: at(0),
+		DeviceIDs: []string{"foo"},
+		Metrics:   []metric.Key{metric.AQI, metric.Temp},
+	})
+
+	// The AQI is derived from PM2.5, which isn't exported itself.
+	want := `{"device_id":"foo","timestamp":"2018-03-25T00:00:00Z","aqi":100}
+`
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected export (-want +got):\n%s", diff)
+	}
+}
+
+func TestExportAggregate(t *testing.T) {
+	database := seed(t,
+		&mpb.Measurement{DeviceId: "foo", Timestamp: tspb.New(at(0)), Temp: wpb.Float(20)},
+		&mpb.Measurement{DeviceId: "bar", Timestamp: tspb.New(at(10 * time.Minute)), Temp: wpb.Float(10)},
+		&mpb.Measurement{DeviceId: "foo", Timestamp: tspb.New(at(20 * time.Minute)), Temp: wpb.Float(21), Rh: wpb.Float(50)},
+		&mpb.Measurement{DeviceId: "foo", Timestamp: tspb.New(at(40 * time.Minute)), Temp: wpb.Float(30)},
+		&mpb.Measurement{DeviceId: "bar", Timestamp: tspb.New(at(2 * time.Hour)), Temp: wpb.Float(12)},
+	)
+
+	// Buckets are aligned to the hour in a time zone 30 minutes ahead of UTC, so the first
+	// bucket starts at 23:30 UTC and the measurement at 00:40 UTC is in the second.
+	got, n := export(t, database, Options{
+		Format:    CSV,
+		StartTime: at(0),
+		Metrics:   []metric.Key{metric.Temp, metric.RH},
+		Bucket:    time.Hour,
+		Location:  time.FixedZone("", 30*60),
+	})
+
+	want := `device_id,timestamp,count,temp,rh
+bar,2018-03-25T00:00:00+00:30,1,10,
+foo,2018-03-25T00:00:00+00:30,2,20.5,50
+foo,2018-03-25T01:00:00+00:30,1,30,
+bar,2018-03-25T02:00:00+00:30,1,12,
+`
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected export (-want +got):\n%s", diff)
+	}
+	if n != 4 {
+		t.Errorf("got %d rows, want 4", n)
+	}
+}
+
+func TestExportPages(t *testing.T) {
+	var ms []*mpb.Measurement
+	for i := range 2*pageSize + 1 {
+		ms = append(ms, &mpb.Measurement{DeviceId: "foo", Timestamp: tspb.New(at(time.Duration(i) * time.Second)), Temp: wpb.Float(20)})
+	}
+	database := seed(t, ms...)
+
+	if _, n := export(t, database, Options{Format: JSONL, StartTime: at(0)}); n != len(ms) {
+		t.Errorf("got %d rows, want %d", n, len(ms))
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{"valid", Options{Format: CSV, StartTime: at(0), EndTime: at(time.Hour)}, false},
+		{"bucket", Options{Format: Parquet, Bucket: 15 * time.Minute}, false},
+		{"day bucket", Options{Format: JSONL, Bucket: 24 * time.Hour}, false},
+		{"no format", Options{}, true},
+		{"unknown format", Options{Format: "xlsx"}, true},
+		{"end before start", Options{Format: CSV, StartTime: at(time.Hour), EndTime: at(0)}, true},
+		{"unknown metric", Options{Format: CSV, Metrics: []metric.Key{"foo"}}, true},
+		{"bucket doesn't divide a day", Options{Format: CSV, Bucket: 7 * time.Hour}, true},
+		{"bucket longer than a day", Options{Format: CSV, Bucket: 48 * time.Hour}, true},
+		{"negative bucket", Options{Format: CSV, Bucket: -time.Hour}, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.opts.Validate()
+			if c.wantErr && err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !c.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	loc := time.FixedZone("", -7*60*60)
+
+	cases := []struct {
+		s       string
+		want    time.Time
+		wantErr bool
+	}{
+		{"2018-03-25T01:02:03Z", time.Date(2018, time.March, 25, 1, 2, 3, 0, time.UTC), false},
+		{"2018-03-25", time.Date(2018, time.March, 25, 7, 0, 0, 0, time.UTC), false},
+		{"03/25/2018", time.Time{}, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseTime(c.s, loc)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("ParseTime(%q): expected error, got nil", c.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseTime(%q): unexpected error: %v", c.s, err)
+			continue
+		}
+		if !got.Equal(c.want) {
+			t.Errorf("ParseTime(%q) = %v, want %v", c.s, got, c.want)
+		}
+	}
+}
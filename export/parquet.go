@@ -0,0 +1,88 @@
+package export
+
+import (
+	"io"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// rowGroupSize is the number of rows buffered in memory before they're written out as a row
+// group.
+const rowGroupSize = 10000
+
+type parquetWriter struct {
+	columns
+	w *parquet.Writer
+
+	// The indexes of the columns in the schema, which orders them by name, and so in each row.
+	numColumns int
+	deviceID   int
+	timestamp  int
+	count      int
+	values     []int
+}
+
+func newParquetWriter(w io.Writer, c columns) (*parquetWriter, error) {
+	group := parquet.Group{
+		"device_id": parquet.String(),
+		"timestamp": parquet.Timestamp(parquet.Millisecond),
+	}
+	if c.aggregated {
+		group["count"] = parquet.Int(64)
+	}
+	for _, k := range c.metrics {
+		group[string(k)] = parquet.Optional(parquet.Leaf(parquet.FloatType))
+	}
+	schema := parquet.NewSchema("measurement", group)
+
+	index := func(name string) int {
+		col, _ := schema.Lookup(name)
+		return col.ColumnIndex
+	}
+
+	pw := &parquetWriter{
+		columns:    c,
+		numColumns: len(schema.Columns()),
+		deviceID:   index("device_id"),
+		timestamp:  index("timestamp"),
+		count:      index("count"),
+	}
+	for _, k := range c.metrics {
+		pw.values = append(pw.values, index(string(k)))
+	}
+
+	config, err := parquet.NewWriterConfig(schema, parquet.MaxRowsPerRowGroup(rowGroupSize), parquet.Compression(&parquet.Snappy))
+	if err != nil {
+		return nil, err
+	}
+	pw.w = parquet.NewWriter(w, config)
+
+	return pw, nil
+}
+
+func (pw *parquetWriter) Write(r Row) error {
+	row := make(parquet.Row, pw.numColumns)
+	row[pw.deviceID] = parquet.ByteArrayValue([]byte(r.DeviceID)).Level(0, 0, pw.deviceID)
+	row[pw.timestamp] = parquet.Int64Value(r.Timestamp.UnixMilli()).Level(0, 0, pw.timestamp)
+	if pw.aggregated {
+		row[pw.count] = parquet.Int64Value(int64(r.Count)).Level(0, 0, pw.count)
+	}
+
+	// Metric columns are optional, so their values are defined at level 1 and missing ones are
+	// nulls at level 0.
+	for i, v := range r.Values {
+		col := pw.values[i]
+		if v == nil {
+			row[col] = parquet.NullValue().Level(0, 0, col)
+		} else {
+			row[col] = parquet.FloatValue(*v).Level(0, 1, col)
+		}
+	}
+
+	_, err := pw.w.WriteRows([]parquet.Row{row})
+	return err
+}
+
+func (pw *parquetWriter) Close() error {
+	return pw.w.Close()
+}
@@ -0,0 +1,80 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mtraver/environmental-sensor/metric"
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetRow is a row of a Parquet export of temp and PM2.5, as a Parquet reader sees it.
+type parquetRow struct {
+	DeviceID  string    `parquet:"device_id"`
+	Timestamp time.Time `parquet:"timestamp,timestamp(millisecond)"`
+	Count     int64     `parquet:"count"`
+	Temp      *float32  `parquet:"temp,optional"`
+	PM25      *float32  `parquet:"pm25,optional"`
+}
+
+func TestParquetWriter(t *testing.T) {
+	cases := []struct {
+		name       string
+		aggregated bool
+	}{
+		{"measurements", false},
+		{"aggregated", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			pw, err := newParquetWriter(&buf, columns{metrics: []metric.Key{metric.Temp, metric.PM25}, aggregated: tc.aggregated, location: time.UTC})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// Enough rows to fill more than one row group.
+			var want []parquetRow
+			for i := range rowGroupSize + 1 {
+				temp, pm25 := float32(i), float32(i)/2
+				r := Row{DeviceID: "foo", Timestamp: at(time.Duration(i) * time.Second), Values: []*float32{&temp, nil}}
+				if i%2 == 0 {
+					r.Values = []*float32{nil, &pm25}
+				}
+				if tc.aggregated {
+					r.Count = i
+				}
+				if err := pw.Write(r); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				want = append(want, parquetRow{DeviceID: r.DeviceID, Timestamp: r.Timestamp, Count: int64(r.Count), Temp: r.Values[0], PM25: r.Values[1]})
+			}
+			if err := pw.Close(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			f, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatalf("Failed to open file: %v", err)
+			}
+			if got := len(f.RowGroups()); got != 2 {
+				t.Errorf("got %d row groups, want 2", got)
+			}
+			if _, ok := f.Schema().Lookup("count"); ok != tc.aggregated {
+				t.Errorf("got count column %t, want %t", ok, tc.aggregated)
+			}
+
+			got, err := parquet.Read[parquetRow](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatalf("Failed to read rows: %v", err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("Unexpected rows (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// header returns the names of the columns.
+func (c columns) header() []string {
+	h := []string{"device_id", "timestamp"}
+	if c.aggregated {
+		h = append(h, "count")
+	}
+	for _, k := range c.metrics {
+		h = append(h, string(k))
+	}
+	return h
+}
+
+func formatFloat(v float32) string {
+	return strconv.FormatFloat(float64(v), 'f', -1, 32)
+}
+
+// csvWriter writes a header line and then one line per row. Missing values are empty.
+type csvWriter struct {
+	columns
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, c columns) (*csvWriter, error) {
+	cw := &csvWriter{columns: c, w: csv.NewWriter(w)}
+	if err := cw.w.Write(c.header()); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (cw *csvWriter) Write(r Row) error {
+	record := []string{r.DeviceID, r.Timestamp.In(cw.location).Format(time.RFC3339)}
+	if cw.aggregated {
+		record = append(record, strconv.Itoa(r.Count))
+	}
+	for _, v := range r.Values {
+		if v == nil {
+			record = append(record, "")
+		} else {
+			record = append(record, formatFloat(*v))
+		}
+	}
+
+	return cw.w.Write(record)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// jsonlWriter writes one JSON object per line. Missing values are omitted.
+type jsonlWriter struct {
+	columns
+	w *bufio.Writer
+}
+
+func newJSONLWriter(w io.Writer, c columns) *jsonlWriter {
+	return &jsonlWriter{columns: c, w: bufio.NewWriter(w)}
+}
+
+func (jw *jsonlWriter) Write(r Row) error {
+	// The object is built by hand so that keys are in column order.
+	b := []byte(`{"device_id":`)
+	id, err := json.Marshal(r.DeviceID)
+	if err != nil {
+		return err
+	}
+	b = append(b, id...)
+	b = append(b, `,"timestamp":"`...)
+	b = r.Timestamp.In(jw.location).AppendFormat(b, time.RFC3339)
+	b = append(b, '"')
+
+	if jw.aggregated {
+		b = append(b, `,"count":`...)
+		b = strconv.AppendInt(b, int64(r.Count), 10)
+	}
+
+	for i, v := range r.Values {
+		if v == nil {
+			continue
+		}
+		b = append(b, `,"`...)
+		b = append(b, jw.metrics[i]...)
+		b = append(b, `":`...)
+		b = append(b, formatFloat(*v)...)
+	}
+	b = append(b, "}\n"...)
+
+	_, err = jw.w.Write(b)
+	return err
+}
+
+func (jw *jsonlWriter) Close() error {
+	return jw.w.Flush()
+}
@@ -0,0 +1,91 @@
+package graph
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mtraver/environmental-sensor/account"
+	"github.com/mtraver/environmental-sensor/device"
+	"github.com/mtraver/environmental-sensor/util"
+)
+
+var (
+	errSignInRequired = errors.New("sign in required")
+	errAccessDenied   = errors.New("access denied")
+)
+
+// viewableDevices returns the registered devices that the viewer can see.
+func (r *Resolver) viewableDevices(ctx context.Context) ([]device.Device, error) {
+	devices, err := r.Registry.Devices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return util.FilterInPlace(devices, account.FromContext(ctx).CanView), nil
+}
+
+// deviceScope returns the device IDs whose measurements the viewer can read.
+func (r *Resolver) deviceScope(ctx context.Context) (account.DeviceScope, error) {
+	return account.FromContext(ctx).Scope(ctx, r.Registry)
+}
+
+// checkCanEditDeviceID returns an error unless the viewer can edit the device that reports the
+// given device ID. Only admins can edit things that apply to unregistered device IDs or, if the
+// ID is empty, to every device.
+func (r *Resolver) checkCanEditDeviceID(ctx context.Context, deviceID string) error {
+	v := account.FromContext(ctx)
+	if v.Admin {
+		return nil
+	}
+	if !v.SignedIn() {
+		return errSignInRequired
+	}
+	if deviceID == "" {
+		return errAccessDenied
+	}
+
+	d, found, err := r.Registry.DeviceByDeviceID(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	if !found || !v.CanEdit(d) {
+		return errAccessDenied
+	}
+
+	return nil
+}
+
+// editableDevice gets the device with the given registry ID, returning an error unless the
+// viewer can edit it. Devices the viewer can't see are reported as not found.
+func (r *Resolver) editableDevice(ctx context.Context, id string) (device.Device, error) {
+	v := account.FromContext(ctx)
+	if !v.SignedIn() && !v.Admin {
+		return device.Device{}, errSignInRequired
+	}
+
+	d, err := r.Registry.Device(ctx, id)
+	if err != nil {
+		return d, err
+	}
+	if !v.CanView(d) {
+		return d, device.ErrNotFound
+	}
+	if !v.CanEdit(d) {
+		return d, errAccessDenied
+	}
+
+	return d, nil
+}
+
+// restrictToScope limits the devices that args query to those whose measurements the viewer can
+// read. It returns false if there are none, in which case there's nothing to query.
+func (r *Resolver) restrictToScope(ctx context.Context, args *measurementsArgs) (bool, error) {
+	scope, err := r.deviceScope(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var ok bool
+	args.query.DeviceIDs, ok = scope.Restrict(args.query.DeviceIDs)
+	return ok, nil
+}
@@ -0,0 +1,30 @@
+package graph
+
+import (
+	"github.com/mtraver/environmental-sensor/account"
+	"github.com/mtraver/environmental-sensor/graph/model"
+)
+
+func apiTokenToGQL(t account.APIToken) *model.APIToken {
+	return &model.APIToken{
+		ID:        t.ID,
+		Name:      t.Name,
+		CreatedAt: timeToGQLTimestamp(t.Created),
+	}
+}
+
+func viewerToGQL(v account.Viewer, tokens []account.APIToken) *model.Viewer {
+	gqlViewer := &model.Viewer{
+		ID:        v.User.ID,
+		Email:     stringToPtr(v.User.Email),
+		Name:      stringToPtr(v.User.Name),
+		Admin:     v.Admin,
+		APITokens: []*model.APIToken{},
+	}
+
+	for _, t := range tokens {
+		gqlViewer.APITokens = append(gqlViewer.APITokens, apiTokenToGQL(t))
+	}
+
+	return gqlViewer
+}
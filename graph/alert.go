@@ -0,0 +1,152 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/alert"
+	"github.com/mtraver/environmental-sensor/graph/model"
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+// applyAlertRuleInput sets the fields of rule that are present in input. Channels must be among
+// the configured channels.
+func (r *Resolver) applyAlertRuleInput(rule *alert.Rule, input model.AlertRuleInput) error {
+	kind, err := alertRuleKindFromGQL(input.Kind)
+	if err != nil {
+		return err
+	}
+
+	rule.Name = input.Name
+	rule.Kind = kind
+
+	if input.DeviceID != nil {
+		rule.DeviceID = *input.DeviceID
+	}
+	if input.Metric != nil {
+		rule.Metric = metric.Key(*input.Metric)
+	}
+	if input.Op != nil {
+		rule.Op = alert.Op(*input.Op)
+	}
+	if input.Threshold != nil {
+		rule.Threshold = *input.Threshold
+	}
+	if input.AqiCategory != nil {
+		rule.Category = *input.AqiCategory
+	}
+	if input.AqiStandard != nil {
+		rule.AQIStandard = *input.AqiStandard
+	}
+	if input.For != nil {
+		rule.For, err = time.ParseDuration(*input.For)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %w", *input.For, err)
+		}
+	}
+	if input.Channels != nil {
+		for _, c := range input.Channels {
+			if _, ok := r.AlertChannels[c]; !ok {
+				return fmt.Errorf("unknown notification channel %q", c)
+			}
+		}
+		rule.Channels = input.Channels
+	}
+	if input.Enabled != nil {
+		rule.Enabled = *input.Enabled
+	}
+
+	return nil
+}
+
+func alertRuleKindFromGQL(kind model.AlertRuleKind) (alert.Kind, error) {
+	switch kind {
+	case model.AlertRuleKindThreshold:
+		return alert.Threshold, nil
+	case model.AlertRuleKindAqiCategory:
+		return alert.AQICategory, nil
+	case model.AlertRuleKindAbsence:
+		return alert.Absence, nil
+	default:
+		return "", fmt.Errorf("unsupported alert rule kind: %q", kind)
+	}
+}
+
+func alertRuleKindToGQL(kind alert.Kind) model.AlertRuleKind {
+	switch kind {
+	case alert.AQICategory:
+		return model.AlertRuleKindAqiCategory
+	case alert.Absence:
+		return model.AlertRuleKindAbsence
+	default:
+		return model.AlertRuleKindThreshold
+	}
+}
+
+func alertStatusToGQL(status alert.Status) model.AlertStatus {
+	switch status {
+	case alert.Pending:
+		return model.AlertStatusPending
+	case alert.Firing:
+		return model.AlertStatusFiring
+	case alert.Resolved:
+		return model.AlertStatusResolved
+	default:
+		return model.AlertStatusInactive
+	}
+}
+
+// formatDuration formats d like time.Duration.String but without trailing zero units, so that
+// 10 minutes is "10m" rather than "10m0s".
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+func alertRuleToGQLAlertRule(r alert.Rule) *model.AlertRule {
+	gqlRule := &model.AlertRule{
+		ID:          r.ID,
+		Name:        r.Name,
+		DeviceID:    stringToPtr(r.DeviceID),
+		Kind:        alertRuleKindToGQL(r.Kind),
+		AqiStandard: stringToPtr(r.AQIStandard),
+		For:         formatDuration(r.For),
+		Channels:    nonNil(r.Channels),
+		Enabled:     r.Enabled,
+	}
+
+	switch r.Kind {
+	case alert.Threshold:
+		gqlRule.Metric = stringToPtr(string(r.Metric))
+		gqlRule.Op = stringToPtr(string(r.Op))
+		gqlRule.Threshold = &r.Threshold
+	case alert.AQICategory:
+		gqlRule.AqiCategory = stringToPtr(r.Category)
+	}
+
+	return gqlRule
+}
+
+func alertStateToGQLAlert(r alert.Rule, s alert.State) *model.Alert {
+	a := &model.Alert{
+		Rule:       alertRuleToGQLAlertRule(r),
+		DeviceID:   s.DeviceID,
+		Status:     alertStatusToGQL(s.Status),
+		Since:      stringToPtr(timeToGQLTimestamp(s.Since)),
+		FiredAt:    stringToPtr(timeToGQLTimestamp(s.FiredAt)),
+		ResolvedAt: stringToPtr(timeToGQLTimestamp(s.ResolvedAt)),
+	}
+
+	if r.Kind != alert.Absence && !s.Evaluated.IsZero() {
+		a.Value = &s.Value
+	}
+
+	return a
+}
@@ -0,0 +1,126 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/aqi"
+	"github.com/mtraver/environmental-sensor/calibration"
+	"github.com/mtraver/environmental-sensor/database"
+	"github.com/mtraver/environmental-sensor/graph/model"
+	"github.com/mtraver/environmental-sensor/measurement"
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+// wantsAQI reports whether the client requested the AQI, either explicitly or by not filtering
+// metrics at all.
+func (a measurementsArgs) wantsAQI() bool {
+	return len(a.metrics) == 0 || slices.Contains(a.metrics, metric.AQI)
+}
+
+// aqiStandardFor returns a function that gives the AQI standard to use for each device ID. If
+// requested is non-nil then that standard is used for every device. Otherwise each registered
+// device's own standard is used, and the US EPA AQI for devices that don't have one.
+func (r *Resolver) aqiStandardFor(ctx context.Context, requested *string) (func(deviceID string) aqi.Standard, error) {
+	if requested != nil {
+		std, ok := aqi.Lookup(*requested)
+		if !ok {
+			return nil, fmt.Errorf("unknown AQI standard: %q", *requested)
+		}
+		return func(string) aqi.Standard { return std }, nil
+	}
+
+	devices, err := r.Registry.Devices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byDeviceID := make(map[string]aqi.Standard)
+	for _, d := range devices {
+		std := d.Standard()
+		if std == nil {
+			continue
+		}
+
+		for _, id := range d.DeviceIDs() {
+			byDeviceID[id] = std
+		}
+	}
+
+	return func(deviceID string) aqi.Standard {
+		if std, ok := byDeviceID[deviceID]; ok {
+			return std
+		}
+		return aqi.USEPA
+	}, nil
+}
+
+// fillNowCast sets the NowCast AQI of each of sms on the standard given by standardFor. For each
+// device it reads the measurements from the aqi.NowCastWindow before that device's earliest
+// measurement in sms, so that the NowCast of every measurement is computed from a full window.
+// Those measurements are corrected with profiles, as sms should already have been.
+func (r *Resolver) fillNowCast(ctx context.Context, sms []measurement.StorableMeasurement, standardFor func(deviceID string) aqi.Standard, profiles calibration.Profiles) error {
+	earliest := make(map[string]time.Time)
+	for _, sm := range sms {
+		if t, ok := earliest[sm.DeviceID]; !ok || sm.Timestamp.Before(t) {
+			earliest[sm.DeviceID] = sm.Timestamp
+		}
+	}
+
+	var history []measurement.StorableMeasurement
+	for id, t := range earliest {
+		page, err := r.Database.Query(ctx, database.Query{
+			StartTime: t.Add(-aqi.NowCastWindow),
+			// The end time is inclusive, and history mustn't include the measurement itself.
+			EndTime:   t.Add(-time.Nanosecond),
+			DeviceIDs: []string{id},
+			Metrics:   aqi.Pollutants,
+		})
+		if err != nil {
+			return err
+		}
+
+		history = append(history, page.Measurements...)
+	}
+
+	profiles.ApplyAll(history)
+	measurement.FillNowCast(sms, history, standardFor)
+	return nil
+}
+
+func aqiStandardToGQL(s aqi.Standard) *model.AQIStandard {
+	gqlStandard := &model.AQIStandard{
+		ID:         s.ID(),
+		Name:       s.Name(),
+		Pollutants: []string{},
+		Categories: []*model.AQICategory{},
+	}
+
+	for _, p := range s.Pollutants() {
+		gqlStandard.Pollutants = append(gqlStandard.Pollutants, string(p))
+	}
+
+	for _, c := range s.Categories() {
+		gqlStandard.Categories = append(gqlStandard.Categories, aqiCategoryToGQL(c))
+	}
+
+	return gqlStandard
+}
+
+func aqiCategoryToGQL(c aqi.Category) *model.AQICategory {
+	gqlCategory := &model.AQICategory{
+		Name:  c.Name,
+		Abbrv: c.Abbrv,
+		Color: c.Color,
+	}
+
+	if c.Max != math.MaxInt {
+		max := int32(c.Max)
+		gqlCategory.Max = &max
+	}
+
+	return gqlCategory
+}
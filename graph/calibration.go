@@ -0,0 +1,131 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/calibration"
+	"github.com/mtraver/environmental-sensor/graph/model"
+	"github.com/mtraver/environmental-sensor/measurement"
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+// calibrationProfiles returns every calibration profile.
+func (r *Resolver) calibrationProfiles(ctx context.Context) (calibration.Profiles, error) {
+	return r.Calibrations.CalibrationProfiles(ctx)
+}
+
+// applyCalibrationProfileInput sets the fields of p from input.
+func applyCalibrationProfileInput(p *calibration.Profile, input model.CalibrationProfileInput) error {
+	kind, err := calibrationKindFromGQL(input.Kind)
+	if err != nil {
+		return err
+	}
+
+	p.DeviceID = input.DeviceID
+	p.Metric = metric.Key(input.Metric)
+	p.Kind = kind
+
+	p.Scale = 1
+	if input.Scale != nil {
+		p.Scale = *input.Scale
+	}
+	p.Offset = 0
+	if input.Offset != nil {
+		p.Offset = *input.Offset
+	}
+
+	p.ValidFrom, p.ValidUntil = time.Time{}, time.Time{}
+	if input.ValidFrom != nil {
+		if p.ValidFrom, err = gqlTimestampToTime(*input.ValidFrom); err != nil {
+			return err
+		}
+	}
+	if input.ValidUntil != nil {
+		if p.ValidUntil, err = gqlTimestampToTime(*input.ValidUntil); err != nil {
+			return err
+		}
+	}
+
+	p.Note = ""
+	if input.Note != nil {
+		p.Note = *input.Note
+	}
+
+	return nil
+}
+
+func calibrationKindFromGQL(kind model.CalibrationKind) (calibration.Kind, error) {
+	switch kind {
+	case model.CalibrationKindLinear:
+		return calibration.Linear, nil
+	case model.CalibrationKindEpaHumidity:
+		return calibration.EPAHumidity, nil
+	default:
+		return "", fmt.Errorf("unknown calibration kind %q", kind)
+	}
+}
+
+func calibrationKindToGQL(kind calibration.Kind) model.CalibrationKind {
+	switch kind {
+	case calibration.EPAHumidity:
+		return model.CalibrationKindEpaHumidity
+	default:
+		return model.CalibrationKindLinear
+	}
+}
+
+func calibrationProfileToGQL(p calibration.Profile) *model.CalibrationProfile {
+	gqlProfile := &model.CalibrationProfile{
+		ID:         p.ID,
+		DeviceID:   p.DeviceID,
+		Metric:     string(p.Metric),
+		Kind:       calibrationKindToGQL(p.Kind),
+		ValidFrom:  stringToPtr(timeToGQLTimestamp(p.ValidFrom)),
+		ValidUntil: stringToPtr(timeToGQLTimestamp(p.ValidUntil)),
+		Note:       stringToPtr(p.Note),
+	}
+
+	if p.Kind == calibration.Linear {
+		gqlProfile.Scale = &p.Scale
+		gqlProfile.Offset = &p.Offset
+	}
+
+	return gqlProfile
+}
+
+// rawValuesToGQL returns the values of sm's raw metrics as reported, before calibration.
+func rawValuesToGQL(sm measurement.StorableMeasurement) *model.RawValues {
+	value := func(key metric.Key) *float64 {
+		if v, ok := sm.Raw[key]; ok {
+			f := float64(v)
+			return &f
+		}
+		return float32PtrToFloat64Ptr(sm.Value(key))
+	}
+
+	return &model.RawValues{
+		Temp:     value(metric.Temp),
+		Pm1:      value(metric.PM1),
+		Pm25:     value(metric.PM25),
+		Pm4:      value(metric.PM4),
+		Pm10:     value(metric.PM10),
+		Rh:       value(metric.RH),
+		VocIndex: value(metric.VOCIndex),
+		NoxIndex: value(metric.NOxIndex),
+		Hcho:     value(metric.HCHO),
+		Co2:      value(metric.CO2),
+	}
+}
+
+// calibratedMetrics returns the metrics of sm that were corrected by calibration, sorted.
+func calibratedMetrics(sm measurement.StorableMeasurement) []string {
+	calibrated := []string{}
+	for k := range sm.Raw {
+		calibrated = append(calibrated, string(k))
+	}
+	slices.Sort(calibrated)
+	return calibrated
+}
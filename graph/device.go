@@ -0,0 +1,102 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/mtraver/environmental-sensor/device"
+	"github.com/mtraver/environmental-sensor/graph/model"
+)
+
+// applyDeviceInput sets the fields of d that are present in input.
+func applyDeviceInput(d *device.Device, input model.DeviceInput) {
+	if input.DeviceID != nil {
+		d.DeviceID = *input.DeviceID
+	}
+	if input.Aliases != nil {
+		d.Aliases = input.Aliases
+	}
+	if input.DisplayName != nil {
+		d.DisplayName = *input.DisplayName
+	}
+	if input.Location != nil {
+		d.Location = *input.Location
+	}
+	if input.Timezone != nil {
+		d.Timezone = *input.Timezone
+	}
+	if input.Sensors != nil {
+		d.Sensors = input.Sensors
+	}
+	if input.Owner != nil {
+		d.Owner = *input.Owner
+	}
+	if input.Tags != nil {
+		d.Tags = input.Tags
+	}
+	if input.AqiStandard != nil {
+		d.AQIStandard = *input.AqiStandard
+	}
+	if input.Visibility != nil {
+		d.Visibility = visibilityFromGQL(*input.Visibility)
+	}
+	if input.SharedWith != nil {
+		d.SharedWith = input.SharedWith
+	}
+}
+
+func visibilityFromGQL(v model.Visibility) device.Visibility {
+	switch v {
+	case model.VisibilityPublic:
+		return device.Public
+	case model.VisibilityHidden:
+		return device.Hidden
+	default:
+		return device.Private
+	}
+}
+
+func visibilityToGQL(v device.Visibility) model.Visibility {
+	switch v {
+	case device.Public:
+		return model.VisibilityPublic
+	case device.Hidden:
+		return model.VisibilityHidden
+	default:
+		return model.VisibilityPrivate
+	}
+}
+
+// deviceFilter returns a function that reports whether a device matches all of the given
+// filters. Nil filters match every device.
+func deviceFilter(location, owner, tag *string) func(d device.Device) bool {
+	return func(d device.Device) bool {
+		if location != nil && d.Location != *location {
+			return false
+		}
+		if owner != nil && d.Owner != *owner {
+			return false
+		}
+		if tag != nil && !d.HasTag(*tag) {
+			return false
+		}
+		return true
+	}
+}
+
+// visibleDeviceIDs returns the current device IDs of the registered devices that the viewer can
+// see, leaving out hidden devices.
+func (r *Resolver) visibleDeviceIDs(ctx context.Context) ([]string, error) {
+	devices, err := r.viewableDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(devices))
+	for _, d := range devices {
+		if d.EffectiveVisibility() != device.Hidden {
+			ids = append(ids, d.DeviceID)
+		}
+	}
+
+	return ids, nil
+}
@@ -2,22 +2,682 @@
 
 package model
 
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type AQICategory struct {
+	Name  string `json:"name"`
+	Abbrv string `json:"abbrv"`
+	Color string `json:"color"`
+	Max   *int32 `json:"max,omitempty"`
+}
+
+type AQIStandard struct {
+	ID         string         `json:"id"`
+	Name       string         `json:"name"`
+	Pollutants []string       `json:"pollutants"`
+	Categories []*AQICategory `json:"categories"`
+}
+
+type Alert struct {
+	Rule       *AlertRule  `json:"rule"`
+	DeviceID   string      `json:"deviceId"`
+	Status     AlertStatus `json:"status"`
+	Since      *string     `json:"since,omitempty"`
+	FiredAt    *string     `json:"firedAt,omitempty"`
+	ResolvedAt *string     `json:"resolvedAt,omitempty"`
+	Value      *float64    `json:"value,omitempty"`
+}
+
+type AlertRule struct {
+	ID          string        `json:"id"`
+	Name        string        `json:"name"`
+	DeviceID    *string       `json:"deviceId,omitempty"`
+	Kind        AlertRuleKind `json:"kind"`
+	Metric      *string       `json:"metric,omitempty"`
+	Op          *string       `json:"op,omitempty"`
+	Threshold   *float64      `json:"threshold,omitempty"`
+	AqiCategory *string       `json:"aqiCategory,omitempty"`
+	AqiStandard *string       `json:"aqiStandard,omitempty"`
+	For         string        `json:"for"`
+	Channels    []string      `json:"channels"`
+	Enabled     bool          `json:"enabled"`
+}
+
+type AlertRuleInput struct {
+	Name        string        `json:"name"`
+	DeviceID    *string       `json:"deviceId,omitempty"`
+	Kind        AlertRuleKind `json:"kind"`
+	Metric      *string       `json:"metric,omitempty"`
+	Op          *string       `json:"op,omitempty"`
+	Threshold   *float64      `json:"threshold,omitempty"`
+	AqiCategory *string       `json:"aqiCategory,omitempty"`
+	AqiStandard *string       `json:"aqiStandard,omitempty"`
+	For         *string       `json:"for,omitempty"`
+	Channels    []string      `json:"channels,omitempty"`
+	Enabled     *bool         `json:"enabled,omitempty"`
+}
+
+type APIToken struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"createdAt"`
+}
+
+type CalibrationProfile struct {
+	ID         string          `json:"id"`
+	DeviceID   string          `json:"deviceId"`
+	Metric     string          `json:"metric"`
+	Kind       CalibrationKind `json:"kind"`
+	Scale      *float64        `json:"scale,omitempty"`
+	Offset     *float64        `json:"offset,omitempty"`
+	ValidFrom  *string         `json:"validFrom,omitempty"`
+	ValidUntil *string         `json:"validUntil,omitempty"`
+	Note       *string         `json:"note,omitempty"`
+}
+
+type CalibrationProfileInput struct {
+	DeviceID   string          `json:"deviceId"`
+	Metric     string          `json:"metric"`
+	Kind       CalibrationKind `json:"kind"`
+	Scale      *float64        `json:"scale,omitempty"`
+	Offset     *float64        `json:"offset,omitempty"`
+	ValidFrom  *string         `json:"validFrom,omitempty"`
+	ValidUntil *string         `json:"validUntil,omitempty"`
+	Note       *string         `json:"note,omitempty"`
+}
+
+type Device struct {
+	ID           string           `json:"id"`
+	DeviceID     string           `json:"deviceId"`
+	Aliases      []string         `json:"aliases"`
+	AWSThingArn  *string          `json:"awsThingArn,omitempty"`
+	Name         string           `json:"name"`
+	DisplayName  *string          `json:"displayName,omitempty"`
+	Location     *string          `json:"location,omitempty"`
+	Timezone     *string          `json:"timezone,omitempty"`
+	Sensors      []string         `json:"sensors"`
+	Owner        *string          `json:"owner,omitempty"`
+	Tags         []string         `json:"tags"`
+	AqiStandard  *string          `json:"aqiStandard,omitempty"`
+	Visibility   Visibility       `json:"visibility"`
+	SharedWith   []string         `json:"sharedWith"`
+	HasPushToken bool             `json:"hasPushToken"`
+	CreatedAt    string           `json:"createdAt"`
+	UpdatedAt    string           `json:"updatedAt"`
+	Latest       *Measurement     `json:"latest,omitempty"`
+	Reporting    *DeviceReporting `json:"reporting"`
+}
+
+type DeviceInput struct {
+	DeviceID    *string     `json:"deviceId,omitempty"`
+	Aliases     []string    `json:"aliases,omitempty"`
+	DisplayName *string     `json:"displayName,omitempty"`
+	Location    *string     `json:"location,omitempty"`
+	Timezone    *string     `json:"timezone,omitempty"`
+	Sensors     []string    `json:"sensors,omitempty"`
+	Owner       *string     `json:"owner,omitempty"`
+	Tags        []string    `json:"tags,omitempty"`
+	AqiStandard *string     `json:"aqiStandard,omitempty"`
+	Visibility  *Visibility `json:"visibility,omitempty"`
+	SharedWith  []string    `json:"sharedWith,omitempty"`
+}
+
+type DeviceReporting struct {
+	LastSeen *string      `json:"lastSeen,omitempty"`
+	Stale    bool         `json:"stale"`
+	Cadence  *string      `json:"cadence,omitempty"`
+	Gaps     []*GapBucket `json:"gaps"`
+	Uptime   []*Uptime    `json:"uptime"`
+}
+
+type GapBucket struct {
+	Max   *string `json:"max,omitempty"`
+	Count int32   `json:"count"`
+}
+
 type Measurement struct {
-	DeviceID        string   `json:"deviceId"`
-	Timestamp       string   `json:"timestamp"`
-	UploadTimestamp string   `json:"uploadTimestamp"`
-	Temp            *float64 `json:"temp,omitempty"`
-	Pm1             *float64 `json:"pm1,omitempty"`
-	Pm25            *float64 `json:"pm25,omitempty"`
-	Pm4             *float64 `json:"pm4,omitempty"`
-	Pm10            *float64 `json:"pm10,omitempty"`
-	Aqi             *float64 `json:"aqi,omitempty"`
-	Rh              *float64 `json:"rh,omitempty"`
-	VocIndex        *float64 `json:"vocIndex,omitempty"`
-	NoxIndex        *float64 `json:"noxIndex,omitempty"`
-	Hcho            *float64 `json:"hcho,omitempty"`
-	Co2             *float64 `json:"co2,omitempty"`
+	DeviceID        string       `json:"deviceId"`
+	Timestamp       string       `json:"timestamp"`
+	UploadTimestamp string       `json:"uploadTimestamp"`
+	Temp            *float64     `json:"temp,omitempty"`
+	Pm1             *float64     `json:"pm1,omitempty"`
+	Pm25            *float64     `json:"pm25,omitempty"`
+	Pm4             *float64     `json:"pm4,omitempty"`
+	Pm10            *float64     `json:"pm10,omitempty"`
+	Aqi             *float64     `json:"aqi,omitempty"`
+	AqiNowCast      *float64     `json:"aqiNowCast,omitempty"`
+	AqiPollutant    *string      `json:"aqiPollutant,omitempty"`
+	AqiStandard     *string      `json:"aqiStandard,omitempty"`
+	AqiCategory     *AQICategory `json:"aqiCategory,omitempty"`
+	Rh              *float64     `json:"rh,omitempty"`
+	VocIndex        *float64     `json:"vocIndex,omitempty"`
+	NoxIndex        *float64     `json:"noxIndex,omitempty"`
+	Hcho            *float64     `json:"hcho,omitempty"`
+	Co2             *float64     `json:"co2,omitempty"`
+	DewPoint        *float64     `json:"dewPoint,omitempty"`
+	HeatIndex       *float64     `json:"heatIndex,omitempty"`
+	Humidex         *float64     `json:"humidex,omitempty"`
+	AbsHumidity     *float64     `json:"absHumidity,omitempty"`
+	Vpd             *float64     `json:"vpd,omitempty"`
+	Raw             *RawValues   `json:"raw"`
+	Calibrated      []string     `json:"calibrated"`
+}
+
+type MeasurementConnection struct {
+	Edges    []*MeasurementEdge `json:"edges"`
+	PageInfo *PageInfo          `json:"pageInfo"`
+}
+
+type MeasurementEdge struct {
+	Cursor string       `json:"cursor"`
+	Node   *Measurement `json:"node"`
+}
+
+type Metric struct {
+	Key     string `json:"key"`
+	Name    string `json:"name"`
+	Unit    string `json:"unit"`
+	Units   []Unit `json:"units"`
+	Derived bool   `json:"derived"`
+}
+
+type Mutation struct {
+}
+
+type NewAPIToken struct {
+	Token    string    `json:"token"`
+	APIToken *APIToken `json:"apiToken"`
+}
+
+type PageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor,omitempty"`
+	EndCursor       *string `json:"endCursor,omitempty"`
 }
 
 type Query struct {
 }
+
+type RawValues struct {
+	Temp     *float64 `json:"temp,omitempty"`
+	Pm1      *float64 `json:"pm1,omitempty"`
+	Pm25     *float64 `json:"pm25,omitempty"`
+	Pm4      *float64 `json:"pm4,omitempty"`
+	Pm10     *float64 `json:"pm10,omitempty"`
+	Rh       *float64 `json:"rh,omitempty"`
+	VocIndex *float64 `json:"vocIndex,omitempty"`
+	NoxIndex *float64 `json:"noxIndex,omitempty"`
+	Hcho     *float64 `json:"hcho,omitempty"`
+	Co2      *float64 `json:"co2,omitempty"`
+}
+
+type Rollup struct {
+	DeviceID   string     `json:"deviceId"`
+	Metric     string     `json:"metric"`
+	Resolution Resolution `json:"resolution"`
+	StartTime  string     `json:"startTime"`
+	Min        float64    `json:"min"`
+	Max        float64    `json:"max"`
+	Mean       float64    `json:"mean"`
+	Count      int32      `json:"count"`
+}
+
+type RoutingRule struct {
+	ID            string        `json:"id"`
+	Name          string        `json:"name"`
+	Priority      int32         `json:"priority"`
+	DevicePattern *string       `json:"devicePattern,omitempty"`
+	Source        *string       `json:"source,omitempty"`
+	Metric        *string       `json:"metric,omitempty"`
+	Op            *string       `json:"op,omitempty"`
+	Threshold     *float64      `json:"threshold,omitempty"`
+	Action        RoutingAction `json:"action"`
+	Sinks         []string      `json:"sinks"`
+	Tags          []string      `json:"tags"`
+	RenameTo      *string       `json:"renameTo,omitempty"`
+	Enabled       bool          `json:"enabled"`
+}
+
+type RoutingRuleInput struct {
+	Name          string        `json:"name"`
+	Priority      *int32        `json:"priority,omitempty"`
+	DevicePattern *string       `json:"devicePattern,omitempty"`
+	Source        *string       `json:"source,omitempty"`
+	Metric        *string       `json:"metric,omitempty"`
+	Op            *string       `json:"op,omitempty"`
+	Threshold     *float64      `json:"threshold,omitempty"`
+	Action        RoutingAction `json:"action"`
+	Sinks         []string      `json:"sinks,omitempty"`
+	Tags          []string      `json:"tags,omitempty"`
+	RenameTo      *string       `json:"renameTo,omitempty"`
+	Enabled       *bool         `json:"enabled,omitempty"`
+}
+
+type Subscription struct {
+}
+
+type Uptime struct {
+	Window  string   `json:"window"`
+	Percent *float64 `json:"percent,omitempty"`
+}
+
+type Viewer struct {
+	ID        string      `json:"id"`
+	Email     *string     `json:"email,omitempty"`
+	Name      *string     `json:"name,omitempty"`
+	Admin     bool        `json:"admin"`
+	APITokens []*APIToken `json:"apiTokens"`
+}
+
+type AlertRuleKind string
+
+const (
+	AlertRuleKindThreshold   AlertRuleKind = "THRESHOLD"
+	AlertRuleKindAqiCategory AlertRuleKind = "AQI_CATEGORY"
+	AlertRuleKindAbsence     AlertRuleKind = "ABSENCE"
+)
+
+var AllAlertRuleKind = []AlertRuleKind{
+	AlertRuleKindThreshold,
+	AlertRuleKindAqiCategory,
+	AlertRuleKindAbsence,
+}
+
+func (e AlertRuleKind) IsValid() bool {
+	switch e {
+	case AlertRuleKindThreshold, AlertRuleKindAqiCategory, AlertRuleKindAbsence:
+		return true
+	}
+	return false
+}
+
+func (e AlertRuleKind) String() string {
+	return string(e)
+}
+
+func (e *AlertRuleKind) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = AlertRuleKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid AlertRuleKind", str)
+	}
+	return nil
+}
+
+func (e AlertRuleKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *AlertRuleKind) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e AlertRuleKind) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type AlertStatus string
+
+const (
+	AlertStatusInactive AlertStatus = "INACTIVE"
+	AlertStatusPending  AlertStatus = "PENDING"
+	AlertStatusFiring   AlertStatus = "FIRING"
+	AlertStatusResolved AlertStatus = "RESOLVED"
+)
+
+var AllAlertStatus = []AlertStatus{
+	AlertStatusInactive,
+	AlertStatusPending,
+	AlertStatusFiring,
+	AlertStatusResolved,
+}
+
+func (e AlertStatus) IsValid() bool {
+	switch e {
+	case AlertStatusInactive, AlertStatusPending, AlertStatusFiring, AlertStatusResolved:
+		return true
+	}
+	return false
+}
+
+func (e AlertStatus) String() string {
+	return string(e)
+}
+
+func (e *AlertStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = AlertStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid AlertStatus", str)
+	}
+	return nil
+}
+
+func (e AlertStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *AlertStatus) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e AlertStatus) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type CalibrationKind string
+
+const (
+	CalibrationKindLinear      CalibrationKind = "LINEAR"
+	CalibrationKindEpaHumidity CalibrationKind = "EPA_HUMIDITY"
+)
+
+var AllCalibrationKind = []CalibrationKind{
+	CalibrationKindLinear,
+	CalibrationKindEpaHumidity,
+}
+
+func (e CalibrationKind) IsValid() bool {
+	switch e {
+	case CalibrationKindLinear, CalibrationKindEpaHumidity:
+		return true
+	}
+	return false
+}
+
+func (e CalibrationKind) String() string {
+	return string(e)
+}
+
+func (e *CalibrationKind) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = CalibrationKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid CalibrationKind", str)
+	}
+	return nil
+}
+
+func (e CalibrationKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *CalibrationKind) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e CalibrationKind) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type Resolution string
+
+const (
+	ResolutionHourly Resolution = "HOURLY"
+	ResolutionDaily  Resolution = "DAILY"
+)
+
+var AllResolution = []Resolution{
+	ResolutionHourly,
+	ResolutionDaily,
+}
+
+func (e Resolution) IsValid() bool {
+	switch e {
+	case ResolutionHourly, ResolutionDaily:
+		return true
+	}
+	return false
+}
+
+func (e Resolution) String() string {
+	return string(e)
+}
+
+func (e *Resolution) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Resolution(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Resolution", str)
+	}
+	return nil
+}
+
+func (e Resolution) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *Resolution) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e Resolution) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type RoutingAction string
+
+const (
+	RoutingActionDrop   RoutingAction = "DROP"
+	RoutingActionRoute  RoutingAction = "ROUTE"
+	RoutingActionTag    RoutingAction = "TAG"
+	RoutingActionRename RoutingAction = "RENAME"
+)
+
+var AllRoutingAction = []RoutingAction{
+	RoutingActionDrop,
+	RoutingActionRoute,
+	RoutingActionTag,
+	RoutingActionRename,
+}
+
+func (e RoutingAction) IsValid() bool {
+	switch e {
+	case RoutingActionDrop, RoutingActionRoute, RoutingActionTag, RoutingActionRename:
+		return true
+	}
+	return false
+}
+
+func (e RoutingAction) String() string {
+	return string(e)
+}
+
+func (e *RoutingAction) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = RoutingAction(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid RoutingAction", str)
+	}
+	return nil
+}
+
+func (e RoutingAction) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *RoutingAction) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e RoutingAction) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type Unit string
+
+const (
+	UnitCelsius    Unit = "CELSIUS"
+	UnitFahrenheit Unit = "FAHRENHEIT"
+	UnitKelvin     Unit = "KELVIN"
+	UnitPpm        Unit = "PPM"
+	UnitPpb        Unit = "PPB"
+	UnitMgPerM3    Unit = "MG_PER_M3"
+	UnitUgPerM3    Unit = "UG_PER_M3"
+)
+
+var AllUnit = []Unit{
+	UnitCelsius,
+	UnitFahrenheit,
+	UnitKelvin,
+	UnitPpm,
+	UnitPpb,
+	UnitMgPerM3,
+	UnitUgPerM3,
+}
+
+func (e Unit) IsValid() bool {
+	switch e {
+	case UnitCelsius, UnitFahrenheit, UnitKelvin, UnitPpm, UnitPpb, UnitMgPerM3, UnitUgPerM3:
+		return true
+	}
+	return false
+}
+
+func (e Unit) String() string {
+	return string(e)
+}
+
+func (e *Unit) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Unit(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Unit", str)
+	}
+	return nil
+}
+
+func (e Unit) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *Unit) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e Unit) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type Visibility string
+
+const (
+	VisibilityPrivate Visibility = "PRIVATE"
+	VisibilityPublic  Visibility = "PUBLIC"
+	VisibilityHidden  Visibility = "HIDDEN"
+)
+
+var AllVisibility = []Visibility{
+	VisibilityPrivate,
+	VisibilityPublic,
+	VisibilityHidden,
+}
+
+func (e Visibility) IsValid() bool {
+	switch e {
+	case VisibilityPrivate, VisibilityPublic, VisibilityHidden:
+		return true
+	}
+	return false
+}
+
+func (e Visibility) String() string {
+	return string(e)
+}
+
+func (e *Visibility) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Visibility(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Visibility", str)
+	}
+	return nil
+}
+
+func (e Visibility) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *Visibility) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e Visibility) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
@@ -1,8 +1,14 @@
 package graph
 
 import (
+	"time"
+
+	"github.com/mtraver/environmental-sensor/aqi"
+	"github.com/mtraver/environmental-sensor/device"
 	"github.com/mtraver/environmental-sensor/graph/model"
 	"github.com/mtraver/environmental-sensor/measurement"
+	"github.com/mtraver/environmental-sensor/rollup"
+	"github.com/mtraver/environmental-sensor/uptime"
 )
 
 func storableMeasurementToGQLMeasurement(sm measurement.StorableMeasurement) *model.Measurement {
@@ -16,12 +22,122 @@ func storableMeasurementToGQLMeasurement(sm measurement.StorableMeasurement) *mo
 		Pm4:             float32PtrToFloat64Ptr(sm.PM4),
 		Pm10:            float32PtrToFloat64Ptr(sm.PM10),
 		Aqi:             float32PtrToFloat64Ptr(sm.AQI),
+		AqiNowCast:      float32PtrToFloat64Ptr(sm.AQINowCast),
+		AqiPollutant:    stringToPtr(string(sm.AQIPollutant)),
+		AqiStandard:     stringToPtr(sm.AQIStandard),
+		AqiCategory:     aqiCategoryOf(sm),
 		Rh:              float32PtrToFloat64Ptr(sm.RH),
 		VocIndex:        float32PtrToFloat64Ptr(sm.VOCIndex),
 		NoxIndex:        float32PtrToFloat64Ptr(sm.NOxIndex),
 		Hcho:            float32PtrToFloat64Ptr(sm.HCHO),
 		Co2:             float32PtrToFloat64Ptr(sm.CO2),
+		DewPoint:        float32PtrToFloat64Ptr(sm.DewPoint),
+		HeatIndex:       float32PtrToFloat64Ptr(sm.HeatIndex),
+		Humidex:         float32PtrToFloat64Ptr(sm.Humidex),
+		AbsHumidity:     float32PtrToFloat64Ptr(sm.AbsHumidity),
+		Vpd:             float32PtrToFloat64Ptr(sm.VPD),
+		Raw:             rawValuesToGQL(sm),
+		Calibrated:      calibratedMetrics(sm),
+	}
+}
+
+// aqiCategoryOf returns the category of sm's AQI on its standard, or nil if it has no AQI.
+func aqiCategoryOf(sm measurement.StorableMeasurement) *model.AQICategory {
+	if sm.AQI == nil {
+		return nil
+	}
+
+	std, ok := aqi.Lookup(sm.AQIStandard)
+	if !ok {
+		return nil
+	}
+
+	return aqiCategoryToGQL(aqi.CategoryOf(std, int(*sm.AQI)))
+}
+
+func bucketToGQLRollup(b rollup.Bucket) *model.Rollup {
+	return &model.Rollup{
+		DeviceID:   b.DeviceID,
+		Metric:     string(b.Metric),
+		Resolution: resolutionToGQL(b.Resolution),
+		StartTime:  timeToGQLTimestamp(b.Start),
+		Min:        float64(b.Min),
+		Max:        float64(b.Max),
+		Mean:       float64(b.Mean()),
+		Count:      int32(b.Count),
+	}
+}
+
+func deviceToGQLDevice(d device.Device) *model.Device {
+	return &model.Device{
+		ID:           d.ID,
+		DeviceID:     d.DeviceID,
+		Aliases:      nonNil(d.Aliases),
+		AWSThingArn:  stringToPtr(d.AWSThingARN),
+		Name:         d.Name(),
+		DisplayName:  stringToPtr(d.DisplayName),
+		Location:     stringToPtr(d.Location),
+		Timezone:     stringToPtr(d.Timezone),
+		Sensors:      nonNil(d.Sensors),
+		Owner:        stringToPtr(d.Owner),
+		Tags:         nonNil(d.Tags),
+		AqiStandard:  stringToPtr(d.AQIStandard),
+		Visibility:   visibilityToGQL(d.EffectiveVisibility()),
+		SharedWith:   nonNil(d.SharedWith),
+		HasPushToken: d.PushTokenHash != "",
+		CreatedAt:    timeToGQLTimestamp(d.Created),
+		UpdatedAt:    timeToGQLTimestamp(d.Updated),
+	}
+}
+
+func reportToGQLDeviceReporting(r uptime.Report) *model.DeviceReporting {
+	reporting := &model.DeviceReporting{
+		LastSeen: stringToPtr(timeToGQLTimestamp(r.LastSeen)),
+		Stale:    r.Stale,
+		Gaps:     []*model.GapBucket{},
+		Uptime:   []*model.Uptime{},
+	}
+
+	if r.Cadence > 0 {
+		reporting.Cadence = stringToPtr(formatDuration(r.Cadence.Round(time.Second)))
+	}
+
+	for _, b := range r.Gaps {
+		gqlBucket := &model.GapBucket{Count: int32(b.Count)}
+		if b.Max > 0 {
+			gqlBucket.Max = stringToPtr(formatDuration(b.Max))
+		}
+		reporting.Gaps = append(reporting.Gaps, gqlBucket)
 	}
+
+	for _, u := range r.Uptime {
+		gqlUptime := &model.Uptime{Window: u.WindowName()}
+		if u.Known {
+			percent := u.Percent()
+			gqlUptime.Percent = &percent
+		}
+		reporting.Uptime = append(reporting.Uptime, gqlUptime)
+	}
+
+	return reporting
+}
+
+// stringToPtr returns nil for the empty string so that unset fields are null in GraphQL.
+func stringToPtr(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
+
+// nonNil returns s, or an empty slice if s is nil, for non-null GraphQL list fields.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+
+	return s
 }
 
 func float32PtrToFloat64Ptr(f *float32) *float64 {
@@ -0,0 +1,146 @@
+package graph
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/aqi"
+	"github.com/mtraver/environmental-sensor/calibration"
+	"github.com/mtraver/environmental-sensor/database"
+	"github.com/mtraver/environmental-sensor/graph/model"
+	"github.com/mtraver/environmental-sensor/measurement"
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+const (
+	// The default and maximum number of measurements in a page of measurementsConnection.
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// measurementsArgs holds the parsed arguments common to the measurement queries.
+type measurementsArgs struct {
+	query database.Query
+
+	// The metrics requested by the client. Unlike query.Metrics this may contain derived metrics,
+	// which aren't stored, so they're replaced in query.Metrics by the metrics they're derived from.
+	metrics []metric.Key
+
+	// The end of the queried range. It's the current time if the client didn't give one.
+	end time.Time
+
+	// standardFor gives the AQI standard to use for each device ID.
+	standardFor func(deviceID string) aqi.Standard
+
+	// profiles correct the measurements before derived metrics are computed.
+	profiles calibration.Profiles
+}
+
+func parseMeasurementsArgs(startTime string, endTime *string, deviceIDs []string, metrics []string) (measurementsArgs, error) {
+	var args measurementsArgs
+
+	start, err := gqlTimestampToTime(startTime)
+	if err != nil {
+		return args, err
+	}
+	args.query.StartTime = start
+
+	args.end = time.Now().UTC()
+	if endTime != nil {
+		args.end, err = gqlTimestampToTime(*endTime)
+		if err != nil {
+			return args, err
+		}
+		args.query.EndTime = args.end
+	}
+
+	args.query.DeviceIDs = deviceIDs
+
+	stored := measurement.StorableMeasurement{}.ValueMap()
+	for _, m := range metrics {
+		key := metric.Key(m)
+		args.metrics = append(args.metrics, key)
+
+		switch _, ok := stored[key]; {
+		case ok:
+			args.query.Metrics = append(args.query.Metrics, key)
+		case key.Derived():
+			args.query.Metrics = append(args.query.Metrics, metric.All[key].Inputs...)
+		default:
+			return args, fmt.Errorf("unknown metric: %q", m)
+		}
+	}
+
+	return args, nil
+}
+
+// toGQL fills in derived metrics and converts sm to a GraphQL measurement, keeping only the
+// metrics requested by the client. sm must already be corrected with a.profiles.
+func (a measurementsArgs) toGQL(sm measurement.StorableMeasurement) *model.Measurement {
+	sm.FillDerivedMetrics(a.standardFor(sm.DeviceID))
+	if len(a.metrics) > 0 {
+		sm.KeepOnly(a.metrics)
+	}
+
+	return storableMeasurementToGQLMeasurement(sm)
+}
+
+// pageSize returns the number of measurements to return in a page given the client's
+// requested number, which may be nil.
+func pageSize(first *int32) (int, error) {
+	if first == nil {
+		return defaultPageSize, nil
+	}
+
+	if *first < 0 {
+		return 0, fmt.Errorf("first must not be negative")
+	}
+
+	return min(int(*first), maxPageSize), nil
+}
+
+func pageToGQLConnection(page database.Page, args measurementsArgs) *model.MeasurementConnection {
+	conn := &model.MeasurementConnection{
+		Edges: []*model.MeasurementEdge{},
+		PageInfo: &model.PageInfo{
+			HasNextPage: page.HasNextPage,
+		},
+	}
+
+	for i, sm := range page.Measurements {
+		conn.Edges = append(conn.Edges, &model.MeasurementEdge{
+			Cursor: page.Cursors[i],
+			Node:   args.toGQL(sm),
+		})
+	}
+
+	if len(page.Cursors) > 0 {
+		startCursor := page.Cursors[0]
+		conn.PageInfo.StartCursor = &startCursor
+	}
+	if endCursor := page.EndCursor(); endCursor != "" {
+		conn.PageInfo.EndCursor = &endCursor
+	}
+
+	return conn
+}
+
+// sortByTimestamp flattens the given map of device ID to measurements into a single slice
+// sorted by timestamp and then device ID.
+func sortByTimestamp(byDevice map[string][]measurement.StorableMeasurement) []measurement.StorableMeasurement {
+	var sms []measurement.StorableMeasurement
+	for _, deviceSMs := range byDevice {
+		sms = append(sms, deviceSMs...)
+	}
+
+	slices.SortFunc(sms, func(a, b measurement.StorableMeasurement) int {
+		if c := a.Timestamp.Compare(b.Timestamp); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.DeviceID, b.DeviceID)
+	})
+
+	return sms
+}
@@ -5,12 +5,25 @@ package graph
 // It serves as dependency injection for your app, add any dependencies you require here.
 
 import (
+	"github.com/mtraver/environmental-sensor/account"
+	"github.com/mtraver/environmental-sensor/alert"
+	"github.com/mtraver/environmental-sensor/broker"
+	"github.com/mtraver/environmental-sensor/calibration"
 	"github.com/mtraver/environmental-sensor/database"
+	"github.com/mtraver/environmental-sensor/device"
+	"github.com/mtraver/environmental-sensor/routing"
 )
 
+// Resolver resolves queries on behalf of the account.Viewer carried by each request's context.
 type Resolver struct {
-	Database       database.Database
-	AWSRegion      string
-	AWSRoleARN     string
-	IgnoredDevices map[string]struct{}
+	Database      database.Database
+	Broker        *broker.Broker
+	Registry      device.Registry
+	AlertStore    alert.Store
+	AlertChannels map[string]alert.Notifier
+	Calibrations  calibration.Store
+	Accounts      account.Store
+	Routing       routing.Store
+	AWSRegion     string
+	AWSRoleARN    string
 }
@@ -0,0 +1,80 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/database"
+	"github.com/mtraver/environmental-sensor/graph/model"
+	"github.com/mtraver/environmental-sensor/measurement"
+	"github.com/mtraver/environmental-sensor/rollup"
+)
+
+const (
+	// Measurement queries spanning at least these durations are served from rollups
+	// rather than raw measurements, which would be too many points to be useful.
+	hourlyRollupMinRange = 7 * 24 * time.Hour
+	dailyRollupMinRange  = 90 * 24 * time.Hour
+)
+
+// rollupResolutionForRange returns the rollup resolution that should be used to serve a
+// measurement query over the given range. ok is false if raw measurements should be used.
+func rollupResolutionForRange(start, end time.Time) (res rollup.Resolution, ok bool) {
+	switch d := end.Sub(start); {
+	case d >= dailyRollupMinRange:
+		return rollup.Daily, true
+	case d >= hourlyRollupMinRange:
+		return rollup.Hourly, true
+	default:
+		return "", false
+	}
+}
+
+// rollupMeasurements returns measurements synthesized from the rollup means of the given
+// resolution, filtered by q's devices and metrics and sorted by timestamp.
+func (r *Resolver) rollupMeasurements(ctx context.Context, res rollup.Resolution, q database.Query, end time.Time) ([]measurement.StorableMeasurement, error) {
+	buckets, err := r.Database.Rollups(ctx, res, q.DeviceIDs, q.StartTime, end)
+	if err != nil {
+		return nil, err
+	}
+
+	measurements := make(map[string][]measurement.StorableMeasurement, len(buckets))
+	for deviceID, bs := range buckets {
+		if len(q.Metrics) > 0 {
+			bs = slices.DeleteFunc(bs, func(b rollup.Bucket) bool {
+				return !slices.Contains(q.Metrics, b.Metric)
+			})
+		}
+
+		measurements[deviceID] = rollup.ToMeasurements(bs)
+	}
+
+	sms := sortByTimestamp(measurements)
+	if q.Limit > 0 && len(sms) > q.Limit {
+		sms = sms[:q.Limit]
+	}
+
+	return sms, nil
+}
+
+func resolutionFromGQL(res model.Resolution) (rollup.Resolution, error) {
+	switch res {
+	case model.ResolutionHourly:
+		return rollup.Hourly, nil
+	case model.ResolutionDaily:
+		return rollup.Daily, nil
+	default:
+		return "", fmt.Errorf("unsupported resolution: %q", res)
+	}
+}
+
+func resolutionToGQL(res rollup.Resolution) model.Resolution {
+	switch res {
+	case rollup.Daily:
+		return model.ResolutionDaily
+	default:
+		return model.ResolutionHourly
+	}
+}
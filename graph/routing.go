@@ -0,0 +1,112 @@
+package graph
+
+import (
+	"fmt"
+
+	"github.com/mtraver/environmental-sensor/alert"
+	"github.com/mtraver/environmental-sensor/graph/model"
+	"github.com/mtraver/environmental-sensor/ingest"
+	"github.com/mtraver/environmental-sensor/metric"
+	"github.com/mtraver/environmental-sensor/routing"
+)
+
+// applyRoutingRuleInput sets the fields of rule that are present in input.
+func applyRoutingRuleInput(rule *routing.Rule, input model.RoutingRuleInput) error {
+	action, err := routingActionFromGQL(input.Action)
+	if err != nil {
+		return err
+	}
+
+	rule.Name = input.Name
+	rule.Action = action
+
+	if input.Priority != nil {
+		rule.Priority = int(*input.Priority)
+	}
+	if input.DevicePattern != nil {
+		rule.DevicePattern = *input.DevicePattern
+	}
+	if input.Source != nil {
+		rule.Source = *input.Source
+	}
+	if input.Metric != nil {
+		rule.Metric = metric.Key(*input.Metric)
+	}
+	if input.Op != nil {
+		rule.Op = alert.Op(*input.Op)
+	}
+	if input.Threshold != nil {
+		rule.Threshold = *input.Threshold
+	}
+	if input.Sinks != nil {
+		rule.Sinks = nil
+		for _, s := range input.Sinks {
+			rule.Sinks = append(rule.Sinks, ingest.Sink(s))
+		}
+	}
+	if input.Tags != nil {
+		rule.Tags = input.Tags
+	}
+	if input.RenameTo != nil {
+		rule.RenameTo = *input.RenameTo
+	}
+	if input.Enabled != nil {
+		rule.Enabled = *input.Enabled
+	}
+
+	return nil
+}
+
+func routingActionFromGQL(action model.RoutingAction) (routing.Action, error) {
+	switch action {
+	case model.RoutingActionDrop:
+		return routing.Drop, nil
+	case model.RoutingActionRoute:
+		return routing.Route, nil
+	case model.RoutingActionTag:
+		return routing.Tag, nil
+	case model.RoutingActionRename:
+		return routing.Rename, nil
+	default:
+		return "", fmt.Errorf("unsupported routing action: %q", action)
+	}
+}
+
+func routingActionToGQL(action routing.Action) model.RoutingAction {
+	switch action {
+	case routing.Route:
+		return model.RoutingActionRoute
+	case routing.Tag:
+		return model.RoutingActionTag
+	case routing.Rename:
+		return model.RoutingActionRename
+	default:
+		return model.RoutingActionDrop
+	}
+}
+
+func routingRuleToGQLRoutingRule(r routing.Rule) *model.RoutingRule {
+	gqlRule := &model.RoutingRule{
+		ID:            r.ID,
+		Name:          r.Name,
+		Priority:      int32(r.Priority),
+		DevicePattern: stringToPtr(r.DevicePattern),
+		Source:        stringToPtr(r.Source),
+		Metric:        stringToPtr(string(r.Metric)),
+		Action:        routingActionToGQL(r.Action),
+		Sinks:         []string{},
+		Tags:          nonNil(r.Tags),
+		RenameTo:      stringToPtr(r.RenameTo),
+		Enabled:       r.Enabled,
+	}
+
+	if r.Op != "" {
+		gqlRule.Op = stringToPtr(string(r.Op))
+		gqlRule.Threshold = &r.Threshold
+	}
+	for _, s := range r.Sinks {
+		gqlRule.Sinks = append(gqlRule.Sinks, string(s))
+	}
+
+	return gqlRule
+}
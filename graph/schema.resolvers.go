@@ -7,76 +7,901 @@ package graph
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
 
+	"github.com/mtraver/environmental-sensor/account"
+	"github.com/mtraver/environmental-sensor/alert"
+	"github.com/mtraver/environmental-sensor/aqi"
+	"github.com/mtraver/environmental-sensor/calibration"
+	"github.com/mtraver/environmental-sensor/database"
 	"github.com/mtraver/environmental-sensor/device"
 	"github.com/mtraver/environmental-sensor/graph/model"
 	"github.com/mtraver/environmental-sensor/measurement"
-	"github.com/mtraver/environmental-sensor/util"
+	"github.com/mtraver/environmental-sensor/metric"
+	"github.com/mtraver/environmental-sensor/rollup"
+	"github.com/mtraver/environmental-sensor/routing"
+	"github.com/mtraver/environmental-sensor/uptime"
 )
 
+// Latest is the resolver for the latest field.
+func (r *deviceResolver) Latest(ctx context.Context, obj *model.Device, aqiStandard *string) (*model.Measurement, error) {
+	ids := append([]string{obj.DeviceID}, obj.Aliases...)
+	latest, err := r.Database.Latest(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// The device may have reported under several IDs. Use the most recent measurement.
+	var newest *measurement.StorableMeasurement
+	for _, sm := range latest {
+		if newest == nil || sm.Timestamp.After(newest.Timestamp) {
+			newest = &sm
+		}
+	}
+
+	if newest == nil {
+		return nil, nil
+	}
+
+	// The requested standard takes precedence over the device's own.
+	var stdID string
+	if aqiStandard != nil {
+		stdID = *aqiStandard
+	} else if obj.AqiStandard != nil {
+		stdID = *obj.AqiStandard
+	}
+	std, ok := aqi.Lookup(stdID)
+	if !ok {
+		return nil, fmt.Errorf("unknown AQI standard: %q", stdID)
+	}
+
+	profiles, err := r.calibrationProfiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sms := []measurement.StorableMeasurement{*newest}
+	profiles.ApplyAll(sms)
+	if err := r.fillNowCast(ctx, sms, func(string) aqi.Standard { return std }, profiles); err != nil {
+		return nil, err
+	}
+
+	sms[0].FillDerivedMetrics(std)
+	return storableMeasurementToGQLMeasurement(sms[0]), nil
+}
+
+// Reporting is the resolver for the reporting field.
+func (r *deviceResolver) Reporting(ctx context.Context, obj *model.Device) (*model.DeviceReporting, error) {
+	d := device.Device{DeviceID: obj.DeviceID, Aliases: obj.Aliases}
+
+	report, err := uptime.ForDevice(ctx, r.Database, d, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	return reportToGQLDeviceReporting(report), nil
+}
+
+// Temp is the resolver for the temp field.
+func (r *measurementResolver) Temp(ctx context.Context, obj *model.Measurement, unit *model.Unit) (*float64, error) {
+	return convertValue(ctx, metric.Temp, obj.Temp, unit)
+}
+
+// Hcho is the resolver for the hcho field.
+func (r *measurementResolver) Hcho(ctx context.Context, obj *model.Measurement, unit *model.Unit) (*float64, error) {
+	return convertValue(ctx, metric.HCHO, obj.Hcho, unit)
+}
+
+// Co2 is the resolver for the co2 field.
+func (r *measurementResolver) Co2(ctx context.Context, obj *model.Measurement, unit *model.Unit) (*float64, error) {
+	return convertValue(ctx, metric.CO2, obj.Co2, unit)
+}
+
+// DewPoint is the resolver for the dewPoint field.
+func (r *measurementResolver) DewPoint(ctx context.Context, obj *model.Measurement, unit *model.Unit) (*float64, error) {
+	return convertValue(ctx, metric.DewPoint, obj.DewPoint, unit)
+}
+
+// HeatIndex is the resolver for the heatIndex field.
+func (r *measurementResolver) HeatIndex(ctx context.Context, obj *model.Measurement, unit *model.Unit) (*float64, error) {
+	return convertValue(ctx, metric.HeatIndex, obj.HeatIndex, unit)
+}
+
+// RegisterDevice is the resolver for the registerDevice field.
+func (r *mutationResolver) RegisterDevice(ctx context.Context, input model.DeviceInput) (*model.Device, error) {
+	v := account.FromContext(ctx)
+	if !v.SignedIn() && !v.Admin {
+		return nil, errSignInRequired
+	}
+
+	d := device.Device{Owner: v.User.VerifiedEmail()}
+	applyDeviceInput(&d, input)
+	if !v.CanEdit(d) {
+		return nil, errAccessDenied
+	}
+
+	d, err := r.Registry.PutDevice(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+
+	return deviceToGQLDevice(d), nil
+}
+
+// UpdateDevice is the resolver for the updateDevice field.
+func (r *mutationResolver) UpdateDevice(ctx context.Context, id string, input model.DeviceInput) (*model.Device, error) {
+	d, err := r.editableDevice(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	applyDeviceInput(&d, input)
+
+	d, err = r.Registry.PutDevice(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+
+	return deviceToGQLDevice(d), nil
+}
+
+// DeleteDevice is the resolver for the deleteDevice field.
+func (r *mutationResolver) DeleteDevice(ctx context.Context, id string) (bool, error) {
+	if _, err := r.editableDevice(ctx, id); err != nil {
+		return false, err
+	}
+
+	if err := r.Registry.DeleteDevice(ctx, id); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SyncDevicesFromAWS is the resolver for the syncDevicesFromAWS field.
+func (r *mutationResolver) SyncDevicesFromAWS(ctx context.Context) ([]*model.Device, error) {
+	if !account.FromContext(ctx).Admin {
+		return nil, errAccessDenied
+	}
+
+	things, err := device.GetDevicesAWS(ctx, r.AWSRoleARN, r.AWSRegion)
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := device.SyncAWS(ctx, r.Registry, things)
+	if err != nil {
+		return nil, err
+	}
+
+	gqlDevices := []*model.Device{}
+	for _, d := range changed {
+		gqlDevices = append(gqlDevices, deviceToGQLDevice(d))
+	}
+
+	return gqlDevices, nil
+}
+
+// CreateDevicePushToken is the resolver for the createDevicePushToken field.
+func (r *mutationResolver) CreateDevicePushToken(ctx context.Context, id string) (string, error) {
+	d, err := r.editableDevice(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	token, hash, err := device.NewPushToken(d.ID)
+	if err != nil {
+		return "", err
+	}
+	d.PushTokenHash = hash
+
+	if _, err := r.Registry.PutDevice(ctx, d); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// DeleteDevicePushToken is the resolver for the deleteDevicePushToken field.
+func (r *mutationResolver) DeleteDevicePushToken(ctx context.Context, id string) (bool, error) {
+	d, err := r.editableDevice(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	d.PushTokenHash = ""
+
+	if _, err := r.Registry.PutDevice(ctx, d); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// CreateAlertRule is the resolver for the createAlertRule field.
+func (r *mutationResolver) CreateAlertRule(ctx context.Context, input model.AlertRuleInput) (*model.AlertRule, error) {
+	rule := alert.Rule{Enabled: true}
+	if err := r.applyAlertRuleInput(&rule, input); err != nil {
+		return nil, err
+	}
+	if err := r.checkCanEditDeviceID(ctx, rule.DeviceID); err != nil {
+		return nil, err
+	}
+
+	rule, err := r.AlertStore.PutAlertRule(ctx, rule)
+	if err != nil {
+		return nil, err
+	}
+
+	return alertRuleToGQLAlertRule(rule), nil
+}
+
+// UpdateAlertRule is the resolver for the updateAlertRule field.
+func (r *mutationResolver) UpdateAlertRule(ctx context.Context, id string, input model.AlertRuleInput) (*model.AlertRule, error) {
+	rule, err := r.AlertStore.AlertRule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkCanEditDeviceID(ctx, rule.DeviceID); err != nil {
+		return nil, err
+	}
+	if err := r.applyAlertRuleInput(&rule, input); err != nil {
+		return nil, err
+	}
+	if err := r.checkCanEditDeviceID(ctx, rule.DeviceID); err != nil {
+		return nil, err
+	}
+
+	rule, err = r.AlertStore.PutAlertRule(ctx, rule)
+	if err != nil {
+		return nil, err
+	}
+
+	return alertRuleToGQLAlertRule(rule), nil
+}
+
+// DeleteAlertRule is the resolver for the deleteAlertRule field.
+func (r *mutationResolver) DeleteAlertRule(ctx context.Context, id string) (bool, error) {
+	rule, err := r.AlertStore.AlertRule(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	if err := r.checkCanEditDeviceID(ctx, rule.DeviceID); err != nil {
+		return false, err
+	}
+
+	if err := r.AlertStore.DeleteAlertRule(ctx, id); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// CreateRoutingRule is the resolver for the createRoutingRule field.
+func (r *mutationResolver) CreateRoutingRule(ctx context.Context, input model.RoutingRuleInput) (*model.RoutingRule, error) {
+	if !account.FromContext(ctx).Admin {
+		return nil, errAccessDenied
+	}
+
+	rule := routing.Rule{Enabled: true}
+	if err := applyRoutingRuleInput(&rule, input); err != nil {
+		return nil, err
+	}
+
+	rule, err := r.Routing.PutRoutingRule(ctx, rule)
+	if err != nil {
+		return nil, err
+	}
+
+	return routingRuleToGQLRoutingRule(rule), nil
+}
+
+// UpdateRoutingRule is the resolver for the updateRoutingRule field.
+func (r *mutationResolver) UpdateRoutingRule(ctx context.Context, id string, input model.RoutingRuleInput) (*model.RoutingRule, error) {
+	if !account.FromContext(ctx).Admin {
+		return nil, errAccessDenied
+	}
+
+	rule, err := r.Routing.RoutingRule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyRoutingRuleInput(&rule, input); err != nil {
+		return nil, err
+	}
+
+	rule, err = r.Routing.PutRoutingRule(ctx, rule)
+	if err != nil {
+		return nil, err
+	}
+
+	return routingRuleToGQLRoutingRule(rule), nil
+}
+
+// DeleteRoutingRule is the resolver for the deleteRoutingRule field.
+func (r *mutationResolver) DeleteRoutingRule(ctx context.Context, id string) (bool, error) {
+	if !account.FromContext(ctx).Admin {
+		return false, errAccessDenied
+	}
+
+	if err := r.Routing.DeleteRoutingRule(ctx, id); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// CreateCalibrationProfile is the resolver for the createCalibrationProfile field.
+func (r *mutationResolver) CreateCalibrationProfile(ctx context.Context, input model.CalibrationProfileInput) (*model.CalibrationProfile, error) {
+	var p calibration.Profile
+	if err := applyCalibrationProfileInput(&p, input); err != nil {
+		return nil, err
+	}
+	if err := r.checkCanEditDeviceID(ctx, p.DeviceID); err != nil {
+		return nil, err
+	}
+
+	p, err := r.Calibrations.PutCalibrationProfile(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	return calibrationProfileToGQL(p), nil
+}
+
+// UpdateCalibrationProfile is the resolver for the updateCalibrationProfile field.
+func (r *mutationResolver) UpdateCalibrationProfile(ctx context.Context, id string, input model.CalibrationProfileInput) (*model.CalibrationProfile, error) {
+	p, err := r.Calibrations.CalibrationProfile(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkCanEditDeviceID(ctx, p.DeviceID); err != nil {
+		return nil, err
+	}
+	if err := applyCalibrationProfileInput(&p, input); err != nil {
+		return nil, err
+	}
+	if err := r.checkCanEditDeviceID(ctx, p.DeviceID); err != nil {
+		return nil, err
+	}
+
+	p, err = r.Calibrations.PutCalibrationProfile(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	return calibrationProfileToGQL(p), nil
+}
+
+// DeleteCalibrationProfile is the resolver for the deleteCalibrationProfile field.
+func (r *mutationResolver) DeleteCalibrationProfile(ctx context.Context, id string) (bool, error) {
+	p, err := r.Calibrations.CalibrationProfile(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	if err := r.checkCanEditDeviceID(ctx, p.DeviceID); err != nil {
+		return false, err
+	}
+
+	if err := r.Calibrations.DeleteCalibrationProfile(ctx, id); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// CreateAPIToken is the resolver for the createApiToken field.
+func (r *mutationResolver) CreateAPIToken(ctx context.Context, name string) (*model.NewAPIToken, error) {
+	v := account.FromContext(ctx)
+	if !v.SignedIn() {
+		return nil, errSignInRequired
+	}
+
+	token, t, err := account.NewAPIToken(v.User.ID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err = r.Accounts.PutAPIToken(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.NewAPIToken{Token: token, APIToken: apiTokenToGQL(t)}, nil
+}
+
+// DeleteAPIToken is the resolver for the deleteApiToken field.
+func (r *mutationResolver) DeleteAPIToken(ctx context.Context, id string) (bool, error) {
+	v := account.FromContext(ctx)
+	if !v.SignedIn() {
+		return false, errSignInRequired
+	}
+
+	// Users can only delete their own tokens. Other users' tokens are reported as not found.
+	tokens, err := r.Accounts.APITokens(ctx, v.User.ID)
+	if err != nil {
+		return false, err
+	}
+	if !slices.ContainsFunc(tokens, func(t account.APIToken) bool { return t.ID == id }) {
+		return false, account.ErrNotFound
+	}
+
+	if err := r.Accounts.DeleteAPIToken(ctx, id); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
 // Measurements is the resolver for the measurements field.
-func (r *queryResolver) Measurements(ctx context.Context, startTime string, endTime *string) ([]*model.Measurement, error) {
-	start, err := gqlTimestampToTime(startTime)
+func (r *queryResolver) Measurements(ctx context.Context, startTime string, endTime *string, deviceIds []string, metrics []string, limit *int32, aqiStandard *string) ([]*model.Measurement, error) {
+	args, err := parseMeasurementsArgs(startTime, endTime, deviceIds, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok, err := r.restrictToScope(ctx, &args); err != nil {
+		return nil, err
+	} else if !ok {
+		return []*model.Measurement{}, nil
+	}
+
+	args.standardFor, err = r.aqiStandardFor(ctx, aqiStandard)
 	if err != nil {
 		return nil, err
 	}
 
-	var measurements map[string][]measurement.StorableMeasurement
-	if endTime == nil {
-		measurements, err = r.Database.Since(ctx, start)
+	args.profiles, err = r.calibrationProfiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit != nil {
+		if *limit < 0 {
+			return nil, fmt.Errorf("limit must not be negative")
+		}
+		args.query.Limit = int(*limit)
+	}
+
+	var measurements []measurement.StorableMeasurement
+	if res, ok := rollupResolutionForRange(args.query.StartTime, args.end); ok {
+		measurements, err = r.rollupMeasurements(ctx, res, args.query, args.end)
 		if err != nil {
 			return nil, err
 		}
+
+		// Linear corrections of means are exact. Other corrections are approximate.
+		args.profiles.ApplyAll(measurements)
+
+		// Hourly means are exactly what NowCast averages, so the NowCast can be computed from
+		// them directly. It's meaningless for daily means.
+		if res == rollup.Hourly && args.wantsAQI() {
+			measurement.FillNowCast(measurements, nil, args.standardFor)
+		}
 	} else {
-		end, err := gqlTimestampToTime(*endTime)
+		page, err := r.Database.Query(ctx, args.query)
 		if err != nil {
 			return nil, err
 		}
+		measurements = page.Measurements
+		args.profiles.ApplyAll(measurements)
 
-		measurements, err = r.Database.Between(ctx, start, end)
-		if err != nil {
-			return nil, err
+		if args.wantsAQI() {
+			if err := r.fillNowCast(ctx, measurements, args.standardFor, args.profiles); err != nil {
+				return nil, err
+			}
 		}
 	}
 
 	gqlMeasurements := []*model.Measurement{}
-	for _, ms := range measurements {
-		for _, m := range ms {
-			m.FillDerivedMetrics()
-			gqlMeasurements = append(gqlMeasurements, storableMeasurementToGQLMeasurement(m))
-		}
+	for _, m := range measurements {
+		gqlMeasurements = append(gqlMeasurements, args.toGQL(m))
 	}
 
 	return gqlMeasurements, nil
 }
 
-// Latest is the resolver for the latest field.
-func (r *queryResolver) Latest(ctx context.Context) ([]*model.Measurement, error) {
-	ids, err := device.GetDeviceIDsAWS(ctx, r.AWSRoleARN, r.AWSRegion)
+// MeasurementsConnection is the resolver for the measurementsConnection field.
+func (r *queryResolver) MeasurementsConnection(ctx context.Context, startTime string, endTime *string, deviceIds []string, metrics []string, first *int32, after *string, aqiStandard *string) (*model.MeasurementConnection, error) {
+	args, err := parseMeasurementsArgs(startTime, endTime, deviceIds, metrics)
 	if err != nil {
 		return nil, err
 	}
 
-	ids = util.FilterInPlace(ids, func(id string) bool {
-		_, ok := r.IgnoredDevices[id]
-		return !ok
-	})
+	if ok, err := r.restrictToScope(ctx, &args); err != nil {
+		return nil, err
+	} else if !ok {
+		return pageToGQLConnection(database.Page{}, args), nil
+	}
+
+	args.standardFor, err = r.aqiStandardFor(ctx, aqiStandard)
+	if err != nil {
+		return nil, err
+	}
+
+	args.profiles, err = r.calibrationProfiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	args.query.Limit, err = pageSize(first)
+	if err != nil {
+		return nil, err
+	}
+	if args.query.Limit == 0 {
+		return pageToGQLConnection(database.Page{}, args), nil
+	}
+
+	if after != nil {
+		args.query.Cursor = *after
+	}
+
+	page, err := r.Database.Query(ctx, args.query)
+	if err != nil {
+		return nil, err
+	}
+
+	args.profiles.ApplyAll(page.Measurements)
+	if args.wantsAQI() {
+		if err := r.fillNowCast(ctx, page.Measurements, args.standardFor, args.profiles); err != nil {
+			return nil, err
+		}
+	}
+
+	return pageToGQLConnection(page, args), nil
+}
+
+// Latest is the resolver for the latest field.
+func (r *queryResolver) Latest(ctx context.Context, aqiStandard *string) ([]*model.Measurement, error) {
+	ids, err := r.visibleDeviceIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	latest, err := r.Database.Latest(ctx, ids)
 	if err != nil {
 		return nil, err
 	}
 
+	standardFor, err := r.aqiStandardFor(ctx, aqiStandard)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles, err := r.calibrationProfiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sms := slices.Collect(maps.Values(latest))
+	profiles.ApplyAll(sms)
+	if err := r.fillNowCast(ctx, sms, standardFor, profiles); err != nil {
+		return nil, err
+	}
+
 	gqlMeasurements := []*model.Measurement{}
-	for _, m := range latest {
-		m.FillDerivedMetrics()
+	for _, m := range sms {
+		m.FillDerivedMetrics(standardFor(m.DeviceID))
 		gqlMeasurements = append(gqlMeasurements, storableMeasurementToGQLMeasurement(m))
 	}
 
 	return gqlMeasurements, nil
 }
 
+// Rollups is the resolver for the rollups field.
+func (r *queryResolver) Rollups(ctx context.Context, resolution model.Resolution, startTime string, endTime *string) ([]*model.Rollup, error) {
+	res, err := resolutionFromGQL(resolution)
+	if err != nil {
+		return nil, err
+	}
+
+	start, err := gqlTimestampToTime(startTime)
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now().UTC()
+	if endTime != nil {
+		end, err = gqlTimestampToTime(*endTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	scope, err := r.deviceScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceIDs, ok := scope.Restrict(nil)
+	if !ok {
+		return []*model.Rollup{}, nil
+	}
+
+	buckets, err := r.Database.Rollups(ctx, res, deviceIDs, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	gqlRollups := []*model.Rollup{}
+	for _, bs := range buckets {
+		for _, b := range bs {
+			gqlRollups = append(gqlRollups, bucketToGQLRollup(b))
+		}
+	}
+
+	return gqlRollups, nil
+}
+
+// Devices is the resolver for the devices field.
+func (r *queryResolver) Devices(ctx context.Context, location *string, owner *string, tag *string) ([]*model.Device, error) {
+	devices, err := r.viewableDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	match := deviceFilter(location, owner, tag)
+
+	gqlDevices := []*model.Device{}
+	for _, d := range devices {
+		if match(d) {
+			gqlDevices = append(gqlDevices, deviceToGQLDevice(d))
+		}
+	}
+
+	return gqlDevices, nil
+}
+
+// Device is the resolver for the device field.
+func (r *queryResolver) Device(ctx context.Context, id string) (*model.Device, error) {
+	d, err := r.Registry.Device(ctx, id)
+	if errors.Is(err, device.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !account.FromContext(ctx).CanView(d) {
+		return nil, nil
+	}
+
+	return deviceToGQLDevice(d), nil
+}
+
+// AlertRules is the resolver for the alertRules field.
+func (r *queryResolver) AlertRules(ctx context.Context) ([]*model.AlertRule, error) {
+	scope, err := r.deviceScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := r.AlertStore.AlertRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rules for every device are shown to everyone who's signed in. Their alerts are only shown
+	// for the devices each viewer can see.
+	v := account.FromContext(ctx)
+	gqlRules := []*model.AlertRule{}
+	for _, rule := range rules {
+		if rule.DeviceID == "" && (v.SignedIn() || v.Admin) || rule.DeviceID != "" && scope.Allows(rule.DeviceID) {
+			gqlRules = append(gqlRules, alertRuleToGQLAlertRule(rule))
+		}
+	}
+
+	return gqlRules, nil
+}
+
+// Alerts is the resolver for the alerts field.
+func (r *queryResolver) Alerts(ctx context.Context, status *model.AlertStatus) ([]*model.Alert, error) {
+	scope, err := r.deviceScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := r.AlertStore.AlertRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rulesByID := make(map[string]alert.Rule, len(rules))
+	for _, rule := range rules {
+		rulesByID[rule.ID] = rule
+	}
+
+	states, err := r.AlertStore.AlertStates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	gqlAlerts := []*model.Alert{}
+	for _, s := range states {
+		rule, ok := rulesByID[s.RuleID]
+		if !ok || !scope.Allows(s.DeviceID) {
+			continue
+		}
+
+		a := alertStateToGQLAlert(rule, s)
+		if status != nil && a.Status != *status {
+			continue
+		}
+		gqlAlerts = append(gqlAlerts, a)
+	}
+
+	return gqlAlerts, nil
+}
+
+// RoutingRules is the resolver for the routingRules field.
+func (r *queryResolver) RoutingRules(ctx context.Context) ([]*model.RoutingRule, error) {
+	if !account.FromContext(ctx).Admin {
+		return nil, errAccessDenied
+	}
+
+	rules, err := r.Routing.RoutingRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	gqlRules := []*model.RoutingRule{}
+	for _, rule := range rules {
+		gqlRules = append(gqlRules, routingRuleToGQLRoutingRule(rule))
+	}
+
+	return gqlRules, nil
+}
+
+// AqiStandards is the resolver for the aqiStandards field.
+func (r *queryResolver) AqiStandards(ctx context.Context) ([]*model.AQIStandard, error) {
+	gqlStandards := []*model.AQIStandard{}
+	for _, s := range aqi.Standards {
+		gqlStandards = append(gqlStandards, aqiStandardToGQL(s))
+	}
+
+	return gqlStandards, nil
+}
+
+// Metrics is the resolver for the metrics field.
+func (r *queryResolver) Metrics(ctx context.Context) ([]*model.Metric, error) {
+	keys := slices.Sorted(maps.Keys(metric.All))
+
+	metrics := make([]*model.Metric, len(keys))
+	for i, k := range keys {
+		metrics[i] = metricToGQL(ctx, k)
+	}
+
+	return metrics, nil
+}
+
+// CalibrationProfiles is the resolver for the calibrationProfiles field.
+func (r *queryResolver) CalibrationProfiles(ctx context.Context, deviceID *string) ([]*model.CalibrationProfile, error) {
+	scope, err := r.deviceScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles, err := r.Calibrations.CalibrationProfiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	gqlProfiles := []*model.CalibrationProfile{}
+	for _, p := range profiles {
+		if deviceID != nil && p.DeviceID != *deviceID || !scope.Allows(p.DeviceID) {
+			continue
+		}
+		gqlProfiles = append(gqlProfiles, calibrationProfileToGQL(p))
+	}
+
+	return gqlProfiles, nil
+}
+
+// Viewer is the resolver for the viewer field.
+func (r *queryResolver) Viewer(ctx context.Context) (*model.Viewer, error) {
+	v := account.FromContext(ctx)
+	if !v.SignedIn() {
+		return nil, nil
+	}
+
+	tokens, err := r.Accounts.APITokens(ctx, v.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return viewerToGQL(v, tokens), nil
+}
+
+// Temp is the resolver for the temp field.
+func (r *rawValuesResolver) Temp(ctx context.Context, obj *model.RawValues, unit *model.Unit) (*float64, error) {
+	return convertValue(ctx, metric.Temp, obj.Temp, unit)
+}
+
+// Hcho is the resolver for the hcho field.
+func (r *rawValuesResolver) Hcho(ctx context.Context, obj *model.RawValues, unit *model.Unit) (*float64, error) {
+	return convertValue(ctx, metric.HCHO, obj.Hcho, unit)
+}
+
+// Co2 is the resolver for the co2 field.
+func (r *rawValuesResolver) Co2(ctx context.Context, obj *model.RawValues, unit *model.Unit) (*float64, error) {
+	return convertValue(ctx, metric.CO2, obj.Co2, unit)
+}
+
+// MeasurementAdded is the resolver for the measurementAdded field.
+func (r *subscriptionResolver) MeasurementAdded(ctx context.Context, deviceIds []string, aqiStandard *string) (<-chan *model.Measurement, error) {
+	if r.Broker == nil {
+		return nil, fmt.Errorf("live measurements are not available")
+	}
+
+	// Devices' standards and calibration profiles are looked up once, so changes to them don't
+	// affect subscriptions that are already open.
+	standardFor, err := r.aqiStandardFor(ctx, aqiStandard)
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := r.calibrationProfiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	scope, err := r.deviceScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deviceIds, ok := scope.Restrict(deviceIds)
+	if !ok {
+		return nil, errAccessDenied
+	}
+
+	measurements := r.Broker.Subscribe(ctx, deviceIds)
+
+	ch := make(chan *model.Measurement)
+	go func() {
+		defer close(ch)
+
+		for m := range measurements {
+			sm, err := measurement.NewStorableMeasurement(m)
+			if err != nil {
+				continue
+			}
+			profiles.Apply(&sm)
+			sm.FillDerivedMetrics(standardFor(sm.DeviceID))
+
+			select {
+			case ch <- storableMeasurementToGQLMeasurement(sm):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// Device returns DeviceResolver implementation.
+func (r *Resolver) Device() DeviceResolver { return &deviceResolver{r} }
+
+// Measurement returns MeasurementResolver implementation.
+func (r *Resolver) Measurement() MeasurementResolver { return &measurementResolver{r} }
+
+// Mutation returns MutationResolver implementation.
+func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
+
 // Query returns QueryResolver implementation.
 func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 
-type queryResolver struct{ *Resolver }
+// RawValues returns RawValuesResolver implementation.
+func (r *Resolver) RawValues() RawValuesResolver { return &rawValuesResolver{r} }
+
+// Subscription returns SubscriptionResolver implementation.
+func (r *Resolver) Subscription() SubscriptionResolver { return &subscriptionResolver{r} }
+
+type (
+	deviceResolver       struct{ *Resolver }
+	measurementResolver  struct{ *Resolver }
+	mutationResolver     struct{ *Resolver }
+	queryResolver        struct{ *Resolver }
+	rawValuesResolver    struct{ *Resolver }
+	subscriptionResolver struct{ *Resolver }
+)
@@ -0,0 +1,78 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mtraver/environmental-sensor/graph/model"
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+type unitPreferencesKey struct{}
+
+// WithUnitPreferences returns a copy of ctx carrying the caller's preferred units, which are used
+// for values whose unit isn't given in the query.
+func WithUnitPreferences(ctx context.Context, p metric.Preferences) context.Context {
+	return context.WithValue(ctx, unitPreferencesKey{}, p)
+}
+
+// unitPreferences returns the preferred units carried by ctx, if any.
+func unitPreferences(ctx context.Context) metric.Preferences {
+	p, _ := ctx.Value(unitPreferencesKey{}).(metric.Preferences)
+	return p
+}
+
+// The GraphQL Unit enum values are the upper case metric.Unit IDs.
+func unitFromGQL(u model.Unit) metric.Unit {
+	return metric.Unit(strings.ToLower(string(u)))
+}
+
+func unitToGQL(u metric.Unit) model.Unit {
+	return model.Unit(strings.ToUpper(string(u)))
+}
+
+// convertValue converts v, a value of k in the unit it's stored in, to unit, or to the caller's
+// preferred unit if unit is nil.
+func convertValue(ctx context.Context, k metric.Key, v *float64, unit *model.Unit) (*float64, error) {
+	u := unitPreferences(ctx).UnitFor(k)
+	if unit != nil {
+		u = unitFromGQL(*unit)
+		if !slices.Contains(metric.All[k].Units, u) {
+			return nil, fmt.Errorf("%s can't be given in %s", k, *unit)
+		}
+	}
+
+	if v == nil || u == "" {
+		return v, nil
+	}
+
+	converted, err := metric.Convert(k, float32(*v), u)
+	if err != nil {
+		return nil, err
+	}
+	f := float64(converted)
+	return &f, nil
+}
+
+func metricToGQL(ctx context.Context, k metric.Key) *model.Metric {
+	info := metric.All[k]
+
+	m := &model.Metric{
+		Key:     string(k),
+		Name:    info.Name,
+		Unit:    info.Unit,
+		Units:   []model.Unit{},
+		Derived: k.Derived(),
+	}
+
+	if u := unitPreferences(ctx).UnitFor(k); u != "" {
+		m.Unit = u.Symbol()
+	}
+	for _, u := range info.Units {
+		m.Units = append(m.Units, unitToGQL(u))
+	}
+
+	return m
+}
@@ -0,0 +1,75 @@
+// Package humidity computes metrics derived from air temperature and relative humidity:
+// dew point, heat index, humidex, absolute humidity, and vapor pressure deficit. Temperatures
+// are in °C and relative humidity is in percent.
+package humidity
+
+import "math"
+
+// Coefficients of the Magnus formula for saturation vapor pressure over water, from Alduchov
+// and Eskridge (1996).
+const (
+	magnusA = 17.625
+	magnusB = 243.04 // °C
+	magnusC = 6.1094 // hPa
+)
+
+// saturationVaporPressure returns the saturation vapor pressure over water at temp, in hPa.
+func saturationVaporPressure(temp float64) float64 {
+	return magnusC * math.Exp(magnusA*temp/(magnusB+temp))
+}
+
+// DewPoint returns the temperature in °C to which air at temp with relative humidity rh must be
+// cooled to become saturated. rh must be positive.
+func DewPoint(temp, rh float32) float32 {
+	t := float64(temp)
+	gamma := math.Log(float64(rh)/100) + magnusA*t/(magnusB+t)
+	return float32(magnusB * gamma / (magnusA - gamma))
+}
+
+// HeatIndex returns the US National Weather Service heat index in °C, which is what temp feels
+// like at relative humidity rh. It uses the Rothfusz regression, with the NWS's adjustments,
+// when the heat index is at least 80 °F and Steadman's simpler formula otherwise.
+// See https://www.wpc.ncep.noaa.gov/html/heatindex_equation.shtml.
+func HeatIndex(temp, rh float32) float32 {
+	t := float64(temp)*9/5 + 32
+	r := float64(rh)
+
+	hi := 0.5 * (t + 61 + (t-68)*1.2 + r*0.094)
+	if (hi+t)/2 >= 80 {
+		hi = -42.379 + 2.04901523*t + 10.14333127*r -
+			0.22475541*t*r - 0.00683783*t*t - 0.05481717*r*r +
+			0.00122874*t*t*r + 0.00085282*t*r*r - 0.00000199*t*t*r*r
+
+		switch {
+		case r < 13 && t >= 80 && t <= 112:
+			hi -= (13 - r) / 4 * math.Sqrt((17-math.Abs(t-95))/17)
+		case r > 85 && t >= 80 && t <= 87:
+			hi += (r - 85) / 10 * (87 - t) / 5
+		}
+	}
+
+	return float32((hi - 32) * 5 / 9)
+}
+
+// Humidex returns the Environment Canada humidex, a dimensionless number on the scale of °C
+// that describes how hot temp feels at relative humidity rh. rh must be positive.
+func Humidex(temp, rh float32) float32 {
+	dewPointK := float64(DewPoint(temp, rh)) + 273.15
+	e := 6.11 * math.Exp(5417.7530*(1/273.16-1/dewPointK))
+	return temp + float32(0.5555*(e-10))
+}
+
+// AbsoluteHumidity returns the mass of water vapor in a volume of air at temp with relative
+// humidity rh, in g/m³.
+func AbsoluteHumidity(temp, rh float32) float32 {
+	t := float64(temp)
+	vaporPressure := float64(rh) / 100 * saturationVaporPressure(t)
+	return float32(216.7 * vaporPressure / (273.15 + t))
+}
+
+// VPD returns the vapor pressure deficit, the difference between the saturation vapor pressure
+// at temp and the actual vapor pressure at relative humidity rh, in kPa.
+func VPD(temp, rh float32) float32 {
+	es := saturationVaporPressure(float64(temp)) / 10
+	return float32(es * (1 - float64(rh)/100))
+}
@@ -0,0 +1,48 @@
+package humidity
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// Computed values are compared to reference values to within this many units.
+const tolerance = 0.05
+
+func TestHumidity(t *testing.T) {
+	cases := []struct {
+		temp, rh float32
+
+		dewPoint, heatIndex, humidex, absHumidity, vpd float32
+	}{
+		{25, 50, 13.86, 24.86, 28.28, 11.49, 1.581},
+		// Hot and humid enough for the Rothfusz regression.
+		{32, 70, 25.84, 40.41, 45.28, 23.61, 1.425},
+		// Hot and dry, with the low humidity adjustment.
+		{30, 10, -4.95, 27.86, 26.80, 3.03, 3.813},
+		// Warm and very humid, with the high humidity adjustment.
+		{27, 90, 25.22, 31.09, 39.58, 23.13, 0.356},
+		{0, 80, -3.04, -1.86, -2.84, 3.88, 0.122},
+		{20, 100, 20, 20.67, 27.57, 17.26, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%v_%v", c.temp, c.rh), func(t *testing.T) {
+			for _, f := range []struct {
+				name string
+				fn   func(temp, rh float32) float32
+				want float32
+			}{
+				{"DewPoint", DewPoint, c.dewPoint},
+				{"HeatIndex", HeatIndex, c.heatIndex},
+				{"Humidex", Humidex, c.humidex},
+				{"AbsoluteHumidity", AbsoluteHumidity, c.absHumidity},
+				{"VPD", VPD, c.vpd},
+			} {
+				if got := f.fn(c.temp, c.rh); math.Abs(float64(got-f.want)) > tolerance {
+					t.Errorf("%s: got %v, want %v", f.name, got, f.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+// Package importer reads measurements from CSV, JSON Lines, or protobuf files, validates them,
+// and writes them to Pub/Sub or directly to a database.
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/ingest"
+	"github.com/mtraver/environmental-sensor/measurement"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/measurementpbutil"
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+const (
+	// DefaultBatchSize is the number of measurements written at a time if Options.BatchSize
+	// isn't set.
+	DefaultBatchSize = 500
+
+	// maxReportedErrors is the number of record errors kept in a Report.
+	maxReportedErrors = 20
+)
+
+// Reader reads measurements from a file, one record at a time.
+type Reader interface {
+	// Read returns the measurement in the next record. It returns io.EOF after the last record,
+	// and a *RecordError if the record is malformed, in which case reading can continue.
+	Read() (*mpb.Measurement, error)
+}
+
+// RecordError is an error in one record of the input.
+type RecordError struct {
+	// Record is the 1-based number of the record, not counting any header.
+	Record int
+	Err    error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("record %d: %v", e.Record, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// Sink writes measurements.
+type Sink interface {
+	// Write writes ms. It returns only once every measurement has been accepted by the
+	// destination, so that the import can resume after the batch if it fails later on.
+	Write(ctx context.Context, ms []*mpb.Measurement) error
+}
+
+// Options control an import.
+type Options struct {
+	// The number of measurements written at a time. If it's zero then DefaultBatchSize is used.
+	BatchSize int
+
+	// Skip is the number of records to skip before importing. To resume a failed import, set it
+	// to the Committed count of the failed import's report.
+	Skip int
+
+	// If DryRun is true then records are read and validated but nothing is written.
+	DryRun bool
+
+	// MaxAge and MaxFuture limit how far before and after the time of the import measurement
+	// timestamps may be, as the limits of the ingest.Pipeline that the measurements are sent to
+	// do. Records outside those limits are invalid. Zero means no limit.
+	MaxAge    time.Duration
+	MaxFuture time.Duration
+
+	// Checkpoint, if non-nil, is called with the report's Committed count after each batch is
+	// written. If it returns an error then the import stops.
+	Checkpoint func(committed int) error
+}
+
+// Report summarizes an import.
+type Report struct {
+	// Read is the number of records read, including those that were skipped.
+	Read int
+
+	// Skipped is the number of records skipped because of Options.Skip.
+	Skipped int
+
+	// Invalid is the number of records that were malformed or failed validation. They aren't
+	// written.
+	Invalid int
+
+	// Duplicates is the number of records with the same device ID and timestamp as an earlier
+	// record. Only the first is written.
+	Duplicates int
+
+	// Written is the number of measurements written, or that would have been in a dry run.
+	Written int
+
+	// Committed is the number of records, counted from the start of the input, that were
+	// processed and whose measurements are known to have been written.
+	Committed int
+
+	// Errors are the first record errors.
+	Errors []error
+
+	// Devices and Metrics count the measurements written by device and by metric.
+	Devices map[string]int
+	Metrics map[metric.Key]int
+
+	// First and Last are the earliest and latest timestamps of the measurements written.
+	First, Last time.Time
+}
+
+func (r *Report) addError(err error) {
+	r.Invalid++
+	if len(r.Errors) < maxReportedErrors {
+		r.Errors = append(r.Errors, err)
+	}
+}
+
+func (r *Report) add(sm measurement.StorableMeasurement) {
+	r.Written++
+	r.Devices[sm.DeviceID]++
+	for k, v := range sm.ValueMap() {
+		if v != nil {
+			r.Metrics[k]++
+		}
+	}
+
+	if r.First.IsZero() || sm.Timestamp.Before(r.First) {
+		r.First = sm.Timestamp
+	}
+	if sm.Timestamp.After(r.Last) {
+		r.Last = sm.Timestamp
+	}
+}
+
+func (r Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "records read: %d\n", r.Read)
+	if r.Skipped > 0 {
+		fmt.Fprintf(&b, "skipped (resumed): %d\n", r.Skipped)
+	}
+	fmt.Fprintf(&b, "invalid: %d\n", r.Invalid)
+	fmt.Fprintf(&b, "duplicates: %d\n", r.Duplicates)
+	fmt.Fprintf(&b, "written: %d\n", r.Written)
+
+	if r.Written > 0 {
+		fmt.Fprintf(&b, "time range: %s to %s\n", r.First.Format(time.RFC3339), r.Last.Format(time.RFC3339))
+		for _, id := range slices.Sorted(maps.Keys(r.Devices)) {
+			fmt.Fprintf(&b, "device %s: %d\n", id, r.Devices[id])
+		}
+		for _, k := range slices.Sorted(maps.Keys(r.Metrics)) {
+			fmt.Fprintf(&b, "metric %s: %d\n", k, r.Metrics[k])
+		}
+	}
+
+	for _, err := range r.Errors {
+		fmt.Fprintf(&b, "error: %v\n", err)
+	}
+	if r.Invalid > len(r.Errors) {
+		fmt.Fprintf(&b, "... and %d more errors\n", r.Invalid-len(r.Errors))
+	}
+
+	return b.String()
+}
+
+// validate checks that m can be stored, has at least one value, and has timestamps within the
+// limits set by opts relative to now.
+func validate(m *mpb.Measurement, now time.Time, opts Options) (measurement.StorableMeasurement, error) {
+	if err := measurementpbutil.Validate(m); err != nil {
+		return measurement.StorableMeasurement{}, err
+	}
+	if errs := ingest.CheckTimestamps(m, now, opts.MaxAge, opts.MaxFuture); len(errs) > 0 {
+		return measurement.StorableMeasurement{}, measurementpbutil.ValidationError(errs)
+	}
+	return measurement.NewStorableMeasurement(m)
+}
+
+// Import reads every record from r and writes the valid ones to sink in batches. Invalid
+// records are counted in the report and skipped; they don't stop the import. Import returns an
+// error if reading the input fails in a way it can't continue from, or if writing fails, in
+// which case the report's Committed count says where to resume.
+func Import(ctx context.Context, r Reader, sink Sink, opts Options) (Report, error) {
+	report := Report{Devices: make(map[string]int), Metrics: make(map[metric.Key]int)}
+	now := time.Now()
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	// Measurements are keyed in the database by device ID and timestamp, so records that share
+	// both would overwrite each other.
+	seen := make(map[string]bool)
+
+	var batch []*mpb.Measurement
+	var pending []measurement.StorableMeasurement
+	flush := func() error {
+		if !opts.DryRun && len(batch) > 0 {
+			if err := sink.Write(ctx, batch); err != nil {
+				return err
+			}
+		}
+
+		for _, sm := range pending {
+			report.add(sm)
+		}
+		report.Committed = report.Read
+		batch, pending = batch[:0], pending[:0]
+
+		if opts.Checkpoint != nil && !opts.DryRun {
+			return opts.Checkpoint(report.Committed)
+		}
+		return nil
+	}
+
+	for {
+		m, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		report.Read++
+
+		if report.Read <= opts.Skip {
+			report.Skipped++
+			report.Committed = report.Read
+			continue
+		}
+
+		var recordErr *RecordError
+		if errors.As(err, &recordErr) {
+			report.addError(err)
+			continue
+		} else if err != nil {
+			return report, err
+		}
+
+		sm, err := validate(m, now, opts)
+		if err != nil {
+			report.addError(&RecordError{Record: report.Read, Err: err})
+			continue
+		}
+
+		key := sm.DBKey()
+		if seen[key] {
+			report.Duplicates++
+			continue
+		}
+		seen[key] = true
+
+		batch = append(batch, m)
+		pending = append(pending, sm)
+		if len(batch) >= batchSize {
+			if err := flush(); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	return report, flush()
+}
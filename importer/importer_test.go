@@ -0,0 +1,214 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/metric"
+	"github.com/mtraver/environmental-sensor/testutil"
+	"github.com/mtraver/environmental-sensor/web/db"
+	tspb "google.golang.org/protobuf/types/known/timestamppb"
+	wpb "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// sliceReader returns each of its records in turn. A nil measurement is returned as a
+// RecordError.
+type sliceReader struct {
+	ms []*mpb.Measurement
+	i  int
+}
+
+func (r *sliceReader) Read() (*mpb.Measurement, error) {
+	if r.i >= len(r.ms) {
+		return nil, io.EOF
+	}
+	r.i++
+
+	m := r.ms[r.i-1]
+	if m == nil {
+		return nil, &RecordError{Record: r.i, Err: errors.New("malformed")}
+	}
+	return m, nil
+}
+
+// fakeSink records the batches written to it and fails once it has been written to failAfter
+// times, if failAfter is positive.
+type fakeSink struct {
+	batches   [][]string
+	failAfter int
+}
+
+func (s *fakeSink) Write(ctx context.Context, ms []*mpb.Measurement) error {
+	if s.failAfter > 0 && len(s.batches) >= s.failAfter {
+		return errors.New("sink failed")
+	}
+
+	var ids []string
+	for _, m := range ms {
+		ids = append(ids, m.GetDeviceId()+"@"+m.GetTimestamp().AsTime().Format("15:04:05"))
+	}
+	s.batches = append(s.batches, ids)
+	return nil
+}
+
+func m(deviceID string, sec int64, temp float32) *mpb.Measurement {
+	return &mpb.Measurement{
+		DeviceId:  deviceID,
+		Timestamp: tspb.New(testutil.Timestamp.Add(time.Duration(sec) * time.Second)),
+		Temp:      wpb.Float(temp),
+	}
+}
+
+func TestImport(t *testing.T) {
+	records := []*mpb.Measurement{
+		m("foo", 0, 20),
+		m("foo", 1, 21),
+		nil,
+		m("foo", 1, 22),
+		{DeviceId: "foo", Timestamp: tspb.New(testutil.Timestamp)},
+		m("", 2, 20),
+		m("bar", 2, 20),
+	}
+
+	sink := &fakeSink{}
+	report, err := Import(context.Background(), &sliceReader{ms: records}, sink, Options{BatchSize: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	wantBatches := [][]string{
+		{"foo@00:00:00", "foo@00:00:01"},
+		{"bar@00:00:02"},
+	}
+	if diff := cmp.Diff(wantBatches, sink.batches); diff != "" {
+		t.Errorf("Unexpected batches (-want +got):\n%s", diff)
+	}
+
+	if report.Read != 7 || report.Invalid != 3 || report.Duplicates != 1 || report.Written != 3 || report.Committed != 7 {
+		t.Errorf("Unexpected counts: %+v", report)
+	}
+	if diff := cmp.Diff(map[string]int{"foo": 2, "bar": 1}, report.Devices); diff != "" {
+		t.Errorf("Unexpected devices (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[metric.Key]int{metric.Temp: 3}, report.Metrics); diff != "" {
+		t.Errorf("Unexpected metrics (-want +got):\n%s", diff)
+	}
+	if !report.First.Equal(testutil.Timestamp) || !report.Last.Equal(testutil.Timestamp.Add(2*time.Second)) {
+		t.Errorf("Unexpected time range %v to %v", report.First, report.Last)
+	}
+	if len(report.Errors) != 3 {
+		t.Errorf("Got %d errors, expected 3: %v", len(report.Errors), report.Errors)
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	sink := &fakeSink{}
+	report, err := Import(context.Background(), &sliceReader{ms: []*mpb.Measurement{m("foo", 0, 20), nil}}, sink, Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(sink.batches) != 0 {
+		t.Errorf("Expected nothing to be written in a dry run, got %v", sink.batches)
+	}
+	if report.Written != 1 || report.Invalid != 1 {
+		t.Errorf("Unexpected counts: %+v", report)
+	}
+}
+
+func TestImportTimestampLimits(t *testing.T) {
+	future := m("foo", 0, 20)
+	future.Timestamp = tspb.New(time.Now().Add(2 * time.Hour))
+
+	cases := []struct {
+		name        string
+		opts        Options
+		wantInvalid int
+	}{
+		{"no_limits", Options{}, 0},
+		{"max_future", Options{MaxFuture: time.Hour}, 1},
+		{"max_age_and_future", Options{MaxAge: time.Hour, MaxFuture: time.Hour}, 2},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Dry runs apply the same limits as real imports.
+			for _, dryRun := range []bool{false, true} {
+				opts := tc.opts
+				opts.DryRun = dryRun
+
+				report, err := Import(context.Background(), &sliceReader{ms: []*mpb.Measurement{m("foo", 0, 20), future}}, &fakeSink{}, opts)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if report.Invalid != tc.wantInvalid {
+					t.Errorf("dry run %t: got %d invalid, want %d: %v", dryRun, report.Invalid, tc.wantInvalid, report.Errors)
+				}
+			}
+		})
+	}
+}
+
+func TestImportResume(t *testing.T) {
+	var records []*mpb.Measurement
+	for i := range 5 {
+		records = append(records, m("foo", int64(i), 20))
+	}
+
+	var checkpoints []int
+	checkpoint := func(committed int) error {
+		checkpoints = append(checkpoints, committed)
+		return nil
+	}
+
+	sink := &fakeSink{failAfter: 1}
+	report, err := Import(context.Background(), &sliceReader{ms: records}, sink, Options{BatchSize: 2, Checkpoint: checkpoint})
+	if err == nil {
+		t.Fatal("Expected error from sink, got nil")
+	}
+	if report.Committed != 2 {
+		t.Errorf("Committed = %d, expected 2", report.Committed)
+	}
+
+	sink = &fakeSink{}
+	report, err = Import(context.Background(), &sliceReader{ms: records}, sink, Options{BatchSize: 2, Skip: report.Committed, Checkpoint: checkpoint})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	wantBatches := [][]string{
+		{"foo@00:00:02", "foo@00:00:03"},
+		{"foo@00:00:04"},
+	}
+	if diff := cmp.Diff(wantBatches, sink.batches); diff != "" {
+		t.Errorf("Unexpected batches (-want +got):\n%s", diff)
+	}
+	if report.Skipped != 2 || report.Written != 3 {
+		t.Errorf("Unexpected counts: %+v", report)
+	}
+	if diff := cmp.Diff([]int{2, 4, 5}, checkpoints); diff != "" {
+		t.Errorf("Unexpected checkpoints (-want +got):\n%s", diff)
+	}
+}
+
+func TestDatabaseSink(t *testing.T) {
+	database := db.NewMemoryDB()
+	sink := DatabaseSink{Database: database}
+
+	if err := sink.Write(context.Background(), []*mpb.Measurement{m("foo", 0, 20), m("foo", 1, 21)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	latest, err := database.Latest(context.Background(), []string{"foo"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := latest["foo"].Temp; got == nil || *got != 21 {
+		t.Errorf("Expected latest temp 21, got %v", got)
+	}
+}
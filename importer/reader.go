@@ -0,0 +1,412 @@
+package importer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/measurement"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/metric"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Format is an input file format.
+type Format string
+
+const (
+	// CSV is comma-separated values with a header row. See CSVOptions.
+	CSV Format = "csv"
+
+	// JSONL is one Measurement per line in protojson format, as written by the archive package.
+	JSONL Format = "jsonl"
+
+	// Proto is a stream of size-delimited binary Measurement protobufs.
+	Proto Format = "proto"
+)
+
+// Formats are the supported input formats.
+var Formats = []Format{CSV, JSONL, Proto}
+
+// ParseFormat parses the name of a format.
+func ParseFormat(s string) (Format, error) {
+	f := Format(strings.ToLower(s))
+	if !slices.Contains(Formats, f) {
+		return "", fmt.Errorf("importer: unknown format %q", s)
+	}
+	return f, nil
+}
+
+// FormatFromPath infers the format of a file from its extension, ignoring any ".gz".
+func FormatFromPath(path string) (Format, error) {
+	ext := strings.TrimPrefix(filepath.Ext(strings.TrimSuffix(path, ".gz")), ".")
+	switch ext {
+	case "json", "ndjson":
+		return JSONL, nil
+	case "pb", "binpb":
+		return Proto, nil
+	}
+	return ParseFormat(ext)
+}
+
+// Decompress returns a reader of r's contents, gunzipped if they're gzipped.
+func Decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+	return br, nil
+}
+
+// legacyTimeFormat is the timestamp format of CSV files made for the original import tool.
+const legacyTimeFormat = "2006-01-02T15:04:05.999999"
+
+// timeFormats are the formats tried, in order, to parse CSV timestamps if CSVOptions.TimeFormat
+// isn't set. Only the first includes a UTC offset.
+var timeFormats = []string{
+	time.RFC3339Nano,
+	legacyTimeFormat,
+	"2006-01-02 15:04:05.999999",
+}
+
+// Mapping maps metrics to the names of the CSV columns that hold their values. If a metric is
+// mapped to more than one column then their values are averaged.
+type Mapping map[metric.Key][]string
+
+// ParseMapping parses mappings of the form key=column, e.g. "pm25=PM2.5". More than one column
+// may be given for a metric, separated by commas, e.g. "temp=temp1,temp2".
+func ParseMapping(specs []string) (Mapping, error) {
+	m := make(Mapping)
+	for _, spec := range specs {
+		key, cols, ok := strings.Cut(spec, "=")
+		if !ok || cols == "" {
+			return nil, fmt.Errorf("importer: mapping must be of the form metric=column: %q", spec)
+		}
+
+		k := metric.Key(strings.TrimSpace(key))
+		if _, ok := (measurement.StorableMeasurement{}).ValueMap()[k]; !ok {
+			return nil, fmt.Errorf("importer: unknown metric %q in mapping %q", key, spec)
+		}
+
+		for _, c := range strings.Split(cols, ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				m[k] = append(m[k], c)
+			}
+		}
+	}
+	return m, nil
+}
+
+// CSVOptions control how a CSV file is read.
+type CSVOptions struct {
+	// Mapping maps metrics to columns. If it's empty then each column whose header is a metric's
+	// key or name, ignoring case, is mapped to that metric, e.g. "pm25" or "PM2.5".
+	Mapping Mapping
+
+	// TimestampColumn is the name of the column holding timestamps. If it's empty then the
+	// column named "timestamp" is used if there is one, and the first column if not.
+	TimestampColumn string
+
+	// TimeFormat is the layout of timestamps, as for time.Parse. If it's empty then RFC 3339
+	// timestamps and timestamps like "2006-01-02T15:04:05.999999" are accepted.
+	TimeFormat string
+
+	// Location is the time zone of timestamps that don't include a UTC offset. If it's nil then
+	// UTC is used.
+	Location *time.Location
+
+	// DeviceColumn is the name of the column holding device IDs. If it's empty then the column
+	// named "device_id" is used if there is one.
+	DeviceColumn string
+
+	// DeviceID is the device ID of records that don't have one, either because there's no
+	// device ID column or because it's empty.
+	DeviceID string
+}
+
+type column struct {
+	key     metric.Key
+	indices []int
+}
+
+// CSVReader reads measurements from a CSV file, one per row.
+type CSVReader struct {
+	r       *csv.Reader
+	opts    CSVOptions
+	record  int
+	tsCol   int
+	devCol  int
+	columns []column
+}
+
+// NewCSVReader returns a reader of the CSV data in r. It reads the header row to find the
+// columns given by opts and returns an error if any is missing.
+func NewCSVReader(r io.Reader, opts CSVOptions) (*CSVReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("importer: CSV file is empty")
+	} else if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int, len(header))
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if _, ok := index[h]; !ok {
+			index[h] = i
+		}
+	}
+	find := func(name string) (int, bool) {
+		i, ok := index[strings.ToLower(strings.TrimSpace(name))]
+		return i, ok
+	}
+
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+
+	reader := &CSVReader{r: cr, opts: opts, devCol: -1}
+
+	if opts.TimestampColumn != "" {
+		i, ok := find(opts.TimestampColumn)
+		if !ok {
+			return nil, fmt.Errorf("importer: no timestamp column %q", opts.TimestampColumn)
+		}
+		reader.tsCol = i
+	} else if i, ok := find("timestamp"); ok {
+		reader.tsCol = i
+	}
+
+	if opts.DeviceColumn != "" {
+		i, ok := find(opts.DeviceColumn)
+		if !ok {
+			return nil, fmt.Errorf("importer: no device column %q", opts.DeviceColumn)
+		}
+		reader.devCol = i
+	} else if i, ok := find("device_id"); ok {
+		reader.devCol = i
+	}
+
+	mapping := opts.Mapping
+	if len(mapping) == 0 {
+		mapping = make(Mapping)
+		for k := range (measurement.StorableMeasurement{}).ValueMap() {
+			for _, name := range []string{string(k), metric.All[k].Name} {
+				if _, ok := find(name); ok {
+					mapping[k] = []string{name}
+					break
+				}
+			}
+		}
+	}
+
+	for k, cols := range mapping {
+		c := column{key: k}
+		for _, name := range cols {
+			i, ok := find(name)
+			if !ok {
+				return nil, fmt.Errorf("importer: no column %q for metric %s", name, k)
+			}
+			c.indices = append(c.indices, i)
+		}
+		reader.columns = append(reader.columns, c)
+	}
+	if len(reader.columns) == 0 {
+		return nil, errors.New("importer: no columns are mapped to metrics")
+	}
+	slices.SortFunc(reader.columns, func(a, b column) int {
+		return strings.Compare(string(a.key), string(b.key))
+	})
+
+	return reader, nil
+}
+
+// Read implements Reader.
+func (r *CSVReader) Read() (*mpb.Measurement, error) {
+	row, err := r.r.Read()
+	if err == io.EOF {
+		return nil, err
+	}
+	r.record++
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return nil, &RecordError{Record: r.record, Err: err}
+	} else if err != nil {
+		return nil, err
+	}
+
+	m, err := r.rowToProto(row)
+	if err != nil {
+		return nil, &RecordError{Record: r.record, Err: err}
+	}
+	return m, nil
+}
+
+func (r *CSVReader) rowToProto(row []string) (*mpb.Measurement, error) {
+	field := func(i int) string {
+		if i < 0 || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	ts, err := r.parseTime(field(r.tsCol))
+	if err != nil {
+		return nil, err
+	}
+
+	sm := measurement.StorableMeasurement{
+		DeviceID:  r.opts.DeviceID,
+		Timestamp: ts,
+	}
+	if id := field(r.devCol); id != "" {
+		sm.DeviceID = id
+	}
+
+	for _, c := range r.columns {
+		var values []float32
+		for _, i := range c.indices {
+			s := field(i)
+			if s == "" {
+				continue
+			}
+
+			v, err := strconv.ParseFloat(s, 32)
+			if err != nil {
+				return nil, fmt.Errorf("bad value for %s: %q", c.key, s)
+			}
+			values = append(values, float32(v))
+		}
+
+		if len(values) > 0 {
+			sm.SetValue(c.key, mean(values))
+		}
+	}
+
+	return measurement.NewMeasurement(&sm)
+}
+
+func (r *CSVReader) parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, errors.New("missing timestamp")
+	}
+
+	if r.opts.TimeFormat != "" {
+		return time.ParseInLocation(r.opts.TimeFormat, s, r.opts.Location)
+	}
+
+	for _, layout := range timeFormats {
+		// ParseInLocation uses the offset in s if there is one.
+		if t, err := time.ParseInLocation(layout, s, r.opts.Location); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad timestamp %q", s)
+}
+
+func mean(x []float32) float32 {
+	var total float32
+	for _, v := range x {
+		total += v
+	}
+	return total / float32(len(x))
+}
+
+// JSONLReader reads measurements from JSON Lines, one Measurement per line in protojson format.
+type JSONLReader struct {
+	scanner  *bufio.Scanner
+	deviceID string
+	record   int
+}
+
+// NewJSONLReader returns a reader of the JSON Lines in r. Measurements without a device ID are
+// given deviceID.
+func NewJSONLReader(r io.Reader, deviceID string) *JSONLReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	return &JSONLReader{scanner: s, deviceID: deviceID}
+}
+
+// Read implements Reader.
+func (r *JSONLReader) Read() (*mpb.Measurement, error) {
+	for r.scanner.Scan() {
+		line := r.scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		r.record++
+
+		m := &mpb.Measurement{}
+		if err := protojson.Unmarshal(line, m); err != nil {
+			return nil, &RecordError{Record: r.record, Err: err}
+		}
+		if m.GetDeviceId() == "" {
+			m.DeviceId = r.deviceID
+		}
+		return m, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// ProtoReader reads measurements from a stream of size-delimited binary Measurement protobufs,
+// as written by protodelim.MarshalTo.
+type ProtoReader struct {
+	r        *bufio.Reader
+	deviceID string
+}
+
+// NewProtoReader returns a reader of the protobufs in r. Measurements without a device ID are
+// given deviceID.
+func NewProtoReader(r io.Reader, deviceID string) *ProtoReader {
+	return &ProtoReader{r: bufio.NewReader(r), deviceID: deviceID}
+}
+
+// Read implements Reader. A protobuf that can't be unmarshaled is returned as an error that
+// stops the import because the rest of the stream can't be trusted to be aligned.
+func (r *ProtoReader) Read() (*mpb.Measurement, error) {
+	m := &mpb.Measurement{}
+	if err := protodelim.UnmarshalFrom(r.r, m); err != nil {
+		return nil, err
+	}
+	if m.GetDeviceId() == "" {
+		m.DeviceId = r.deviceID
+	}
+	return m, nil
+}
+
+// NewReader returns a reader of r in the given format. Gzipped input is decompressed. The CSV
+// options are used only for CSV; otherwise only opts.DeviceID is used.
+func NewReader(r io.Reader, format Format, opts CSVOptions) (Reader, error) {
+	r, err := Decompress(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case CSV:
+		return NewCSVReader(r, opts)
+	case JSONL:
+		return NewJSONLReader(r, opts.DeviceID), nil
+	case Proto:
+		return NewProtoReader(r, opts.DeviceID), nil
+	}
+	return nil, fmt.Errorf("importer: unknown format %q", format)
+}
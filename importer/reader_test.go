@@ -0,0 +1,270 @@
+package importer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/metric"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/testing/protocmp"
+	tspb "google.golang.org/protobuf/types/known/timestamppb"
+	wpb "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const epsilon = 0.00001
+
+func floatsEqual(a float32, b float32) bool {
+	return math.Abs(float64(a-b)) < epsilon
+}
+
+// readAll reads every record from r, recording record errors as nil measurements.
+func readAll(t *testing.T, r Reader) []*mpb.Measurement {
+	t.Helper()
+
+	var ms []*mpb.Measurement
+	for {
+		m, err := r.Read()
+		if err == io.EOF {
+			return ms
+		}
+
+		var recordErr *RecordError
+		if errors.As(err, &recordErr) {
+			ms = append(ms, nil)
+			continue
+		} else if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ms = append(ms, m)
+	}
+}
+
+func TestMean(t *testing.T) {
+	cases := []struct {
+		name string
+		x    []float32
+		want float32
+	}{
+		{"single", []float32{12.7}, 12.7},
+		{"multiple", []float32{10.0, 20.0, 42.6}, 24.2},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := mean(c.x); !floatsEqual(got, c.want) {
+				t.Errorf("Expected %v, got %v", c.want, got)
+			}
+		})
+	}
+
+	if got := mean(nil); !math.IsNaN(float64(got)) {
+		t.Errorf("Expected NaN for empty input, got %v", got)
+	}
+}
+
+func TestParseMapping(t *testing.T) {
+	got, err := ParseMapping([]string{"pm25=PM2.5", "temp=temp1, temp2", "temp=temp3"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := Mapping{
+		metric.PM25: {"PM2.5"},
+		metric.Temp: {"temp1", "temp2", "temp3"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected mapping (-want +got):\n%s", diff)
+	}
+
+	for _, spec := range []string{"pm25", "pm25=", "aqi=AQI", "spam=eggs"} {
+		if _, err := ParseMapping([]string{spec}); err == nil {
+			t.Errorf("Expected error for %q, got nil", spec)
+		}
+	}
+}
+
+func TestCSVReader(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatalf("Failed to load location: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		csv  string
+		opts CSVOptions
+		want []*mpb.Measurement
+	}{
+		{
+			name: "legacy",
+			csv: "Date,Temp 1,Temp 2,Temp 3\n" +
+				"2006-01-02T15:04:05.999999,18.5,18.0,18.6\n",
+			opts: CSVOptions{
+				Mapping:  Mapping{metric.Temp: {"Temp 1", "Temp 2", "Temp 3"}},
+				DeviceID: "foo",
+			},
+			want: []*mpb.Measurement{
+				{
+					DeviceId:  "foo",
+					Timestamp: tspb.New(time.Date(2006, 1, 2, 15, 4, 5, 999999000, time.UTC)),
+					Temp:      wpb.Float(mean([]float32{18.5, 18.0, 18.6})),
+				},
+			},
+		},
+		{
+			name: "default_mapping",
+			csv: "device_id,timestamp,PM2.5,rh,notes\n" +
+				"foo,2024-06-01T12:00:00Z,5,40,ok\n" +
+				",2024-06-01T12:01:00-07:00,,41,\n" +
+				"foo,yesterday,5,40,\n" +
+				"foo,2024-06-01T12:02:00Z,spam,40,\n",
+			opts: CSVOptions{DeviceID: "bar"},
+			want: []*mpb.Measurement{
+				{
+					DeviceId:  "foo",
+					Timestamp: tspb.New(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)),
+					Pm25:      wpb.Float(5),
+					Rh:        wpb.Float(40),
+				},
+				{
+					DeviceId:  "bar",
+					Timestamp: tspb.New(time.Date(2024, 6, 1, 19, 1, 0, 0, time.UTC)),
+					Rh:        wpb.Float(41),
+				},
+				nil,
+				nil,
+			},
+		},
+		{
+			name: "time_zone_and_format",
+			csv: "when,sensor,co2\n" +
+				"06/01/2024 12:00,foo,420\n",
+			opts: CSVOptions{
+				TimestampColumn: "when",
+				TimeFormat:      "01/02/2006 15:04",
+				Location:        la,
+				DeviceColumn:    "sensor",
+			},
+			want: []*mpb.Measurement{
+				{
+					DeviceId:  "foo",
+					Timestamp: tspb.New(time.Date(2024, 6, 1, 19, 0, 0, 0, time.UTC)),
+					Co2:       wpb.Float(420),
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := NewCSVReader(strings.NewReader(c.csv), c.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff(c.want, readAll(t, r), protocmp.Transform()); diff != "" {
+				t.Errorf("Unexpected measurements (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCSVReaderBadHeader(t *testing.T) {
+	cases := []struct {
+		name string
+		csv  string
+		opts CSVOptions
+	}{
+		{"empty", "", CSVOptions{}},
+		{"no_metrics", "timestamp,spam\n", CSVOptions{}},
+		{"missing_mapped_column", "timestamp,temp\n", CSVOptions{Mapping: Mapping{metric.PM25: {"PM2.5"}}}},
+		{"missing_timestamp_column", "timestamp,temp\n", CSVOptions{TimestampColumn: "when"}},
+		{"missing_device_column", "timestamp,temp\n", CSVOptions{DeviceColumn: "sensor"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := NewCSVReader(strings.NewReader(c.csv), c.opts); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	ms := []*mpb.Measurement{
+		{DeviceId: "foo", Timestamp: tspb.New(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)), Temp: wpb.Float(20)},
+		{Timestamp: tspb.New(time.Date(2024, 6, 1, 12, 1, 0, 0, time.UTC)), Pm25: wpb.Float(5)},
+	}
+	want := []*mpb.Measurement{ms[0], {DeviceId: "bar", Timestamp: ms[1].Timestamp, Pm25: ms[1].Pm25}}
+
+	var protos bytes.Buffer
+	for _, m := range ms {
+		if _, err := protodelim.MarshalTo(&protos, m); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	jsonl := `{"deviceId":"foo","timestamp":"2024-06-01T12:00:00Z","temp":20}` + "\n\n" +
+		`{"timestamp":"2024-06-01T12:01:00Z","pm25":5}` + "\n"
+
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write([]byte(jsonl))
+	gz.Close()
+
+	cases := []struct {
+		name   string
+		format Format
+		data   []byte
+	}{
+		{"proto", Proto, protos.Bytes()},
+		{"jsonl", JSONL, []byte(jsonl)},
+		{"jsonl_gzip", JSONL, gzipped.Bytes()},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := NewReader(bytes.NewReader(c.data), c.format, CSVOptions{DeviceID: "bar"})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff(want, readAll(t, r), protocmp.Transform()); diff != "" {
+				t.Errorf("Unexpected measurements (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	cases := map[string]Format{
+		"data.csv":         CSV,
+		"data.CSV.gz":      CSV,
+		"archive.jsonl.gz": JSONL,
+		"data.json":        JSONL,
+		"data.pb":          Proto,
+		"data.proto":       Proto,
+	}
+
+	for path, want := range cases {
+		got, err := FormatFromPath(path)
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", path, err)
+		} else if got != want {
+			t.Errorf("FormatFromPath(%q) = %q, expected %q", path, got, want)
+		}
+	}
+
+	if _, err := FormatFromPath("data.xlsx"); err == nil {
+		t.Error("Expected error for unknown extension, got nil")
+	}
+}
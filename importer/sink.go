@@ -0,0 +1,72 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/pubsub/v2"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"google.golang.org/protobuf/proto"
+)
+
+// SourceAttribute is the value of the "source" attribute of Pub/Sub messages published by
+// PubSubSink, so that the push handler can be told to ignore imported messages if need be.
+const SourceAttribute = "importer"
+
+// Publisher is the part of *pubsub.Publisher used by PubSubSink.
+type Publisher interface {
+	Publish(ctx context.Context, msg *pubsub.Message) *pubsub.PublishResult
+}
+
+// PubSubSink publishes measurements to a Pub/Sub topic. It's expected that the topic pushes to
+// the web app's push handler, which saves them just as it does measurements from devices.
+type PubSubSink struct {
+	Publisher Publisher
+}
+
+// Write implements Sink. It waits for every message in the batch to be published and returns
+// the first error if any failed.
+func (s PubSubSink) Write(ctx context.Context, ms []*mpb.Measurement) error {
+	results := make([]*pubsub.PublishResult, 0, len(ms))
+	for _, m := range ms {
+		data, err := proto.Marshal(m)
+		if err != nil {
+			return err
+		}
+
+		results = append(results, s.Publisher.Publish(ctx, &pubsub.Message{
+			Data:       data,
+			Attributes: map[string]string{"source": SourceAttribute},
+		}))
+	}
+
+	var firstErr error
+	for _, r := range results {
+		if _, err := r.Get(ctx); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("importer: failed to publish: %w", err)
+		}
+	}
+	return firstErr
+}
+
+// Saver saves measurements. It's implemented by the web app's databases.
+type Saver interface {
+	Save(ctx context.Context, m *mpb.Measurement) error
+}
+
+// DatabaseSink saves measurements directly to a database, bypassing Pub/Sub and the web app.
+// The database updates rollups as it saves them, but measurements saved this way don't trigger
+// alerts or reach the web app's other sinks.
+type DatabaseSink struct {
+	Database Saver
+}
+
+// Write implements Sink.
+func (s DatabaseSink) Write(ctx context.Context, ms []*mpb.Measurement) error {
+	for _, m := range ms {
+		if err := s.Database.Save(ctx, m); err != nil {
+			return fmt.Errorf("importer: failed to save measurement from %s: %w", m.GetDeviceId(), err)
+		}
+	}
+	return nil
+}
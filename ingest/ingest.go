@@ -0,0 +1,357 @@
+// Package ingest validates the measurements that devices send and saves them. Measurements
+// arrive by several routes, such as Pub/Sub push deliveries and the gRPC API, and they all go
+// through a Pipeline so that they're treated the same.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/alert"
+	"github.com/mtraver/environmental-sensor/broker"
+	"github.com/mtraver/environmental-sensor/measurement"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	mpbutil "github.com/mtraver/environmental-sensor/measurementpbutil"
+	"github.com/mtraver/gaelog"
+)
+
+var (
+	// ErrInvalid is wrapped by the errors that Ingest returns for invalid measurements.
+	ErrInvalid = errors.New("ingest: invalid measurement")
+
+	// ErrIgnored is returned by Ingest for measurements that the pipeline's Router drops.
+	ErrIgnored = errors.New("ingest: measurement is ignored")
+
+	// ErrDuplicate is returned by Ingest for measurements that have already been ingested.
+	ErrDuplicate = errors.New("ingest: duplicate measurement")
+)
+
+const (
+	// DefaultMaxAge and DefaultMaxFuture are reasonable limits on how far before and after the
+	// current time measurement timestamps may be. Devices may hold on to measurements for a while
+	// if they can't upload them, but one whose clock is far off is broken.
+	DefaultMaxAge    = 30 * 24 * time.Hour
+	DefaultMaxFuture = time.Hour
+
+	// dedupeWindow is how long copies of a measurement are recognized for, at least. It's as
+	// long as Pub/Sub retains messages.
+	dedupeWindow = 7 * 24 * time.Hour
+)
+
+// Sink is one of the places that Ingest delivers measurements to.
+type Sink string
+
+const (
+	SinkDatabase Sink = "database"
+	SinkLive     Sink = "live"
+	SinkAlerts   Sink = "alerts"
+	SinkInfluxDB Sink = "influxdb"
+)
+
+// Valid reports whether s is a known sink.
+func (s Sink) Valid() bool {
+	switch s {
+	case SinkDatabase, SinkLive, SinkAlerts, SinkInfluxDB:
+		return true
+	default:
+		return false
+	}
+}
+
+// Decision is what to do with a measurement, as decided by a Router.
+type Decision struct {
+	// Drop is true if the measurement should be dropped.
+	Drop bool
+
+	// DeviceID is the device ID that the measurement should be attributed to. If it's empty
+	// then the measurement keeps its own device ID.
+	DeviceID string
+
+	// Sinks are the sinks that the measurement should be delivered to. If it's empty then it's
+	// delivered to all of them.
+	Sinks []Sink
+
+	// Tags are the tags to attach to the measurement.
+	Tags map[string]string
+
+	// Rules are the names of the rules that made the decision, for logging.
+	Rules []string
+}
+
+// Router decides what happens to each measurement before it's validated and delivered, e.g.
+// according to routing rules that can be changed while the pipeline is running.
+type Router interface {
+	// Route decides what to do with m, which was sent by the given source. The source is empty if
+	// the entry point that received m doesn't set one; see WithSource.
+	Route(ctx context.Context, m *mpb.Measurement, source string) (Decision, error)
+}
+
+type sourceKey struct{}
+
+// WithSource returns a copy of ctx that carries the source of the measurement being ingested,
+// e.g. the "source" attribute of the Pub/Sub message that carried it. Routers can match on it.
+func WithSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+// Source returns the source carried by ctx. It's empty if there's none.
+func Source(ctx context.Context) string {
+	source, _ := ctx.Value(sourceKey{}).(string)
+	return source
+}
+
+type receivedKey struct{}
+
+// WithReceived returns a copy of ctx that carries when the measurement being ingested was first
+// received, if it's being ingested again later, e.g. after being quarantined. Its timestamps are
+// checked against that time rather than the current time.
+func WithReceived(ctx context.Context, received time.Time) context.Context {
+	return context.WithValue(ctx, receivedKey{}, received)
+}
+
+// Received returns the time carried by ctx. ok is false if there's none.
+func Received(ctx context.Context) (received time.Time, ok bool) {
+	received, ok = ctx.Value(receivedKey{}).(time.Time)
+	return received, ok
+}
+
+type tagsKey struct{}
+
+// WithTags returns a copy of ctx that carries tags to attach to the measurement being ingested.
+// Ingest adds the tags that its Router decides on. Sinks that support tags, like InfluxDB, get
+// them with Tags.
+func WithTags(ctx context.Context, tags map[string]string) context.Context {
+	return context.WithValue(ctx, tagsKey{}, tags)
+}
+
+// Tags returns the tags carried by ctx. It's nil if there are none.
+func Tags(ctx context.Context) map[string]string {
+	tags, _ := ctx.Value(tagsKey{}).(map[string]string)
+	return tags
+}
+
+// Saver saves measurements. Saving a measurement that has already been saved must not be an
+// error, so that measurements can be sent again if it's not known whether they were saved.
+type Saver interface {
+	Save(ctx context.Context, m *mpb.Measurement) error
+}
+
+// DedupeStore remembers the measurements that have been ingested.
+type DedupeStore interface {
+	// ClaimMessage records that the measurement with the given key is being ingested. It returns
+	// false if the key has already been claimed and the claim hasn't expired.
+	ClaimMessage(ctx context.Context, key string, expires time.Time) (bool, error)
+
+	// ReleaseMessage deletes the claim on key so that the measurement can be ingested again.
+	ReleaseMessage(ctx context.Context, key string) error
+}
+
+// DedupeKey returns the key that identifies m, and copies of it, in a DedupeStore.
+func DedupeKey(m *mpb.Measurement) string {
+	if id := m.GetMessageId(); id != "" {
+		return m.GetDeviceId() + "#" + id
+	}
+	return m.GetDeviceId() + "#" + m.GetTimestamp().AsTime().Format(time.RFC3339Nano)
+}
+
+// Pipeline saves measurements and passes them on. Only Database is required.
+type Pipeline struct {
+	Database Saver
+
+	// Dedupe remembers the measurements that have been ingested so that copies delivered again,
+	// e.g. by Pub/Sub or MQTT redelivery, are dropped before they reach any store. If it's nil
+	// then only the database drops copies, and InfluxDB and alerts see them all.
+	Dedupe DedupeStore
+
+	// Broker delivers saved measurements to live subscribers.
+	Broker *broker.Broker
+
+	// Alerts evaluates the alert rules that apply to saved measurements.
+	Alerts *alert.Evaluator
+
+	// InfluxDB is a secondary store that measurements are also saved to.
+	InfluxDB Saver
+
+	// Router decides whether each measurement is dropped, which sinks it goes to, how it's
+	// tagged, and which device it's attributed to. If it's nil then every measurement goes to
+	// every sink as is.
+	Router Router
+
+	// MaxAge and MaxFuture limit how far before and after the current time measurement
+	// timestamps may be. Measurements outside those limits are invalid. Zero means no limit.
+	MaxAge    time.Duration
+	MaxFuture time.Duration
+}
+
+// CheckTimestamps returns the problems with m's timestamps relative to now, the time that m was
+// received. Its timestamp may be at most maxAge before now, and neither its timestamp nor its
+// upload timestamp may be more than maxFuture after now. Zero means no limit.
+func CheckTimestamps(m *mpb.Measurement, now time.Time, maxAge, maxFuture time.Duration) []mpbutil.FieldError {
+	var errs []mpbutil.FieldError
+	check := func(field string, ts time.Time, maxAge time.Duration) {
+		if maxAge > 0 && ts.Before(now.Add(-maxAge)) {
+			errs = append(errs, mpbutil.FieldError{
+				Field:  field,
+				Reason: fmt.Sprintf("%s is more than %v before it was received", ts.Format(time.RFC3339), maxAge),
+			})
+		}
+		if maxFuture > 0 && ts.After(now.Add(maxFuture)) {
+			errs = append(errs, mpbutil.FieldError{
+				Field:  field,
+				Reason: fmt.Sprintf("%s is more than %v after it was received", ts.Format(time.RFC3339), maxFuture),
+			})
+		}
+	}
+
+	check("timestamp", m.GetTimestamp().AsTime(), maxAge)
+	if m.GetUploadTimestamp() != nil {
+		// Devices upload measurements they've held on to, so only how far in the future the
+		// upload timestamp is matters.
+		check("upload_timestamp", m.GetUploadTimestamp().AsTime(), 0)
+	}
+	return errs
+}
+
+// Ingest routes m, validates it, and saves it to the database. Once it's saved it's delivered
+// to live subscribers, alert rules are evaluated, and it's saved to InfluxDB. Those steps happen
+// after m is safely stored, so their errors are logged rather than returned.
+//
+// The Router, if there is one, goes first, given the source carried by ctx. If it renames m's
+// device then m's device ID is changed. If it routes m to only some sinks then m is only
+// delivered to those, and if SinkDatabase isn't one of them then the error is nil even if
+// another sink fails. m's timestamps are checked against the time that it was received, which is
+// now unless ctx carries another (see WithReceived).
+//
+// The error wraps ErrInvalid and a measurementpbutil.ValidationError if m is invalid, is
+// ErrIgnored if the Router drops m, and is ErrDuplicate if m has already been ingested. Any other
+// error means that m couldn't be routed or saved and may be retried.
+func (p Pipeline) Ingest(ctx context.Context, m *mpb.Measurement) error {
+	now := time.Now()
+
+	var sinks []Sink
+	if p.Router != nil {
+		d, err := p.route(ctx, m)
+		if err != nil {
+			return err
+		}
+		if d.Drop {
+			return ErrIgnored
+		}
+		sinks = d.Sinks
+		if len(d.Tags) > 0 {
+			ctx = WithTags(ctx, d.Tags)
+		}
+	}
+	to := func(s Sink) bool {
+		return len(sinks) == 0 || slices.Contains(sinks, s)
+	}
+
+	var errs mpbutil.ValidationError
+	if err := mpbutil.Validate(m); err != nil && !errors.As(err, &errs) {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if len(errs) == 0 {
+		received := now
+		if t, ok := Received(ctx); ok {
+			received = t
+		}
+		errs = append(errs, CheckTimestamps(m, received, p.MaxAge, p.MaxFuture)...)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalid, errs)
+	}
+
+	key := DedupeKey(m)
+	if p.Dedupe != nil {
+		// Remember the measurement at least until it's too old to be ingested anyway.
+		expires := now.Add(dedupeWindow)
+		if p.MaxAge > 0 {
+			expires = m.GetTimestamp().AsTime().Add(p.MaxAge)
+		}
+		expires = later(expires, now.Add(dedupeWindow))
+
+		claimed, err := p.Dedupe.ClaimMessage(ctx, key, expires)
+		if err != nil {
+			return fmt.Errorf("ingest: failed to check for duplicates: %w", err)
+		}
+		if !claimed {
+			return ErrDuplicate
+		}
+	}
+
+	if to(SinkDatabase) {
+		if err := p.Database.Save(ctx, m); err != nil {
+			// Let the measurement be ingested when it's delivered again.
+			if p.Dedupe != nil {
+				if err := p.Dedupe.ReleaseMessage(ctx, key); err != nil {
+					gaelog.Errorf(ctx, "Failed to release claim on measurement %q: %v", key, err)
+				}
+			}
+			return fmt.Errorf("ingest: failed to save measurement: %w", err)
+		}
+	}
+
+	if p.Broker != nil && to(SinkLive) {
+		if err := p.Broker.Publish(ctx, m); err != nil {
+			gaelog.Errorf(ctx, "Failed to publish measurement to live subscribers: %v", err)
+		}
+	}
+
+	if p.Alerts != nil && to(SinkAlerts) {
+		p.evaluateAlerts(ctx, m)
+	}
+
+	if p.InfluxDB != nil && to(SinkInfluxDB) {
+		if err := p.InfluxDB.Save(ctx, m); err != nil {
+			gaelog.Errorf(ctx, "Failed to save measurement to InfluxDB: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// route asks the Router what to do with m and logs the decision. If the Router renames m's
+// device then m's device ID is changed.
+func (p Pipeline) route(ctx context.Context, m *mpb.Measurement) (Decision, error) {
+	d, err := p.Router.Route(ctx, m, Source(ctx))
+	if err != nil {
+		return d, fmt.Errorf("ingest: failed to route measurement: %w", err)
+	}
+
+	switch {
+	case d.Drop:
+		gaelog.Infof(ctx, "Dropping measurement from device %q per routing rules %q", m.GetDeviceId(), d.Rules)
+	case len(d.Rules) > 0:
+		gaelog.Infof(ctx, "Routing rules %q matched measurement from device %q", d.Rules, m.GetDeviceId())
+	}
+
+	if d.DeviceID != "" && d.DeviceID != m.GetDeviceId() {
+		gaelog.Infof(ctx, "Renaming device %q to %q per routing rules", m.GetDeviceId(), d.DeviceID)
+		m.DeviceId = d.DeviceID
+	}
+
+	return d, nil
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// evaluateAlerts evaluates the alert rules that apply to the device that sent m.
+func (p Pipeline) evaluateAlerts(ctx context.Context, m *mpb.Measurement) {
+	sm, err := measurement.NewStorableMeasurement(m)
+	if err != nil {
+		gaelog.Errorf(ctx, "Failed to evaluate alerts: %v", err)
+		return
+	}
+
+	if err := p.Alerts.Observe(ctx, sm); err != nil {
+		gaelog.Errorf(ctx, "Failed to evaluate alerts: %v", err)
+	}
+}
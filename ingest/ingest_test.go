@@ -0,0 +1,315 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	mpbutil "github.com/mtraver/environmental-sensor/measurementpbutil"
+	"github.com/mtraver/environmental-sensor/testutil"
+	tspb "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fakeSaver records the IDs of the devices whose measurements it saves, and the tags they're
+// saved with.
+type fakeSaver struct {
+	saved []string
+	tags  []map[string]string
+	err   error
+}
+
+func (s *fakeSaver) Save(ctx context.Context, m *mpb.Measurement) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.saved = append(s.saved, m.GetDeviceId())
+	s.tags = append(s.tags, Tags(ctx))
+	return nil
+}
+
+// routerFunc is a Router that calls itself.
+type routerFunc func(ctx context.Context, m *mpb.Measurement, source string) (Decision, error)
+
+func (f routerFunc) Route(ctx context.Context, m *mpb.Measurement, source string) (Decision, error) {
+	return f(ctx, m, source)
+}
+
+// dropBar is a Router that drops measurements from device "bar".
+var dropBar = routerFunc(func(ctx context.Context, m *mpb.Measurement, source string) (Decision, error) {
+	return Decision{Drop: m.GetDeviceId() == "bar"}, nil
+})
+
+func TestIngest(t *testing.T) {
+	errSave := errors.New("unavailable")
+
+	invalid := testutil.FullyPopulatedMeasurementProto()
+	invalid.DeviceId = ""
+
+	ignored := testutil.FullyPopulatedMeasurementProto()
+	ignored.DeviceId = "bar"
+
+	cases := []struct {
+		name       string
+		m          *mpb.Measurement
+		saveErr    error
+		wantErr    error
+		wantSaved  int
+		wantInflux int
+	}{
+		{"valid", testutil.FullyPopulatedMeasurementProto(), nil, nil, 1, 1},
+		{"invalid", invalid, nil, ErrInvalid, 0, 0},
+		{"ignored", ignored, nil, ErrIgnored, 0, 0},
+		{"save_failed", testutil.FullyPopulatedMeasurementProto(), errSave, errSave, 0, 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			database := &fakeSaver{err: tc.saveErr}
+			influx := &fakeSaver{}
+			p := Pipeline{
+				Database: database,
+				InfluxDB: influx,
+				Router:   dropBar,
+			}
+
+			err := p.Ingest(context.Background(), tc.m)
+			if tc.wantErr == nil && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			} else if !errors.Is(err, tc.wantErr) {
+				t.Errorf("got error %v, want %v", err, tc.wantErr)
+			}
+
+			if len(database.saved) != tc.wantSaved {
+				t.Errorf("saved %d measurements to the database, want %d", len(database.saved), tc.wantSaved)
+			}
+			if len(influx.saved) != tc.wantInflux {
+				t.Errorf("saved %d measurements to InfluxDB, want %d", len(influx.saved), tc.wantInflux)
+			}
+		})
+	}
+}
+
+func TestIngestRouting(t *testing.T) {
+	errRoute := errors.New("unavailable")
+
+	cases := []struct {
+		name       string
+		decision   Decision
+		routeErr   error
+		wantErr    error
+		wantSaved  []string
+		wantInflux []string
+		wantTags   map[string]string
+	}{
+		{name: "all", wantSaved: []string{"foo"}, wantInflux: []string{"foo"}},
+		{name: "database", decision: Decision{Sinks: []Sink{SinkDatabase}}, wantSaved: []string{"foo"}},
+		{name: "influxdb", decision: Decision{Sinks: []Sink{SinkInfluxDB}}, wantInflux: []string{"foo"}},
+		{name: "neither", decision: Decision{Sinks: []Sink{SinkLive, SinkAlerts}}},
+		{name: "drop", decision: Decision{Drop: true}, wantErr: ErrIgnored},
+		{name: "rename", decision: Decision{DeviceID: "bar"}, wantSaved: []string{"bar"}, wantInflux: []string{"bar"}},
+		{name: "tags", decision: Decision{Tags: map[string]string{"site": "lab"}}, wantSaved: []string{"foo"}, wantInflux: []string{"foo"}, wantTags: map[string]string{"site": "lab"}},
+		{name: "error", routeErr: errRoute, wantErr: errRoute},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotSource string
+			database := &fakeSaver{}
+			influx := &fakeSaver{}
+			p := Pipeline{
+				Database: database,
+				InfluxDB: influx,
+				Router: routerFunc(func(ctx context.Context, m *mpb.Measurement, source string) (Decision, error) {
+					gotSource = source
+					return tc.decision, tc.routeErr
+				}),
+			}
+
+			ctx := WithSource(context.Background(), "AWS")
+			err := p.Ingest(ctx, testutil.FullyPopulatedMeasurementProto())
+			if tc.wantErr == nil && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			} else if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+
+			if gotSource != "AWS" {
+				t.Errorf("got source %q, want %q", gotSource, "AWS")
+			}
+			if diff := cmp.Diff(tc.wantSaved, database.saved); diff != "" {
+				t.Errorf("Unexpected devices saved to the database (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantInflux, influx.saved); diff != "" {
+				t.Errorf("Unexpected devices saved to InfluxDB (-want +got):\n%s", diff)
+			}
+			for _, got := range influx.tags {
+				if diff := cmp.Diff(tc.wantTags, got); diff != "" {
+					t.Errorf("Unexpected tags (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestSource(t *testing.T) {
+	if got := Source(context.Background()); got != "" {
+		t.Errorf("got source %q, want empty", got)
+	}
+
+	if got := Source(WithSource(context.Background(), "AWS")); got != "AWS" {
+		t.Errorf("got source %q, want %q", got, "AWS")
+	}
+}
+
+func TestTags(t *testing.T) {
+	if got := Tags(context.Background()); got != nil {
+		t.Errorf("got tags %v, want nil", got)
+	}
+
+	ctx := WithTags(context.Background(), map[string]string{"site": "lab"})
+	if got := Tags(ctx)["site"]; got != "lab" {
+		t.Errorf("got tag %q, want %q", got, "lab")
+	}
+}
+
+// fakeDedupeStore is a DedupeStore whose claims never expire.
+type fakeDedupeStore map[string]bool
+
+func (s fakeDedupeStore) ClaimMessage(ctx context.Context, key string, expires time.Time) (bool, error) {
+	if s[key] {
+		return false, nil
+	}
+	s[key] = true
+	return true, nil
+}
+
+func (s fakeDedupeStore) ReleaseMessage(ctx context.Context, key string) error {
+	delete(s, key)
+	return nil
+}
+
+func TestIngestDeduplicates(t *testing.T) {
+	ctx := context.Background()
+	database := &fakeSaver{}
+	influx := &fakeSaver{}
+	p := Pipeline{Database: database, InfluxDB: influx, Dedupe: fakeDedupeStore{}}
+
+	m := testutil.FullyPopulatedMeasurementProto()
+	m.MessageId = "abc"
+
+	if err := p.Ingest(ctx, m); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := p.Ingest(ctx, m); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("got error %v, want %v", err, ErrDuplicate)
+	}
+
+	// A measurement with a different ID isn't a duplicate, even if it's otherwise the same.
+	m.MessageId = "def"
+	if err := p.Ingest(ctx, m); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(database.saved) != 2 {
+		t.Errorf("saved %d measurements to the database, want 2", len(database.saved))
+	}
+	if len(influx.saved) != 2 {
+		t.Errorf("saved %d measurements to InfluxDB, want 2", len(influx.saved))
+	}
+
+	// A measurement that fails to save isn't a duplicate when it's delivered again.
+	m.MessageId = "ghi"
+	database.err = errors.New("unavailable")
+	if err := p.Ingest(ctx, m); err == nil || errors.Is(err, ErrDuplicate) {
+		t.Errorf("got error %v, want a save error", err)
+	}
+	database.err = nil
+	if err := p.Ingest(ctx, m); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestDedupeKey(t *testing.T) {
+	m := testutil.FullyPopulatedMeasurementProto()
+	m.DeviceId = "foo"
+	m.Timestamp = tspb.New(time.Date(2018, 3, 25, 0, 0, 0, 250000000, time.UTC))
+
+	if got, want := DedupeKey(m), "foo#2018-03-25T00:00:00.25Z"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	m.MessageId = "abc"
+	if got, want := DedupeKey(m), "foo#abc"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestIngestReceived(t *testing.T) {
+	p := Pipeline{Database: &fakeSaver{}, MaxAge: DefaultMaxAge, MaxFuture: DefaultMaxFuture}
+	received := time.Now().Add(-10 * DefaultMaxAge)
+
+	m := testutil.FullyPopulatedMeasurementProto()
+	m.Timestamp = tspb.New(received.Add(-time.Hour))
+	m.UploadTimestamp = nil
+
+	if err := p.Ingest(context.Background(), m); !errors.Is(err, ErrInvalid) {
+		t.Errorf("got error %v, want %v", err, ErrInvalid)
+	}
+
+	// Checked against when it was received, it's recent.
+	if err := p.Ingest(WithReceived(context.Background(), received), m); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestIngestTimestampWindow(t *testing.T) {
+	now := time.Now()
+
+	cases := []struct {
+		name      string
+		ts        time.Time
+		upload    time.Time
+		wantField string
+	}{
+		{name: "now", ts: now},
+		{name: "recent", ts: now.Add(-24 * time.Hour)},
+		{name: "too_old", ts: now.Add(-DefaultMaxAge - time.Hour), wantField: "timestamp"},
+		{name: "soon", ts: now.Add(DefaultMaxFuture / 2)},
+		{name: "too_far_in_future", ts: now.Add(DefaultMaxFuture + time.Minute), wantField: "timestamp"},
+		{name: "old_upload", ts: now.Add(-DefaultMaxAge + time.Hour), upload: now.Add(-DefaultMaxAge + 2*time.Hour)},
+		{name: "upload_too_far_in_future", ts: now, upload: now.Add(DefaultMaxFuture + time.Minute), wantField: "upload_timestamp"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			database := &fakeSaver{}
+			p := Pipeline{Database: database, MaxAge: DefaultMaxAge, MaxFuture: DefaultMaxFuture}
+
+			m := testutil.FullyPopulatedMeasurementProto()
+			m.Timestamp = tspb.New(tc.ts)
+			m.UploadTimestamp = nil
+			if !tc.upload.IsZero() {
+				m.UploadTimestamp = tspb.New(tc.upload)
+			}
+
+			err := p.Ingest(context.Background(), m)
+			if tc.wantField == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+
+			var verr mpbutil.ValidationError
+			if !errors.Is(err, ErrInvalid) || !errors.As(err, &verr) {
+				t.Fatalf("got error %v, want a ValidationError wrapping %v", err, ErrInvalid)
+			}
+			if len(verr) != 1 || verr[0].Field != tc.wantField {
+				t.Errorf("got errors %v, want one for field %q", verr, tc.wantField)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package measurement
+
+import (
+	"github.com/mtraver/environmental-sensor/humidity"
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+// A derivation computes a derived metric from the values of the metric's inputs, given in the
+// order of its metric.Info.Inputs. ok is false if the metric is undefined for those values.
+type derivation func(inputs []float32) (v float32, ok bool)
+
+// derivations contains the derivation of every derived metric except the AQI, which depends on
+// the choice of standard and needs only some of its inputs. To add a derived metric, add it to
+// metric.All with its inputs, give it a field in StorableMeasurement and an entry in
+// DerivedValueMap and valuePtr, and add its derivation here.
+var derivations = map[metric.Key]derivation{
+	metric.DewPoint:    tempRH(humidity.DewPoint, true),
+	metric.HeatIndex:   tempRH(humidity.HeatIndex, false),
+	metric.Humidex:     tempRH(humidity.Humidex, true),
+	metric.AbsHumidity: tempRH(humidity.AbsoluteHumidity, false),
+	metric.VPD:         tempRH(humidity.VPD, false),
+}
+
+// tempRH adapts a function of temperature and relative humidity to a derivation. If
+// needsHumidity is true then the derivation is undefined for a relative humidity of zero.
+func tempRH(f func(temp, rh float32) float32, needsHumidity bool) derivation {
+	return func(inputs []float32) (float32, bool) {
+		temp, rh := inputs[0], inputs[1]
+		if needsHumidity && rh <= 0 {
+			return 0, false
+		}
+		return f(temp, rh), true
+	}
+}
+
+// inputValues returns the values of the given metrics from values, in order. ok is false if any
+// of them is missing.
+func inputValues(values map[metric.Key]*float32, keys []metric.Key) (inputs []float32, ok bool) {
+	inputs = make([]float32, len(keys))
+	for i, k := range keys {
+		v := values[k]
+		if v == nil {
+			return nil, false
+		}
+		inputs[i] = *v
+	}
+	return inputs, true
+}
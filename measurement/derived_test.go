@@ -0,0 +1,93 @@
+package measurement
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+func TestDerivedMetricsRegistered(t *testing.T) {
+	var sm StorableMeasurement
+	derived := sm.DerivedValueMap()
+
+	for key := range metric.All {
+		if !key.Derived() {
+			continue
+		}
+
+		if _, ok := derived[key]; !ok {
+			t.Errorf("%s is missing from DerivedValueMap", key)
+		}
+		if sm.valuePtr(key) == nil {
+			t.Errorf("%s has no field", key)
+		}
+		if _, ok := derivations[key]; !ok && key != metric.AQI {
+			t.Errorf("%s has no derivation", key)
+		}
+	}
+
+	for key := range derived {
+		if !key.Derived() {
+			t.Errorf("%s is in DerivedValueMap but isn't a derived metric in metric.All", key)
+		}
+	}
+}
+
+func TestFillDerivedMetricsHumidity(t *testing.T) {
+	cases := []struct {
+		name string
+		temp *float32
+		rh   *float32
+		want map[metric.Key]float32
+	}{
+		{
+			name: "both_inputs",
+			temp: floatPtr(25),
+			rh:   floatPtr(50),
+			want: map[metric.Key]float32{
+				metric.DewPoint:    13.86,
+				metric.HeatIndex:   24.86,
+				metric.Humidex:     28.28,
+				metric.AbsHumidity: 11.49,
+				metric.VPD:         1.581,
+			},
+		},
+		{
+			// Dew point and humidex are undefined for completely dry air.
+			name: "zero_humidity",
+			temp: floatPtr(25),
+			rh:   floatPtr(0),
+			want: map[metric.Key]float32{
+				metric.HeatIndex:   23.56,
+				metric.AbsHumidity: 0,
+				metric.VPD:         3.163,
+			},
+		},
+		{
+			name: "missing_input",
+			temp: floatPtr(25),
+			want: map[metric.Key]float32{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sm := StorableMeasurement{Temp: tc.temp, RH: tc.rh}
+			sm.FillDerivedMetrics(nil)
+
+			for key := range derivations {
+				got := sm.Value(key)
+				want, ok := tc.want[key]
+				switch {
+				case !ok && got != nil:
+					t.Errorf("%s: got %v, want nil", key, *got)
+				case ok && got == nil:
+					t.Errorf("%s: got nil, want %v", key, want)
+				case ok && math.Abs(float64(*got-want)) > 0.01:
+					t.Errorf("%s: got %v, want %v", key, *got, want)
+				}
+			}
+		})
+	}
+}
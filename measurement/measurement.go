@@ -29,6 +29,7 @@ type StorableMeasurement struct {
 	DeviceID        string    `json:"-" datastore:"device_id"`
 	Timestamp       time.Time `json:"-" datastore:"timestamp"`
 	UploadTimestamp time.Time `json:"-" datastore:"upload_timestamp,omitempty"`
+	MessageID       string    `json:"-" datastore:"message_id,noindex,omitempty"`
 
 	// These metrics are the raw values reported by sensors. They must match the
 	// metrics defined in the generated Measurement type (from measurement.proto).
@@ -45,8 +46,24 @@ type StorableMeasurement struct {
 
 	// These metrics are derived from the raw values. They're not stored in the database
 	// (the `datastore` tag is set to "-") but they are passed to the frontend.
-	// These values are populated by the FillDerivedMetrics method.
-	AQI *float32 `json:"aqi,omitempty" datastore:"-"`
+	// These values are populated by the FillDerivedMetrics method, except for AQINowCast,
+	// which depends on earlier measurements and is populated by FillNowCast.
+	// AQIStandard is the ID of the aqi.Standard that AQI and AQINowCast are on.
+	AQI          *float32   `json:"aqi,omitempty" datastore:"-"`
+	AQIPollutant metric.Key `json:"aqi_pollutant,omitempty" datastore:"-"`
+	AQINowCast   *float32   `json:"aqi_nowcast,omitempty" datastore:"-"`
+	AQIStandard  string     `json:"aqi_standard,omitempty" datastore:"-"`
+
+	// These are derived from Temp and RH. See derivations.
+	DewPoint    *float32 `json:"dew_point,omitempty" datastore:"-"`
+	HeatIndex   *float32 `json:"heat_index,omitempty" datastore:"-"`
+	Humidex     *float32 `json:"humidex,omitempty" datastore:"-"`
+	AbsHumidity *float32 `json:"abs_humidity,omitempty" datastore:"-"`
+	VPD         *float32 `json:"vpd,omitempty" datastore:"-"`
+
+	// Raw holds the values, as reported, of the raw metrics that were corrected by calibration.
+	// The corrected values replace them in the fields above. It's nil if nothing was corrected.
+	Raw map[metric.Key]float32 `json:"raw,omitempty" datastore:"-"`
 }
 
 func (sm StorableMeasurement) MarshalJSON() ([]byte, error) {
@@ -80,6 +97,7 @@ func NewStorableMeasurement(m *mpb.Measurement) (StorableMeasurement, error) {
 	sm := StorableMeasurement{
 		DeviceID:  m.GetDeviceId(),
 		Timestamp: m.GetTimestamp().AsTime(),
+		MessageID: m.GetMessageId(),
 	}
 
 	// The generated protobuf code uses a pointer to tspb.Timestamp, but in StorableMeasurement
@@ -158,6 +176,7 @@ func NewMeasurement(sm *StorableMeasurement) (*mpb.Measurement, error) {
 	m := &mpb.Measurement{
 		DeviceId:  sm.DeviceID,
 		Timestamp: tspb.New(sm.Timestamp),
+		MessageId: sm.MessageID,
 	}
 
 	// The upload timestamp may be the zero timestamp. If it is, then the upload timestamp
@@ -209,9 +228,23 @@ func NewMeasurement(sm *StorableMeasurement) (*mpb.Measurement, error) {
 	return m, nil
 }
 
+// keyTimeFormat is the format of timestamps in keys. It's to the microsecond, which is as precise
+// as Datastore stores times, so the key of a measurement loaded from Datastore is the same as the
+// key it was stored under. Fractional seconds are only included if they're non-zero.
+const keyTimeFormat = "2006-01-02T15:04:05.999999Z07:00"
+
 // DBKey returns a string key suitable for Datastore. It promotes Device ID and timestamp into the key.
+// Keys of measurements taken on the second are the same as they were before sub-second
+// timestamps were distinguished.
 func (sm *StorableMeasurement) DBKey() string {
-	return strings.Join([]string{sm.DeviceID, sm.Timestamp.Format(time.RFC3339)}, keySep)
+	return strings.Join([]string{sm.DeviceID, sm.Timestamp.UTC().Format(keyTimeFormat)}, keySep)
+}
+
+// LegacyDBKey returns the key that measurements were stored under before sub-second timestamps
+// were distinguished, when keys were to the second. It's the same as DBKey if sm was taken on
+// the second.
+func (sm *StorableMeasurement) LegacyDBKey() string {
+	return strings.Join([]string{sm.DeviceID, sm.Timestamp.UTC().Format(time.RFC3339)}, keySep)
 }
 
 // ValueMap returns a map from metric key to value, which may be nil.
@@ -230,14 +263,170 @@ func (sm StorableMeasurement) ValueMap() map[metric.Key]*float32 {
 	}
 }
 
-func (sm *StorableMeasurement) FillDerivedMetrics() {
-	if sm.PM25 != nil {
-		v := float32(aqi.PM25(*sm.PM25))
+// DerivedValueMap returns a map from derived metric key to value, which is nil until
+// FillDerivedMetrics is called and remains nil if the metric's inputs are missing.
+func (sm StorableMeasurement) DerivedValueMap() map[metric.Key]*float32 {
+	return map[metric.Key]*float32{
+		metric.AQI:         sm.AQI,
+		metric.DewPoint:    sm.DewPoint,
+		metric.HeatIndex:   sm.HeatIndex,
+		metric.Humidex:     sm.Humidex,
+		metric.AbsHumidity: sm.AbsHumidity,
+		metric.VPD:         sm.VPD,
+	}
+}
+
+// Value returns the value of the given raw or derived metric, or nil if it's unset or unknown.
+func (sm StorableMeasurement) Value(key metric.Key) *float32 {
+	p := sm.valuePtr(key)
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+// valuePtr returns a pointer to the field that holds the given metric, or nil if there isn't one.
+func (sm *StorableMeasurement) valuePtr(key metric.Key) **float32 {
+	switch key {
+	case metric.Temp:
+		return &sm.Temp
+	case metric.PM1:
+		return &sm.PM1
+	case metric.PM25:
+		return &sm.PM25
+	case metric.PM4:
+		return &sm.PM4
+	case metric.PM10:
+		return &sm.PM10
+	case metric.RH:
+		return &sm.RH
+	case metric.VOCIndex:
+		return &sm.VOCIndex
+	case metric.NOxIndex:
+		return &sm.NOxIndex
+	case metric.HCHO:
+		return &sm.HCHO
+	case metric.CO2:
+		return &sm.CO2
+	case metric.AQI:
+		return &sm.AQI
+	case metric.DewPoint:
+		return &sm.DewPoint
+	case metric.HeatIndex:
+		return &sm.HeatIndex
+	case metric.Humidex:
+		return &sm.Humidex
+	case metric.AbsHumidity:
+		return &sm.AbsHumidity
+	case metric.VPD:
+		return &sm.VPD
+	default:
+		return nil
+	}
+}
+
+// SetValue sets the value of the given raw metric. It returns false if key isn't one of the
+// metrics returned by ValueMap.
+func (sm *StorableMeasurement) SetValue(key metric.Key, v float32) bool {
+	if _, ok := sm.ValueMap()[key]; !ok {
+		return false
+	}
+
+	*sm.valuePtr(key) = &v
+	return true
+}
+
+// KeepOnly clears every metric, raw or derived, that isn't in keys. It reports whether any of
+// the given metrics has a value.
+func (sm *StorableMeasurement) KeepOnly(keys []metric.Key) bool {
+	keep := make(map[metric.Key]bool, len(keys))
+	for _, k := range keys {
+		keep[k] = true
+	}
+
+	found := false
+	filter := func(k metric.Key) {
+		p := sm.valuePtr(k)
+		if !keep[k] {
+			*p = nil
+		} else if *p != nil {
+			found = true
+		}
+	}
+
+	for k := range sm.ValueMap() {
+		filter(k)
+	}
+	for k := range sm.DerivedValueMap() {
+		filter(k)
+	}
+
+	// Copies of sm share Raw, so replace it rather than modifying it.
+	var raw map[metric.Key]float32
+	for k, v := range sm.Raw {
+		if keep[k] {
+			if raw == nil {
+				raw = make(map[metric.Key]float32)
+			}
+			raw[k] = v
+		}
+	}
+	sm.Raw = raw
+
+	// The AQI's pollutant, NowCast, and standard go along with the AQI.
+	if !keep[metric.AQI] {
+		sm.AQIPollutant = ""
+		sm.AQINowCast = nil
+		sm.AQIStandard = ""
+	}
+
+	return found
+}
+
+// FillDerivedMetrics computes the metrics that are derived from the raw values. The AQI is the
+// overall index under std of the pollutants in sm, and AQIPollutant is the pollutant that
+// determines it. If std is nil the US EPA AQI is used. The other derived metrics are computed
+// by their derivations if all of their inputs are present.
+func (sm *StorableMeasurement) FillDerivedMetrics(std aqi.Standard) {
+	if std == nil {
+		std = aqi.USEPA
+	}
+
+	if index, dominant, ok := aqi.Compute(std, sm.concentrations(std)); ok {
+		v := float32(index)
 		sm.AQI = &v
+		sm.AQIPollutant = dominant
+		sm.AQIStandard = std.ID()
+	}
+
+	values := sm.ValueMap()
+	for key, derive := range derivations {
+		if inputs, ok := inputValues(values, metric.All[key].Inputs); ok {
+			if v, ok := derive(inputs); ok {
+				*sm.valuePtr(key) = &v
+			}
+		}
+	}
+}
+
+// concentrations returns the values in sm of the pollutants that std considers.
+func (sm StorableMeasurement) concentrations(std aqi.Standard) map[metric.Key]float32 {
+	concentrations := make(map[metric.Key]float32)
+	values := sm.ValueMap()
+	for _, p := range std.Pollutants() {
+		if v := values[p]; v != nil {
+			concentrations[p] = *v
+		}
 	}
+	return concentrations
 }
 
 func (sm StorableMeasurement) String() string {
+	return sm.Format(nil)
+}
+
+// Format is like String but gives values in the units preferred by p.
+func (sm StorableMeasurement) Format(p metric.Preferences) string {
 	delay := ""
 	if !sm.UploadTimestamp.IsZero() {
 		delay = fmt.Sprintf("(%v upload delay)", sm.UploadTimestamp.Sub(sm.Timestamp))
@@ -249,8 +438,8 @@ func (sm StorableMeasurement) String() string {
 			continue
 		}
 
-		info := metric.All[key]
-		valueStrs = append(valueStrs, fmt.Sprintf("%s=%.3f%s", info.Name, *v, info.Unit))
+		value, unit := p.Convert(key, *v)
+		valueStrs = append(valueStrs, fmt.Sprintf("%s=%.3f%s", metric.All[key].Name, value, unit))
 	}
 	sort.Strings(valueStrs)
 
@@ -7,6 +7,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/mtraver/environmental-sensor/aqi"
 	mpb "github.com/mtraver/environmental-sensor/measurementpb"
 	"github.com/mtraver/environmental-sensor/metric"
 	"github.com/mtraver/environmental-sensor/testutil"
@@ -173,6 +174,25 @@ func TestStorableMeasurementDBKey(t *testing.T) {
 	if got := sm.DBKey(); got != want {
 		t.Errorf("got %q, want %q", got, want)
 	}
+
+	// Measurements taken within the same second have different keys.
+	sm.Timestamp = sm.Timestamp.Add(250 * time.Millisecond)
+	want = "foo#2018-03-25T00:00:00.25Z"
+	if got := sm.DBKey(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := sm.LegacyDBKey(), "foo#2018-03-25T00:00:00Z"; got != want {
+		t.Errorf("got legacy key %q, want %q", got, want)
+	}
+
+	// Datastore stores times to the microsecond, so the key of a measurement loaded from it must
+	// be the same as the key of the measurement that was saved.
+	sm.Timestamp = sm.Timestamp.Add(123456789 * time.Nanosecond)
+	loaded := sm
+	loaded.Timestamp = time.UnixMicro(sm.Timestamp.UnixMicro()).In(time.Local)
+	if got, want := loaded.DBKey(), sm.DBKey(); got != want {
+		t.Errorf("got key %q for the loaded measurement, want %q", got, want)
+	}
 }
 
 func TestStorableMeasurementValueMap(t *testing.T) {
@@ -225,6 +245,23 @@ func TestStorableMeasurementValueMap(t *testing.T) {
 	}
 }
 
+func TestStorableMeasurementSetValue(t *testing.T) {
+	var sm StorableMeasurement
+	for k := range fullyPopulatedStorableMeasurement.ValueMap() {
+		if !sm.SetValue(k, *fullyPopulatedStorableMeasurement.ValueMap()[k]) {
+			t.Errorf("SetValue(%q) returned false", k)
+		}
+	}
+
+	if diff := cmp.Diff(sm.ValueMap(), fullyPopulatedStorableMeasurement.ValueMap()); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+
+	if sm.SetValue(metric.AQI, 10) {
+		t.Errorf("SetValue(%q) returned true for a derived metric", metric.AQI)
+	}
+}
+
 func TestNewStorableMeasurement(t *testing.T) {
 	for _, tc := range conversionCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -270,3 +307,113 @@ func TestNewMeasurement(t *testing.T) {
 		})
 	}
 }
+
+func TestFillDerivedMetrics(t *testing.T) {
+	pm25 := float32(35.4)
+	pm10 := float32(254)
+	aqi100 := float32(100)
+	aqi150 := float32(150)
+	eaqi4 := float32(4)
+	aqhi4 := float32(4)
+
+	cases := []struct {
+		name string
+		std  aqi.Standard
+		sm   StorableMeasurement
+		want StorableMeasurement
+	}{
+		{
+			name: "no_pollutants",
+			sm:   StorableMeasurement{DeviceID: "foo"},
+			want: StorableMeasurement{DeviceID: "foo"},
+		},
+		{
+			name: "pm25",
+			sm:   StorableMeasurement{DeviceID: "foo", PM25: &pm25},
+			want: StorableMeasurement{DeviceID: "foo", PM25: &pm25, AQI: &aqi100, AQIPollutant: metric.PM25, AQIStandard: "us_epa"},
+		},
+		{
+			name: "pm10_dominant",
+			sm:   StorableMeasurement{DeviceID: "foo", PM25: &pm25, PM10: &pm10},
+			want: StorableMeasurement{DeviceID: "foo", PM25: &pm25, PM10: &pm10, AQI: &aqi150, AQIPollutant: metric.PM10, AQIStandard: "us_epa"},
+		},
+		{
+			name: "eu_eaqi",
+			std:  aqi.EUEAQI,
+			sm:   StorableMeasurement{DeviceID: "foo", PM25: &pm25},
+			want: StorableMeasurement{DeviceID: "foo", PM25: &pm25, AQI: &eaqi4, AQIPollutant: metric.PM25, AQIStandard: "eu_eaqi"},
+		},
+		{
+			name: "standard_ignores_pollutant",
+			std:  aqi.CanadaAQHI,
+			sm:   StorableMeasurement{DeviceID: "foo", PM25: &pm25, PM10: &pm10},
+			want: StorableMeasurement{DeviceID: "foo", PM25: &pm25, PM10: &pm10, AQI: &aqhi4, AQIPollutant: metric.PM25, AQIStandard: "ca_aqhi"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sm := tc.sm
+			sm.FillDerivedMetrics(tc.std)
+			if diff := cmp.Diff(sm, tc.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStorableMeasurementKeepOnly(t *testing.T) {
+	temp := float32(18.5)
+	rh := float32(55.0)
+	aqi := float32(42.0)
+
+	cases := []struct {
+		name      string
+		sm        StorableMeasurement
+		keys      []metric.Key
+		want      StorableMeasurement
+		wantFound bool
+	}{
+		{
+			name:      "keep_raw",
+			sm:        StorableMeasurement{DeviceID: "foo", Temp: &temp, RH: &rh, AQI: &aqi, AQIPollutant: metric.PM25, AQINowCast: &aqi},
+			keys:      []metric.Key{metric.RH},
+			want:      StorableMeasurement{DeviceID: "foo", RH: &rh},
+			wantFound: true,
+		},
+		{
+			name:      "keep_derived",
+			sm:        StorableMeasurement{DeviceID: "foo", Temp: &temp, AQI: &aqi, AQIPollutant: metric.PM25, AQINowCast: &aqi},
+			keys:      []metric.Key{metric.AQI, metric.CO2},
+			want:      StorableMeasurement{DeviceID: "foo", AQI: &aqi, AQIPollutant: metric.PM25, AQINowCast: &aqi},
+			wantFound: true,
+		},
+		{
+			name:      "keep_humidity_derived",
+			sm:        StorableMeasurement{DeviceID: "foo", Temp: &temp, RH: &rh, DewPoint: &temp, VPD: &rh},
+			keys:      []metric.Key{metric.DewPoint},
+			want:      StorableMeasurement{DeviceID: "foo", DewPoint: &temp},
+			wantFound: true,
+		},
+		{
+			name:      "none_present",
+			sm:        StorableMeasurement{DeviceID: "foo", Temp: &temp},
+			keys:      []metric.Key{metric.CO2},
+			want:      StorableMeasurement{DeviceID: "foo"},
+			wantFound: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sm := tc.sm
+			if found := sm.KeepOnly(tc.keys); found != tc.wantFound {
+				t.Errorf("got found = %v, want %v", found, tc.wantFound)
+			}
+
+			if diff := cmp.Diff(sm, tc.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package measurement
+
+import (
+	"slices"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/aqi"
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+// FillNowCast sets the NowCast AQI of each of sms from the measurements reported by the same
+// device in the preceding aqi.NowCastWindow, drawn from both sms and history. history should
+// contain the measurements from the aqi.NowCastWindow before the earliest of sms so that the
+// earliest measurements get a NowCast too, and it must not contain any of sms. The AQINowCast of
+// measurements for which the NowCast can't be computed is left nil.
+//
+// The NowCast concentrations are indexed under the standard that standardFor returns for each
+// measurement's device. If standardFor is nil, or returns nil, the US EPA AQI is used.
+func FillNowCast(sms []StorableMeasurement, history []StorableMeasurement, standardFor func(deviceID string) aqi.Standard) {
+	// Samples of each pollutant for each device, sorted by time.
+	samples := make(map[string]map[metric.Key][]aqi.Sample)
+	add := func(sm StorableMeasurement) {
+		values := sm.ValueMap()
+		for _, p := range aqi.Pollutants {
+			v := values[p]
+			if v == nil {
+				continue
+			}
+
+			if samples[sm.DeviceID] == nil {
+				samples[sm.DeviceID] = make(map[metric.Key][]aqi.Sample)
+			}
+			samples[sm.DeviceID][p] = append(samples[sm.DeviceID][p], aqi.Sample{Time: sm.Timestamp, Value: *v})
+		}
+	}
+
+	for _, sm := range history {
+		add(sm)
+	}
+	for _, sm := range sms {
+		add(sm)
+	}
+
+	for _, byPollutant := range samples {
+		for _, s := range byPollutant {
+			slices.SortFunc(s, func(a, b aqi.Sample) int { return a.Time.Compare(b.Time) })
+		}
+	}
+
+	for i := range sms {
+		sm := &sms[i]
+
+		// Only pass each pollutant's samples from the window ending at sm.
+		window := make(map[metric.Key][]aqi.Sample)
+		for p, s := range samples[sm.DeviceID] {
+			window[p] = samplesBetween(s, sm.Timestamp.Add(-aqi.NowCastWindow), sm.Timestamp)
+		}
+
+		var std aqi.Standard
+		if standardFor != nil {
+			std = standardFor(sm.DeviceID)
+		}
+		if std == nil {
+			std = aqi.USEPA
+		}
+
+		if index, _, ok := aqi.NowCastIndex(std, window, sm.Timestamp); ok {
+			v := float32(index)
+			sm.AQINowCast = &v
+			sm.AQIStandard = std.ID()
+		}
+	}
+}
+
+// samplesBetween returns the samples in the sorted slice s with times in (start, end].
+func samplesBetween(s []aqi.Sample, start, end time.Time) []aqi.Sample {
+	cmp := func(sample aqi.Sample, t time.Time) int { return sample.Time.Compare(t) }
+
+	// Find the first sample after start and the first sample after end.
+	i, _ := slices.BinarySearchFunc(s, start, cmp)
+	for i < len(s) && s[i].Time.Equal(start) {
+		i++
+	}
+	j, _ := slices.BinarySearchFunc(s, end, cmp)
+	for j < len(s) && s[j].Time.Equal(end) {
+		j++
+	}
+
+	return s[i:j]
+}
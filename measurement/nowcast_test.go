@@ -0,0 +1,70 @@
+package measurement
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/aqi"
+	"github.com/mtraver/environmental-sensor/testutil"
+)
+
+func TestFillNowCast(t *testing.T) {
+	pm := func(v float32) *float32 { return &v }
+	at := func(d time.Duration) time.Time { return testutil.Timestamp.Add(d) }
+
+	history := []StorableMeasurement{
+		{DeviceID: "foo", Timestamp: at(-2*time.Hour + time.Minute), PM25: pm(35.4)},
+		{DeviceID: "foo", Timestamp: at(-time.Hour + time.Minute), PM25: pm(35.4)},
+		// Another device's measurements don't count.
+		{DeviceID: "bar", Timestamp: at(-time.Hour + time.Minute), PM25: pm(500)},
+	}
+
+	sms := []StorableMeasurement{
+		{DeviceID: "foo", Timestamp: at(0), PM25: pm(35.4)},
+		{DeviceID: "foo", Timestamp: at(time.Minute), Temp: pm(20)},
+		{DeviceID: "bar", Timestamp: at(0), PM25: pm(5)},
+	}
+
+	FillNowCast(sms, history, nil)
+
+	if got := sms[0].AQINowCast; got == nil || *got != 100 {
+		t.Errorf("got NowCast %v, want 100", got)
+	}
+
+	// The NowCast doesn't require the measurement itself to have a pollutant.
+	if got := sms[1].AQINowCast; got == nil || *got != 100 {
+		t.Errorf("got NowCast %v, want 100", got)
+	}
+
+	// Both of bar's samples are in the most recent hour, so there's too little data.
+	if got := sms[2].AQINowCast; got != nil {
+		t.Errorf("got NowCast %v, want nil", *got)
+	}
+}
+
+func TestFillNowCastStandard(t *testing.T) {
+	pm := func(v float32) *float32 { return &v }
+	at := func(d time.Duration) time.Time { return testutil.Timestamp.Add(d) }
+
+	sms := []StorableMeasurement{
+		{DeviceID: "foo", Timestamp: at(-time.Hour), PM25: pm(35.4)},
+		{DeviceID: "foo", Timestamp: at(0), PM25: pm(35.4)},
+		{DeviceID: "bar", Timestamp: at(-time.Hour), PM25: pm(35.4)},
+		{DeviceID: "bar", Timestamp: at(0), PM25: pm(35.4)},
+	}
+
+	FillNowCast(sms, nil, func(deviceID string) aqi.Standard {
+		if deviceID == "foo" {
+			return aqi.EUEAQI
+		}
+		return nil
+	})
+
+	if got := sms[1]; got.AQINowCast == nil || *got.AQINowCast != 4 || got.AQIStandard != aqi.EUEAQI.ID() {
+		t.Errorf("got NowCast %v on %q, want 4 on %q", got.AQINowCast, got.AQIStandard, aqi.EUEAQI.ID())
+	}
+
+	if got := sms[3]; got.AQINowCast == nil || *got.AQINowCast != 100 || got.AQIStandard != aqi.USEPA.ID() {
+		t.Errorf("got NowCast %v on %q, want 100 on %q", got.AQINowCast, got.AQIStandard, aqi.USEPA.ID())
+	}
+}
@@ -24,6 +24,55 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type Resolution int32
+
+const (
+	Resolution_RESOLUTION_UNSPECIFIED Resolution = 0
+	Resolution_HOURLY                 Resolution = 1
+	Resolution_DAILY                  Resolution = 2
+)
+
+// Enum value maps for Resolution.
+var (
+	Resolution_name = map[int32]string{
+		0: "RESOLUTION_UNSPECIFIED",
+		1: "HOURLY",
+		2: "DAILY",
+	}
+	Resolution_value = map[string]int32{
+		"RESOLUTION_UNSPECIFIED": 0,
+		"HOURLY":                 1,
+		"DAILY":                  2,
+	}
+)
+
+func (x Resolution) Enum() *Resolution {
+	p := new(Resolution)
+	*p = x
+	return p
+}
+
+func (x Resolution) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Resolution) Descriptor() protoreflect.EnumDescriptor {
+	return file_measurement_proto_enumTypes[0].Descriptor()
+}
+
+func (Resolution) Type() protoreflect.EnumType {
+	return &file_measurement_proto_enumTypes[0]
+}
+
+func (x Resolution) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Resolution.Descriptor instead.
+func (Resolution) EnumDescriptor() ([]byte, []int) {
+	return file_measurement_proto_rawDescGZIP(), []int{0}
+}
+
 type Measurement struct {
 	state     protoimpl.MessageState `protogen:"open.v1"`
 	DeviceId  string                 `protobuf:"bytes,1,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
@@ -37,13 +86,18 @@ type Measurement struct {
 	VocIndex  *wrapperspb.FloatValue `protobuf:"bytes,10,opt,name=voc_index,json=vocIndex,proto3" json:"voc_index,omitempty"`
 	NoxIndex  *wrapperspb.FloatValue `protobuf:"bytes,11,opt,name=nox_index,json=noxIndex,proto3" json:"nox_index,omitempty"`
 	Hcho      *wrapperspb.FloatValue `protobuf:"bytes,12,opt,name=hcho,proto3" json:"hcho,omitempty"`
-	Co2       *wrapperspb.FloatValue `protobuf:"bytes,13,opt,name=co2,proto3" json:"co2,omitempty"` // Next: 14
+	Co2       *wrapperspb.FloatValue `protobuf:"bytes,13,opt,name=co2,proto3" json:"co2,omitempty"` // Next: 15
 	// This field should only be set when the measurement is not uploaded
 	// immediately after it is taken, e.g. if the network goes down and
 	// measurements are stored locally before upload is attempted again later.
 	UploadTimestamp *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=upload_timestamp,json=uploadTimestamp,proto3" json:"upload_timestamp,omitempty"`
-	unknownFields   protoimpl.UnknownFields
-	sizeCache       protoimpl.SizeCache
+	// A unique ID that the device assigns to the measurement when it's taken.
+	// Copies of a measurement that are delivered more than once have the same
+	// ID, so they're only saved once. If it's empty then the device ID and
+	// timestamp identify the measurement.
+	MessageId     string `protobuf:"bytes,14,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *Measurement) Reset() {
@@ -167,6 +221,13 @@ func (x *Measurement) GetUploadTimestamp() *timestamppb.Timestamp {
 	return nil
 }
 
+func (x *Measurement) GetMessageId() string {
+	if x != nil {
+		return x.MessageId
+	}
+	return ""
+}
+
 type GetDevicesResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	DeviceId      []string               `protobuf:"bytes,1,rep,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
@@ -255,11 +316,635 @@ func (x *GetLatestRequest) GetDeviceId() string {
 	return ""
 }
 
+type BatchGetLatestRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// If empty, the latest measurement of every registered device is returned.
+	DeviceId      []string `protobuf:"bytes,1,rep,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchGetLatestRequest) Reset() {
+	*x = BatchGetLatestRequest{}
+	mi := &file_measurement_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchGetLatestRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchGetLatestRequest) ProtoMessage() {}
+
+func (x *BatchGetLatestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_measurement_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchGetLatestRequest.ProtoReflect.Descriptor instead.
+func (*BatchGetLatestRequest) Descriptor() ([]byte, []int) {
+	return file_measurement_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BatchGetLatestRequest) GetDeviceId() []string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return nil
+}
+
+type BatchGetLatestResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Keyed by device ID. Devices with no measurements are omitted.
+	Measurements  map[string]*Measurement `protobuf:"bytes,1,rep,name=measurements,proto3" json:"measurements,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchGetLatestResponse) Reset() {
+	*x = BatchGetLatestResponse{}
+	mi := &file_measurement_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchGetLatestResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchGetLatestResponse) ProtoMessage() {}
+
+func (x *BatchGetLatestResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_measurement_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchGetLatestResponse.ProtoReflect.Descriptor instead.
+func (*BatchGetLatestResponse) Descriptor() ([]byte, []int) {
+	return file_measurement_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *BatchGetLatestResponse) GetMeasurements() map[string]*Measurement {
+	if x != nil {
+		return x.Measurements
+	}
+	return nil
+}
+
+type ListMeasurementsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// If empty, measurements from all devices are returned.
+	DeviceId []string `protobuf:"bytes,1,rep,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	// Metric keys, e.g. "pm25". If non-empty, only measurements with a value for
+	// at least one of these metrics are returned, and other metrics are cleared.
+	Metric []string `protobuf:"bytes,2,rep,name=metric,proto3" json:"metric,omitempty"`
+	// Required. Measurements taken at or after this time are returned.
+	StartTime *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`
+	// If set, only measurements taken at or before this time are returned.
+	EndTime *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=end_time,json=endTime,proto3" json:"end_time,omitempty"`
+	// The maximum number of measurements to return. Defaults to 100 and may be
+	// at most 1000.
+	PageSize int32 `protobuf:"varint,5,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	// The next_page_token of the previous response, to get the next page.
+	PageToken     string `protobuf:"bytes,6,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListMeasurementsRequest) Reset() {
+	*x = ListMeasurementsRequest{}
+	mi := &file_measurement_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListMeasurementsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListMeasurementsRequest) ProtoMessage() {}
+
+func (x *ListMeasurementsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_measurement_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListMeasurementsRequest.ProtoReflect.Descriptor instead.
+func (*ListMeasurementsRequest) Descriptor() ([]byte, []int) {
+	return file_measurement_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListMeasurementsRequest) GetDeviceId() []string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return nil
+}
+
+func (x *ListMeasurementsRequest) GetMetric() []string {
+	if x != nil {
+		return x.Metric
+	}
+	return nil
+}
+
+func (x *ListMeasurementsRequest) GetStartTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartTime
+	}
+	return nil
+}
+
+func (x *ListMeasurementsRequest) GetEndTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EndTime
+	}
+	return nil
+}
+
+func (x *ListMeasurementsRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *ListMeasurementsRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+type ListMeasurementsResponse struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Measurements []*Measurement         `protobuf:"bytes,1,rep,name=measurements,proto3" json:"measurements,omitempty"`
+	// Empty if there are no more pages.
+	NextPageToken string `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListMeasurementsResponse) Reset() {
+	*x = ListMeasurementsResponse{}
+	mi := &file_measurement_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListMeasurementsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListMeasurementsResponse) ProtoMessage() {}
+
+func (x *ListMeasurementsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_measurement_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListMeasurementsResponse.ProtoReflect.Descriptor instead.
+func (*ListMeasurementsResponse) Descriptor() ([]byte, []int) {
+	return file_measurement_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListMeasurementsResponse) GetMeasurements() []*Measurement {
+	if x != nil {
+		return x.Measurements
+	}
+	return nil
+}
+
+func (x *ListMeasurementsResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+type StreamMeasurementsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// If empty, measurements from all devices are streamed.
+	DeviceId []string `protobuf:"bytes,1,rep,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	// Metric keys, as in ListMeasurementsRequest.
+	Metric        []string `protobuf:"bytes,2,rep,name=metric,proto3" json:"metric,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamMeasurementsRequest) Reset() {
+	*x = StreamMeasurementsRequest{}
+	mi := &file_measurement_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamMeasurementsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamMeasurementsRequest) ProtoMessage() {}
+
+func (x *StreamMeasurementsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_measurement_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamMeasurementsRequest.ProtoReflect.Descriptor instead.
+func (*StreamMeasurementsRequest) Descriptor() ([]byte, []int) {
+	return file_measurement_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *StreamMeasurementsRequest) GetDeviceId() []string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return nil
+}
+
+func (x *StreamMeasurementsRequest) GetMetric() []string {
+	if x != nil {
+		return x.Metric
+	}
+	return nil
+}
+
+type AggregateRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Required.
+	Resolution Resolution `protobuf:"varint,1,opt,name=resolution,proto3,enum=measurement.Resolution" json:"resolution,omitempty"`
+	// Required. Buckets that start at or after this time are returned.
+	StartTime *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`
+	// Buckets that start at or before this time are returned. Defaults to now.
+	EndTime *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=end_time,json=endTime,proto3" json:"end_time,omitempty"`
+	// If empty, buckets for all devices are returned.
+	DeviceId []string `protobuf:"bytes,4,rep,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	// Metric keys. If empty, buckets for all metrics are returned.
+	Metric        []string `protobuf:"bytes,5,rep,name=metric,proto3" json:"metric,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AggregateRequest) Reset() {
+	*x = AggregateRequest{}
+	mi := &file_measurement_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AggregateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AggregateRequest) ProtoMessage() {}
+
+func (x *AggregateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_measurement_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AggregateRequest.ProtoReflect.Descriptor instead.
+func (*AggregateRequest) Descriptor() ([]byte, []int) {
+	return file_measurement_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *AggregateRequest) GetResolution() Resolution {
+	if x != nil {
+		return x.Resolution
+	}
+	return Resolution_RESOLUTION_UNSPECIFIED
+}
+
+func (x *AggregateRequest) GetStartTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartTime
+	}
+	return nil
+}
+
+func (x *AggregateRequest) GetEndTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EndTime
+	}
+	return nil
+}
+
+func (x *AggregateRequest) GetDeviceId() []string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return nil
+}
+
+func (x *AggregateRequest) GetMetric() []string {
+	if x != nil {
+		return x.Metric
+	}
+	return nil
+}
+
+// Summary statistics of the values of one metric reported by one device
+// during one hour or day, which are aligned to UTC.
+type Rollup struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DeviceId      string                 `protobuf:"bytes,1,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	Metric        string                 `protobuf:"bytes,2,opt,name=metric,proto3" json:"metric,omitempty"`
+	Resolution    Resolution             `protobuf:"varint,3,opt,name=resolution,proto3,enum=measurement.Resolution" json:"resolution,omitempty"`
+	StartTime     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`
+	Min           float32                `protobuf:"fixed32,5,opt,name=min,proto3" json:"min,omitempty"`
+	Max           float32                `protobuf:"fixed32,6,opt,name=max,proto3" json:"max,omitempty"`
+	Mean          float32                `protobuf:"fixed32,7,opt,name=mean,proto3" json:"mean,omitempty"`
+	Count         int64                  `protobuf:"varint,8,opt,name=count,proto3" json:"count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Rollup) Reset() {
+	*x = Rollup{}
+	mi := &file_measurement_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Rollup) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Rollup) ProtoMessage() {}
+
+func (x *Rollup) ProtoReflect() protoreflect.Message {
+	mi := &file_measurement_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Rollup.ProtoReflect.Descriptor instead.
+func (*Rollup) Descriptor() ([]byte, []int) {
+	return file_measurement_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Rollup) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+func (x *Rollup) GetMetric() string {
+	if x != nil {
+		return x.Metric
+	}
+	return ""
+}
+
+func (x *Rollup) GetResolution() Resolution {
+	if x != nil {
+		return x.Resolution
+	}
+	return Resolution_RESOLUTION_UNSPECIFIED
+}
+
+func (x *Rollup) GetStartTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartTime
+	}
+	return nil
+}
+
+func (x *Rollup) GetMin() float32 {
+	if x != nil {
+		return x.Min
+	}
+	return 0
+}
+
+func (x *Rollup) GetMax() float32 {
+	if x != nil {
+		return x.Max
+	}
+	return 0
+}
+
+func (x *Rollup) GetMean() float32 {
+	if x != nil {
+		return x.Mean
+	}
+	return 0
+}
+
+func (x *Rollup) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+type AggregateResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Ordered by device ID, metric, and start time.
+	Rollups       []*Rollup `protobuf:"bytes,1,rep,name=rollups,proto3" json:"rollups,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AggregateResponse) Reset() {
+	*x = AggregateResponse{}
+	mi := &file_measurement_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AggregateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AggregateResponse) ProtoMessage() {}
+
+func (x *AggregateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_measurement_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AggregateResponse.ProtoReflect.Descriptor instead.
+func (*AggregateResponse) Descriptor() ([]byte, []int) {
+	return file_measurement_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *AggregateResponse) GetRollups() []*Rollup {
+	if x != nil {
+		return x.Rollups
+	}
+	return nil
+}
+
+type IngestRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Measurements  []*Measurement         `protobuf:"bytes,1,rep,name=measurements,proto3" json:"measurements,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IngestRequest) Reset() {
+	*x = IngestRequest{}
+	mi := &file_measurement_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestRequest) ProtoMessage() {}
+
+func (x *IngestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_measurement_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestRequest.ProtoReflect.Descriptor instead.
+func (*IngestRequest) Descriptor() ([]byte, []int) {
+	return file_measurement_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *IngestRequest) GetMeasurements() []*Measurement {
+	if x != nil {
+		return x.Measurements
+	}
+	return nil
+}
+
+type IngestResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The number of measurements that were saved or deliberately dropped.
+	Accepted int32 `protobuf:"varint,1,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	// The number of measurements that were invalid. They weren't saved.
+	Rejected int32 `protobuf:"varint,2,opt,name=rejected,proto3" json:"rejected,omitempty"`
+	// Why each rejected measurement was invalid.
+	Errors        []string `protobuf:"bytes,3,rep,name=errors,proto3" json:"errors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IngestResponse) Reset() {
+	*x = IngestResponse{}
+	mi := &file_measurement_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestResponse) ProtoMessage() {}
+
+func (x *IngestResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_measurement_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestResponse.ProtoReflect.Descriptor instead.
+func (*IngestResponse) Descriptor() ([]byte, []int) {
+	return file_measurement_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *IngestResponse) GetAccepted() int32 {
+	if x != nil {
+		return x.Accepted
+	}
+	return 0
+}
+
+func (x *IngestResponse) GetRejected() int32 {
+	if x != nil {
+		return x.Rejected
+	}
+	return 0
+}
+
+func (x *IngestResponse) GetErrors() []string {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
 var File_measurement_proto protoreflect.FileDescriptor
 
 const file_measurement_proto_rawDesc = "" +
 	"\n" +
-	"\x11measurement.proto\x12\vmeasurement\x1a\x1bgoogle/protobuf/empty.proto\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x1egoogle/protobuf/wrappers.proto\"\x9d\x05\n" +
+	"\x11measurement.proto\x12\vmeasurement\x1a\x1bgoogle/protobuf/empty.proto\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x1egoogle/protobuf/wrappers.proto\"\xbc\x05\n" +
 	"\vMeasurement\x12\x1b\n" +
 	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\x128\n" +
 	"\ttimestamp\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12/\n" +
@@ -274,15 +959,79 @@ const file_measurement_proto_rawDesc = "" +
 	"\tnox_index\x18\v \x01(\v2\x1b.google.protobuf.FloatValueR\bnoxIndex\x12/\n" +
 	"\x04hcho\x18\f \x01(\v2\x1b.google.protobuf.FloatValueR\x04hcho\x12-\n" +
 	"\x03co2\x18\r \x01(\v2\x1b.google.protobuf.FloatValueR\x03co2\x12E\n" +
-	"\x10upload_timestamp\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x0fuploadTimestamp\"1\n" +
+	"\x10upload_timestamp\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x0fuploadTimestamp\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x0e \x01(\tR\tmessageId\"1\n" +
 	"\x12GetDevicesResponse\x12\x1b\n" +
 	"\tdevice_id\x18\x01 \x03(\tR\bdeviceId\"/\n" +
 	"\x10GetLatestRequest\x12\x1b\n" +
-	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId2\xa5\x01\n" +
+	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\"4\n" +
+	"\x15BatchGetLatestRequest\x12\x1b\n" +
+	"\tdevice_id\x18\x01 \x03(\tR\bdeviceId\"\xce\x01\n" +
+	"\x16BatchGetLatestResponse\x12Y\n" +
+	"\fmeasurements\x18\x01 \x03(\v25.measurement.BatchGetLatestResponse.MeasurementsEntryR\fmeasurements\x1aY\n" +
+	"\x11MeasurementsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12.\n" +
+	"\x05value\x18\x02 \x01(\v2\x18.measurement.MeasurementR\x05value:\x028\x01\"\xfc\x01\n" +
+	"\x17ListMeasurementsRequest\x12\x1b\n" +
+	"\tdevice_id\x18\x01 \x03(\tR\bdeviceId\x12\x16\n" +
+	"\x06metric\x18\x02 \x03(\tR\x06metric\x129\n" +
+	"\n" +
+	"start_time\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\tstartTime\x125\n" +
+	"\bend_time\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\aendTime\x12\x1b\n" +
+	"\tpage_size\x18\x05 \x01(\x05R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x06 \x01(\tR\tpageToken\"\x80\x01\n" +
+	"\x18ListMeasurementsResponse\x12<\n" +
+	"\fmeasurements\x18\x01 \x03(\v2\x18.measurement.MeasurementR\fmeasurements\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"P\n" +
+	"\x19StreamMeasurementsRequest\x12\x1b\n" +
+	"\tdevice_id\x18\x01 \x03(\tR\bdeviceId\x12\x16\n" +
+	"\x06metric\x18\x02 \x03(\tR\x06metric\"\xf2\x01\n" +
+	"\x10AggregateRequest\x127\n" +
+	"\n" +
+	"resolution\x18\x01 \x01(\x0e2\x17.measurement.ResolutionR\n" +
+	"resolution\x129\n" +
+	"\n" +
+	"start_time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\tstartTime\x125\n" +
+	"\bend_time\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\aendTime\x12\x1b\n" +
+	"\tdevice_id\x18\x04 \x03(\tR\bdeviceId\x12\x16\n" +
+	"\x06metric\x18\x05 \x03(\tR\x06metric\"\xff\x01\n" +
+	"\x06Rollup\x12\x1b\n" +
+	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\x12\x16\n" +
+	"\x06metric\x18\x02 \x01(\tR\x06metric\x127\n" +
+	"\n" +
+	"resolution\x18\x03 \x01(\x0e2\x17.measurement.ResolutionR\n" +
+	"resolution\x129\n" +
+	"\n" +
+	"start_time\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tstartTime\x12\x10\n" +
+	"\x03min\x18\x05 \x01(\x02R\x03min\x12\x10\n" +
+	"\x03max\x18\x06 \x01(\x02R\x03max\x12\x12\n" +
+	"\x04mean\x18\a \x01(\x02R\x04mean\x12\x14\n" +
+	"\x05count\x18\b \x01(\x03R\x05count\"B\n" +
+	"\x11AggregateResponse\x12-\n" +
+	"\arollups\x18\x01 \x03(\v2\x13.measurement.RollupR\arollups\"M\n" +
+	"\rIngestRequest\x12<\n" +
+	"\fmeasurements\x18\x01 \x03(\v2\x18.measurement.MeasurementR\fmeasurements\"`\n" +
+	"\x0eIngestResponse\x12\x1a\n" +
+	"\baccepted\x18\x01 \x01(\x05R\baccepted\x12\x1a\n" +
+	"\brejected\x18\x02 \x01(\x05R\brejected\x12\x16\n" +
+	"\x06errors\x18\x03 \x03(\tR\x06errors*?\n" +
+	"\n" +
+	"Resolution\x12\x1a\n" +
+	"\x16RESOLUTION_UNSPECIFIED\x10\x00\x12\n" +
+	"\n" +
+	"\x06HOURLY\x10\x01\x12\t\n" +
+	"\x05DAILY\x10\x022\xd6\x04\n" +
 	"\x12MeasurementService\x12G\n" +
 	"\n" +
 	"GetDevices\x12\x16.google.protobuf.Empty\x1a\x1f.measurement.GetDevicesResponse\"\x00\x12F\n" +
-	"\tGetLatest\x12\x1d.measurement.GetLatestRequest\x1a\x18.measurement.Measurement\"\x00B7Z5github.com/mtraver/environmental-sensor/measurementpbb\x06proto3"
+	"\tGetLatest\x12\x1d.measurement.GetLatestRequest\x1a\x18.measurement.Measurement\"\x00\x12[\n" +
+	"\x0eBatchGetLatest\x12\".measurement.BatchGetLatestRequest\x1a#.measurement.BatchGetLatestResponse\"\x00\x12a\n" +
+	"\x10ListMeasurements\x12$.measurement.ListMeasurementsRequest\x1a%.measurement.ListMeasurementsResponse\"\x00\x12Z\n" +
+	"\x12StreamMeasurements\x12&.measurement.StreamMeasurementsRequest\x1a\x18.measurement.Measurement\"\x000\x01\x12L\n" +
+	"\tAggregate\x12\x1d.measurement.AggregateRequest\x1a\x1e.measurement.AggregateResponse\"\x00\x12E\n" +
+	"\x06Ingest\x12\x1a.measurement.IngestRequest\x1a\x1b.measurement.IngestResponse\"\x00(\x01B7Z5github.com/mtraver/environmental-sensor/measurementpbb\x06proto3"
 
 var (
 	file_measurement_proto_rawDescOnce sync.Once
@@ -296,37 +1045,72 @@ func file_measurement_proto_rawDescGZIP() []byte {
 	return file_measurement_proto_rawDescData
 }
 
-var file_measurement_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_measurement_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_measurement_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
 var file_measurement_proto_goTypes = []any{
-	(*Measurement)(nil),           // 0: measurement.Measurement
-	(*GetDevicesResponse)(nil),    // 1: measurement.GetDevicesResponse
-	(*GetLatestRequest)(nil),      // 2: measurement.GetLatestRequest
-	(*timestamppb.Timestamp)(nil), // 3: google.protobuf.Timestamp
-	(*wrapperspb.FloatValue)(nil), // 4: google.protobuf.FloatValue
-	(*emptypb.Empty)(nil),         // 5: google.protobuf.Empty
+	(Resolution)(0),                   // 0: measurement.Resolution
+	(*Measurement)(nil),               // 1: measurement.Measurement
+	(*GetDevicesResponse)(nil),        // 2: measurement.GetDevicesResponse
+	(*GetLatestRequest)(nil),          // 3: measurement.GetLatestRequest
+	(*BatchGetLatestRequest)(nil),     // 4: measurement.BatchGetLatestRequest
+	(*BatchGetLatestResponse)(nil),    // 5: measurement.BatchGetLatestResponse
+	(*ListMeasurementsRequest)(nil),   // 6: measurement.ListMeasurementsRequest
+	(*ListMeasurementsResponse)(nil),  // 7: measurement.ListMeasurementsResponse
+	(*StreamMeasurementsRequest)(nil), // 8: measurement.StreamMeasurementsRequest
+	(*AggregateRequest)(nil),          // 9: measurement.AggregateRequest
+	(*Rollup)(nil),                    // 10: measurement.Rollup
+	(*AggregateResponse)(nil),         // 11: measurement.AggregateResponse
+	(*IngestRequest)(nil),             // 12: measurement.IngestRequest
+	(*IngestResponse)(nil),            // 13: measurement.IngestResponse
+	nil,                               // 14: measurement.BatchGetLatestResponse.MeasurementsEntry
+	(*timestamppb.Timestamp)(nil),     // 15: google.protobuf.Timestamp
+	(*wrapperspb.FloatValue)(nil),     // 16: google.protobuf.FloatValue
+	(*emptypb.Empty)(nil),             // 17: google.protobuf.Empty
 }
 var file_measurement_proto_depIdxs = []int32{
-	3,  // 0: measurement.Measurement.timestamp:type_name -> google.protobuf.Timestamp
-	4,  // 1: measurement.Measurement.temp:type_name -> google.protobuf.FloatValue
-	4,  // 2: measurement.Measurement.pm1:type_name -> google.protobuf.FloatValue
-	4,  // 3: measurement.Measurement.pm25:type_name -> google.protobuf.FloatValue
-	4,  // 4: measurement.Measurement.pm4:type_name -> google.protobuf.FloatValue
-	4,  // 5: measurement.Measurement.pm10:type_name -> google.protobuf.FloatValue
-	4,  // 6: measurement.Measurement.rh:type_name -> google.protobuf.FloatValue
-	4,  // 7: measurement.Measurement.voc_index:type_name -> google.protobuf.FloatValue
-	4,  // 8: measurement.Measurement.nox_index:type_name -> google.protobuf.FloatValue
-	4,  // 9: measurement.Measurement.hcho:type_name -> google.protobuf.FloatValue
-	4,  // 10: measurement.Measurement.co2:type_name -> google.protobuf.FloatValue
-	3,  // 11: measurement.Measurement.upload_timestamp:type_name -> google.protobuf.Timestamp
-	5,  // 12: measurement.MeasurementService.GetDevices:input_type -> google.protobuf.Empty
-	2,  // 13: measurement.MeasurementService.GetLatest:input_type -> measurement.GetLatestRequest
-	1,  // 14: measurement.MeasurementService.GetDevices:output_type -> measurement.GetDevicesResponse
-	0,  // 15: measurement.MeasurementService.GetLatest:output_type -> measurement.Measurement
-	14, // [14:16] is the sub-list for method output_type
-	12, // [12:14] is the sub-list for method input_type
-	12, // [12:12] is the sub-list for extension type_name
-	12, // [12:12] is the sub-list for extension extendee
-	0,  // [0:12] is the sub-list for field type_name
+	15, // 0: measurement.Measurement.timestamp:type_name -> google.protobuf.Timestamp
+	16, // 1: measurement.Measurement.temp:type_name -> google.protobuf.FloatValue
+	16, // 2: measurement.Measurement.pm1:type_name -> google.protobuf.FloatValue
+	16, // 3: measurement.Measurement.pm25:type_name -> google.protobuf.FloatValue
+	16, // 4: measurement.Measurement.pm4:type_name -> google.protobuf.FloatValue
+	16, // 5: measurement.Measurement.pm10:type_name -> google.protobuf.FloatValue
+	16, // 6: measurement.Measurement.rh:type_name -> google.protobuf.FloatValue
+	16, // 7: measurement.Measurement.voc_index:type_name -> google.protobuf.FloatValue
+	16, // 8: measurement.Measurement.nox_index:type_name -> google.protobuf.FloatValue
+	16, // 9: measurement.Measurement.hcho:type_name -> google.protobuf.FloatValue
+	16, // 10: measurement.Measurement.co2:type_name -> google.protobuf.FloatValue
+	15, // 11: measurement.Measurement.upload_timestamp:type_name -> google.protobuf.Timestamp
+	14, // 12: measurement.BatchGetLatestResponse.measurements:type_name -> measurement.BatchGetLatestResponse.MeasurementsEntry
+	15, // 13: measurement.ListMeasurementsRequest.start_time:type_name -> google.protobuf.Timestamp
+	15, // 14: measurement.ListMeasurementsRequest.end_time:type_name -> google.protobuf.Timestamp
+	1,  // 15: measurement.ListMeasurementsResponse.measurements:type_name -> measurement.Measurement
+	0,  // 16: measurement.AggregateRequest.resolution:type_name -> measurement.Resolution
+	15, // 17: measurement.AggregateRequest.start_time:type_name -> google.protobuf.Timestamp
+	15, // 18: measurement.AggregateRequest.end_time:type_name -> google.protobuf.Timestamp
+	0,  // 19: measurement.Rollup.resolution:type_name -> measurement.Resolution
+	15, // 20: measurement.Rollup.start_time:type_name -> google.protobuf.Timestamp
+	10, // 21: measurement.AggregateResponse.rollups:type_name -> measurement.Rollup
+	1,  // 22: measurement.IngestRequest.measurements:type_name -> measurement.Measurement
+	1,  // 23: measurement.BatchGetLatestResponse.MeasurementsEntry.value:type_name -> measurement.Measurement
+	17, // 24: measurement.MeasurementService.GetDevices:input_type -> google.protobuf.Empty
+	3,  // 25: measurement.MeasurementService.GetLatest:input_type -> measurement.GetLatestRequest
+	4,  // 26: measurement.MeasurementService.BatchGetLatest:input_type -> measurement.BatchGetLatestRequest
+	6,  // 27: measurement.MeasurementService.ListMeasurements:input_type -> measurement.ListMeasurementsRequest
+	8,  // 28: measurement.MeasurementService.StreamMeasurements:input_type -> measurement.StreamMeasurementsRequest
+	9,  // 29: measurement.MeasurementService.Aggregate:input_type -> measurement.AggregateRequest
+	12, // 30: measurement.MeasurementService.Ingest:input_type -> measurement.IngestRequest
+	2,  // 31: measurement.MeasurementService.GetDevices:output_type -> measurement.GetDevicesResponse
+	1,  // 32: measurement.MeasurementService.GetLatest:output_type -> measurement.Measurement
+	5,  // 33: measurement.MeasurementService.BatchGetLatest:output_type -> measurement.BatchGetLatestResponse
+	7,  // 34: measurement.MeasurementService.ListMeasurements:output_type -> measurement.ListMeasurementsResponse
+	1,  // 35: measurement.MeasurementService.StreamMeasurements:output_type -> measurement.Measurement
+	11, // 36: measurement.MeasurementService.Aggregate:output_type -> measurement.AggregateResponse
+	13, // 37: measurement.MeasurementService.Ingest:output_type -> measurement.IngestResponse
+	31, // [31:38] is the sub-list for method output_type
+	24, // [24:31] is the sub-list for method input_type
+	24, // [24:24] is the sub-list for extension type_name
+	24, // [24:24] is the sub-list for extension extendee
+	0,  // [0:24] is the sub-list for field type_name
 }
 
 func init() { file_measurement_proto_init() }
@@ -339,13 +1123,14 @@ func file_measurement_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_measurement_proto_rawDesc), len(file_measurement_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   3,
+			NumEnums:      1,
+			NumMessages:   14,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_measurement_proto_goTypes,
 		DependencyIndexes: file_measurement_proto_depIdxs,
+		EnumInfos:         file_measurement_proto_enumTypes,
 		MessageInfos:      file_measurement_proto_msgTypes,
 	}.Build()
 	File_measurement_proto = out.File
@@ -20,8 +20,13 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	MeasurementService_GetDevices_FullMethodName = "/measurement.MeasurementService/GetDevices"
-	MeasurementService_GetLatest_FullMethodName  = "/measurement.MeasurementService/GetLatest"
+	MeasurementService_GetDevices_FullMethodName         = "/measurement.MeasurementService/GetDevices"
+	MeasurementService_GetLatest_FullMethodName          = "/measurement.MeasurementService/GetLatest"
+	MeasurementService_BatchGetLatest_FullMethodName     = "/measurement.MeasurementService/BatchGetLatest"
+	MeasurementService_ListMeasurements_FullMethodName   = "/measurement.MeasurementService/ListMeasurements"
+	MeasurementService_StreamMeasurements_FullMethodName = "/measurement.MeasurementService/StreamMeasurements"
+	MeasurementService_Aggregate_FullMethodName          = "/measurement.MeasurementService/Aggregate"
+	MeasurementService_Ingest_FullMethodName             = "/measurement.MeasurementService/Ingest"
 )
 
 // MeasurementServiceClient is the client API for MeasurementService service.
@@ -30,6 +35,17 @@ const (
 type MeasurementServiceClient interface {
 	GetDevices(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*GetDevicesResponse, error)
 	GetLatest(ctx context.Context, in *GetLatestRequest, opts ...grpc.CallOption) (*Measurement, error)
+	// Returns the latest measurement of each of the given devices in one call.
+	BatchGetLatest(ctx context.Context, in *BatchGetLatestRequest, opts ...grpc.CallOption) (*BatchGetLatestResponse, error)
+	// Returns measurements in a time range, in timestamp order, a page at a time.
+	ListMeasurements(ctx context.Context, in *ListMeasurementsRequest, opts ...grpc.CallOption) (*ListMeasurementsResponse, error)
+	// Streams measurements as they're received until the client cancels.
+	StreamMeasurements(ctx context.Context, in *StreamMeasurementsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Measurement], error)
+	// Returns hourly or daily summary statistics of each metric.
+	Aggregate(ctx context.Context, in *AggregateRequest, opts ...grpc.CallOption) (*AggregateResponse, error)
+	// Saves measurements streamed by a device. The device must authenticate
+	// with its X.509 client certificate, and may only send its own measurements.
+	Ingest(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[IngestRequest, IngestResponse], error)
 }
 
 type measurementServiceClient struct {
@@ -60,12 +76,85 @@ func (c *measurementServiceClient) GetLatest(ctx context.Context, in *GetLatestR
 	return out, nil
 }
 
+func (c *measurementServiceClient) BatchGetLatest(ctx context.Context, in *BatchGetLatestRequest, opts ...grpc.CallOption) (*BatchGetLatestResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchGetLatestResponse)
+	err := c.cc.Invoke(ctx, MeasurementService_BatchGetLatest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *measurementServiceClient) ListMeasurements(ctx context.Context, in *ListMeasurementsRequest, opts ...grpc.CallOption) (*ListMeasurementsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListMeasurementsResponse)
+	err := c.cc.Invoke(ctx, MeasurementService_ListMeasurements_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *measurementServiceClient) StreamMeasurements(ctx context.Context, in *StreamMeasurementsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Measurement], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MeasurementService_ServiceDesc.Streams[0], MeasurementService_StreamMeasurements_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamMeasurementsRequest, Measurement]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MeasurementService_StreamMeasurementsClient = grpc.ServerStreamingClient[Measurement]
+
+func (c *measurementServiceClient) Aggregate(ctx context.Context, in *AggregateRequest, opts ...grpc.CallOption) (*AggregateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AggregateResponse)
+	err := c.cc.Invoke(ctx, MeasurementService_Aggregate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *measurementServiceClient) Ingest(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[IngestRequest, IngestResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MeasurementService_ServiceDesc.Streams[1], MeasurementService_Ingest_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[IngestRequest, IngestResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MeasurementService_IngestClient = grpc.ClientStreamingClient[IngestRequest, IngestResponse]
+
 // MeasurementServiceServer is the server API for MeasurementService service.
 // All implementations must embed UnimplementedMeasurementServiceServer
 // for forward compatibility.
 type MeasurementServiceServer interface {
 	GetDevices(context.Context, *emptypb.Empty) (*GetDevicesResponse, error)
 	GetLatest(context.Context, *GetLatestRequest) (*Measurement, error)
+	// Returns the latest measurement of each of the given devices in one call.
+	BatchGetLatest(context.Context, *BatchGetLatestRequest) (*BatchGetLatestResponse, error)
+	// Returns measurements in a time range, in timestamp order, a page at a time.
+	ListMeasurements(context.Context, *ListMeasurementsRequest) (*ListMeasurementsResponse, error)
+	// Streams measurements as they're received until the client cancels.
+	StreamMeasurements(*StreamMeasurementsRequest, grpc.ServerStreamingServer[Measurement]) error
+	// Returns hourly or daily summary statistics of each metric.
+	Aggregate(context.Context, *AggregateRequest) (*AggregateResponse, error)
+	// Saves measurements streamed by a device. The device must authenticate
+	// with its X.509 client certificate, and may only send its own measurements.
+	Ingest(grpc.ClientStreamingServer[IngestRequest, IngestResponse]) error
 	mustEmbedUnimplementedMeasurementServiceServer()
 }
 
@@ -82,6 +171,21 @@ func (UnimplementedMeasurementServiceServer) GetDevices(context.Context, *emptyp
 func (UnimplementedMeasurementServiceServer) GetLatest(context.Context, *GetLatestRequest) (*Measurement, error) {
 	return nil, status.Error(codes.Unimplemented, "method GetLatest not implemented")
 }
+func (UnimplementedMeasurementServiceServer) BatchGetLatest(context.Context, *BatchGetLatestRequest) (*BatchGetLatestResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method BatchGetLatest not implemented")
+}
+func (UnimplementedMeasurementServiceServer) ListMeasurements(context.Context, *ListMeasurementsRequest) (*ListMeasurementsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListMeasurements not implemented")
+}
+func (UnimplementedMeasurementServiceServer) StreamMeasurements(*StreamMeasurementsRequest, grpc.ServerStreamingServer[Measurement]) error {
+	return status.Error(codes.Unimplemented, "method StreamMeasurements not implemented")
+}
+func (UnimplementedMeasurementServiceServer) Aggregate(context.Context, *AggregateRequest) (*AggregateResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Aggregate not implemented")
+}
+func (UnimplementedMeasurementServiceServer) Ingest(grpc.ClientStreamingServer[IngestRequest, IngestResponse]) error {
+	return status.Error(codes.Unimplemented, "method Ingest not implemented")
+}
 func (UnimplementedMeasurementServiceServer) mustEmbedUnimplementedMeasurementServiceServer() {}
 func (UnimplementedMeasurementServiceServer) testEmbeddedByValue()                            {}
 
@@ -139,6 +243,78 @@ func _MeasurementService_GetLatest_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _MeasurementService_BatchGetLatest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetLatestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MeasurementServiceServer).BatchGetLatest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MeasurementService_BatchGetLatest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MeasurementServiceServer).BatchGetLatest(ctx, req.(*BatchGetLatestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MeasurementService_ListMeasurements_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListMeasurementsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MeasurementServiceServer).ListMeasurements(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MeasurementService_ListMeasurements_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MeasurementServiceServer).ListMeasurements(ctx, req.(*ListMeasurementsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MeasurementService_StreamMeasurements_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamMeasurementsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MeasurementServiceServer).StreamMeasurements(m, &grpc.GenericServerStream[StreamMeasurementsRequest, Measurement]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MeasurementService_StreamMeasurementsServer = grpc.ServerStreamingServer[Measurement]
+
+func _MeasurementService_Aggregate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AggregateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MeasurementServiceServer).Aggregate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MeasurementService_Aggregate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MeasurementServiceServer).Aggregate(ctx, req.(*AggregateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MeasurementService_Ingest_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MeasurementServiceServer).Ingest(&grpc.GenericServerStream[IngestRequest, IngestResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MeasurementService_IngestServer = grpc.ClientStreamingServer[IngestRequest, IngestResponse]
+
 // MeasurementService_ServiceDesc is the grpc.ServiceDesc for MeasurementService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -154,7 +330,30 @@ var MeasurementService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetLatest",
 			Handler:    _MeasurementService_GetLatest_Handler,
 		},
+		{
+			MethodName: "BatchGetLatest",
+			Handler:    _MeasurementService_BatchGetLatest_Handler,
+		},
+		{
+			MethodName: "ListMeasurements",
+			Handler:    _MeasurementService_ListMeasurements_Handler,
+		},
+		{
+			MethodName: "Aggregate",
+			Handler:    _MeasurementService_Aggregate_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamMeasurements",
+			Handler:       _MeasurementService_StreamMeasurements_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Ingest",
+			Handler:       _MeasurementService_Ingest_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "measurement.proto",
 }
@@ -3,34 +3,65 @@ package measurementpbutil
 
 import (
 	"fmt"
+	"maps"
+	"math"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 
 	mpb "github.com/mtraver/environmental-sensor/measurementpb"
 	"github.com/mtraver/environmental-sensor/metric"
+	"github.com/mtraver/environmental-sensor/util"
 	wpb "google.golang.org/protobuf/types/known/wrapperspb"
 )
 
+// MaxMessageIDLength is the maximum length of a measurement's message ID, in bytes.
+const MaxMessageIDLength = 128
+
 var (
 	deviceIDRegex = regexp.MustCompile(`^[a-z][a-z0-9+.%~_-]{2,254}$`)
+
+	// minTimestamp is the earliest valid timestamp. Devices that haven't set their clock think
+	// it's 1970.
+	minTimestamp = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
 )
 
-func String(m *mpb.Measurement) string {
-	var timestamp time.Time
-	if m.GetTimestamp() != nil {
-		timestamp = m.GetTimestamp().AsTime()
+// FieldError is a problem with one field of a Measurement.
+type FieldError struct {
+	// Field is the name of the field in measurement.proto, e.g. "upload_timestamp". It's empty
+	// for problems with the Measurement as a whole.
+	Field  string
+	Reason string
+}
+
+func (e FieldError) Error() string {
+	if e.Field == "" {
+		return e.Reason
 	}
+	return e.Field + ": " + e.Reason
+}
 
-	delay := ""
-	if m.GetUploadTimestamp() != nil {
-		uploadts := m.GetUploadTimestamp().AsTime()
+// ValidationError lists the problems with a Measurement.
+type ValidationError []FieldError
 
-		delay = fmt.Sprintf("(%v upload delay)", uploadts.Sub(timestamp))
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
 	}
+	return "measurementpbutil: invalid measurement: " + strings.Join(msgs, "; ")
+}
+
+// NewMessageID returns a new random message ID for a measurement.
+func NewMessageID() (string, error) {
+	return util.NewID()
+}
 
-	values := map[metric.Key]*wpb.FloatValue{
+// values returns the value of each metric in m, keyed by metric. Values that aren't set are nil.
+func values(m *mpb.Measurement) map[metric.Key]*wpb.FloatValue {
+	return map[metric.Key]*wpb.FloatValue{
 		metric.Temp:     m.GetTemp(),
 		metric.PM1:      m.GetPm1(),
 		metric.PM25:     m.GetPm25(),
@@ -42,15 +73,48 @@ func String(m *mpb.Measurement) string {
 		metric.HCHO:     m.GetHcho(),
 		metric.CO2:      m.GetCo2(),
 	}
+}
+
+// fieldNames are the names in measurement.proto of the fields that hold each metric.
+var fieldNames = map[metric.Key]string{
+	metric.Temp:     "temp",
+	metric.PM1:      "pm1",
+	metric.PM25:     "pm25",
+	metric.PM4:      "pm4",
+	metric.PM10:     "pm10",
+	metric.RH:       "rh",
+	metric.VOCIndex: "voc_index",
+	metric.NOxIndex: "nox_index",
+	metric.HCHO:     "hcho",
+	metric.CO2:      "co2",
+}
+
+func String(m *mpb.Measurement) string {
+	return Format(m, nil)
+}
+
+// Format is like String but gives values in the units preferred by p.
+func Format(m *mpb.Measurement, p metric.Preferences) string {
+	var timestamp time.Time
+	if m.GetTimestamp() != nil {
+		timestamp = m.GetTimestamp().AsTime()
+	}
+
+	delay := ""
+	if m.GetUploadTimestamp() != nil {
+		uploadts := m.GetUploadTimestamp().AsTime()
+
+		delay = fmt.Sprintf("(%v upload delay)", uploadts.Sub(timestamp))
+	}
 
 	var valueStrs []string
-	for key, v := range values {
+	for key, v := range values(m) {
 		if v == nil {
 			continue
 		}
 
-		info := metric.All[key]
-		valueStrs = append(valueStrs, fmt.Sprintf("%s=%.3f%s", info.Name, v.GetValue(), info.Unit))
+		value, unit := p.Convert(key, v.GetValue())
+		valueStrs = append(valueStrs, fmt.Sprintf("%s=%.3f%s", metric.All[key].Name, value, unit))
 	}
 	sort.Strings(valueStrs)
 
@@ -72,15 +136,65 @@ func String(m *mpb.Measurement) string {
 	return strings.Join(elements[:n], " ")
 }
 
-// Validate validates each field of the Measurement.
+// Validate validates each field of the Measurement. If any are invalid it returns a
+// ValidationError listing all of the problems.
 func Validate(m *mpb.Measurement) error {
+	var errs ValidationError
+	add := func(field, format string, a ...any) {
+		errs = append(errs, FieldError{Field: field, Reason: fmt.Sprintf(format, a...)})
+	}
+
 	if m.GetDeviceId() == "" {
-		return fmt.Errorf("measurementpbutil: device_id is required")
+		add("device_id", "is required")
+	} else if !deviceIDRegex.MatchString(m.GetDeviceId()) {
+		add("device_id", "%q is not a valid device ID", m.GetDeviceId())
+	}
+
+	if len(m.GetMessageId()) > MaxMessageIDLength {
+		add("message_id", "is longer than %d bytes", MaxMessageIDLength)
+	}
+
+	var timestamp time.Time
+	if m.GetTimestamp() == nil {
+		add("timestamp", "is required")
+	} else if err := m.GetTimestamp().CheckValid(); err != nil {
+		add("timestamp", "%v", err)
+	} else if timestamp = m.GetTimestamp().AsTime(); timestamp.Before(minTimestamp) {
+		add("timestamp", "%s is before %s, so the device's clock is probably not set",
+			timestamp.Format(time.RFC3339), minTimestamp.Format(time.RFC3339))
 	}
 
-	if !deviceIDRegex.MatchString(m.GetDeviceId()) {
-		return fmt.Errorf("measurementpbutil: device_id failed validation: %q", m.GetDeviceId())
+	if m.GetUploadTimestamp() != nil {
+		if err := m.GetUploadTimestamp().CheckValid(); err != nil {
+			add("upload_timestamp", "%v", err)
+		} else if upload := m.GetUploadTimestamp().AsTime(); !timestamp.IsZero() && upload.Before(timestamp) {
+			add("upload_timestamp", "%s is before timestamp %s",
+				upload.Format(time.RFC3339), timestamp.Format(time.RFC3339))
+		}
 	}
 
+	vals := values(m)
+	present := 0
+	for _, k := range slices.Sorted(maps.Keys(fieldNames)) {
+		v := vals[k]
+		if v == nil {
+			continue
+		}
+		present++
+
+		info := metric.All[k]
+		if f := float64(v.GetValue()); math.IsNaN(f) || math.IsInf(f, 0) {
+			add(fieldNames[k], "%v is not a finite number", f)
+		} else if !info.InRange(v.GetValue()) {
+			add(fieldNames[k], "%v%s is outside the range [%v, %v]", v.GetValue(), info.Unit, info.Min, info.Max)
+		}
+	}
+	if present == 0 {
+		add("", "no metrics are set")
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
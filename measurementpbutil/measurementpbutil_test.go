@@ -1,10 +1,17 @@
 package measurementpbutil
 
 import (
+	"errors"
+	"math"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/metric"
 	"github.com/mtraver/environmental-sensor/testutil"
+	tspb "google.golang.org/protobuf/types/known/timestamppb"
 	wpb "google.golang.org/protobuf/types/known/wrapperspb"
 )
 
@@ -46,6 +53,109 @@ func TestValidate(t *testing.T) {
 	}
 }
 
+func TestValidateMessageID(t *testing.T) {
+	id, err := NewMessageID()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	m := getMeasurement(t, "foo")
+	m.MessageId = id
+	if err := Validate(m); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	m.MessageId = strings.Repeat("a", MaxMessageIDLength+1)
+	if err := Validate(m); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+func TestValidateFields(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(m *mpb.Measurement)
+		want   ValidationError
+	}{
+		{
+			name:   "valid",
+			modify: func(m *mpb.Measurement) {},
+		},
+		{
+			name:   "no_timestamp",
+			modify: func(m *mpb.Measurement) { m.Timestamp = nil },
+			want:   ValidationError{{"timestamp", "is required"}},
+		},
+		{
+			name:   "zero_timestamp",
+			modify: func(m *mpb.Measurement) { m.Timestamp = &tspb.Timestamp{} },
+			want:   ValidationError{{"timestamp", "1970-01-01T00:00:00Z is before 2000-01-01T00:00:00Z, so the device's clock is probably not set"}},
+		},
+		{
+			name: "upload_before_timestamp",
+			modify: func(m *mpb.Measurement) {
+				m.UploadTimestamp = tspb.New(testutil.Timestamp.Add(-time.Second))
+			},
+			want: ValidationError{{"upload_timestamp", "2018-03-24T23:59:59Z is before timestamp 2018-03-25T00:00:00Z"}},
+		},
+		{
+			name: "upload_after_timestamp",
+			modify: func(m *mpb.Measurement) {
+				m.UploadTimestamp = tspb.New(testutil.Timestamp.Add(time.Second))
+			},
+		},
+		{
+			name:   "nan",
+			modify: func(m *mpb.Measurement) { m.Temp = wpb.Float(float32(math.NaN())) },
+			want:   ValidationError{{"temp", "NaN is not a finite number"}},
+		},
+		{
+			name: "out_of_range",
+			modify: func(m *mpb.Measurement) {
+				m.Temp = wpb.Float(5000)
+				m.Co2 = wpb.Float(-1)
+			},
+			want: ValidationError{
+				{"co2", "-1ppm is outside the range [0, 40000]"},
+				{"temp", "5000°C is outside the range [-100, 150]"},
+			},
+		},
+		{
+			name:   "no_metrics",
+			modify: func(m *mpb.Measurement) { m.Temp = nil },
+			want:   ValidationError{{"", "no metrics are set"}},
+		},
+		{
+			name: "many",
+			modify: func(m *mpb.Measurement) {
+				m.DeviceId = ""
+				m.Timestamp = nil
+				m.Temp = nil
+			},
+			want: ValidationError{
+				{"device_id", "is required"},
+				{"timestamp", "is required"},
+				{"", "no metrics are set"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := getMeasurement(t, "foo")
+			c.modify(m)
+
+			var got ValidationError
+			if err := Validate(m); err != nil && !errors.As(err, &got) {
+				t.Fatalf("got error of type %T, want ValidationError", err)
+			}
+			if diff := cmp.Diff(c.want, got); diff != "" {
+				t.Errorf("Unexpected errors (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestString(t *testing.T) {
 	cases := []struct {
 		name string
@@ -112,3 +222,18 @@ func TestString(t *testing.T) {
 		})
 	}
 }
+
+func TestFormat(t *testing.T) {
+	m := &mpb.Measurement{
+		DeviceId:  "foo",
+		Timestamp: testutil.TimestampProto,
+		Temp:      wpb.Float(20.0),
+		Co2:       wpb.Float(1000.0),
+		Pm25:      wpb.Float(12.0),
+	}
+
+	want := "foo CO₂=1800.000mg/m³, PM2.5=12.000μg/m³, temp=68.000°F 2018-03-25T00:00:00Z"
+	if got := Format(m, metric.Preferences{metric.Fahrenheit, metric.MilligramsPerCubicMeter}); got != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+}
@@ -13,7 +13,14 @@ const (
 	NOxIndex Key = "noxIndex"
 	HCHO     Key = "hcho"
 	CO2      Key = "co2"
-	AQI      Key = "aqi"
+
+	// Derived metrics, which are computed from the metrics above.
+	AQI         Key = "aqi"
+	DewPoint    Key = "dewPoint"
+	HeatIndex   Key = "heatIndex"
+	Humidex     Key = "humidex"
+	AbsHumidity Key = "absHumidity"
+	VPD         Key = "vpd"
 )
 
 type Info struct {
@@ -22,47 +29,130 @@ type Info struct {
 
 	// The metric's unit, e.g. "μg/m³".
 	Unit string
+
+	// Units are the units that the metric's values can be given in, if there's more than one.
+	// The first is the unit they're stored in, whose symbol is Unit.
+	Units []Unit
+
+	// Inputs are the metrics that a derived metric is computed from. It's empty for metrics
+	// that are reported by sensors.
+	Inputs []Key
+
+	// Min and Max bound the values that sensors can plausibly report, in the unit they're stored
+	// in. They're unset for derived metrics.
+	Min, Max float32
+}
+
+// InRange reports whether v is within the metric's range. Every value is in range if the range
+// is unset.
+func (i Info) InRange(v float32) bool {
+	if i.Min == 0 && i.Max == 0 {
+		return true
+	}
+	return v >= i.Min && v <= i.Max
+}
+
+// Derived reports whether the metric is computed from other metrics rather than reported by
+// sensors.
+func (k Key) Derived() bool {
+	return len(All[k].Inputs) > 0
 }
 
 var All = map[Key]Info{
 	Temp: {
-		Name: "temp",
-		Unit: "°C",
+		Name:  "temp",
+		Unit:  "°C",
+		Units: []Unit{Celsius, Fahrenheit, Kelvin},
+		Min:   -100,
+		Max:   150,
 	},
 	PM1: {
 		Name: "PM1.0",
 		Unit: "μg/m³",
+		Min:  0,
+		Max:  1000,
 	},
 	PM25: {
 		Name: "PM2.5",
 		Unit: "μg/m³",
+		Min:  0,
+		Max:  1000,
 	},
 	PM4: {
 		Name: "PM4",
 		Unit: "μg/m³",
+		Min:  0,
+		Max:  1000,
 	},
 	PM10: {
 		Name: "PM10",
 		Unit: "μg/m³",
+		Min:  0,
+		Max:  1000,
 	},
 	RH: {
 		Name: "RH",
 		Unit: "%",
+		Min:  0,
+		Max:  100,
 	},
 	VOCIndex: {
 		Name: "VOCIndex",
 		Unit: "",
+		Min:  0,
+		Max:  500,
 	},
 	NOxIndex: {
 		Name: "NOₓIndex",
 		Unit: "",
+		Min:  0,
+		Max:  500,
 	},
 	HCHO: {
-		Name: "HCHO",
-		Unit: "ppb",
+		Name:  "HCHO",
+		Unit:  "ppb",
+		Units: []Unit{PPB, MicrogramsPerCubicMeter},
+		Min:   0,
+		Max:   5000,
 	},
 	CO2: {
-		Name: "CO₂",
-		Unit: "ppm",
+		Name:  "CO₂",
+		Unit:  "ppm",
+		Units: []Unit{PPM, MilligramsPerCubicMeter},
+		Min:   0,
+		Max:   40000,
+	},
+	AQI: {
+		Name: "AQI",
+		Unit: "",
+		// The AQI only needs one of its inputs.
+		Inputs: []Key{PM25, PM10},
+	},
+	DewPoint: {
+		Name:   "DewPoint",
+		Unit:   "°C",
+		Units:  []Unit{Celsius, Fahrenheit, Kelvin},
+		Inputs: []Key{Temp, RH},
+	},
+	HeatIndex: {
+		Name:   "HeatIndex",
+		Unit:   "°C",
+		Units:  []Unit{Celsius, Fahrenheit, Kelvin},
+		Inputs: []Key{Temp, RH},
+	},
+	Humidex: {
+		Name:   "Humidex",
+		Unit:   "",
+		Inputs: []Key{Temp, RH},
+	},
+	AbsHumidity: {
+		Name:   "AbsHumidity",
+		Unit:   "g/m³",
+		Inputs: []Key{Temp, RH},
+	},
+	VPD: {
+		Name:   "VPD",
+		Unit:   "kPa",
+		Inputs: []Key{Temp, RH},
 	},
 }
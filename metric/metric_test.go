@@ -0,0 +1,27 @@
+package metric
+
+import "testing"
+
+func TestInRange(t *testing.T) {
+	cases := []struct {
+		key  Key
+		v    float32
+		want bool
+	}{
+		{Temp, 20, true},
+		{Temp, -100, true},
+		{Temp, 5000, false},
+		{RH, 100, true},
+		{RH, 100.5, false},
+		{CO2, -1, false},
+		{CO2, 0, true},
+		// Derived metrics have no range.
+		{AQI, 5000, true},
+	}
+
+	for _, c := range cases {
+		if got := All[c.key].InRange(c.v); got != c.want {
+			t.Errorf("%s.InRange(%v) = %v, want %v", c.key, c.v, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package metric
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Unit identifies a unit that a metric's values can be given in.
+type Unit string
+
+const (
+	Celsius    Unit = "celsius"
+	Fahrenheit Unit = "fahrenheit"
+	Kelvin     Unit = "kelvin"
+
+	PPM                     Unit = "ppm"
+	PPB                     Unit = "ppb"
+	MilligramsPerCubicMeter Unit = "mg_per_m3"
+	MicrogramsPerCubicMeter Unit = "ug_per_m3"
+)
+
+var symbols = map[Unit]string{
+	Celsius:                 "°C",
+	Fahrenheit:              "°F",
+	Kelvin:                  "K",
+	PPM:                     "ppm",
+	PPB:                     "ppb",
+	MilligramsPerCubicMeter: "mg/m³",
+	MicrogramsPerCubicMeter: "μg/m³",
+}
+
+// Symbol returns the unit's symbol, e.g. "°F".
+func (u Unit) Symbol() string {
+	return symbols[u]
+}
+
+// molarVolume is the volume in liters of a mole of gas at 25 °C and 1 atm, the conditions under
+// which mixing ratios are conventionally converted to mass concentrations.
+const molarVolume = 24.45
+
+// molarMass is the molar mass in g/mol of each gas whose mixing ratio we measure.
+var molarMass = map[Key]float64{
+	CO2:  44.01,
+	HCHO: 30.031,
+}
+
+// fromBase converts a value of the given metric from the unit it's stored in to each unit.
+// Mass concentrations are converted from mixing ratios of the same scale: mg/m³ from ppm and
+// μg/m³ from ppb.
+var fromBase = map[Unit]func(k Key, v float64) float64{
+	Celsius:                 func(_ Key, c float64) float64 { return c },
+	Fahrenheit:              func(_ Key, c float64) float64 { return c*9/5 + 32 },
+	Kelvin:                  func(_ Key, c float64) float64 { return c + 273.15 },
+	PPM:                     func(_ Key, v float64) float64 { return v },
+	PPB:                     func(_ Key, v float64) float64 { return v },
+	MilligramsPerCubicMeter: func(k Key, ppm float64) float64 { return ppm * molarMass[k] / molarVolume },
+	MicrogramsPerCubicMeter: func(k Key, ppb float64) float64 { return ppb * molarMass[k] / molarVolume },
+}
+
+// Convert converts v, a value of k in the unit it's stored in, to u. It returns an error if k
+// can't be given in u.
+func Convert(k Key, v float32, u Unit) (float32, error) {
+	if !slices.Contains(All[k].Units, u) {
+		return 0, fmt.Errorf("metric: %s can't be given in %q", k, u)
+	}
+	return float32(fromBase[u](k, float64(v))), nil
+}
+
+// Preferences are the units that a user prefers. Each metric is given in the first preferred
+// unit that it can be given in, or in the unit it's stored in if there's none.
+type Preferences []Unit
+
+// ParsePreferences parses a comma-separated list of units, e.g. "fahrenheit,mg_per_m3".
+func ParsePreferences(s string) (Preferences, error) {
+	var p Preferences
+	for _, id := range strings.Split(s, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+
+		u := Unit(id)
+		if _, ok := symbols[u]; !ok {
+			return nil, fmt.Errorf("metric: unknown unit %q", id)
+		}
+		p = append(p, u)
+	}
+
+	return p, nil
+}
+
+func (p Preferences) String() string {
+	ids := make([]string, len(p))
+	for i, u := range p {
+		ids[i] = string(u)
+	}
+	return strings.Join(ids, ",")
+}
+
+// UnitFor returns the unit that values of k should be given in. It's empty if k can only be
+// given in the unit it's stored in.
+func (p Preferences) UnitFor(k Key) Unit {
+	units := All[k].Units
+	for _, u := range p {
+		if slices.Contains(units, u) {
+			return u
+		}
+	}
+
+	if len(units) == 0 {
+		return ""
+	}
+	return units[0]
+}
+
+// Convert converts v, a value of k in the unit it's stored in, to the preferred unit. It returns
+// the converted value and the symbol of its unit.
+func (p Preferences) Convert(k Key, v float32) (float32, string) {
+	u := p.UnitFor(k)
+	if u == "" {
+		return v, All[k].Unit
+	}
+
+	converted, _ := Convert(k, v, u)
+	return converted, u.Symbol()
+}
@@ -0,0 +1,121 @@
+package metric
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConvert(t *testing.T) {
+	cases := []struct {
+		key  Key
+		v    float32
+		unit Unit
+		want float32
+	}{
+		{Temp, 20, Celsius, 20},
+		{Temp, 20, Fahrenheit, 68},
+		{Temp, -40, Fahrenheit, -40},
+		{Temp, 20, Kelvin, 293.15},
+		{DewPoint, 0, Fahrenheit, 32},
+		{CO2, 1000, PPM, 1000},
+		{CO2, 1000, MilligramsPerCubicMeter, 1800.0},
+		{HCHO, 100, MicrogramsPerCubicMeter, 122.83},
+	}
+
+	for _, c := range cases {
+		got, err := Convert(c.key, c.v, c.unit)
+		if err != nil {
+			t.Errorf("Convert(%s, %v, %s): unexpected error: %v", c.key, c.v, c.unit, err)
+			continue
+		}
+		if math.Abs(float64(got-c.want)) > 0.01 {
+			t.Errorf("Convert(%s, %v, %s) = %v, want %v", c.key, c.v, c.unit, got, c.want)
+		}
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	cases := []struct {
+		key  Key
+		unit Unit
+	}{
+		{Temp, PPM},
+		{CO2, MicrogramsPerCubicMeter},
+		{PM25, MicrogramsPerCubicMeter},
+		{Humidex, Fahrenheit},
+		{Temp, "rankine"},
+	}
+
+	for _, c := range cases {
+		if _, err := Convert(c.key, 1, c.unit); err == nil {
+			t.Errorf("Convert(%s, 1, %q): expected error, got nil", c.key, c.unit)
+		}
+	}
+}
+
+func TestParsePreferences(t *testing.T) {
+	cases := []struct {
+		s       string
+		want    Preferences
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"fahrenheit", Preferences{Fahrenheit}, false},
+		{" fahrenheit, mg_per_m3 ,", Preferences{Fahrenheit, MilligramsPerCubicMeter}, false},
+		{"fahrenheit,furlongs", nil, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParsePreferences(c.s)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("ParsePreferences(%q): expected error, got nil", c.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePreferences(%q): unexpected error: %v", c.s, err)
+			continue
+		}
+		if diff := cmp.Diff(c.want, got); diff != "" {
+			t.Errorf("ParsePreferences(%q): unexpected result (-want +got):\n%s", c.s, diff)
+		}
+	}
+}
+
+func TestPreferencesUnitFor(t *testing.T) {
+	p := Preferences{MicrogramsPerCubicMeter, Kelvin, Fahrenheit}
+
+	cases := []struct {
+		key  Key
+		want Unit
+	}{
+		// The first preferred unit that the metric can be given in wins.
+		{Temp, Kelvin},
+		{HeatIndex, Kelvin},
+		{HCHO, MicrogramsPerCubicMeter},
+		// CO₂ can't be given in any of the preferred units.
+		{CO2, PPM},
+		// PM2.5 has only one unit.
+		{PM25, ""},
+	}
+
+	for _, c := range cases {
+		if got := p.UnitFor(c.key); got != c.want {
+			t.Errorf("UnitFor(%s) = %q, want %q", c.key, got, c.want)
+		}
+	}
+}
+
+func TestPreferencesConvert(t *testing.T) {
+	p := Preferences{Fahrenheit}
+
+	if v, sym := p.Convert(Temp, 100); v != 212 || sym != "°F" {
+		t.Errorf("Convert(temp, 100) = %v %q, want 212 %q", v, sym, "°F")
+	}
+	if v, sym := p.Convert(PM25, 12.5); v != 12.5 || sym != "μg/m³" {
+		t.Errorf("Convert(pm25, 12.5) = %v %q, want 12.5 %q", v, sym, "μg/m³")
+	}
+}
@@ -0,0 +1,101 @@
+// Package quarantine keeps telemetry that was rejected during ingestion, e.g. because it
+// couldn't be decoded or failed validation, so that it can be examined and reprocessed once
+// whatever rejected it is fixed.
+package quarantine
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/util"
+)
+
+// ErrNotFound is returned by Store methods when there's no matching entry.
+var ErrNotFound = errors.New("quarantine: not found")
+
+// Attribute is a message attribute, e.g. the Pub/Sub attribute "source".
+type Attribute struct {
+	Key   string `datastore:"key,noindex"`
+	Value string `datastore:"value,noindex"`
+}
+
+// Entry is a rejected message.
+type Entry struct {
+	// ID identifies the entry. It's assigned when the entry is stored.
+	ID string `datastore:"-"`
+
+	// Received is when the message was received.
+	Received time.Time `datastore:"received"`
+
+	// Reason is why the message was rejected.
+	Reason string `datastore:"reason,noindex"`
+
+	// DeviceID is the ID of the device that sent the message, if it could be decoded.
+	DeviceID string `datastore:"device_id"`
+
+	// MessageID is the ID given to the message by whatever delivered it, e.g. Pub/Sub.
+	MessageID string `datastore:"message_id,noindex"`
+
+	Attributes []Attribute `datastore:"attributes,noindex"`
+
+	// Payload is the message as it was received.
+	Payload []byte `datastore:"payload,noindex"`
+}
+
+// Attribute returns the value of the message attribute with the given key. It's empty if the
+// message didn't have one.
+func (e Entry) Attribute(key string) string {
+	for _, a := range e.Attributes {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// NewAttributes converts a map of message attributes, sorted by key.
+func NewAttributes(m map[string]string) []Attribute {
+	attrs := make([]Attribute, 0, len(m))
+	for k, v := range m {
+		attrs = append(attrs, Attribute{Key: k, Value: v})
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+	return attrs
+}
+
+// Store stores quarantined messages.
+type Store interface {
+	// Quarantined gets the entry with the given ID. It returns ErrNotFound if there's none.
+	Quarantined(ctx context.Context, id string) (Entry, error)
+
+	// RecentlyQuarantined gets up to limit entries, most recently received first.
+	RecentlyQuarantined(ctx context.Context, limit int) ([]Entry, error)
+
+	// PutQuarantined stores e, assigning it an ID if it doesn't have one. It returns the stored
+	// entry.
+	PutQuarantined(ctx context.Context, e Entry) (Entry, error)
+
+	// DeleteQuarantined deletes the entry with the given ID. It returns ErrNotFound if there's
+	// none.
+	DeleteQuarantined(ctx context.Context, id string) error
+}
+
+// PrepareEntry readies e to be stored, assigning it an ID if it doesn't have one. Store
+// implementations call it from PutQuarantined.
+func PrepareEntry(e Entry) (Entry, error) {
+	if e.Received.IsZero() {
+		return e, errors.New("quarantine: received time must be set")
+	}
+
+	if e.ID == "" {
+		id, err := util.NewID()
+		if err != nil {
+			return e, err
+		}
+		e.ID = id
+	}
+
+	return e, nil
+}
@@ -0,0 +1,25 @@
+package quarantine
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewAttributes(t *testing.T) {
+	got := NewAttributes(map[string]string{"source": "AWS", "device": "foo"})
+	want := []Attribute{{"device", "foo"}, {"source", "AWS"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected attributes (-want +got):\n%s", diff)
+	}
+}
+
+func TestEntryAttribute(t *testing.T) {
+	e := Entry{Attributes: NewAttributes(map[string]string{"source": "AWS", "device": "foo"})}
+	if got := e.Attribute("source"); got != "AWS" {
+		t.Errorf("got %q, want %q", got, "AWS")
+	}
+	if got := e.Attribute("spam"); got != "" {
+		t.Errorf("got %q, want the empty string", got)
+	}
+}
@@ -0,0 +1,260 @@
+// Package rollup computes hourly and daily summary statistics (min, max, mean, and count)
+// of measurements, per device and metric.
+package rollup
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/measurement"
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+// Used for separating substrings in database keys. The octothorpe is fine for this because
+// device IDs, metric keys, and timestamps can't contain it.
+const keySep = "#"
+
+type Resolution string
+
+const (
+	Hourly Resolution = "hourly"
+	Daily  Resolution = "daily"
+)
+
+// Resolutions contains every supported Resolution, finest first.
+var Resolutions = []Resolution{Hourly, Daily}
+
+// Duration returns the width of a bucket of the given resolution.
+func (r Resolution) Duration() time.Duration {
+	switch r {
+	case Hourly:
+		return time.Hour
+	case Daily:
+		return 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// Truncate returns the start of the bucket of the given resolution that contains t.
+// Buckets are aligned to UTC.
+func (r Resolution) Truncate(t time.Time) time.Time {
+	t = t.UTC()
+	switch r {
+	case Hourly:
+		return t.Truncate(time.Hour)
+	case Daily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	default:
+		return t
+	}
+}
+
+// Valid reports whether r is a supported resolution.
+func (r Resolution) Valid() bool {
+	return r.Duration() != 0
+}
+
+// Bucket holds summary statistics for the values of one metric reported by one device
+// during one time interval. The interval is [Start, Start + Resolution.Duration()).
+type Bucket struct {
+	DeviceID   string     `datastore:"device_id"`
+	Metric     metric.Key `datastore:"metric"`
+	Resolution Resolution `datastore:"resolution"`
+	Start      time.Time  `datastore:"start"`
+
+	Min   float32 `datastore:"min,noindex"`
+	Max   float32 `datastore:"max,noindex"`
+	Sum   float64 `datastore:"sum,noindex"`
+	Count int64   `datastore:"count,noindex"`
+
+	// LateCount is the number of values that were uploaded some time after they were
+	// measured (i.e. measurements with an upload timestamp). It's informational only;
+	// late values are counted in the bucket that contains their measurement timestamp,
+	// not their upload timestamp.
+	LateCount int64 `datastore:"late_count,noindex"`
+}
+
+// NewBucket returns an empty Bucket of the given resolution that contains t.
+func NewBucket(deviceID string, key metric.Key, res Resolution, t time.Time) Bucket {
+	return Bucket{
+		DeviceID:   deviceID,
+		Metric:     key,
+		Resolution: res,
+		Start:      res.Truncate(t),
+	}
+}
+
+// DBKey returns a string key suitable for Datastore. Two values for the same device,
+// metric, and resolution that fall in the same interval will have the same key.
+func (b *Bucket) DBKey() string {
+	return strings.Join([]string{b.DeviceID, string(b.Resolution), string(b.Metric), b.Start.Format(time.RFC3339)}, keySep)
+}
+
+// Add adds a single value to the bucket. late should be true if the value was uploaded
+// some time after it was measured.
+func (b *Bucket) Add(v float32, late bool) {
+	if b.Count == 0 || v < b.Min {
+		b.Min = v
+	}
+	if b.Count == 0 || v > b.Max {
+		b.Max = v
+	}
+	b.Sum += float64(v)
+	b.Count++
+
+	if late {
+		b.LateCount++
+	}
+}
+
+// Merge adds the values summarized by o to b. It's the caller's responsibility to make
+// sure that the two buckets cover the same device, metric, and interval.
+func (b *Bucket) Merge(o Bucket) {
+	if o.Count == 0 {
+		return
+	}
+
+	if b.Count == 0 || o.Min < b.Min {
+		b.Min = o.Min
+	}
+	if b.Count == 0 || o.Max > b.Max {
+		b.Max = o.Max
+	}
+	b.Sum += o.Sum
+	b.Count += o.Count
+	b.LateCount += o.LateCount
+}
+
+// Mean returns the mean of the values in the bucket, or NaN if the bucket is empty.
+func (b Bucket) Mean() float32 {
+	if b.Count == 0 {
+		return float32(math.NaN())
+	}
+
+	return float32(b.Sum / float64(b.Count))
+}
+
+func (b Bucket) String() string {
+	return fmt.Sprintf("%s %s %s %s min=%.3f max=%.3f mean=%.3f count=%d",
+		b.DeviceID, b.Resolution, b.Metric, b.Start.Format(time.RFC3339), b.Min, b.Max, b.Mean(), b.Count)
+}
+
+// FromMeasurement returns one single-value Bucket for each resolution and each metric
+// present in sm. The buckets are chosen by the measurement's timestamp so that late
+// arrivals land in the interval in which they were measured.
+func FromMeasurement(sm measurement.StorableMeasurement) []Bucket {
+	late := !sm.UploadTimestamp.IsZero()
+
+	var buckets []Bucket
+	for _, res := range Resolutions {
+		for k, v := range sm.ValueMap() {
+			if v == nil {
+				continue
+			}
+
+			b := NewBucket(sm.DeviceID, k, res, sm.Timestamp)
+			b.Add(*v, late)
+			buckets = append(buckets, b)
+		}
+	}
+
+	sortBuckets(buckets)
+	return buckets
+}
+
+// Compute summarizes the given measurements into buckets of the given resolution.
+// The result is sorted by device ID, start time, then metric.
+func Compute(sms []measurement.StorableMeasurement, res Resolution) []Bucket {
+	byKey := make(map[string]*Bucket)
+	for _, sm := range sms {
+		late := !sm.UploadTimestamp.IsZero()
+
+		for k, v := range sm.ValueMap() {
+			if v == nil {
+				continue
+			}
+
+			b := NewBucket(sm.DeviceID, k, res, sm.Timestamp)
+			if existing, ok := byKey[b.DBKey()]; ok {
+				existing.Add(*v, late)
+				continue
+			}
+
+			b.Add(*v, late)
+			byKey[b.DBKey()] = &b
+		}
+	}
+
+	buckets := make([]Bucket, 0, len(byKey))
+	for _, b := range byKey {
+		buckets = append(buckets, *b)
+	}
+
+	sortBuckets(buckets)
+	return buckets
+}
+
+// ToMeasurements converts buckets into measurements, one per device and interval, whose
+// values are the bucket means. The measurement timestamp is the start of the interval.
+// This lets callers that only understand measurements (e.g. charts) consume rollups.
+func ToMeasurements(buckets []Bucket) []measurement.StorableMeasurement {
+	type groupKey struct {
+		deviceID string
+		start    time.Time
+	}
+
+	groups := make(map[groupKey]*measurement.StorableMeasurement)
+	var order []groupKey
+	for _, b := range buckets {
+		if b.Count == 0 {
+			continue
+		}
+
+		gk := groupKey{b.DeviceID, b.Start}
+		sm, ok := groups[gk]
+		if !ok {
+			sm = &measurement.StorableMeasurement{
+				DeviceID:  b.DeviceID,
+				Timestamp: b.Start,
+			}
+			groups[gk] = sm
+			order = append(order, gk)
+		}
+
+		sm.SetValue(b.Metric, b.Mean())
+	}
+
+	sms := make([]measurement.StorableMeasurement, 0, len(order))
+	for _, gk := range order {
+		sms = append(sms, *groups[gk])
+	}
+
+	sort.SliceStable(sms, func(i, j int) bool {
+		if sms[i].DeviceID != sms[j].DeviceID {
+			return sms[i].DeviceID < sms[j].DeviceID
+		}
+		return sms[i].Timestamp.Before(sms[j].Timestamp)
+	})
+
+	return sms
+}
+
+func sortBuckets(buckets []Bucket) {
+	sort.Slice(buckets, func(i, j int) bool {
+		a, b := buckets[i], buckets[j]
+		if a.DeviceID != b.DeviceID {
+			return a.DeviceID < b.DeviceID
+		}
+		if a.Resolution != b.Resolution {
+			return a.Resolution.Duration() < b.Resolution.Duration()
+		}
+		if !a.Start.Equal(b.Start) {
+			return a.Start.Before(b.Start)
+		}
+		return a.Metric < b.Metric
+	})
+}
@@ -0,0 +1,173 @@
+package rollup
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/mtraver/environmental-sensor/measurement"
+	"github.com/mtraver/environmental-sensor/metric"
+	"github.com/mtraver/environmental-sensor/testutil"
+)
+
+var cmpFloats = cmpopts.EquateApprox(0, 0.0001)
+
+func floatPtr(f float32) *float32 {
+	return &f
+}
+
+func TestResolutionTruncate(t *testing.T) {
+	ts := time.Date(2018, time.March, 25, 14, 40, 12, 0, time.UTC)
+
+	cases := []struct {
+		name string
+		res  Resolution
+		t    time.Time
+		want time.Time
+	}{
+		{"hourly", Hourly, ts, time.Date(2018, time.March, 25, 14, 0, 0, 0, time.UTC)},
+		{"daily", Daily, ts, time.Date(2018, time.March, 25, 0, 0, 0, 0, time.UTC)},
+		{"daily_non_utc", Daily, time.Date(2018, time.March, 25, 22, 0, 0, 0, time.FixedZone("PDT", -7*60*60)), time.Date(2018, time.March, 26, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.res.Truncate(c.t); !got.Equal(c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestBucketDBKey(t *testing.T) {
+	b := NewBucket("foo", metric.Temp, Hourly, testutil.Timestamp2)
+
+	want := "foo#hourly#temp#2018-03-25T14:00:00Z"
+	if got := b.DBKey(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestBucketAddAndMerge(t *testing.T) {
+	a := NewBucket("foo", metric.Temp, Hourly, testutil.Timestamp)
+	a.Add(18.0, false)
+	a.Add(20.0, false)
+
+	b := NewBucket("foo", metric.Temp, Hourly, testutil.Timestamp)
+	b.Add(-3.0, true)
+
+	a.Merge(b)
+	a.Merge(NewBucket("foo", metric.Temp, Hourly, testutil.Timestamp))
+
+	want := Bucket{
+		DeviceID:   "foo",
+		Metric:     metric.Temp,
+		Resolution: Hourly,
+		Start:      testutil.Timestamp,
+		Min:        -3.0,
+		Max:        20.0,
+		Sum:        35.0,
+		Count:      3,
+		LateCount:  1,
+	}
+	if diff := cmp.Diff(a, want, cmpFloats); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+
+	if got := a.Mean(); math.Abs(float64(got)-35.0/3) > 0.0001 {
+		t.Errorf("got mean %v, want %v", got, 35.0/3)
+	}
+}
+
+func TestBucketMeanEmpty(t *testing.T) {
+	if got := NewBucket("foo", metric.Temp, Hourly, testutil.Timestamp).Mean(); !math.IsNaN(float64(got)) {
+		t.Errorf("got %v, want NaN", got)
+	}
+}
+
+func TestFromMeasurement(t *testing.T) {
+	// A late arrival: measured at 00:00 but uploaded at 14:40. It belongs in the
+	// buckets containing its measurement timestamp.
+	sm := measurement.StorableMeasurement{
+		DeviceID:        "foo",
+		Timestamp:       testutil.Timestamp,
+		UploadTimestamp: testutil.Timestamp2,
+		Temp:            floatPtr(18.5),
+		RH:              floatPtr(55.0),
+	}
+
+	want := []Bucket{
+		{DeviceID: "foo", Metric: metric.RH, Resolution: Hourly, Start: testutil.Timestamp, Min: 55, Max: 55, Sum: 55, Count: 1, LateCount: 1},
+		{DeviceID: "foo", Metric: metric.Temp, Resolution: Hourly, Start: testutil.Timestamp, Min: 18.5, Max: 18.5, Sum: 18.5, Count: 1, LateCount: 1},
+		{DeviceID: "foo", Metric: metric.RH, Resolution: Daily, Start: testutil.Timestamp, Min: 55, Max: 55, Sum: 55, Count: 1, LateCount: 1},
+		{DeviceID: "foo", Metric: metric.Temp, Resolution: Daily, Start: testutil.Timestamp, Min: 18.5, Max: 18.5, Sum: 18.5, Count: 1, LateCount: 1},
+	}
+
+	got := FromMeasurement(sm)
+	if diff := cmp.Diff(got, want, cmpFloats); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	sms := []measurement.StorableMeasurement{
+		{DeviceID: "foo", Timestamp: testutil.Timestamp, Temp: floatPtr(18.0)},
+		{DeviceID: "foo", Timestamp: testutil.Timestamp.Add(30 * time.Minute), Temp: floatPtr(20.0)},
+		{DeviceID: "foo", Timestamp: testutil.Timestamp.Add(90 * time.Minute), Temp: floatPtr(22.0), UploadTimestamp: testutil.Timestamp2},
+		{DeviceID: "bar", Timestamp: testutil.Timestamp, PM25: floatPtr(7.0)},
+	}
+
+	cases := []struct {
+		name string
+		res  Resolution
+		want []Bucket
+	}{
+		{
+			name: "hourly",
+			res:  Hourly,
+			want: []Bucket{
+				{DeviceID: "bar", Metric: metric.PM25, Resolution: Hourly, Start: testutil.Timestamp, Min: 7, Max: 7, Sum: 7, Count: 1},
+				{DeviceID: "foo", Metric: metric.Temp, Resolution: Hourly, Start: testutil.Timestamp, Min: 18, Max: 20, Sum: 38, Count: 2},
+				{DeviceID: "foo", Metric: metric.Temp, Resolution: Hourly, Start: testutil.Timestamp.Add(time.Hour), Min: 22, Max: 22, Sum: 22, Count: 1, LateCount: 1},
+			},
+		},
+		{
+			name: "daily",
+			res:  Daily,
+			want: []Bucket{
+				{DeviceID: "bar", Metric: metric.PM25, Resolution: Daily, Start: testutil.Timestamp, Min: 7, Max: 7, Sum: 7, Count: 1},
+				{DeviceID: "foo", Metric: metric.Temp, Resolution: Daily, Start: testutil.Timestamp, Min: 18, Max: 22, Sum: 60, Count: 3, LateCount: 1},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Compute(sms, tc.res)
+			if diff := cmp.Diff(got, tc.want, cmpFloats); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestToMeasurements(t *testing.T) {
+	buckets := []Bucket{
+		{DeviceID: "foo", Metric: metric.Temp, Resolution: Hourly, Start: testutil.Timestamp.Add(time.Hour), Min: 22, Max: 22, Sum: 22, Count: 1},
+		{DeviceID: "foo", Metric: metric.Temp, Resolution: Hourly, Start: testutil.Timestamp, Min: 18, Max: 20, Sum: 38, Count: 2},
+		{DeviceID: "foo", Metric: metric.RH, Resolution: Hourly, Start: testutil.Timestamp, Min: 50, Max: 60, Sum: 110, Count: 2},
+		{DeviceID: "foo", Metric: metric.CO2, Resolution: Hourly, Start: testutil.Timestamp},
+	}
+
+	want := []measurement.StorableMeasurement{
+		{DeviceID: "foo", Timestamp: testutil.Timestamp, Temp: floatPtr(19), RH: floatPtr(55)},
+		{DeviceID: "foo", Timestamp: testutil.Timestamp.Add(time.Hour), Temp: floatPtr(22)},
+	}
+
+	got := ToMeasurements(buckets)
+	if diff := cmp.Diff(got, want, cmpFloats); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+}
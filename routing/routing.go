@@ -0,0 +1,318 @@
+// Package routing decides what happens to incoming measurements according to rules that can be
+// changed while the web app is running: whether they're dropped, which sinks they go to, how
+// they're tagged, and which device they're attributed to.
+package routing
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/alert"
+	"github.com/mtraver/environmental-sensor/ingest"
+	"github.com/mtraver/environmental-sensor/measurement"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/metric"
+	"github.com/mtraver/environmental-sensor/util"
+)
+
+var ErrNotFound = errors.New("routing: not found")
+
+type Action string
+
+const (
+	// Drop rules drop matching measurements.
+	Drop Action = "drop"
+
+	// Route rules deliver matching measurements only to the rule's sinks.
+	Route Action = "route"
+
+	// Tag rules attach the rule's tags to matching measurements.
+	Tag Action = "tag"
+
+	// Rename rules attribute matching measurements to another device ID, e.g. because the
+	// hardware that reports under the old ID has moved.
+	Rename Action = "rename"
+)
+
+// Rule matches measurements and says what to do with them. A measurement matches if it meets
+// every condition that's set; a rule with no conditions matches every measurement.
+type Rule struct {
+	// ID identifies the rule. It's assigned when the rule is stored.
+	ID string `datastore:"-"`
+
+	Name string `datastore:"name,noindex"`
+
+	// Priority orders rules. Rules with lower priorities are evaluated first, and rules with
+	// the same priority are evaluated in order of ID.
+	Priority int `datastore:"priority,noindex"`
+
+	// DevicePattern is a pattern, in the syntax of path.Match, that the device ID must match,
+	// e.g. "test-*".
+	DevicePattern string `datastore:"device_pattern,noindex"`
+
+	// Source is the "source" attribute of the message that must have carried the measurement,
+	// e.g. "AWS".
+	Source string `datastore:"source,noindex"`
+
+	// Metric is a metric that the measurement must have. If Op is set then its value must also
+	// compare to Threshold, e.g. "temp > 60".
+	Metric    metric.Key `datastore:"metric,noindex"`
+	Op        alert.Op   `datastore:"op,noindex"`
+	Threshold float64    `datastore:"threshold,noindex"`
+
+	Action Action `datastore:"action,noindex"`
+
+	// Sinks are the sinks that Route rules deliver measurements to.
+	Sinks []ingest.Sink `datastore:"sinks,noindex"`
+
+	// Tags are the tags, of the form key=value, that Tag rules attach.
+	Tags []string `datastore:"tags,noindex"`
+
+	// RenameTo is the device ID that Rename rules attribute measurements to.
+	RenameTo string `datastore:"rename_to,noindex"`
+
+	Enabled bool `datastore:"enabled"`
+}
+
+// Validate returns an error if r is not valid.
+func (r Rule) Validate() error {
+	if r.Name == "" {
+		return errors.New("routing: rule name must be set")
+	}
+
+	if _, err := path.Match(r.DevicePattern, ""); err != nil {
+		return fmt.Errorf("routing: invalid device pattern %q: %w", r.DevicePattern, err)
+	}
+
+	if r.Metric != "" {
+		if _, ok := metric.All[r.Metric]; !ok || r.Metric.Derived() {
+			return fmt.Errorf("routing: unknown metric %q", r.Metric)
+		}
+	}
+	if r.Op != "" {
+		if r.Metric == "" {
+			return errors.New("routing: rules that compare a metric must name it")
+		}
+		if !r.Op.Valid() {
+			return fmt.Errorf("routing: unknown operator %q", r.Op)
+		}
+	}
+
+	switch r.Action {
+	case Drop:
+	case Route:
+		if len(r.Sinks) == 0 {
+			return errors.New("routing: route rules must have at least one sink")
+		}
+		for _, s := range r.Sinks {
+			if !s.Valid() {
+				return fmt.Errorf("routing: unknown sink %q", s)
+			}
+		}
+	case Tag:
+		if len(r.Tags) == 0 {
+			return errors.New("routing: tag rules must have at least one tag")
+		}
+		for _, t := range r.Tags {
+			key, _, ok := strings.Cut(t, "=")
+			if !ok || key == "" {
+				return fmt.Errorf("routing: tag %q must be of the form key=value", t)
+			}
+			if key == "device" {
+				return errors.New("routing: the device tag can't be set")
+			}
+		}
+	case Rename:
+		if r.RenameTo == "" {
+			return errors.New("routing: rename rules must have a device ID to rename to")
+		}
+		// The octothorpe is used to separate substrings in database keys.
+		if strings.Contains(r.RenameTo, "#") {
+			return fmt.Errorf("routing: device ID %q must not contain '#'", r.RenameTo)
+		}
+	default:
+		return fmt.Errorf("routing: unknown action %q", r.Action)
+	}
+
+	return nil
+}
+
+// Matches reports whether a measurement that was sent as sm by the given source meets the rule's
+// conditions.
+func (r Rule) Matches(sm measurement.StorableMeasurement, source string) bool {
+	if r.DevicePattern != "" {
+		if ok, _ := path.Match(r.DevicePattern, sm.DeviceID); !ok {
+			return false
+		}
+	}
+
+	if r.Source != "" && r.Source != source {
+		return false
+	}
+
+	if r.Metric != "" {
+		v := sm.Value(r.Metric)
+		if v == nil {
+			return false
+		}
+		if r.Op != "" && !r.Op.Compare(float64(*v), r.Threshold) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func compareRules(a, b Rule) int {
+	return cmp.Or(cmp.Compare(a.Priority, b.Priority), strings.Compare(a.ID, b.ID))
+}
+
+// Sort sorts rules in the order that they're evaluated.
+func Sort(rules []Rule) {
+	slices.SortFunc(rules, compareRules)
+}
+
+// Evaluate evaluates the enabled rules, in order of priority, against m, which was sent by the
+// given source. Tag and Rename rules take effect and evaluation continues, so later rules see
+// the new device ID. The first Drop or Route rule to match ends evaluation. The decision's
+// DeviceID is m's own device ID unless a rule renamed it, and its Rules are the names of the
+// rules that matched, in the order they were evaluated.
+func Evaluate(rules []Rule, m *mpb.Measurement, source string) ingest.Decision {
+	d := ingest.Decision{DeviceID: m.GetDeviceId()}
+
+	// Measurements without a valid timestamp can't be converted, but they can still be matched
+	// by their device ID and source. They're rejected when they're ingested anyway.
+	sm, _ := measurement.NewStorableMeasurement(m)
+	sm.DeviceID = m.GetDeviceId()
+
+	rules = slices.Clone(rules)
+	Sort(rules)
+	for _, r := range rules {
+		if !r.Enabled || !r.Matches(sm, source) {
+			continue
+		}
+		d.Rules = append(d.Rules, r.Name)
+
+		switch r.Action {
+		case Drop:
+			d.Drop = true
+			return d
+		case Route:
+			d.Sinks = r.Sinks
+			return d
+		case Tag:
+			if d.Tags == nil {
+				d.Tags = make(map[string]string)
+			}
+			for _, t := range r.Tags {
+				key, value, _ := strings.Cut(t, "=")
+				d.Tags[key] = value
+			}
+		case Rename:
+			d.DeviceID = r.RenameTo
+			sm.DeviceID = r.RenameTo
+		}
+	}
+
+	return d
+}
+
+// Store stores rules.
+type Store interface {
+	RoutingRules(ctx context.Context) ([]Rule, error)
+
+	// RoutingRule gets the rule with the given ID. It returns ErrNotFound if there's none.
+	RoutingRule(ctx context.Context, id string) (Rule, error)
+
+	// PutRoutingRule validates and stores r, assigning it an ID if it doesn't have one. It
+	// returns the stored rule.
+	PutRoutingRule(ctx context.Context, r Rule) (Rule, error)
+
+	// DeleteRoutingRule deletes the rule with the given ID. It returns ErrNotFound if there's
+	// none.
+	DeleteRoutingRule(ctx context.Context, id string) error
+}
+
+// PrepareRule readies r to be stored. It validates r and assigns it an ID if it doesn't have
+// one. Store implementations call it from PutRoutingRule.
+func PrepareRule(r Rule) (Rule, error) {
+	if err := r.Validate(); err != nil {
+		return r, err
+	}
+
+	if r.ID == "" {
+		id, err := util.NewID()
+		if err != nil {
+			return r, err
+		}
+		r.ID = id
+	}
+
+	return r, nil
+}
+
+// DefaultCacheTTL is how long a Router uses the rules it has read before reading them again.
+const DefaultCacheTTL = 30 * time.Second
+
+// Router is an ingest.Router that evaluates the rules in a Store. It caches the rules for a
+// while so that the store isn't read for every measurement, so changes to them take effect
+// within the cache TTL rather than right away.
+type Router struct {
+	store Store
+	ttl   time.Duration
+
+	// now returns the current time. If it's nil then time.Now is used.
+	now func() time.Time
+
+	mu      sync.Mutex
+	rules   []Rule
+	fetched time.Time
+}
+
+// NewRouter returns a Router that evaluates the rules in store, reading them at most once per
+// ttl.
+func NewRouter(store Store, ttl time.Duration) *Router {
+	return &Router{store: store, ttl: ttl}
+}
+
+// Route implements ingest.Router.
+func (r *Router) Route(ctx context.Context, m *mpb.Measurement, source string) (ingest.Decision, error) {
+	rules, err := r.cachedRules(ctx)
+	if err != nil {
+		return ingest.Decision{}, err
+	}
+	return Evaluate(rules, m, source), nil
+}
+
+// cachedRules returns the rules, reading them from the store if the cached ones are stale.
+func (r *Router) cachedRules(ctx context.Context) ([]Rule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if r.now != nil {
+		now = r.now()
+	}
+	if r.rules != nil && now.Sub(r.fetched) < r.ttl {
+		return r.rules, nil
+	}
+
+	rules, err := r.store.RoutingRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if rules == nil {
+		rules = []Rule{}
+	}
+	Sort(rules)
+
+	r.rules, r.fetched = rules, now
+	return rules, nil
+}
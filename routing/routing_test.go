@@ -0,0 +1,196 @@
+package routing
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mtraver/environmental-sensor/alert"
+	"github.com/mtraver/environmental-sensor/ingest"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/metric"
+	"github.com/mtraver/environmental-sensor/testutil"
+)
+
+func TestRuleValidate(t *testing.T) {
+	cases := []struct {
+		name  string
+		r     Rule
+		valid bool
+	}{
+		{"drop", Rule{Name: "x", Action: Drop}, true},
+		{"drop_pattern", Rule{Name: "x", DevicePattern: "test-*", Action: Drop}, true},
+		{"bad_pattern", Rule{Name: "x", DevicePattern: "[", Action: Drop}, false},
+		{"metric", Rule{Name: "x", Metric: metric.CO2, Action: Drop}, true},
+		{"metric_op", Rule{Name: "x", Metric: metric.Temp, Op: alert.GreaterThan, Threshold: 60, Action: Drop}, true},
+		{"unknown_metric", Rule{Name: "x", Metric: "radon", Action: Drop}, false},
+		{"derived_metric", Rule{Name: "x", Metric: metric.AQI, Action: Drop}, false},
+		{"op_without_metric", Rule{Name: "x", Op: alert.GreaterThan, Action: Drop}, false},
+		{"bad_op", Rule{Name: "x", Metric: metric.Temp, Op: "==", Action: Drop}, false},
+		{"route", Rule{Name: "x", Action: Route, Sinks: []ingest.Sink{ingest.SinkInfluxDB}}, true},
+		{"route_no_sinks", Rule{Name: "x", Action: Route}, false},
+		{"route_unknown_sink", Rule{Name: "x", Action: Route, Sinks: []ingest.Sink{"s3"}}, false},
+		{"tag", Rule{Name: "x", Action: Tag, Tags: []string{"site=lab", "empty="}}, true},
+		{"tag_none", Rule{Name: "x", Action: Tag}, false},
+		{"tag_no_value", Rule{Name: "x", Action: Tag, Tags: []string{"site"}}, false},
+		{"tag_device", Rule{Name: "x", Action: Tag, Tags: []string{"device=bar"}}, false},
+		{"rename", Rule{Name: "x", Action: Rename, RenameTo: "bar"}, true},
+		{"rename_empty", Rule{Name: "x", Action: Rename}, false},
+		{"rename_octothorpe", Rule{Name: "x", Action: Rename, RenameTo: "b#r"}, false},
+		{"no_name", Rule{Action: Drop}, false},
+		{"unknown_action", Rule{Name: "x", Action: "vibes"}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.r.Validate()
+			if err != nil && tc.valid {
+				t.Errorf("Unexpected error: %v", err)
+			} else if err == nil && !tc.valid {
+				t.Error("Expected error, got no error")
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	foo := testutil.FullyPopulatedMeasurementProto()
+	noTimestamp := testutil.FullyPopulatedMeasurementProto()
+	noTimestamp.Timestamp = nil
+
+	cases := []struct {
+		name   string
+		rules  []Rule
+		m      *mpb.Measurement
+		source string
+		want   ingest.Decision
+	}{
+		{
+			name: "no_rules",
+			m:    foo,
+			want: ingest.Decision{DeviceID: "foo"},
+		},
+		{
+			name:   "drop_source",
+			rules:  []Rule{{Name: "aws", Source: "AWS", Action: Drop, Enabled: true}},
+			m:      foo,
+			source: "AWS",
+			want:   ingest.Decision{Drop: true, DeviceID: "foo", Rules: []string{"aws"}},
+		},
+		{
+			name:   "other_source",
+			rules:  []Rule{{Name: "aws", Source: "AWS", Action: Drop, Enabled: true}},
+			m:      foo,
+			source: "GCP",
+			want:   ingest.Decision{DeviceID: "foo"},
+		},
+		{
+			name:  "disabled",
+			rules: []Rule{{Name: "all", Action: Drop}},
+			m:     foo,
+			want:  ingest.Decision{DeviceID: "foo"},
+		},
+		{
+			name:  "device_pattern",
+			rules: []Rule{{Name: "f", DevicePattern: "f*", Action: Drop, Enabled: true}, {Name: "b", DevicePattern: "b*", Action: Drop, Enabled: true}},
+			m:     foo,
+			want:  ingest.Decision{Drop: true, DeviceID: "foo", Rules: []string{"f"}},
+		},
+		{
+			name: "metric_threshold",
+			rules: []Rule{
+				{Name: "hot", Metric: metric.Temp, Op: alert.GreaterThan, Threshold: 60, Action: Drop, Enabled: true},
+				{Name: "co2", Metric: metric.CO2, Op: alert.LessThan, Threshold: 500, Action: Route, Sinks: []ingest.Sink{ingest.SinkDatabase}, Enabled: true},
+			},
+			m:    foo,
+			want: ingest.Decision{DeviceID: "foo", Sinks: []ingest.Sink{ingest.SinkDatabase}, Rules: []string{"co2"}},
+		},
+		{
+			name: "tag_rename_then_route",
+			rules: []Rule{
+				{ID: "b", Name: "route", DevicePattern: "bar", Action: Route, Sinks: []ingest.Sink{ingest.SinkInfluxDB}, Enabled: true, Priority: 2},
+				{ID: "a", Name: "rename", DevicePattern: "foo", Action: Rename, RenameTo: "bar", Enabled: true, Priority: 1},
+				{ID: "c", Name: "tag1", Action: Tag, Tags: []string{"site=lab", "floor=1"}, Enabled: true},
+				{ID: "d", Name: "tag2", Action: Tag, Tags: []string{"floor=2"}, Enabled: true},
+				{ID: "e", Name: "never", Action: Drop, Enabled: true, Priority: 3},
+			},
+			m: foo,
+			want: ingest.Decision{
+				DeviceID: "bar",
+				Sinks:    []ingest.Sink{ingest.SinkInfluxDB},
+				Tags:     map[string]string{"site": "lab", "floor": "2"},
+				Rules:    []string{"tag1", "tag2", "rename", "route"},
+			},
+		},
+		{
+			name:  "no_timestamp",
+			rules: []Rule{{Name: "co2", Metric: metric.CO2, Action: Drop, Enabled: true}, {Name: "foo", DevicePattern: "foo", Action: Drop, Enabled: true}},
+			m:     noTimestamp,
+			want:  ingest.Decision{Drop: true, DeviceID: "foo", Rules: []string{"foo"}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Evaluate(tc.rules, tc.m, tc.source)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected decision (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// fakeStore is a Store that only lists rules, and counts how many times it's asked to.
+type fakeStore struct {
+	Store
+	rules []Rule
+	reads int
+}
+
+func (s *fakeStore) RoutingRules(ctx context.Context) ([]Rule, error) {
+	s.reads++
+	return slices.Clone(s.rules), nil
+}
+
+func TestRouterCachesRules(t *testing.T) {
+	ctx := context.Background()
+	store := &fakeStore{rules: []Rule{{Name: "all", Action: Drop, Enabled: true}}}
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	r := NewRouter(store, time.Minute)
+	r.now = func() time.Time { return now }
+
+	route := func() ingest.Decision {
+		t.Helper()
+
+		d, err := r.Route(ctx, testutil.FullyPopulatedMeasurementProto(), "")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return d
+	}
+
+	if d := route(); !d.Drop {
+		t.Errorf("got %+v, want the measurement dropped", d)
+	}
+
+	// The rules are cached, so a change isn't seen until the cache expires.
+	store.rules = nil
+	now = now.Add(30 * time.Second)
+	if d := route(); !d.Drop || store.reads != 1 {
+		t.Errorf("got %+v after %d reads, want the cached rule to drop the measurement after 1 read", d, store.reads)
+	}
+
+	now = now.Add(time.Minute)
+	if d := route(); d.Drop || store.reads != 2 {
+		t.Errorf("got %+v after %d reads, want no rules to apply after 2 reads", d, store.reads)
+	}
+
+	// Having no rules is cached too.
+	route()
+	if store.reads != 2 {
+		t.Errorf("got %d reads, want 2", store.reads)
+	}
+}
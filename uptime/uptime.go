@@ -0,0 +1,302 @@
+// Package uptime reports how regularly devices send measurements: when each device was last
+// seen, the cadence at which it usually reports, a histogram of the gaps between its
+// measurements, and the fraction of recent time during which it was reporting.
+package uptime
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/database"
+	"github.com/mtraver/environmental-sensor/device"
+	"github.com/mtraver/environmental-sensor/measurement"
+)
+
+// Windows contains the windows over which uptime is reported, shortest first.
+var Windows = []time.Duration{24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour}
+
+// GapBounds are the upper bounds of the buckets of the gap histogram. The last bucket, which
+// has no upper bound, isn't included.
+var GapBounds = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+}
+
+// A gap between measurements is only counted as downtime if it's longer than this many
+// multiples of the device's cadence. This allows for jitter and the occasional lost message.
+const toleranceFactor = 2
+
+// GapBucket counts the gaps between consecutive measurements that were longer than the
+// previous bucket's Max and no longer than Max. Max is zero for the last bucket, which is
+// unbounded.
+type GapBucket struct {
+	Max   time.Duration
+	Count int
+}
+
+func (b GapBucket) String() string {
+	if b.Max == 0 {
+		return "longer"
+	}
+	return fmt.Sprintf("<= %v", b.Max)
+}
+
+// Uptime is the fraction of Window during which a device was reporting. Known is false if
+// there's too little data to say.
+type Uptime struct {
+	Window   time.Duration
+	Fraction float64
+	Known    bool
+}
+
+// WindowName returns a short name for u's window, like "24h" or "7d".
+func (u Uptime) WindowName() string {
+	return WindowName(u.Window)
+}
+
+// WindowName returns a short name for the window w. Windows longer than a day that are a
+// whole number of days are named in days, like "7d", and others in hours, like "24h".
+func WindowName(w time.Duration) string {
+	const day = 24 * time.Hour
+	if w > day && w%day == 0 {
+		return fmt.Sprintf("%dd", w/day)
+	}
+	return fmt.Sprintf("%gh", w.Hours())
+}
+
+// Percent returns the uptime as a percentage.
+func (u Uptime) Percent() float64 {
+	return 100 * u.Fraction
+}
+
+// Report describes how regularly one device reports.
+type Report struct {
+	Device device.Device
+
+	// LastSeen is the timestamp of the device's latest measurement. It's zero if the device has
+	// never reported.
+	LastSeen time.Time
+
+	// Cadence is the median interval between the device's measurements. It's zero if there are
+	// too few measurements to infer it.
+	Cadence time.Duration
+
+	// Stale is true if the device hasn't reported for longer than its cadence allows, or has
+	// never reported. If the cadence is unknown then the device is stale if it hasn't reported
+	// within the shortest of Windows.
+	Stale bool
+
+	Gaps   []GapBucket
+	Uptime []Uptime
+}
+
+// Compute builds a report for d from the timestamps of its measurements over the longest of
+// Windows, and the timestamp of its latest measurement, which may be older than that.
+//
+// Uptime over a window is shortened to begin at the earliest timestamp if that's later than
+// the start of the window, so that recently added devices aren't penalized for the time before
+// they existed. Time spent in gaps longer than toleranceFactor times the cadence is downtime.
+func Compute(d device.Device, timestamps []time.Time, lastSeen time.Time, now time.Time) Report {
+	timestamps = slices.Clone(timestamps)
+	slices.SortFunc(timestamps, func(a, b time.Time) int { return a.Compare(b) })
+
+	r := Report{
+		Device:   d,
+		LastSeen: lastSeen,
+		Cadence:  cadence(timestamps),
+		Gaps:     gapHistogram(timestamps),
+	}
+	if n := len(timestamps); n > 0 && timestamps[n-1].After(r.LastSeen) {
+		r.LastSeen = timestamps[n-1]
+	}
+
+	tolerance := toleranceFactor * r.Cadence
+	switch {
+	case r.LastSeen.IsZero():
+		r.Stale = true
+	case r.Cadence > 0:
+		r.Stale = now.Sub(r.LastSeen) > tolerance
+	default:
+		r.Stale = now.Sub(r.LastSeen) > Windows[0]
+	}
+
+	for _, w := range Windows {
+		u := Uptime{Window: w}
+		if r.Cadence > 0 {
+			u.Fraction, u.Known = uptime(timestamps, now.Add(-w), now, tolerance)
+		}
+		r.Uptime = append(r.Uptime, u)
+	}
+
+	return r
+}
+
+// cadence returns the median of the intervals between the sorted timestamps, ignoring
+// duplicates.
+func cadence(timestamps []time.Time) time.Duration {
+	var intervals []time.Duration
+	for i := 1; i < len(timestamps); i++ {
+		if d := timestamps[i].Sub(timestamps[i-1]); d > 0 {
+			intervals = append(intervals, d)
+		}
+	}
+
+	if len(intervals) == 0 {
+		return 0
+	}
+
+	slices.Sort(intervals)
+	return intervals[len(intervals)/2]
+}
+
+func gapHistogram(timestamps []time.Time) []GapBucket {
+	buckets := make([]GapBucket, len(GapBounds)+1)
+	for i, b := range GapBounds {
+		buckets[i].Max = b
+	}
+
+	for i := 1; i < len(timestamps); i++ {
+		gap := timestamps[i].Sub(timestamps[i-1])
+		if gap <= 0 {
+			continue
+		}
+
+		j, _ := slices.BinarySearch(GapBounds, gap)
+		buckets[j].Count++
+	}
+
+	return buckets
+}
+
+// uptime returns the fraction of [start, end] that the sorted timestamps cover, allowing gaps
+// of up to tolerance. ok is false if there are no timestamps at or before end.
+func uptime(timestamps []time.Time, start, end time.Time, tolerance time.Duration) (fraction float64, ok bool) {
+	// The last measurement before the window tells us whether the device was up at its start.
+	i, _ := slices.BinarySearchFunc(timestamps, start, func(t, target time.Time) int { return t.Compare(target) })
+	var prev time.Time
+	if i > 0 {
+		prev = timestamps[i-1]
+	} else if i < len(timestamps) {
+		start = timestamps[i]
+		prev = start
+	} else {
+		return 0, false
+	}
+
+	if !end.After(start) {
+		return 0, false
+	}
+
+	var down time.Duration
+	addGap := func(t time.Time) {
+		excess := t.Sub(prev) - tolerance
+		excess = min(excess, t.Sub(start))
+		if excess > 0 {
+			down += excess
+		}
+		prev = t
+	}
+
+	for _, t := range timestamps[i:] {
+		if t.After(end) {
+			break
+		}
+		addGap(t)
+	}
+	addGap(end)
+
+	return 1 - float64(down)/float64(end.Sub(start)), true
+}
+
+// Database is the subset of database.Database needed to build reports.
+type Database interface {
+	Between(ctx context.Context, startTime time.Time, endTime time.Time) (map[string][]measurement.StorableMeasurement, error)
+	Query(ctx context.Context, q database.Query) (database.Page, error)
+	Latest(ctx context.Context, deviceIDs []string) (map[string]measurement.StorableMeasurement, error)
+}
+
+// longestWindow returns the longest of Windows.
+func longestWindow() time.Duration {
+	return slices.Max(Windows)
+}
+
+// ForDevices builds a report for each of the given devices. Measurements reported under a
+// device's aliases count as the device's measurements.
+func ForDevices(ctx context.Context, db Database, devices []device.Device, now time.Time) ([]Report, error) {
+	byID, err := db.Between(ctx, now.Add(-longestWindow()), now)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]Report, 0, len(devices))
+	for _, d := range devices {
+		ids := append([]string{d.DeviceID}, d.Aliases...)
+
+		var sms []measurement.StorableMeasurement
+		for _, id := range ids {
+			sms = append(sms, byID[id]...)
+		}
+
+		lastSeen, err := latest(ctx, db, ids)
+		if err != nil {
+			return nil, err
+		}
+
+		reports = append(reports, Compute(d, timestamps(sms), lastSeen, now))
+	}
+
+	return reports, nil
+}
+
+// ForDevice builds a report for d. It's cheaper than ForDevices for a single device because it
+// only reads that device's measurements.
+func ForDevice(ctx context.Context, db Database, d device.Device, now time.Time) (Report, error) {
+	ids := append([]string{d.DeviceID}, d.Aliases...)
+
+	page, err := db.Query(ctx, database.Query{
+		StartTime: now.Add(-longestWindow()),
+		EndTime:   now,
+		DeviceIDs: ids,
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	lastSeen, err := latest(ctx, db, ids)
+	if err != nil {
+		return Report{}, err
+	}
+
+	return Compute(d, timestamps(page.Measurements), lastSeen, now), nil
+}
+
+// latest returns the timestamp of the most recent measurement reported under any of ids.
+func latest(ctx context.Context, db Database, ids []string) (time.Time, error) {
+	latest, err := db.Latest(ctx, ids)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var t time.Time
+	for _, sm := range latest {
+		if sm.Timestamp.After(t) {
+			t = sm.Timestamp
+		}
+	}
+
+	return t, nil
+}
+
+func timestamps(sms []measurement.StorableMeasurement) []time.Time {
+	ts := make([]time.Time, len(sms))
+	for i, sm := range sms {
+		ts[i] = sm.Timestamp
+	}
+	return ts
+}
@@ -0,0 +1,224 @@
+package uptime
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mtraver/environmental-sensor/device"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/web/db"
+	tspb "google.golang.org/protobuf/types/known/timestamppb"
+	wpb "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var now = time.Date(2018, time.March, 25, 0, 0, 0, 0, time.UTC)
+
+// every returns timestamps every interval from start up to but not including end.
+func every(interval time.Duration, start, end time.Time) []time.Time {
+	var ts []time.Time
+	for t := start; t.Before(end); t = t.Add(interval) {
+		ts = append(ts, t)
+	}
+	return ts
+}
+
+func TestCadence(t *testing.T) {
+	cases := []struct {
+		name string
+		ts   []time.Time
+		want time.Duration
+	}{
+		{"empty", nil, 0},
+		{"one", []time.Time{now}, 0},
+		{"duplicates", []time.Time{now, now}, 0},
+		{"steady", every(time.Minute, now.Add(-time.Hour), now), time.Minute},
+		{"outlier", []time.Time{now, now.Add(time.Minute), now.Add(2 * time.Minute), now.Add(3 * time.Hour)}, time.Minute},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := cadence(tc.ts); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGapHistogram(t *testing.T) {
+	ts := []time.Time{
+		now,
+		now.Add(time.Minute),                  // 1m
+		now.Add(2 * time.Minute),              // 1m
+		now.Add(4 * time.Minute),              // 2m
+		now.Add(4*time.Minute + time.Hour),    // 1h
+		now.Add(4*time.Minute + 26*time.Hour), // 25h
+	}
+
+	want := []GapBucket{
+		{Max: time.Minute, Count: 2},
+		{Max: 5 * time.Minute, Count: 1},
+		{Max: 15 * time.Minute},
+		{Max: time.Hour, Count: 1},
+		{Max: 6 * time.Hour},
+		{Max: 24 * time.Hour},
+		{Count: 1},
+	}
+
+	if diff := cmp.Diff(gapHistogram(ts), want); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	day := 24 * time.Hour
+	d := device.Device{DeviceID: "foo"}
+
+	// Reports every minute for 30 days except for a 6 hour outage ending 6 hours ago.
+	var withOutage []time.Time
+	withOutage = append(withOutage, every(time.Minute, now.Add(-30*day), now.Add(-12*time.Hour))...)
+	withOutage = append(withOutage, every(time.Minute, now.Add(-6*time.Hour), now)...)
+
+	cases := []struct {
+		name       string
+		ts         []time.Time
+		lastSeen   time.Time
+		wantStale  bool
+		wantUptime []float64
+	}{
+		{
+			name:       "steady",
+			ts:         every(time.Minute, now.Add(-30*day), now),
+			wantUptime: []float64{1, 1, 1},
+		},
+		{
+			name:       "outage",
+			ts:         withOutage,
+			wantUptime: []float64{1 - (6*60+1-2)/(24*60.0), 1 - (6*60+1-2)/(7*24*60.0), 1 - (6*60+1-2)/(30*24*60.0)},
+		},
+		{
+			// The device was added 12 hours ago, so every window is shortened to 12 hours.
+			name:       "new",
+			ts:         every(time.Minute, now.Add(-12*time.Hour), now),
+			wantUptime: []float64{1, 1, 1},
+		},
+		{
+			// Stopped reporting 12 hours ago.
+			name:       "stopped",
+			ts:         every(time.Minute, now.Add(-30*day), now.Add(-12*time.Hour)),
+			wantStale:  true,
+			wantUptime: []float64{1 - (12*60+1-2)/(24*60.0), 1 - (12*60+1-2)/(7*24*60.0), 1 - (12*60+1-2)/(30*24*60.0)},
+		},
+		{
+			name:       "never_seen",
+			wantStale:  true,
+			wantUptime: []float64{math.NaN(), math.NaN(), math.NaN()},
+		},
+		{
+			// Only seen long ago, before the longest window.
+			name:       "seen_long_ago",
+			lastSeen:   now.Add(-60 * day),
+			wantStale:  true,
+			wantUptime: []float64{math.NaN(), math.NaN(), math.NaN()},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := Compute(d, tc.ts, tc.lastSeen, now)
+
+			if r.Stale != tc.wantStale {
+				t.Errorf("got stale %v, want %v", r.Stale, tc.wantStale)
+			}
+
+			for i, u := range r.Uptime {
+				want := tc.wantUptime[i]
+				if math.IsNaN(want) {
+					if u.Known {
+						t.Errorf("%v: got uptime %v, want unknown", u.Window, u.Fraction)
+					}
+					continue
+				}
+
+				if !u.Known || math.Abs(u.Fraction-want) > 1e-9 {
+					t.Errorf("%v: got uptime %v (known=%v), want %v", u.Window, u.Fraction, u.Known, want)
+				}
+			}
+		})
+	}
+}
+
+func TestForDevices(t *testing.T) {
+	ctx := context.Background()
+	mdb := db.NewMemoryDB()
+
+	// The device reported under an old ID and then its current one.
+	for i, ts := range every(time.Minute, now.Add(-time.Hour), now.Add(-10*time.Minute)) {
+		id := "foo"
+		if i < 10 {
+			id = "old-foo"
+		}
+
+		m := &mpb.Measurement{DeviceId: id, Timestamp: tspb.New(ts), Temp: wpb.Float(20)}
+		if err := mdb.Save(ctx, m); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	devices := []device.Device{
+		{DeviceID: "foo", Aliases: []string{"old-foo"}},
+		{DeviceID: "bar"},
+	}
+
+	reports, err := ForDevices(ctx, mdb, devices, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	report, err := ForDevice(ctx, mdb, devices[0], now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(report, reports[0]); diff != "" {
+		t.Errorf("ForDevice and ForDevices mismatch (-ForDevice +ForDevices):\n%s", diff)
+	}
+
+	foo := reports[0]
+	if want := now.Add(-11 * time.Minute); !foo.LastSeen.Equal(want) {
+		t.Errorf("got last seen %v, want %v", foo.LastSeen, want)
+	}
+	if foo.Cadence != time.Minute {
+		t.Errorf("got cadence %v, want %v", foo.Cadence, time.Minute)
+	}
+	if !foo.Stale {
+		t.Error("got stale false, want true")
+	}
+	if want := 49; foo.Gaps[0].Count != want {
+		t.Errorf("got %d gaps of at most a minute, want %d", foo.Gaps[0].Count, want)
+	}
+
+	if bar := reports[1]; !bar.Stale || !bar.LastSeen.IsZero() {
+		t.Errorf("got stale %v and last seen %v for a device that never reported", bar.Stale, bar.LastSeen)
+	}
+}
+
+func TestWindowName(t *testing.T) {
+	cases := []struct {
+		w    time.Duration
+		want string
+	}{
+		{time.Hour, "1h"},
+		{24 * time.Hour, "24h"},
+		{36 * time.Hour, "36h"},
+		{7 * 24 * time.Hour, "7d"},
+		{30 * 24 * time.Hour, "30d"},
+	}
+
+	for _, tc := range cases {
+		if got := WindowName(tc.w); got != tc.want {
+			t.Errorf("WindowName(%v): got %q, want %q", tc.w, got, tc.want)
+		}
+	}
+}
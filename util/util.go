@@ -1,5 +1,11 @@
 package util
 
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
 func Filter[T any](slice []T, predicate func(T) bool) []T {
 	if slice == nil {
 		return nil
@@ -39,3 +45,24 @@ func SliceToSet[T comparable](slice []T) map[T]struct{} {
 
 	return result
 }
+
+// SplitList splits a comma-separated list, trimming space around each item and dropping empty
+// ones.
+func SplitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// NewID returns a new random ID: 16 random bytes, hex-encoded.
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -106,3 +106,24 @@ func TestSliceToSet(t *testing.T) {
 		})
 	}
 }
+
+func TestSplitList(t *testing.T) {
+	cases := []struct {
+		name string
+		s    string
+		want []string
+	}{
+		{"empty", "", nil},
+		{"blank", " , ,", nil},
+		{"one", "foo", []string{"foo"}},
+		{"several", " foo,bar , baz,,", []string{"foo", "bar", "baz"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, SplitList(tc.s)); diff != "" {
+				t.Errorf("Unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
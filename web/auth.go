@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mtraver/gaelog"
+	"golang.org/x/oauth2"
+
+	"github.com/mtraver/environmental-sensor/account"
+	"github.com/mtraver/environmental-sensor/apiauth"
+)
+
+const (
+	// sessionCookie holds the session token of a signed-in user.
+	sessionCookie = "session"
+	sessionTTL    = 30 * 24 * time.Hour
+
+	// loginCookie holds the state, nonce, and PKCE verifier of a sign-in that's in progress.
+	loginCookie = "login"
+	loginTTL    = 10 * time.Minute
+)
+
+// authenticator works out who is making each request and makes them available to handlers and
+// GraphQL resolvers as an account.Viewer. Requests are made by the user whose API token is
+// given as a bearer token, or by the user whose session cookie is set, or else anonymously.
+type authenticator struct {
+	Accounts account.Store
+
+	// Admins are the email addresses of the users who can see and edit every device.
+	Admins []string
+
+	// If Disabled is true then every request is made by an anonymous admin. It's for local
+	// development.
+	Disabled bool
+}
+
+var errBadToken = errors.New("invalid API token")
+
+func (a authenticator) viewer(r *http.Request) (account.Viewer, error) {
+	ctx := r.Context()
+
+	if a.Disabled {
+		return account.Viewer{Admin: true}, nil
+	}
+
+	var userID string
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		token, ok := strings.CutPrefix(auth, "Bearer ")
+		if !ok || !account.IsAPIToken(token) {
+			return account.Viewer{}, errBadToken
+		}
+
+		t, err := a.Accounts.APITokenByHash(ctx, account.HashToken(token))
+		if errors.Is(err, account.ErrNotFound) {
+			return account.Viewer{}, errBadToken
+		} else if err != nil {
+			return account.Viewer{}, err
+		}
+		userID = t.UserID
+	} else if c, err := r.Cookie(sessionCookie); err == nil {
+		s, err := a.Accounts.Session(ctx, account.HashToken(c.Value))
+		if errors.Is(err, account.ErrNotFound) {
+			return account.Viewer{}, nil
+		} else if err != nil {
+			return account.Viewer{}, err
+		}
+		if s.Expired(time.Now()) {
+			return account.Viewer{}, nil
+		}
+		userID = s.UserID
+	} else {
+		return account.Viewer{}, nil
+	}
+
+	u, err := a.Accounts.User(ctx, userID)
+	if errors.Is(err, account.ErrNotFound) {
+		return account.Viewer{}, nil
+	} else if err != nil {
+		return account.Viewer{}, err
+	}
+
+	return account.Viewer{User: u, Admin: account.IsAdmin(u.VerifiedEmail(), a.Admins)}, nil
+}
+
+// Wrap puts the viewer making each request in the request's context.
+func (a authenticator) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, err := a.viewer(r)
+		if errors.Is(err, errBadToken) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			gaelog.Errorf(r.Context(), "Failed to authenticate request: %v", err)
+			http.Error(w, "Failed to authenticate request", http.StatusInternalServerError)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(account.NewContext(r.Context(), v)))
+	})
+}
+
+// requireAdmin responds with 403 Forbidden to requests that aren't made by an admin. It must be
+// wrapped by authenticator.Wrap.
+func requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !account.FromContext(r.Context()).Admin {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// loginHandler signs users in with an OIDC provider using the authorization code flow, and
+// signs them out. It serves /auth/login, /auth/callback, and /auth/logout. Users are created
+// the first time they sign in.
+type loginHandler struct {
+	OAuth    *oauth2.Config
+	Verifier *apiauth.OIDCVerifier
+	Accounts account.Store
+}
+
+// newLoginHandler returns a loginHandler for the given OIDC client, fetching the provider's
+// endpoints using discovery.
+func newLoginHandler(ctx context.Context, issuer, clientID, clientSecret, redirectURL string, accounts account.Store) (loginHandler, error) {
+	verifier := apiauth.NewOIDCVerifier(issuer, clientID, nil)
+	discovery, err := verifier.Discover(ctx)
+	if err != nil {
+		return loginHandler{}, err
+	}
+
+	return loginHandler{
+		OAuth: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  discovery.AuthorizationEndpoint,
+				TokenURL: discovery.TokenEndpoint,
+			},
+			Scopes: []string{"openid", "email", "profile"},
+		},
+		Verifier: verifier,
+		Accounts: accounts,
+	}, nil
+}
+
+func (h loginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/auth/login":
+		h.login(w, r)
+	case "/auth/callback":
+		h.callback(w, r)
+	case "/auth/logout":
+		h.logout(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func setCookie(w http.ResponseWriter, name, value string, path string, maxAge time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearCookie(w http.ResponseWriter, name, path string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Path:     path,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// login redirects the user to the provider, remembering the state, nonce, and PKCE verifier in a
+// short-lived cookie so that the callback can check them.
+func (h loginHandler) login(w http.ResponseWriter, r *http.Request) {
+	state, nonce, verifier := randomToken(), randomToken(), oauth2.GenerateVerifier()
+	setCookie(w, loginCookie, state+"."+nonce+"."+verifier, "/auth", loginTTL)
+
+	url := h.OAuth.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oauth2.SetAuthURLParam("nonce", nonce))
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// callback completes sign-in: it exchanges the code for an ID token, verifies it, creates or
+// updates the user, and starts a session.
+func (h loginHandler) callback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	c, err := r.Cookie(loginCookie)
+	if err != nil {
+		http.Error(w, "Sign-in expired, try again", http.StatusBadRequest)
+		return
+	}
+	clearCookie(w, loginCookie, "/auth")
+
+	parts := strings.Split(c.Value, ".")
+	state := r.URL.Query().Get("state")
+	if len(parts) != 3 || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(state)) != 1 {
+		http.Error(w, "Bad sign-in state", http.StatusBadRequest)
+		return
+	}
+	nonce, verifier := parts[1], parts[2]
+
+	if e := r.URL.Query().Get("error"); e != "" {
+		http.Error(w, "Sign-in failed: "+e, http.StatusUnauthorized)
+		return
+	}
+
+	tok, err := h.OAuth.Exchange(ctx, r.URL.Query().Get("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		gaelog.Warningf(ctx, "Failed to exchange code: %v", err)
+		http.Error(w, "Sign-in failed", http.StatusUnauthorized)
+		return
+	}
+
+	rawIDToken, _ := tok.Extra("id_token").(string)
+	claims, err := h.Verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		gaelog.Warningf(ctx, "Failed to verify ID token: %v", err)
+		http.Error(w, "Sign-in failed", http.StatusUnauthorized)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		http.Error(w, "Sign-in failed", http.StatusUnauthorized)
+		return
+	}
+
+	now := time.Now().UTC()
+	u, err := h.Accounts.UserBySubject(ctx, claims.Issuer, claims.Subject)
+	if errors.Is(err, account.ErrNotFound) {
+		u = account.User{Issuer: claims.Issuer, Subject: claims.Subject, Created: now}
+	} else if err != nil {
+		gaelog.Errorf(ctx, "Failed to get user: %v", err)
+		http.Error(w, "Sign-in failed", http.StatusInternalServerError)
+		return
+	}
+
+	u.Email, u.EmailVerified = claims.Email, bool(claims.EmailVerified)
+	u.Name, u.LastLogin = claims.Name, now
+	u, err = h.Accounts.PutUser(ctx, u)
+	if err != nil {
+		gaelog.Errorf(ctx, "Failed to store user: %v", err)
+		http.Error(w, "Sign-in failed", http.StatusInternalServerError)
+		return
+	}
+
+	token, s, err := account.NewSession(u.ID, sessionTTL, now)
+	if err == nil {
+		err = h.Accounts.PutSession(ctx, s)
+	}
+	if err != nil {
+		gaelog.Errorf(ctx, "Failed to start session: %v", err)
+		http.Error(w, "Sign-in failed", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, sessionCookie, token, "/", sessionTTL)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// logout ends the session. It only accepts POST so that other sites can't sign users out.
+func (h loginHandler) logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if err := h.Accounts.DeleteSession(r.Context(), account.HashToken(c.Value)); err != nil {
+			gaelog.Errorf(r.Context(), "Failed to delete session: %v", err)
+		}
+	}
+
+	clearCookie(w, sessionCookie, "/")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/account"
+	"github.com/mtraver/environmental-sensor/web/db"
+)
+
+func TestAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	database := db.NewMemoryDB()
+
+	alice, err := database.PutUser(ctx, account.User{Issuer: "https://issuer.example.com", Subject: "1", Email: "alice@example.com", EmailVerified: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	bob, err := database.PutUser(ctx, account.User{Issuer: "https://issuer.example.com", Subject: "2", Email: "bob@example.com", EmailVerified: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// mallory claims alice's email address but the OIDC provider hasn't verified it.
+	mallory, err := database.PutUser(ctx, account.User{Issuer: "https://issuer.example.com", Subject: "3", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	session, s, err := account.NewSession(alice.ID, time.Hour, time.Now())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := database.PutSession(ctx, s); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	unverified, s, err := account.NewSession(mallory.ID, time.Hour, time.Now())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := database.PutSession(ctx, s); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expired, s, err := account.NewSession(alice.ID, time.Hour, time.Now().Add(-2*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := database.PutSession(ctx, s); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	token, tok, err := account.NewAPIToken(bob.ID, "script")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := database.PutAPIToken(ctx, tok); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		name      string
+		cookie    string
+		auth      string
+		disabled  bool
+		wantCode  int
+		wantUser  string
+		wantAdmin bool
+	}{
+		{name: "anonymous", wantCode: http.StatusOK},
+		{name: "session", cookie: session, wantCode: http.StatusOK, wantUser: alice.ID, wantAdmin: true},
+		{name: "unverified_email", cookie: unverified, wantCode: http.StatusOK, wantUser: mallory.ID},
+		{name: "expired_session", cookie: expired, wantCode: http.StatusOK},
+		{name: "unknown_session", cookie: "nope", wantCode: http.StatusOK},
+		{name: "api_token", auth: "Bearer " + token, wantCode: http.StatusOK, wantUser: bob.ID},
+		{name: "unknown_api_token", auth: "Bearer est_nope", wantCode: http.StatusUnauthorized},
+		{name: "not_api_token", auth: "Bearer eyJhbGciOiJSUzI1NiJ9", wantCode: http.StatusUnauthorized},
+		{name: "basic_auth", auth: "Basic YWxpY2U6cGFzc3dvcmQ=", wantCode: http.StatusUnauthorized},
+		{name: "disabled", disabled: true, wantCode: http.StatusOK, wantAdmin: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := authenticator{Accounts: database, Admins: []string{"Alice@example.com"}, Disabled: tc.disabled}
+
+			var got account.Viewer
+			h := a.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = account.FromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/query", nil)
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: sessionCookie, Value: tc.cookie})
+			}
+			if tc.auth != "" {
+				req.Header.Set("Authorization", tc.auth)
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantCode {
+				t.Fatalf("got status %d, want %d", rec.Code, tc.wantCode)
+			}
+			if got.User.ID != tc.wantUser {
+				t.Errorf("got user %q, want %q", got.User.ID, tc.wantUser)
+			}
+			if got.Admin != tc.wantAdmin {
+				t.Errorf("got admin %v, want %v", got.Admin, tc.wantAdmin)
+			}
+		})
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	h := requireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	cases := []struct {
+		name   string
+		viewer account.Viewer
+		want   int
+	}{
+		{"anonymous", account.Viewer{}, http.StatusForbidden},
+		{"user", account.Viewer{User: account.User{ID: "1"}}, http.StatusForbidden},
+		{"admin", account.Viewer{User: account.User{ID: "1"}, Admin: true}, http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/debug/devicez", nil)
+			req = req.WithContext(account.NewContext(req.Context(), tc.viewer))
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tc.want {
+				t.Errorf("got status %d, want %d", rec.Code, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/datastore"
+	"github.com/mtraver/environmental-sensor/account"
+)
+
+func (db *datastoreDB) User(ctx context.Context, id string) (account.User, error) {
+	var u account.User
+	if err := db.client.Get(ctx, datastore.NameKey(db.userKind, id, nil), &u); errors.Is(err, datastore.ErrNoSuchEntity) {
+		return u, account.ErrNotFound
+	} else if err != nil {
+		return u, err
+	}
+
+	u.ID = id
+	return u, nil
+}
+
+func (db *datastoreDB) UserBySubject(ctx context.Context, issuer, subject string) (account.User, error) {
+	var users []account.User
+	q := datastore.NewQuery(db.userKind).FilterField("issuer", "=", issuer).FilterField("subject", "=", subject).Limit(1)
+	keys, err := db.client.GetAll(ctx, q, &users)
+	if err != nil {
+		return account.User{}, err
+	}
+	if len(users) == 0 {
+		return account.User{}, account.ErrNotFound
+	}
+
+	users[0].ID = keys[0].Name
+	return users[0], nil
+}
+
+func (db *datastoreDB) PutUser(ctx context.Context, u account.User) (account.User, error) {
+	u, err := account.PrepareUser(u)
+	if err != nil {
+		return u, err
+	}
+
+	if _, err := db.client.Put(ctx, datastore.NameKey(db.userKind, u.ID, nil), &u); err != nil {
+		return u, err
+	}
+
+	return u, nil
+}
+
+func (db *datastoreDB) Session(ctx context.Context, id string) (account.Session, error) {
+	var s account.Session
+	if err := db.client.Get(ctx, datastore.NameKey(db.sessionKind, id, nil), &s); errors.Is(err, datastore.ErrNoSuchEntity) {
+		return s, account.ErrNotFound
+	} else if err != nil {
+		return s, err
+	}
+
+	s.ID = id
+	return s, nil
+}
+
+func (db *datastoreDB) PutSession(ctx context.Context, s account.Session) error {
+	if s.ID == "" {
+		return errors.New("db: session ID must be set")
+	}
+
+	_, err := db.client.Put(ctx, datastore.NameKey(db.sessionKind, s.ID, nil), &s)
+	return err
+}
+
+func (db *datastoreDB) DeleteSession(ctx context.Context, id string) error {
+	return db.client.Delete(ctx, datastore.NameKey(db.sessionKind, id, nil))
+}
+
+func (db *datastoreDB) APITokens(ctx context.Context, userID string) ([]account.APIToken, error) {
+	var tokens []account.APIToken
+	keys, err := db.client.GetAll(ctx, datastore.NewQuery(db.apiTokenKind).FilterField("user_id", "=", userID), &tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, k := range keys {
+		tokens[i].ID = k.Name
+	}
+
+	return tokens, nil
+}
+
+func (db *datastoreDB) APITokenByHash(ctx context.Context, hash string) (account.APIToken, error) {
+	var tokens []account.APIToken
+	q := datastore.NewQuery(db.apiTokenKind).FilterField("hash", "=", hash).Limit(1)
+	keys, err := db.client.GetAll(ctx, q, &tokens)
+	if err != nil {
+		return account.APIToken{}, err
+	}
+	if len(tokens) == 0 {
+		return account.APIToken{}, account.ErrNotFound
+	}
+
+	tokens[0].ID = keys[0].Name
+	return tokens[0], nil
+}
+
+func (db *datastoreDB) PutAPIToken(ctx context.Context, t account.APIToken) (account.APIToken, error) {
+	t, err := account.PrepareAPIToken(t)
+	if err != nil {
+		return t, err
+	}
+
+	if _, err := db.client.Put(ctx, datastore.NameKey(db.apiTokenKind, t.ID, nil), &t); err != nil {
+		return t, err
+	}
+
+	return t, nil
+}
+
+func (db *datastoreDB) DeleteAPIToken(ctx context.Context, id string) error {
+	key := datastore.NameKey(db.apiTokenKind, id, nil)
+	if err := db.client.Get(ctx, key, &account.APIToken{}); errors.Is(err, datastore.ErrNoSuchEntity) {
+		return account.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	return db.client.Delete(ctx, key)
+}
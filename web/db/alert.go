@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/datastore"
+	"github.com/mtraver/environmental-sensor/alert"
+)
+
+func (db *datastoreDB) AlertRules(ctx context.Context) ([]alert.Rule, error) {
+	var rules []alert.Rule
+	keys, err := db.client.GetAll(ctx, datastore.NewQuery(db.alertRuleKind), &rules)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, k := range keys {
+		rules[i].ID = k.Name
+	}
+
+	return rules, nil
+}
+
+func (db *datastoreDB) AlertRule(ctx context.Context, id string) (alert.Rule, error) {
+	var r alert.Rule
+	if err := db.client.Get(ctx, datastore.NameKey(db.alertRuleKind, id, nil), &r); errors.Is(err, datastore.ErrNoSuchEntity) {
+		return r, alert.ErrNotFound
+	} else if err != nil {
+		return r, err
+	}
+
+	r.ID = id
+	return r, nil
+}
+
+func (db *datastoreDB) PutAlertRule(ctx context.Context, r alert.Rule) (alert.Rule, error) {
+	r, err := alert.PrepareRule(r)
+	if err != nil {
+		return r, err
+	}
+
+	if _, err := db.client.Put(ctx, datastore.NameKey(db.alertRuleKind, r.ID, nil), &r); err != nil {
+		return r, err
+	}
+
+	return r, nil
+}
+
+func (db *datastoreDB) DeleteAlertRule(ctx context.Context, id string) error {
+	if _, err := db.AlertRule(ctx, id); err != nil {
+		return err
+	}
+
+	keys, err := db.client.GetAll(ctx, datastore.NewQuery(db.alertStateKind).FilterField("rule_id", "=", id).KeysOnly(), nil)
+	if err != nil {
+		return err
+	}
+	keys = append(keys, datastore.NameKey(db.alertRuleKind, id, nil))
+
+	for start := 0; start < len(keys); start += putMultiLimit {
+		end := min(start+putMultiLimit, len(keys))
+		if err := db.client.DeleteMulti(ctx, keys[start:end]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *datastoreDB) AlertStates(ctx context.Context) ([]alert.State, error) {
+	var states []alert.State
+	if _, err := db.client.GetAll(ctx, datastore.NewQuery(db.alertStateKind), &states); err != nil {
+		return nil, err
+	}
+
+	return states, nil
+}
+
+func (db *datastoreDB) AlertState(ctx context.Context, ruleID, deviceID string) (alert.State, error) {
+	s := alert.NewState(ruleID, deviceID)
+	if err := db.client.Get(ctx, datastore.NameKey(db.alertStateKind, s.DBKey(), nil), &s); errors.Is(err, datastore.ErrNoSuchEntity) {
+		return alert.NewState(ruleID, deviceID), nil
+	} else if err != nil {
+		return s, err
+	}
+
+	return s, nil
+}
+
+func (db *datastoreDB) PutAlertState(ctx context.Context, s alert.State) error {
+	_, err := db.client.Put(ctx, datastore.NameKey(db.alertStateKind, s.DBKey(), nil), &s)
+	return err
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/datastore"
+	"github.com/mtraver/environmental-sensor/apiauth"
+)
+
+func (db *datastoreDB) APIKeys(ctx context.Context) ([]apiauth.APIKey, error) {
+	var keys []apiauth.APIKey
+	dsKeys, err := db.client.GetAll(ctx, datastore.NewQuery(db.apiKeyKind), &keys)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, k := range dsKeys {
+		keys[i].ID = k.Name
+	}
+
+	return keys, nil
+}
+
+func (db *datastoreDB) APIKeyByHash(ctx context.Context, hash string) (apiauth.APIKey, error) {
+	var keys []apiauth.APIKey
+	q := datastore.NewQuery(db.apiKeyKind).FilterField("hash", "=", hash).Limit(1)
+	dsKeys, err := db.client.GetAll(ctx, q, &keys)
+	if err != nil {
+		return apiauth.APIKey{}, err
+	}
+	if len(keys) == 0 {
+		return apiauth.APIKey{}, apiauth.ErrNotFound
+	}
+
+	keys[0].ID = dsKeys[0].Name
+	return keys[0], nil
+}
+
+func (db *datastoreDB) PutAPIKey(ctx context.Context, k apiauth.APIKey) (apiauth.APIKey, error) {
+	k, err := apiauth.PrepareAPIKey(k)
+	if err != nil {
+		return k, err
+	}
+
+	if _, err := db.client.Put(ctx, datastore.NameKey(db.apiKeyKind, k.ID, nil), &k); err != nil {
+		return k, err
+	}
+
+	return k, nil
+}
+
+func (db *datastoreDB) DeleteAPIKey(ctx context.Context, id string) error {
+	key := datastore.NameKey(db.apiKeyKind, id, nil)
+	if err := db.client.Get(ctx, key, &apiauth.APIKey{}); errors.Is(err, datastore.ErrNoSuchEntity) {
+		return apiauth.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	return db.client.Delete(ctx, key)
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/datastore"
+	"github.com/mtraver/environmental-sensor/calibration"
+)
+
+func (db *datastoreDB) CalibrationProfiles(ctx context.Context) ([]calibration.Profile, error) {
+	var profiles []calibration.Profile
+	keys, err := db.client.GetAll(ctx, datastore.NewQuery(db.calibrationKind), &profiles)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, k := range keys {
+		profiles[i].ID = k.Name
+	}
+
+	return profiles, nil
+}
+
+func (db *datastoreDB) CalibrationProfile(ctx context.Context, id string) (calibration.Profile, error) {
+	var p calibration.Profile
+	if err := db.client.Get(ctx, datastore.NameKey(db.calibrationKind, id, nil), &p); errors.Is(err, datastore.ErrNoSuchEntity) {
+		return p, calibration.ErrNotFound
+	} else if err != nil {
+		return p, err
+	}
+
+	p.ID = id
+	return p, nil
+}
+
+func (db *datastoreDB) PutCalibrationProfile(ctx context.Context, p calibration.Profile) (calibration.Profile, error) {
+	p, err := calibration.PrepareProfile(p)
+	if err != nil {
+		return p, err
+	}
+
+	if _, err := db.client.Put(ctx, datastore.NameKey(db.calibrationKind, p.ID, nil), &p); err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
+
+func (db *datastoreDB) DeleteCalibrationProfile(ctx context.Context, id string) error {
+	if _, err := db.CalibrationProfile(ctx, id); err != nil {
+		return err
+	}
+
+	return db.client.Delete(ctx, datastore.NameKey(db.calibrationKind, id, nil))
+}
@@ -3,14 +3,17 @@ package db
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
 	"cloud.google.com/go/datastore"
 	"github.com/maypok86/otter/v2"
 	"github.com/maypok86/otter/v2/stats"
+	"github.com/mtraver/environmental-sensor/database"
 	"github.com/mtraver/environmental-sensor/measurement"
 	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/rollup"
 	"google.golang.org/api/iterator"
 )
 
@@ -22,6 +25,20 @@ const (
 	// Datastore queries are limited to this many entities, and multiple queries
 	// are made to fetch all results.
 	queryLimit = 1000
+
+	// Datastore limits the number of entities in a single batch write or delete.
+	putMultiLimit = 500
+
+	// Datastore limits the number of values in an IN filter.
+	inLimit = 30
+
+	// Query reads at most this many entities for one page, so that a metric filter that few
+	// measurements match doesn't scan the whole time range in one request.
+	queryScanLimit = 10 * queryLimit
+
+	// Separates the cursors of the queries that make up a query of many devices. It's not in
+	// the alphabet of Datastore cursors, which are base64url-encoded.
+	cursorSep = "."
 )
 
 // cacheKeyLatest returns the cache key of the latest measurement for the given device ID.
@@ -30,8 +47,27 @@ func cacheKeyLatest(deviceID string) string {
 }
 
 type datastoreDB struct {
-	projectID   string
-	kind        string
+	projectID  string
+	kind       string
+	rollupKind string
+	deviceKind string
+
+	alertRuleKind  string
+	alertStateKind string
+
+	calibrationKind string
+
+	apiKeyKind string
+
+	userKind     string
+	sessionKind  string
+	apiTokenKind string
+
+	dedupeKind     string
+	quarantineKind string
+
+	routingRuleKind string
+
 	client      *datastore.Client
 	latestCache *otter.Cache[string, *mpb.Measurement]
 }
@@ -51,15 +87,35 @@ func NewDatastoreDB(projectID string, kind string) (*datastoreDB, error) {
 	}
 
 	return &datastoreDB{
-		projectID:   projectID,
-		kind:        kind,
+		projectID:  projectID,
+		kind:       kind,
+		rollupKind: kind + "_rollup",
+		deviceKind: kind + "_device",
+
+		alertRuleKind:  kind + "_alert_rule",
+		alertStateKind: kind + "_alert_state",
+
+		calibrationKind: kind + "_calibration",
+
+		apiKeyKind: kind + "_api_key",
+
+		userKind:     kind + "_user",
+		sessionKind:  kind + "_session",
+		apiTokenKind: kind + "_api_token",
+
+		dedupeKind:     kind + "_dedupe",
+		quarantineKind: kind + "_quarantine",
+
+		routingRuleKind: kind + "_routing_rule",
+
 		client:      client,
 		latestCache: cache,
 	}, nil
 }
 
-// Save saves the given Measurement to the database. If the Measurement already exists in the
-// database it makes no change to the database and returns nil as the error.
+// Save saves the given Measurement to the database and adds its values to the hourly and daily
+// rollups. If the Measurement already exists in the database it makes no change to the database
+// and returns nil as the error.
 func (db *datastoreDB) Save(ctx context.Context, m *mpb.Measurement) error {
 	sm, err := measurement.NewStorableMeasurement(m)
 	if err != nil {
@@ -67,16 +123,33 @@ func (db *datastoreDB) Save(ctx context.Context, m *mpb.Measurement) error {
 	}
 
 	key := datastore.NameKey(db.kind, sm.DBKey(), nil)
+	buckets := rollup.FromMeasurement(sm)
 
-	// Only store the measurement if it doesn't exist
+	// Only store the measurement if it doesn't exist. The rollups are updated in the same
+	// transaction so that a redelivered measurement isn't counted twice.
 	_, err = db.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
 		var x measurement.StorableMeasurement
 		if err := tx.Get(key, &x); err != datastore.ErrNoSuchEntity {
 			return err
 		}
 
-		_, err := tx.Put(key, &sm)
-		return err
+		// It may have been saved before sub-second timestamps were distinguished, under a key
+		// to the second. A measurement taken on the second may have that key too, so check the
+		// timestamp.
+		if legacy := sm.LegacyDBKey(); legacy != sm.DBKey() {
+			err := tx.Get(datastore.NameKey(db.kind, legacy, nil), &x)
+			if err == nil && x.Timestamp.Equal(sm.Timestamp.Truncate(time.Microsecond)) {
+				return nil
+			} else if err != nil && err != datastore.ErrNoSuchEntity {
+				return err
+			}
+		}
+
+		if _, err := tx.Put(key, &sm); err != nil {
+			return err
+		}
+
+		return db.addToRollups(tx, buckets)
 	})
 
 	// Each device has a cache entry for its latest value. Update it.
@@ -87,9 +160,8 @@ func (db *datastoreDB) Save(ctx context.Context, m *mpb.Measurement) error {
 	return err
 }
 
-func (db *datastoreDB) executeQuery(ctx context.Context, q *datastore.Query) (map[string][]measurement.StorableMeasurement, error) {
-	results := make(map[string][]measurement.StorableMeasurement)
-
+// runPaged runs q in pages of queryLimit entities, calling fn with each entity in order.
+func runPaged[T any](ctx context.Context, client *datastore.Client, q *datastore.Query, fn func(T)) error {
 	// Don't modify the original query. We'll continue to derive queries from it
 	// using a cursor to break apart the whole query into multiple smaller ones.
 	derivedQuery := q.Limit(queryLimit)
@@ -97,14 +169,14 @@ func (db *datastoreDB) executeQuery(ctx context.Context, q *datastore.Query) (ma
 	for {
 		processed := 0
 
-		it := db.client.Run(ctx, derivedQuery)
+		it := client.Run(ctx, derivedQuery)
 		for {
-			var sm measurement.StorableMeasurement
-			_, err := it.Next(&sm)
+			var entity T
+			_, err := it.Next(&entity)
 			if err == iterator.Done {
 				cursor, err := it.Cursor()
 				if err != nil {
-					return make(map[string][]measurement.StorableMeasurement), err
+					return err
 				}
 
 				// The current query finished, so make a new one that starts
@@ -112,23 +184,30 @@ func (db *datastoreDB) executeQuery(ctx context.Context, q *datastore.Query) (ma
 				derivedQuery = q.Start(cursor).Limit(queryLimit)
 				break
 			} else if err != nil {
-				return make(map[string][]measurement.StorableMeasurement), err
-			}
-
-			if _, ok := results[sm.DeviceID]; !ok {
-				results[sm.DeviceID] = []measurement.StorableMeasurement{}
+				return err
 			}
-			results[sm.DeviceID] = append(results[sm.DeviceID], sm)
 
+			fn(entity)
 			processed++
 		}
 
 		if processed < queryLimit {
 			// The last query returned fewer results than the limit, meaning that a
 			// subsequent query would return nothing, so we're done.
-			break
+			return nil
 		}
 	}
+}
+
+func (db *datastoreDB) executeQuery(ctx context.Context, q *datastore.Query) (map[string][]measurement.StorableMeasurement, error) {
+	results := make(map[string][]measurement.StorableMeasurement)
+
+	err := runPaged(ctx, db.client, q, func(sm measurement.StorableMeasurement) {
+		results[sm.DeviceID] = append(results[sm.DeviceID], sm)
+	})
+	if err != nil {
+		return make(map[string][]measurement.StorableMeasurement), err
+	}
 
 	return results, nil
 }
@@ -159,6 +238,175 @@ func (db *datastoreDB) Between(ctx context.Context, startTime time.Time, endTime
 	return db.executeQuery(ctx, q)
 }
 
+// deviceBatches splits ids, without duplicates, into batches small enough for an IN filter. If
+// ids is empty then it returns one empty batch, which selects every device.
+func deviceBatches(ids []string) [][]string {
+	var unique []string
+	seen := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			unique = append(unique, id)
+		}
+	}
+
+	if len(unique) == 0 {
+		return [][]string{nil}
+	}
+
+	var batches [][]string
+	for start := 0; start < len(unique); start += inLimit {
+		end := min(start+inLimit, len(unique))
+		batches = append(batches, unique[start:end])
+	}
+	return batches
+}
+
+// filterDevices returns q filtered to the given devices, which must fit in an IN filter. If ids
+// is empty then q is returned unchanged.
+func filterDevices(q *datastore.Query, ids []string) *datastore.Query {
+	switch len(ids) {
+	case 0:
+		return q
+	case 1:
+		return q.FilterField("device_id", "=", ids[0])
+	default:
+		values := make([]interface{}, len(ids))
+		for i, id := range ids {
+			values[i] = id
+		}
+		return q.FilterField("device_id", "in", values)
+	}
+}
+
+// queryStream reads the results of one of the queries that make up a Query.
+type queryStream struct {
+	it *datastore.Iterator
+
+	// cursor resumes the query after the last measurement taken from the stream.
+	cursor string
+
+	// head is the next measurement in the stream, or nil if there are no more, and headCursor
+	// resumes the query after it.
+	head       *measurement.StorableMeasurement
+	headCursor string
+}
+
+// advance reads the next measurement into head.
+func (s *queryStream) advance() error {
+	var sm measurement.StorableMeasurement
+	_, err := s.it.Next(&sm)
+	if errors.Is(err, iterator.Done) {
+		s.head = nil
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	cursor, err := s.it.Cursor()
+	if err != nil {
+		return err
+	}
+
+	s.head, s.headCursor = &sm, cursor.String()
+	return nil
+}
+
+// take returns head, which must not be nil, and reads the next measurement.
+func (s *queryStream) take() (measurement.StorableMeasurement, error) {
+	sm := *s.head
+	s.cursor = s.headCursor
+	return sm, s.advance()
+}
+
+// streamsCursor returns the cursor that resumes each of the streams after the measurements
+// taken from them.
+func streamsCursor(streams []*queryStream) string {
+	cursors := make([]string, len(streams))
+	for i, s := range streams {
+		cursors[i] = s.cursor
+	}
+	return strings.Join(cursors, cursorSep)
+}
+
+// Query gets one page of the measurements selected by q, in timestamp order. Device and time
+// filters are applied by Datastore; the metric filter is applied as results are read. Because
+// an IN filter is limited to inLimit values, the devices are queried in batches whose results
+// are merged, and the page's cursors hold the cursor of each batch's query. At most
+// queryScanLimit measurements are read for the page, so it may hold fewer than q.Limit.
+func (db *datastoreDB) Query(ctx context.Context, q database.Query) (database.Page, error) {
+	batches := deviceBatches(q.DeviceIDs)
+
+	cursors := make([]string, len(batches))
+	if q.Cursor != "" {
+		cursors = strings.Split(q.Cursor, cursorSep)
+		if len(cursors) != len(batches) {
+			return database.Page{}, fmt.Errorf("db: invalid cursor: it has %d parts, want %d", len(cursors), len(batches))
+		}
+	}
+
+	streams := make([]*queryStream, len(batches))
+	for i, ids := range batches {
+		dq := datastore.NewQuery(db.kind).Filter("timestamp >=", q.StartTime)
+		if !q.EndTime.IsZero() {
+			dq = dq.Filter("timestamp <=", q.EndTime)
+		}
+		dq = filterDevices(dq, ids).Order("timestamp")
+
+		if cursors[i] != "" {
+			cursor, err := datastore.DecodeCursor(cursors[i])
+			if err != nil {
+				return database.Page{}, fmt.Errorf("db: invalid cursor: %w", err)
+			}
+			dq = dq.Start(cursor)
+		}
+
+		streams[i] = &queryStream{it: db.client.Run(ctx, dq), cursor: cursors[i]}
+		if err := streams[i].advance(); err != nil {
+			return database.Page{}, err
+		}
+	}
+
+	var page database.Page
+	for scanned := 0; ; scanned++ {
+		// Take the earliest measurement of all the streams.
+		var next *queryStream
+		for _, s := range streams {
+			if s.head != nil && (next == nil || s.head.Timestamp.Before(next.head.Timestamp)) {
+				next = s
+			}
+		}
+		if next == nil {
+			return page, nil
+		}
+
+		if scanned == queryScanLimit {
+			// Resume after the last measurement read rather than the last one matched.
+			page.HasNextPage = true
+			page.End = streamsCursor(streams)
+			return page, nil
+		}
+
+		sm, err := next.take()
+		if err != nil {
+			return database.Page{}, err
+		}
+
+		if !q.Match(&sm) {
+			continue
+		}
+
+		if q.Limit > 0 && len(page.Measurements) == q.Limit {
+			// The page is full and we've found another match, so there's a next page.
+			page.HasNextPage = true
+			return page, nil
+		}
+
+		page.Measurements = append(page.Measurements, sm)
+		page.Cursors = append(page.Cursors, streamsCursor(streams))
+	}
+}
+
 // Latest gets the most recent measurement for each of the given device IDs. It returns a map of
 // device ID to StorableMeasurement, and an error. If no measurement is found for a device ID then
 // the returned map will not contain that device ID.
@@ -198,6 +446,80 @@ func (db *datastoreDB) Latest(ctx context.Context, deviceIDs []string) (map[stri
 	return latest, nil
 }
 
+// Oldest gets the measurement with the earliest timestamp. found is false if the database is empty.
+func (db *datastoreDB) Oldest(ctx context.Context) (sm measurement.StorableMeasurement, found bool, err error) {
+	q := datastore.NewQuery(db.kind).Order("timestamp").Limit(1)
+	it := db.client.Run(ctx, q)
+
+	if _, err := it.Next(&sm); errors.Is(err, iterator.Done) {
+		// Nothing found.
+		return sm, false, nil
+	} else if err != nil {
+		return sm, false, err
+	}
+
+	return sm, true, nil
+}
+
+// Delete deletes the given measurements. Measurements that don't exist are ignored. Rollups
+// are not modified, so they continue to summarize deleted measurements.
+func (db *datastoreDB) Delete(ctx context.Context, measurements []measurement.StorableMeasurement) error {
+	keys, err := db.storedKeys(ctx, measurements)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(keys); start += putMultiLimit {
+		end := min(start+putMultiLimit, len(keys))
+		if err := db.client.DeleteMulti(ctx, keys[start:end]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// storedKeys returns the keys that the given measurements may be stored under. Measurements
+// with sub-second timestamps that were saved before those were distinguished are stored under
+// their legacy keys, which are to the second. A measurement taken on the second may be stored
+// under the same legacy key, so a legacy key is only returned if the entity stored under it has
+// the measurement's timestamp.
+func (db *datastoreDB) storedKeys(ctx context.Context, measurements []measurement.StorableMeasurement) ([]*datastore.Key, error) {
+	var keys, legacyKeys []*datastore.Key
+	var legacy []measurement.StorableMeasurement
+	for _, sm := range measurements {
+		keys = append(keys, datastore.NameKey(db.kind, sm.DBKey(), nil))
+		if sm.LegacyDBKey() != sm.DBKey() {
+			legacyKeys = append(legacyKeys, datastore.NameKey(db.kind, sm.LegacyDBKey(), nil))
+			legacy = append(legacy, sm)
+		}
+	}
+
+	for start := 0; start < len(legacyKeys); start += queryLimit {
+		end := min(start+queryLimit, len(legacyKeys))
+
+		stored := make([]measurement.StorableMeasurement, end-start)
+		var merr datastore.MultiError
+		if err := db.client.GetMulti(ctx, legacyKeys[start:end], stored); err != nil && !errors.As(err, &merr) {
+			return nil, err
+		}
+
+		for i := range stored {
+			if merr != nil && merr[i] != nil {
+				if !errors.Is(merr[i], datastore.ErrNoSuchEntity) {
+					return nil, merr[i]
+				}
+				continue
+			}
+			if stored[i].Timestamp.Equal(legacy[start+i].Timestamp.Truncate(time.Microsecond)) {
+				keys = append(keys, legacyKeys[start+i])
+			}
+		}
+	}
+
+	return keys, nil
+}
+
 // latestFromCache looks up the latest measurement for a device in the cache.
 // found is false if there was no cache configured or the key isn't present.
 func (db *datastoreDB) latestFromCache(ctx context.Context, deviceID string) (sm measurement.StorableMeasurement, found bool, err error) {
@@ -1,7 +1,10 @@
 package db
 
 import (
+	"fmt"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestCacheKeyLatest(t *testing.T) {
@@ -11,3 +14,29 @@ func TestCacheKeyLatest(t *testing.T) {
 		t.Errorf("got %q, want %q", got, want)
 	}
 }
+
+func TestDeviceBatches(t *testing.T) {
+	var ids []string
+	for i := range inLimit + 5 {
+		ids = append(ids, fmt.Sprintf("device%d", i))
+	}
+
+	cases := []struct {
+		name string
+		ids  []string
+		want [][]string
+	}{
+		{"none", nil, [][]string{nil}},
+		{"duplicates", []string{"foo", "bar", "foo"}, [][]string{{"foo", "bar"}}},
+		{"full", ids[:inLimit], [][]string{ids[:inLimit]}},
+		{"more than fit", append(ids, ids[0]), [][]string{ids[:inLimit], ids[inLimit:]}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, deviceBatches(tc.ids)); diff != "" {
+				t.Errorf("Unexpected batches (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// claim is the entity that records that a measurement has been ingested. Its key is the
+// measurement's dedupe key. Expired claims may be deleted with a TTL policy on expires.
+type claim struct {
+	Expires time.Time `datastore:"expires"`
+}
+
+func (db *datastoreDB) ClaimMessage(ctx context.Context, key string, expires time.Time) (bool, error) {
+	k := datastore.NameKey(db.dedupeKind, key, nil)
+
+	claimed := false
+	_, err := db.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		claimed = false
+
+		var c claim
+		if err := tx.Get(k, &c); err == nil && c.Expires.After(time.Now()) {
+			return nil
+		} else if err != nil && !errors.Is(err, datastore.ErrNoSuchEntity) {
+			return err
+		}
+
+		if _, err := tx.Put(k, &claim{Expires: expires.UTC()}); err != nil {
+			return err
+		}
+		claimed = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return claimed, nil
+}
+
+func (db *datastoreDB) ReleaseMessage(ctx context.Context, key string) error {
+	return db.client.Delete(ctx, datastore.NameKey(db.dedupeKind, key, nil))
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/mtraver/environmental-sensor/device"
+)
+
+func (db *datastoreDB) Devices(ctx context.Context) ([]device.Device, error) {
+	var devices []device.Device
+	keys, err := db.client.GetAll(ctx, datastore.NewQuery(db.deviceKind), &devices)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, k := range keys {
+		devices[i].ID = k.Name
+	}
+
+	device.Sort(devices)
+	return devices, nil
+}
+
+func (db *datastoreDB) Device(ctx context.Context, id string) (device.Device, error) {
+	var d device.Device
+	if err := db.client.Get(ctx, datastore.NameKey(db.deviceKind, id, nil), &d); errors.Is(err, datastore.ErrNoSuchEntity) {
+		return d, device.ErrNotFound
+	} else if err != nil {
+		return d, err
+	}
+
+	d.ID = id
+	return d, nil
+}
+
+func (db *datastoreDB) DeviceByDeviceID(ctx context.Context, deviceID string) (device.Device, bool, error) {
+	// The device ID may be the device's current ID or one of its aliases.
+	for _, field := range []string{"device_id", "aliases"} {
+		var devices []device.Device
+		q := datastore.NewQuery(db.deviceKind).FilterField(field, "=", deviceID).Limit(1)
+		keys, err := db.client.GetAll(ctx, q, &devices)
+		if err != nil {
+			return device.Device{}, false, err
+		}
+
+		if len(devices) > 0 {
+			devices[0].ID = keys[0].Name
+			return devices[0], true, nil
+		}
+	}
+
+	return device.Device{}, false, nil
+}
+
+func (db *datastoreDB) PutDevice(ctx context.Context, d device.Device) (device.Device, error) {
+	d, err := device.Prepare(ctx, db, d, time.Now().UTC())
+	if err != nil {
+		return d, err
+	}
+
+	if _, err := db.client.Put(ctx, datastore.NameKey(db.deviceKind, d.ID, nil), &d); err != nil {
+		return d, err
+	}
+
+	return d, nil
+}
+
+func (db *datastoreDB) DeleteDevice(ctx context.Context, id string) error {
+	if _, err := db.Device(ctx, id); err != nil {
+		return err
+	}
+
+	return db.client.Delete(ctx, datastore.NameKey(db.deviceKind, id, nil))
+}
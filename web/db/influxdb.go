@@ -2,14 +2,19 @@ package db
 
 import (
 	"context"
+	"maps"
+	"slices"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/mtraver/environmental-sensor/ingest"
 	"github.com/mtraver/environmental-sensor/measurement"
 	mpb "github.com/mtraver/environmental-sensor/measurementpb"
 )
 
-func newInfluxDBPoints(m *mpb.Measurement) ([]*write.Point, error) {
+// newInfluxDBPoints returns a point for each of m's values, tagged with m's device and with tags.
+// The device tag can't be overridden.
+func newInfluxDBPoints(m *mpb.Measurement, tags map[string]string) ([]*write.Point, error) {
 	sm, err := measurement.NewStorableMeasurement(m)
 	if err != nil {
 		return nil, err
@@ -21,8 +26,13 @@ func newInfluxDBPoints(m *mpb.Measurement) ([]*write.Point, error) {
 			continue
 		}
 
-		p := influxdb2.NewPointWithMeasurement("stat").AddField(string(k), *v)
-		points = append(points, p.AddTag("device", sm.DeviceID).SetTime(sm.Timestamp))
+		p := influxdb2.NewPointWithMeasurement("stat").AddField(string(k), *v).AddTag("device", sm.DeviceID)
+		for _, key := range slices.Sorted(maps.Keys(tags)) {
+			if key != "device" {
+				p.AddTag(key, tags[key])
+			}
+		}
+		points = append(points, p.SetTime(sm.Timestamp))
 	}
 
 	return points, nil
@@ -45,7 +55,7 @@ func NewInfluxDB(serverURL, token, org, bucket string) *InfluxDB {
 }
 
 func (db *InfluxDB) Save(ctx context.Context, m *mpb.Measurement) error {
-	points, err := newInfluxDBPoints(m)
+	points, err := newInfluxDBPoints(m, ingest.Tags(ctx))
 	if err != nil {
 		return err
 	}
@@ -28,6 +28,7 @@ func TestNewInfluxDBPoints(t *testing.T) {
 	cases := []struct {
 		name string
 		m    *mpb.Measurement
+		tags map[string]string
 		want []*write.Point
 	}{
 		{
@@ -40,11 +41,22 @@ func TestNewInfluxDBPoints(t *testing.T) {
 				influxdb2.NewPointWithMeasurement("stat").AddTag("device", "foo").AddField("rh", 55.0).SetTime(testutil.Timestamp),
 			},
 		},
+		{
+			name: "tags",
+			m:    testMeasurement,
+			tags: map[string]string{"site": "lab", "device": "bar", "floor": "2"},
+			want: []*write.Point{
+				influxdb2.NewPointWithMeasurement("stat").AddTag("device", "foo").AddTag("floor", "2").AddTag("site", "lab").AddField("temp", 18.3748).SetTime(testutil.Timestamp),
+				influxdb2.NewPointWithMeasurement("stat").AddTag("device", "foo").AddTag("floor", "2").AddTag("site", "lab").AddField("pm25", 12.0).SetTime(testutil.Timestamp),
+				influxdb2.NewPointWithMeasurement("stat").AddTag("device", "foo").AddTag("floor", "2").AddTag("site", "lab").AddField("pm10", 20.0).SetTime(testutil.Timestamp),
+				influxdb2.NewPointWithMeasurement("stat").AddTag("device", "foo").AddTag("floor", "2").AddTag("site", "lab").AddField("rh", 55.0).SetTime(testutil.Timestamp),
+			},
+		},
 	}
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
-			got, err := newInfluxDBPoints(testMeasurement)
+			got, err := newInfluxDBPoints(c.m, c.tags)
 			if err != nil {
 				t.Errorf("Unexpected error: %v", err)
 			}
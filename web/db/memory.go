@@ -0,0 +1,822 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/maypok86/otter/v2/stats"
+	"github.com/mtraver/environmental-sensor/account"
+	"github.com/mtraver/environmental-sensor/alert"
+	"github.com/mtraver/environmental-sensor/apiauth"
+	"github.com/mtraver/environmental-sensor/calibration"
+	"github.com/mtraver/environmental-sensor/database"
+	"github.com/mtraver/environmental-sensor/device"
+	"github.com/mtraver/environmental-sensor/measurement"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/quarantine"
+	"github.com/mtraver/environmental-sensor/rollup"
+	"github.com/mtraver/environmental-sensor/routing"
+)
+
+// MemoryDB is an in-memory implementation of database.Database. It behaves like the
+// Datastore implementation (including rollups) and is intended for tests and local development.
+type MemoryDB struct {
+	mu           sync.RWMutex
+	measurements map[string]measurement.StorableMeasurement
+	rollups      map[string]rollup.Bucket
+	devices      map[string]device.Device
+	alertRules   map[string]alert.Rule
+	alertStates  map[string]alert.State
+	calibrations map[string]calibration.Profile
+	apiKeys      map[string]apiauth.APIKey
+	users        map[string]account.User
+	sessions     map[string]account.Session
+	apiTokens    map[string]account.APIToken
+	claims       map[string]time.Time
+	quarantined  map[string]quarantine.Entry
+	routingRules map[string]routing.Rule
+}
+
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		measurements: make(map[string]measurement.StorableMeasurement),
+		rollups:      make(map[string]rollup.Bucket),
+		devices:      make(map[string]device.Device),
+		alertRules:   make(map[string]alert.Rule),
+		alertStates:  make(map[string]alert.State),
+		calibrations: make(map[string]calibration.Profile),
+		apiKeys:      make(map[string]apiauth.APIKey),
+		users:        make(map[string]account.User),
+		sessions:     make(map[string]account.Session),
+		apiTokens:    make(map[string]account.APIToken),
+		claims:       make(map[string]time.Time),
+		quarantined:  make(map[string]quarantine.Entry),
+		routingRules: make(map[string]routing.Rule),
+	}
+}
+
+// Save saves the given Measurement and adds its values to the rollups. If the Measurement
+// already exists it makes no change and returns nil as the error.
+func (db *MemoryDB) Save(ctx context.Context, m *mpb.Measurement) error {
+	sm, err := measurement.NewStorableMeasurement(m)
+	if err != nil {
+		return err
+	}
+
+	// Datastore stores times to the microsecond.
+	sm.Timestamp = sm.Timestamp.Truncate(time.Microsecond)
+	sm.UploadTimestamp = sm.UploadTimestamp.Truncate(time.Microsecond)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.measurements[sm.DBKey()]; ok {
+		return nil
+	}
+	if stored, ok := db.measurements[sm.LegacyDBKey()]; ok && stored.Timestamp.Equal(sm.Timestamp) {
+		return nil
+	}
+	db.measurements[sm.DBKey()] = sm
+
+	for _, b := range rollup.FromMeasurement(sm) {
+		stored, ok := db.rollups[b.DBKey()]
+		if !ok {
+			stored = rollup.NewBucket(b.DeviceID, b.Metric, b.Resolution, b.Start)
+		}
+		stored.Merge(b)
+		db.rollups[b.DBKey()] = stored
+	}
+
+	return nil
+}
+
+// filter returns the measurements for which keep returns true, grouped by device ID and
+// sorted by timestamp.
+func (db *MemoryDB) filter(keep func(sm measurement.StorableMeasurement) bool) map[string][]measurement.StorableMeasurement {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	results := make(map[string][]measurement.StorableMeasurement)
+	for _, sm := range db.measurements {
+		if keep(sm) {
+			results[sm.DeviceID] = append(results[sm.DeviceID], sm)
+		}
+	}
+
+	for _, sms := range results {
+		sort.Slice(sms, func(i, j int) bool {
+			return sms[i].Timestamp.Before(sms[j].Timestamp)
+		})
+	}
+
+	return results
+}
+
+func (db *MemoryDB) Since(ctx context.Context, startTime time.Time) (map[string][]measurement.StorableMeasurement, error) {
+	return db.filter(func(sm measurement.StorableMeasurement) bool {
+		return !sm.Timestamp.Before(startTime)
+	}), nil
+}
+
+func (db *MemoryDB) DelayedSince(ctx context.Context, startTime time.Time) (map[string][]measurement.StorableMeasurement, error) {
+	return db.filter(func(sm measurement.StorableMeasurement) bool {
+		return !sm.UploadTimestamp.IsZero() && !sm.UploadTimestamp.Before(startTime)
+	}), nil
+}
+
+func (db *MemoryDB) Between(ctx context.Context, startTime time.Time, endTime time.Time) (map[string][]measurement.StorableMeasurement, error) {
+	return db.filter(func(sm measurement.StorableMeasurement) bool {
+		return !sm.Timestamp.Before(startTime) && !sm.Timestamp.After(endTime)
+	}), nil
+}
+
+// memoryCursor returns the cursor that resumes a query after sm. Results are ordered by
+// timestamp and then by key, so the cursor records both.
+func memoryCursor(sm measurement.StorableMeasurement) string {
+	return base64.URLEncoding.EncodeToString([]byte(sm.Timestamp.Format(time.RFC3339Nano) + keySep + sm.DBKey()))
+}
+
+// afterCursor reports whether sm comes after the position recorded in cursor.
+func afterCursor(sm measurement.StorableMeasurement, cursor string) (bool, error) {
+	b, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil {
+		return false, fmt.Errorf("db: invalid cursor: %w", err)
+	}
+
+	tsStr, key, ok := strings.Cut(string(b), keySep)
+	if !ok {
+		return false, fmt.Errorf("db: invalid cursor")
+	}
+
+	ts, err := time.Parse(time.RFC3339Nano, tsStr)
+	if err != nil {
+		return false, fmt.Errorf("db: invalid cursor: %w", err)
+	}
+
+	if !sm.Timestamp.Equal(ts) {
+		return sm.Timestamp.After(ts), nil
+	}
+	return sm.DBKey() > key, nil
+}
+
+func (db *MemoryDB) Query(ctx context.Context, q database.Query) (database.Page, error) {
+	db.mu.RLock()
+	var sms []measurement.StorableMeasurement
+	for _, sm := range db.measurements {
+		if sm.Timestamp.Before(q.StartTime) || (!q.EndTime.IsZero() && sm.Timestamp.After(q.EndTime)) {
+			continue
+		}
+		sms = append(sms, sm)
+	}
+	db.mu.RUnlock()
+
+	sort.Slice(sms, func(i, j int) bool {
+		if !sms[i].Timestamp.Equal(sms[j].Timestamp) {
+			return sms[i].Timestamp.Before(sms[j].Timestamp)
+		}
+		return sms[i].DBKey() < sms[j].DBKey()
+	})
+
+	var page database.Page
+	for _, sm := range sms {
+		if q.Cursor != "" {
+			after, err := afterCursor(sm, q.Cursor)
+			if err != nil {
+				return database.Page{}, err
+			}
+			if !after {
+				continue
+			}
+		}
+
+		if !q.Match(&sm) {
+			continue
+		}
+
+		if q.Limit > 0 && len(page.Measurements) == q.Limit {
+			page.HasNextPage = true
+			break
+		}
+
+		page.Measurements = append(page.Measurements, sm)
+		page.Cursors = append(page.Cursors, memoryCursor(sm))
+	}
+
+	return page, nil
+}
+
+func (db *MemoryDB) Latest(ctx context.Context, deviceIDs []string) (map[string]measurement.StorableMeasurement, error) {
+	ids := make(map[string]struct{}, len(deviceIDs))
+	for _, id := range deviceIDs {
+		ids[id] = struct{}{}
+	}
+
+	latest := make(map[string]measurement.StorableMeasurement)
+	for id, sms := range db.filter(func(sm measurement.StorableMeasurement) bool {
+		_, ok := ids[sm.DeviceID]
+		return ok
+	}) {
+		latest[id] = sms[len(sms)-1]
+	}
+
+	return latest, nil
+}
+
+func (db *MemoryDB) Oldest(ctx context.Context) (measurement.StorableMeasurement, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var oldest measurement.StorableMeasurement
+	found := false
+	for _, sm := range db.measurements {
+		if !found || sm.Timestamp.Before(oldest.Timestamp) {
+			oldest = sm
+			found = true
+		}
+	}
+
+	return oldest, found, nil
+}
+
+func (db *MemoryDB) Delete(ctx context.Context, measurements []measurement.StorableMeasurement) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, sm := range measurements {
+		delete(db.measurements, sm.DBKey())
+		if stored, ok := db.measurements[sm.LegacyDBKey()]; ok && stored.Timestamp.Equal(sm.Timestamp) {
+			delete(db.measurements, sm.LegacyDBKey())
+		}
+	}
+
+	return nil
+}
+
+func (db *MemoryDB) Rollups(ctx context.Context, res rollup.Resolution, deviceIDs []string, startTime time.Time, endTime time.Time) (map[string][]rollup.Bucket, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	results := make(map[string][]rollup.Bucket)
+	for _, b := range db.rollups {
+		if len(deviceIDs) > 0 && !slices.Contains(deviceIDs, b.DeviceID) {
+			continue
+		}
+		if b.Resolution == res && !b.Start.Before(startTime) && !b.Start.After(endTime) {
+			results[b.DeviceID] = append(results[b.DeviceID], b)
+		}
+	}
+
+	for _, bs := range results {
+		sort.Slice(bs, func(i, j int) bool {
+			if !bs[i].Start.Equal(bs[j].Start) {
+				return bs[i].Start.Before(bs[j].Start)
+			}
+			return bs[i].Metric < bs[j].Metric
+		})
+	}
+
+	return results, nil
+}
+
+func (db *MemoryDB) PutRollups(ctx context.Context, buckets []rollup.Bucket) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, b := range buckets {
+		db.rollups[b.DBKey()] = b
+	}
+
+	return nil
+}
+
+func (db *MemoryDB) Devices(ctx context.Context) ([]device.Device, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	devices := make([]device.Device, 0, len(db.devices))
+	for _, d := range db.devices {
+		devices = append(devices, d)
+	}
+
+	device.Sort(devices)
+	return devices, nil
+}
+
+func (db *MemoryDB) Device(ctx context.Context, id string) (device.Device, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	d, ok := db.devices[id]
+	if !ok {
+		return d, device.ErrNotFound
+	}
+	return d, nil
+}
+
+func (db *MemoryDB) DeviceByDeviceID(ctx context.Context, deviceID string) (device.Device, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, d := range db.devices {
+		if slices.Contains(d.DeviceIDs(), deviceID) {
+			return d, true, nil
+		}
+	}
+
+	return device.Device{}, false, nil
+}
+
+func (db *MemoryDB) PutDevice(ctx context.Context, d device.Device) (device.Device, error) {
+	d, err := device.Prepare(ctx, db, d, time.Now().UTC())
+	if err != nil {
+		return d, err
+	}
+
+	// Don't share slices with the caller.
+	d.Aliases = slices.Clone(d.Aliases)
+	d.Sensors = slices.Clone(d.Sensors)
+	d.Tags = slices.Clone(d.Tags)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.devices[d.ID] = d
+
+	return d, nil
+}
+
+func (db *MemoryDB) DeleteDevice(ctx context.Context, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.devices[id]; !ok {
+		return device.ErrNotFound
+	}
+	delete(db.devices, id)
+
+	return nil
+}
+
+func (db *MemoryDB) AlertRules(ctx context.Context) ([]alert.Rule, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	rules := make([]alert.Rule, 0, len(db.alertRules))
+	for _, r := range db.alertRules {
+		rules = append(rules, r)
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].ID < rules[j].ID
+	})
+	return rules, nil
+}
+
+func (db *MemoryDB) AlertRule(ctx context.Context, id string) (alert.Rule, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	r, ok := db.alertRules[id]
+	if !ok {
+		return r, alert.ErrNotFound
+	}
+	return r, nil
+}
+
+func (db *MemoryDB) PutAlertRule(ctx context.Context, r alert.Rule) (alert.Rule, error) {
+	r, err := alert.PrepareRule(r)
+	if err != nil {
+		return r, err
+	}
+	r.Channels = slices.Clone(r.Channels)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.alertRules[r.ID] = r
+
+	return r, nil
+}
+
+func (db *MemoryDB) DeleteAlertRule(ctx context.Context, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.alertRules[id]; !ok {
+		return alert.ErrNotFound
+	}
+	delete(db.alertRules, id)
+
+	for k, s := range db.alertStates {
+		if s.RuleID == id {
+			delete(db.alertStates, k)
+		}
+	}
+
+	return nil
+}
+
+func (db *MemoryDB) AlertStates(ctx context.Context) ([]alert.State, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	states := make([]alert.State, 0, len(db.alertStates))
+	for _, s := range db.alertStates {
+		states = append(states, s)
+	}
+
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].DBKey() < states[j].DBKey()
+	})
+	return states, nil
+}
+
+func (db *MemoryDB) AlertState(ctx context.Context, ruleID, deviceID string) (alert.State, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	s, ok := db.alertStates[alert.NewState(ruleID, deviceID).DBKey()]
+	if !ok {
+		return alert.NewState(ruleID, deviceID), nil
+	}
+	return s, nil
+}
+
+func (db *MemoryDB) PutAlertState(ctx context.Context, s alert.State) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.alertStates[s.DBKey()] = s
+	return nil
+}
+
+func (db *MemoryDB) CalibrationProfiles(ctx context.Context) ([]calibration.Profile, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	profiles := make([]calibration.Profile, 0, len(db.calibrations))
+	for _, p := range db.calibrations {
+		profiles = append(profiles, p)
+	}
+
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].ID < profiles[j].ID
+	})
+	return profiles, nil
+}
+
+func (db *MemoryDB) CalibrationProfile(ctx context.Context, id string) (calibration.Profile, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	p, ok := db.calibrations[id]
+	if !ok {
+		return p, calibration.ErrNotFound
+	}
+	return p, nil
+}
+
+func (db *MemoryDB) PutCalibrationProfile(ctx context.Context, p calibration.Profile) (calibration.Profile, error) {
+	p, err := calibration.PrepareProfile(p)
+	if err != nil {
+		return p, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.calibrations[p.ID] = p
+
+	return p, nil
+}
+
+func (db *MemoryDB) DeleteCalibrationProfile(ctx context.Context, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.calibrations[id]; !ok {
+		return calibration.ErrNotFound
+	}
+	delete(db.calibrations, id)
+
+	return nil
+}
+
+func (db *MemoryDB) APIKeys(ctx context.Context) ([]apiauth.APIKey, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	keys := make([]apiauth.APIKey, 0, len(db.apiKeys))
+	for _, k := range db.apiKeys {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+func (db *MemoryDB) APIKeyByHash(ctx context.Context, hash string) (apiauth.APIKey, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, k := range db.apiKeys {
+		if k.Hash == hash {
+			return k, nil
+		}
+	}
+	return apiauth.APIKey{}, apiauth.ErrNotFound
+}
+
+func (db *MemoryDB) PutAPIKey(ctx context.Context, k apiauth.APIKey) (apiauth.APIKey, error) {
+	k, err := apiauth.PrepareAPIKey(k)
+	if err != nil {
+		return k, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.apiKeys[k.ID] = k
+
+	return k, nil
+}
+
+func (db *MemoryDB) DeleteAPIKey(ctx context.Context, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.apiKeys[id]; !ok {
+		return apiauth.ErrNotFound
+	}
+	delete(db.apiKeys, id)
+
+	return nil
+}
+
+func (db *MemoryDB) User(ctx context.Context, id string) (account.User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	u, ok := db.users[id]
+	if !ok {
+		return u, account.ErrNotFound
+	}
+
+	return u, nil
+}
+
+func (db *MemoryDB) UserBySubject(ctx context.Context, issuer, subject string) (account.User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, u := range db.users {
+		if u.Issuer == issuer && u.Subject == subject {
+			return u, nil
+		}
+	}
+
+	return account.User{}, account.ErrNotFound
+}
+
+func (db *MemoryDB) PutUser(ctx context.Context, u account.User) (account.User, error) {
+	u, err := account.PrepareUser(u)
+	if err != nil {
+		return u, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.users[u.ID] = u
+
+	return u, nil
+}
+
+func (db *MemoryDB) Session(ctx context.Context, id string) (account.Session, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	s, ok := db.sessions[id]
+	if !ok {
+		return s, account.ErrNotFound
+	}
+
+	return s, nil
+}
+
+func (db *MemoryDB) PutSession(ctx context.Context, s account.Session) error {
+	if s.ID == "" {
+		return fmt.Errorf("db: session ID must be set")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.sessions[s.ID] = s
+
+	return nil
+}
+
+func (db *MemoryDB) DeleteSession(ctx context.Context, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.sessions, id)
+
+	return nil
+}
+
+func (db *MemoryDB) APITokens(ctx context.Context, userID string) ([]account.APIToken, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var tokens []account.APIToken
+	for _, t := range db.apiTokens {
+		if t.UserID == userID {
+			tokens = append(tokens, t)
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].ID < tokens[j].ID
+	})
+	return tokens, nil
+}
+
+func (db *MemoryDB) APITokenByHash(ctx context.Context, hash string) (account.APIToken, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, t := range db.apiTokens {
+		if t.Hash == hash {
+			return t, nil
+		}
+	}
+
+	return account.APIToken{}, account.ErrNotFound
+}
+
+func (db *MemoryDB) PutAPIToken(ctx context.Context, t account.APIToken) (account.APIToken, error) {
+	t, err := account.PrepareAPIToken(t)
+	if err != nil {
+		return t, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.apiTokens[t.ID] = t
+
+	return t, nil
+}
+
+func (db *MemoryDB) DeleteAPIToken(ctx context.Context, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.apiTokens[id]; !ok {
+		return account.ErrNotFound
+	}
+	delete(db.apiTokens, id)
+
+	return nil
+}
+
+// CacheStats returns empty stats because MemoryDB has no cache.
+func (db *MemoryDB) CacheStats() stats.Stats {
+	return stats.Stats{}
+}
+
+func (db *MemoryDB) ClaimMessage(ctx context.Context, key string, expires time.Time) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if e, ok := db.claims[key]; ok && e.After(time.Now()) {
+		return false, nil
+	}
+	db.claims[key] = expires
+
+	return true, nil
+}
+
+func (db *MemoryDB) ReleaseMessage(ctx context.Context, key string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.claims, key)
+
+	return nil
+}
+
+func (db *MemoryDB) Quarantined(ctx context.Context, id string) (quarantine.Entry, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	e, ok := db.quarantined[id]
+	if !ok {
+		return e, quarantine.ErrNotFound
+	}
+
+	return e, nil
+}
+
+func (db *MemoryDB) RecentlyQuarantined(ctx context.Context, limit int) ([]quarantine.Entry, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var entries []quarantine.Entry
+	for _, e := range db.quarantined {
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b quarantine.Entry) int {
+		if c := b.Received.Compare(a.Received); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+func (db *MemoryDB) PutQuarantined(ctx context.Context, e quarantine.Entry) (quarantine.Entry, error) {
+	e, err := quarantine.PrepareEntry(e)
+	if err != nil {
+		return e, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.quarantined[e.ID] = e
+
+	return e, nil
+}
+
+func (db *MemoryDB) DeleteQuarantined(ctx context.Context, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.quarantined[id]; !ok {
+		return quarantine.ErrNotFound
+	}
+	delete(db.quarantined, id)
+
+	return nil
+}
+
+func (db *MemoryDB) RoutingRules(ctx context.Context) ([]routing.Rule, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	rules := make([]routing.Rule, 0, len(db.routingRules))
+	for _, r := range db.routingRules {
+		rules = append(rules, r)
+	}
+
+	routing.Sort(rules)
+	return rules, nil
+}
+
+func (db *MemoryDB) RoutingRule(ctx context.Context, id string) (routing.Rule, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	r, ok := db.routingRules[id]
+	if !ok {
+		return r, routing.ErrNotFound
+	}
+
+	return r, nil
+}
+
+func (db *MemoryDB) PutRoutingRule(ctx context.Context, r routing.Rule) (routing.Rule, error) {
+	r, err := routing.PrepareRule(r)
+	if err != nil {
+		return r, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.routingRules[r.ID] = r
+	return r, nil
+}
+
+func (db *MemoryDB) DeleteRoutingRule(ctx context.Context, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.routingRules[id]; !ok {
+		return routing.ErrNotFound
+	}
+	delete(db.routingRules, id)
+
+	return nil
+}
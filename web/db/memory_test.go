@@ -0,0 +1,698 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mtraver/environmental-sensor/account"
+	"github.com/mtraver/environmental-sensor/alert"
+	"github.com/mtraver/environmental-sensor/apiauth"
+	"github.com/mtraver/environmental-sensor/calibration"
+	"github.com/mtraver/environmental-sensor/database"
+	"github.com/mtraver/environmental-sensor/device"
+	"github.com/mtraver/environmental-sensor/ingest"
+	"github.com/mtraver/environmental-sensor/measurement"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/metric"
+	"github.com/mtraver/environmental-sensor/quarantine"
+	"github.com/mtraver/environmental-sensor/rollup"
+	"github.com/mtraver/environmental-sensor/routing"
+	"github.com/mtraver/environmental-sensor/testutil"
+	tspb "google.golang.org/protobuf/types/known/timestamppb"
+	wpb "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var _ database.Database = (*MemoryDB)(nil)
+
+func TestMemoryDBSaveIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+
+	for range 2 {
+		if err := db.Save(ctx, testMeasurement); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	got, err := db.Since(ctx, testutil.Timestamp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(got["foo"]) != 1 {
+		t.Errorf("got %d measurements, want 1", len(got["foo"]))
+	}
+
+	buckets, err := db.Rollups(ctx, rollup.Hourly, nil, testutil.Timestamp, testutil.Timestamp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, b := range buckets["foo"] {
+		if b.Count != 1 {
+			t.Errorf("%s: got count %d, want 1", b.Metric, b.Count)
+		}
+	}
+}
+
+func TestMemoryDBSubSecondKeys(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+
+	// Devices stamp measurements to the nanosecond, but Datastore stores times to the
+	// microsecond, so the measurements loaded from it must still have the keys they were saved
+	// under.
+	at := func(d time.Duration) *mpb.Measurement {
+		return &mpb.Measurement{DeviceId: "foo", Timestamp: tspb.New(testutil.Timestamp.Add(d)), Temp: wpb.Float(20)}
+	}
+	onTheSecond, nanos := at(0), at(123456789*time.Nanosecond)
+
+	// One with a sub-second timestamp that was saved before those were distinguished is stored
+	// under a key to the second.
+	legacy, err := measurement.NewStorableMeasurement(at(500 * time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	db.measurements[legacy.LegacyDBKey()] = legacy
+
+	for _, m := range []*mpb.Measurement{nanos, nanos, at(500 * time.Millisecond)} {
+		if err := db.Save(ctx, m); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	got, err := db.Since(ctx, testutil.Timestamp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(got["foo"]) != 2 {
+		t.Fatalf("got %d measurements, want 2: %v", len(got["foo"]), got["foo"])
+	}
+
+	// A measurement taken on the second has the legacy key, which is taken, so it isn't saved,
+	// as before sub-second timestamps were distinguished.
+	if err := db.Save(ctx, onTheSecond); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got, err = db.Since(ctx, testutil.Timestamp); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if len(got["foo"]) != 2 {
+		t.Fatalf("got %d measurements, want 2", len(got["foo"]))
+	}
+
+	// Deleting the loaded measurements deletes them all.
+	if err := db.Delete(ctx, got["foo"]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got, err = db.Since(ctx, testutil.Timestamp); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if len(got["foo"]) != 0 {
+		t.Errorf("got %d measurements after deleting them, want 0: %v", len(got["foo"]), got["foo"])
+	}
+}
+
+func TestMemoryDBRollupsByDevice(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+
+	bar := testutil.FullyPopulatedMeasurementProto()
+	bar.DeviceId = "bar"
+	for _, m := range []*mpb.Measurement{testMeasurement, bar} {
+		if err := db.Save(ctx, m); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	cases := []struct {
+		name      string
+		deviceIDs []string
+		want      []string
+	}{
+		{"all", nil, []string{"bar", "foo"}},
+		{"one", []string{"bar"}, []string{"bar"}},
+		{"unknown", []string{"baz"}, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			buckets, err := db.Rollups(ctx, rollup.Hourly, tc.deviceIDs, testutil.Timestamp, testutil.Timestamp)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, slices.Sorted(maps.Keys(buckets))); diff != "" {
+				t.Errorf("Unexpected devices (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMemoryDBQueries(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+
+	late := testutil.FullyPopulatedMeasurementProto()
+	late.Timestamp = tspb.New(testutil.Timestamp.Add(time.Hour))
+	late.UploadTimestamp = testutil.TimestampProto2
+
+	for _, m := range []*mpb.Measurement{testMeasurement, late} {
+		if err := db.Save(ctx, m); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	oldest, found, err := db.Oldest(ctx)
+	if err != nil || !found {
+		t.Fatalf("Oldest: got found=%v, err=%v", found, err)
+	}
+	if !oldest.Timestamp.Equal(testutil.Timestamp) {
+		t.Errorf("Oldest: got %v, want %v", oldest.Timestamp, testutil.Timestamp)
+	}
+
+	latest, err := db.Latest(ctx, []string{"foo", "bar"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(latest["foo"].Timestamp, late.GetTimestamp().AsTime()); diff != "" {
+		t.Errorf("Latest mismatch (-got +want):\n%s", diff)
+	}
+	if _, ok := latest["bar"]; ok {
+		t.Errorf("Latest: got measurement for unknown device")
+	}
+
+	delayed, err := db.DelayedSince(ctx, testutil.Timestamp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(delayed["foo"]) != 1 {
+		t.Errorf("DelayedSince: got %d measurements, want 1", len(delayed["foo"]))
+	}
+
+	between, err := db.Between(ctx, testutil.Timestamp, testutil.Timestamp.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := db.Delete(ctx, between["foo"]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	remaining, err := db.Since(ctx, time.Time{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(remaining["foo"]) != 1 || !remaining["foo"][0].Timestamp.Equal(late.GetTimestamp().AsTime()) {
+		t.Errorf("Delete: got remaining measurements %v", remaining)
+	}
+}
+
+func TestMemoryDBQueryPagination(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+
+	for i := range 3 {
+		for _, id := range []string{"foo", "bar", "baz"} {
+			m := &mpb.Measurement{
+				DeviceId:  id,
+				Timestamp: tspb.New(testutil.Timestamp.Add(time.Duration(i) * time.Minute)),
+				Temp:      wpb.Float(20),
+			}
+			if id == "bar" {
+				m.Temp = nil
+				m.Rh = wpb.Float(50)
+			}
+
+			if err := db.Save(ctx, m); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+	}
+
+	cases := []struct {
+		name  string
+		q     database.Query
+		pages []int
+	}{
+		{"all", database.Query{StartTime: testutil.Timestamp}, []int{9}},
+		{"paged", database.Query{StartTime: testutil.Timestamp, Limit: 4}, []int{4, 4, 1}},
+		{"exact_pages", database.Query{StartTime: testutil.Timestamp, Limit: 3}, []int{3, 3, 3}},
+		{"devices", database.Query{StartTime: testutil.Timestamp, DeviceIDs: []string{"foo", "baz"}, Limit: 5}, []int{5, 1}},
+		{"metrics", database.Query{StartTime: testutil.Timestamp, Metrics: []metric.Key{metric.RH}, Limit: 2}, []int{2, 1}},
+		{"end_time", database.Query{StartTime: testutil.Timestamp, EndTime: testutil.Timestamp.Add(time.Minute), DeviceIDs: []string{"foo"}}, []int{2}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := tc.q
+			seen := make(map[string]bool)
+
+			var got []int
+			for {
+				page, err := db.Query(ctx, q)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				got = append(got, len(page.Measurements))
+
+				for _, sm := range page.Measurements {
+					if seen[sm.DBKey()] {
+						t.Errorf("got %s more than once", sm.DBKey())
+					}
+					seen[sm.DBKey()] = true
+
+					if len(q.DeviceIDs) > 0 && !slices.Contains(q.DeviceIDs, sm.DeviceID) {
+						t.Errorf("got measurement from unselected device %q", sm.DeviceID)
+					}
+					if len(q.Metrics) > 0 && sm.Temp != nil {
+						t.Errorf("got unselected metric in %v", sm)
+					}
+				}
+
+				if !page.HasNextPage {
+					break
+				}
+				q.Cursor = page.EndCursor()
+			}
+
+			if diff := cmp.Diff(got, tc.pages); diff != "" {
+				t.Errorf("page sizes mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMemoryDBQueryInvalidCursor(t *testing.T) {
+	db := NewMemoryDB()
+	if err := db.Save(context.Background(), testMeasurement); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := db.Query(context.Background(), database.Query{Cursor: "not a cursor"}); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+var _ device.Registry = (*MemoryDB)(nil)
+
+func TestMemoryDBDevices(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+
+	foo, err := db.PutDevice(ctx, device.Device{DeviceID: "foo", Aliases: []string{"old-foo"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := db.PutDevice(ctx, device.Device{DeviceID: "bar"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	devices, err := db.Devices(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var ids []string
+	for _, d := range devices {
+		ids = append(ids, d.DeviceID)
+	}
+	if diff := cmp.Diff(ids, []string{"bar", "foo"}); diff != "" {
+		t.Errorf("Devices mismatch (-got +want):\n%s", diff)
+	}
+
+	got, found, err := db.DeviceByDeviceID(ctx, "old-foo")
+	if err != nil || !found || got.ID != foo.ID {
+		t.Errorf("DeviceByDeviceID: got %v, found=%v, err=%v", got, found, err)
+	}
+
+	if _, err := db.PutDevice(ctx, device.Device{DeviceID: "old-foo"}); err == nil {
+		t.Error("PutDevice: expected error for duplicate device ID, got nil")
+	}
+
+	if err := db.DeleteDevice(ctx, foo.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := db.Device(ctx, foo.ID); !errors.Is(err, device.ErrNotFound) {
+		t.Errorf("Device: got error %v, want %v", err, device.ErrNotFound)
+	}
+	if err := db.DeleteDevice(ctx, foo.ID); !errors.Is(err, device.ErrNotFound) {
+		t.Errorf("DeleteDevice: got error %v, want %v", err, device.ErrNotFound)
+	}
+}
+
+var _ alert.Store = (*MemoryDB)(nil)
+
+func TestMemoryDBAlerts(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+
+	r, err := db.PutAlertRule(ctx, alert.Rule{Name: "dead", Kind: alert.Absence, For: time.Hour, Enabled: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if r.ID == "" {
+		t.Fatal("PutAlertRule: rule was not assigned an ID")
+	}
+
+	if _, err := db.PutAlertRule(ctx, alert.Rule{Name: "invalid", Kind: alert.Absence}); err == nil {
+		t.Error("PutAlertRule: expected error for invalid rule, got nil")
+	}
+
+	state, err := db.AlertState(ctx, r.ID, "foo")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(state, alert.NewState(r.ID, "foo")); diff != "" {
+		t.Errorf("AlertState mismatch (-got +want):\n%s", diff)
+	}
+
+	state.Status = alert.Firing
+	if err := db.PutAlertState(ctx, state); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	states, err := db.AlertStates(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(states, []alert.State{state}); diff != "" {
+		t.Errorf("AlertStates mismatch (-got +want):\n%s", diff)
+	}
+
+	// Deleting a rule deletes its states.
+	if err := db.DeleteAlertRule(ctx, r.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := db.AlertRule(ctx, r.ID); !errors.Is(err, alert.ErrNotFound) {
+		t.Errorf("AlertRule: got error %v, want %v", err, alert.ErrNotFound)
+	}
+	if states, _ := db.AlertStates(ctx); len(states) != 0 {
+		t.Errorf("AlertStates: got %v, want none", states)
+	}
+}
+
+var _ calibration.Store = (*MemoryDB)(nil)
+
+func TestMemoryDBCalibrationProfiles(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+
+	p, err := db.PutCalibrationProfile(ctx, calibration.Profile{DeviceID: "foo", Metric: metric.Temp, Kind: calibration.Linear, Scale: 1, Offset: -1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if p.ID == "" {
+		t.Fatal("PutCalibrationProfile: profile was not assigned an ID")
+	}
+
+	if _, err := db.PutCalibrationProfile(ctx, calibration.Profile{DeviceID: "foo", Metric: metric.Temp, Kind: calibration.Linear}); err == nil {
+		t.Error("PutCalibrationProfile: expected error for invalid profile, got nil")
+	}
+
+	profiles, err := db.CalibrationProfiles(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(profiles, []calibration.Profile{p}); diff != "" {
+		t.Errorf("CalibrationProfiles mismatch (-got +want):\n%s", diff)
+	}
+
+	if err := db.DeleteCalibrationProfile(ctx, p.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := db.CalibrationProfile(ctx, p.ID); !errors.Is(err, calibration.ErrNotFound) {
+		t.Errorf("CalibrationProfile: got error %v, want %v", err, calibration.ErrNotFound)
+	}
+	if err := db.DeleteCalibrationProfile(ctx, p.ID); !errors.Is(err, calibration.ErrNotFound) {
+		t.Errorf("DeleteCalibrationProfile: got error %v, want %v", err, calibration.ErrNotFound)
+	}
+}
+
+var _ apiauth.KeyStore = (*MemoryDB)(nil)
+
+func TestMemoryDBAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+
+	key, k, err := apiauth.NewKey("dashboard", []string{"foo"}, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	k, err = db.PutAPIKey(ctx, k)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if k.ID == "" {
+		t.Fatal("PutAPIKey: key was not assigned an ID")
+	}
+
+	if _, err := db.PutAPIKey(ctx, apiauth.APIKey{Name: "bad"}); err == nil {
+		t.Error("PutAPIKey: expected error for key without a hash, got nil")
+	}
+
+	got, err := db.APIKeyByHash(ctx, apiauth.HashKey(key))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(got, k); diff != "" {
+		t.Errorf("APIKeyByHash mismatch (-got +want):\n%s", diff)
+	}
+
+	keys, err := db.APIKeys(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(keys, []apiauth.APIKey{k}); diff != "" {
+		t.Errorf("APIKeys mismatch (-got +want):\n%s", diff)
+	}
+
+	if err := db.DeleteAPIKey(ctx, k.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := db.APIKeyByHash(ctx, apiauth.HashKey(key)); !errors.Is(err, apiauth.ErrNotFound) {
+		t.Errorf("APIKeyByHash: got error %v, want %v", err, apiauth.ErrNotFound)
+	}
+	if err := db.DeleteAPIKey(ctx, k.ID); !errors.Is(err, apiauth.ErrNotFound) {
+		t.Errorf("DeleteAPIKey: got error %v, want %v", err, apiauth.ErrNotFound)
+	}
+}
+
+var _ account.Store = (*MemoryDB)(nil)
+
+func TestMemoryDBAccounts(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	u, err := db.PutUser(ctx, account.User{Issuer: "https://accounts.example.com", Subject: "123", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if u.ID == "" {
+		t.Fatal("PutUser: user was not assigned an ID")
+	}
+
+	if _, err := db.PutUser(ctx, account.User{Email: "bob@example.com"}); err == nil {
+		t.Error("PutUser: expected error for user without a subject, got nil")
+	}
+
+	got, err := db.UserBySubject(ctx, u.Issuer, u.Subject)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(got, u); diff != "" {
+		t.Errorf("UserBySubject mismatch (-got +want):\n%s", diff)
+	}
+	if _, err := db.UserBySubject(ctx, "https://other.example.com", u.Subject); !errors.Is(err, account.ErrNotFound) {
+		t.Errorf("UserBySubject: got error %v, want %v", err, account.ErrNotFound)
+	}
+
+	_, s, err := account.NewSession(u.ID, time.Hour, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := db.PutSession(ctx, s); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	gotSession, err := db.Session(ctx, s.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(gotSession, s); diff != "" {
+		t.Errorf("Session mismatch (-got +want):\n%s", diff)
+	}
+	if err := db.DeleteSession(ctx, s.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := db.Session(ctx, s.ID); !errors.Is(err, account.ErrNotFound) {
+		t.Errorf("Session: got error %v, want %v", err, account.ErrNotFound)
+	}
+
+	token, tok, err := account.NewAPIToken(u.ID, "script")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tok, err = db.PutAPIToken(ctx, tok)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	gotToken, err := db.APITokenByHash(ctx, account.HashToken(token))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(gotToken, tok); diff != "" {
+		t.Errorf("APITokenByHash mismatch (-got +want):\n%s", diff)
+	}
+
+	tokens, err := db.APITokens(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(tokens, []account.APIToken{tok}); diff != "" {
+		t.Errorf("APITokens mismatch (-got +want):\n%s", diff)
+	}
+
+	if err := db.DeleteAPIToken(ctx, tok.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := db.DeleteAPIToken(ctx, tok.ID); !errors.Is(err, account.ErrNotFound) {
+		t.Errorf("DeleteAPIToken: got error %v, want %v", err, account.ErrNotFound)
+	}
+}
+
+var _ ingest.DedupeStore = (*MemoryDB)(nil)
+
+func TestMemoryDBClaimMessage(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+	expires := time.Now().Add(time.Hour)
+
+	steps := []struct {
+		name    string
+		key     string
+		expires time.Time
+		release bool
+		want    bool
+	}{
+		{name: "first", key: "foo#1", expires: expires, want: true},
+		{name: "duplicate", key: "foo#1", expires: expires, want: false},
+		{name: "other", key: "foo#2", expires: expires, want: true},
+		{name: "released", key: "foo#1", expires: expires, release: true, want: true},
+		{name: "expired_first", key: "foo#3", expires: time.Now().Add(-time.Hour), want: true},
+		{name: "expired", key: "foo#3", expires: expires, want: true},
+	}
+
+	for _, s := range steps {
+		if s.release {
+			if err := db.ReleaseMessage(ctx, s.key); err != nil {
+				t.Fatalf("%s: unexpected error: %v", s.name, err)
+			}
+		}
+
+		got, err := db.ClaimMessage(ctx, s.key, s.expires)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", s.name, err)
+		}
+		if got != s.want {
+			t.Errorf("%s: ClaimMessage(%q) = %v, want %v", s.name, s.key, got, s.want)
+		}
+	}
+}
+
+var _ quarantine.Store = (*MemoryDB)(nil)
+
+func TestMemoryDBQuarantine(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	if _, err := db.PutQuarantined(ctx, quarantine.Entry{Reason: "spam"}); err == nil {
+		t.Error("PutQuarantined: expected error for entry without a received time, got nil")
+	}
+
+	older, err := db.PutQuarantined(ctx, quarantine.Entry{Received: now, Reason: "bad", Payload: []byte("spam")})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if older.ID == "" {
+		t.Fatal("PutQuarantined: entry was not assigned an ID")
+	}
+	newer, err := db.PutQuarantined(ctx, quarantine.Entry{Received: now.Add(time.Minute), Reason: "worse", DeviceID: "foo"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got, err := db.Quarantined(ctx, older.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(got, older); diff != "" {
+		t.Errorf("Quarantined mismatch (-got +want):\n%s", diff)
+	}
+
+	recent, err := db.RecentlyQuarantined(ctx, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(recent, []quarantine.Entry{newer, older}); diff != "" {
+		t.Errorf("RecentlyQuarantined mismatch (-got +want):\n%s", diff)
+	}
+	recent, err = db.RecentlyQuarantined(ctx, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(recent, []quarantine.Entry{newer}); diff != "" {
+		t.Errorf("RecentlyQuarantined with limit mismatch (-got +want):\n%s", diff)
+	}
+
+	if err := db.DeleteQuarantined(ctx, older.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := db.Quarantined(ctx, older.ID); !errors.Is(err, quarantine.ErrNotFound) {
+		t.Errorf("Quarantined: got error %v, want %v", err, quarantine.ErrNotFound)
+	}
+	if err := db.DeleteQuarantined(ctx, older.ID); !errors.Is(err, quarantine.ErrNotFound) {
+		t.Errorf("DeleteQuarantined: got error %v, want %v", err, quarantine.ErrNotFound)
+	}
+}
+
+var _ routing.Store = (*MemoryDB)(nil)
+
+func TestMemoryDBRoutingRules(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+
+	second, err := db.PutRoutingRule(ctx, routing.Rule{Name: "drop", Action: routing.Drop, Priority: 2, Enabled: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if second.ID == "" {
+		t.Fatal("PutRoutingRule: rule was not assigned an ID")
+	}
+	first, err := db.PutRoutingRule(ctx, routing.Rule{Name: "rename", Action: routing.Rename, RenameTo: "bar", Priority: 1, Enabled: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := db.PutRoutingRule(ctx, routing.Rule{Name: "invalid", Action: routing.Rename}); err == nil {
+		t.Error("PutRoutingRule: expected error for invalid rule, got nil")
+	}
+
+	// Rules are listed in the order they're evaluated.
+	rules, err := db.RoutingRules(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(rules, []routing.Rule{first, second}); diff != "" {
+		t.Errorf("RoutingRules mismatch (-got +want):\n%s", diff)
+	}
+
+	if err := db.DeleteRoutingRule(ctx, first.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := db.RoutingRule(ctx, first.ID); !errors.Is(err, routing.ErrNotFound) {
+		t.Errorf("RoutingRule: got error %v, want %v", err, routing.ErrNotFound)
+	}
+	if err := db.DeleteRoutingRule(ctx, first.ID); !errors.Is(err, routing.ErrNotFound) {
+		t.Errorf("DeleteRoutingRule: got error %v, want %v", err, routing.ErrNotFound)
+	}
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/datastore"
+	"github.com/mtraver/environmental-sensor/quarantine"
+)
+
+func (db *datastoreDB) Quarantined(ctx context.Context, id string) (quarantine.Entry, error) {
+	var e quarantine.Entry
+	if err := db.client.Get(ctx, datastore.NameKey(db.quarantineKind, id, nil), &e); errors.Is(err, datastore.ErrNoSuchEntity) {
+		return e, quarantine.ErrNotFound
+	} else if err != nil {
+		return e, err
+	}
+
+	e.ID = id
+	return e, nil
+}
+
+func (db *datastoreDB) RecentlyQuarantined(ctx context.Context, limit int) ([]quarantine.Entry, error) {
+	var entries []quarantine.Entry
+	q := datastore.NewQuery(db.quarantineKind).Order("-received").Limit(limit)
+	keys, err := db.client.GetAll(ctx, q, &entries)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, k := range keys {
+		entries[i].ID = k.Name
+	}
+
+	return entries, nil
+}
+
+func (db *datastoreDB) PutQuarantined(ctx context.Context, e quarantine.Entry) (quarantine.Entry, error) {
+	e, err := quarantine.PrepareEntry(e)
+	if err != nil {
+		return e, err
+	}
+
+	if _, err := db.client.Put(ctx, datastore.NameKey(db.quarantineKind, e.ID, nil), &e); err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+func (db *datastoreDB) DeleteQuarantined(ctx context.Context, id string) error {
+	key := datastore.NameKey(db.quarantineKind, id, nil)
+	if err := db.client.Get(ctx, key, &quarantine.Entry{}); errors.Is(err, datastore.ErrNoSuchEntity) {
+		return quarantine.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	return db.client.Delete(ctx, key)
+}
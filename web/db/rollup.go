@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/mtraver/environmental-sensor/rollup"
+)
+
+func (db *datastoreDB) rollupKey(b *rollup.Bucket) *datastore.Key {
+	return datastore.NameKey(db.rollupKind, b.DBKey(), nil)
+}
+
+// addToRollups merges each of the given buckets into the stored bucket with the same key,
+// creating stored buckets as needed. It must be called within a transaction so that
+// concurrent updates to the same bucket (e.g. a late arrival racing a live measurement)
+// don't clobber each other.
+func (db *datastoreDB) addToRollups(tx *datastore.Transaction, buckets []rollup.Bucket) error {
+	if len(buckets) == 0 {
+		return nil
+	}
+
+	keys := make([]*datastore.Key, len(buckets))
+	for i := range buckets {
+		keys[i] = db.rollupKey(&buckets[i])
+	}
+
+	stored := make([]rollup.Bucket, len(buckets))
+	if err := tx.GetMulti(keys, stored); err != nil {
+		var merr datastore.MultiError
+		if !errors.As(err, &merr) {
+			return err
+		}
+
+		for _, err := range merr {
+			if err != nil && !errors.Is(err, datastore.ErrNoSuchEntity) {
+				return err
+			}
+		}
+	}
+
+	for i, b := range buckets {
+		// Buckets that don't exist yet are left as the zero value by GetMulti.
+		if stored[i].Count == 0 {
+			stored[i] = rollup.NewBucket(b.DeviceID, b.Metric, b.Resolution, b.Start)
+		}
+
+		stored[i].Merge(b)
+	}
+
+	_, err := tx.PutMulti(keys, stored)
+	return err
+}
+
+// Rollups gets all buckets of the given resolution with a start time greater than or equal to
+// startTime and less than or equal to endTime. If deviceIDs is non-empty then only buckets for
+// those devices are returned. It returns a map of device ID to a Bucket slice sorted by start
+// time, and an error.
+func (db *datastoreDB) Rollups(ctx context.Context, res rollup.Resolution, deviceIDs []string, startTime time.Time, endTime time.Time) (map[string][]rollup.Bucket, error) {
+	results := make(map[string][]rollup.Bucket)
+
+	// Each device is in only one batch, so each device's buckets come from one query and stay
+	// sorted.
+	for _, ids := range deviceBatches(deviceIDs) {
+		q := datastore.NewQuery(db.rollupKind).Filter("resolution =", string(res))
+		q = filterDevices(q, ids).Filter("start >=", startTime).Filter("start <=", endTime).Order("start")
+
+		err := runPaged(ctx, db.client, q, func(b rollup.Bucket) {
+			results[b.DeviceID] = append(results[b.DeviceID], b)
+		})
+		if err != nil {
+			return make(map[string][]rollup.Bucket), err
+		}
+	}
+
+	return results, nil
+}
+
+// PutRollups writes the given buckets, overwriting any stored buckets with the same keys.
+// It's intended for rebuilding rollups from raw measurements.
+func (db *datastoreDB) PutRollups(ctx context.Context, buckets []rollup.Bucket) error {
+	for start := 0; start < len(buckets); start += putMultiLimit {
+		end := min(start+putMultiLimit, len(buckets))
+
+		chunk := buckets[start:end]
+		keys := make([]*datastore.Key, len(chunk))
+		for i := range chunk {
+			keys[i] = db.rollupKey(&chunk[i])
+		}
+
+		if _, err := db.client.PutMulti(ctx, keys, chunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
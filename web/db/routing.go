@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/datastore"
+	"github.com/mtraver/environmental-sensor/routing"
+)
+
+func (db *datastoreDB) RoutingRules(ctx context.Context) ([]routing.Rule, error) {
+	var rules []routing.Rule
+	keys, err := db.client.GetAll(ctx, datastore.NewQuery(db.routingRuleKind), &rules)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, k := range keys {
+		rules[i].ID = k.Name
+	}
+
+	routing.Sort(rules)
+	return rules, nil
+}
+
+func (db *datastoreDB) RoutingRule(ctx context.Context, id string) (routing.Rule, error) {
+	var r routing.Rule
+	if err := db.client.Get(ctx, datastore.NameKey(db.routingRuleKind, id, nil), &r); errors.Is(err, datastore.ErrNoSuchEntity) {
+		return r, routing.ErrNotFound
+	} else if err != nil {
+		return r, err
+	}
+
+	r.ID = id
+	return r, nil
+}
+
+func (db *datastoreDB) PutRoutingRule(ctx context.Context, r routing.Rule) (routing.Rule, error) {
+	r, err := routing.PrepareRule(r)
+	if err != nil {
+		return r, err
+	}
+
+	if _, err := db.client.Put(ctx, datastore.NameKey(db.routingRuleKind, r.ID, nil), &r); err != nil {
+		return r, err
+	}
+
+	return r, nil
+}
+
+func (db *datastoreDB) DeleteRoutingRule(ctx context.Context, id string) error {
+	if _, err := db.RoutingRule(ctx, id); err != nil {
+		return err
+	}
+
+	return db.client.Delete(ctx, datastore.NameKey(db.routingRuleKind, id, nil))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/mtraver/gaelog"
+
+	"github.com/mtraver/environmental-sensor/device"
+	"github.com/mtraver/environmental-sensor/measurement"
+	"github.com/mtraver/environmental-sensor/uptime"
+)
+
+// devicezHandler renders a page displaying when each registered device was last seen, its latest
+// measurement in the user's preferred units, how regularly it reports, and its recent uptime.
+type devicezHandler struct {
+	Database uptime.Database
+	Registry device.Registry
+	Template *template.Template
+}
+
+func (h devicezHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	now := time.Now().UTC()
+
+	var reports []uptime.Report
+	latest := make(map[string]string)
+	devices, err := h.Registry.Devices(ctx)
+	if err == nil {
+		reports, err = uptime.ForDevices(ctx, h.Database, devices, now)
+	}
+	if err == nil {
+		ids := make([]string, len(devices))
+		for i, d := range devices {
+			ids[i] = d.DeviceID
+		}
+
+		var sms map[string]measurement.StorableMeasurement
+		sms, err = h.Database.Latest(ctx, ids)
+
+		units := unitPreferences(r)
+		for id, sm := range sms {
+			latest[id] = sm.Format(units)
+		}
+	}
+	if err != nil {
+		gaelog.Errorf(ctx, "Error fetching data: %v", err)
+	}
+
+	windows := make([]string, len(uptime.Windows))
+	for i, w := range uptime.Windows {
+		windows[i] = uptime.WindowName(w)
+	}
+
+	data := struct {
+		Now     time.Time
+		Windows []string
+		Reports []uptime.Report
+
+		// Latest is each device's latest measurement, keyed by the device ID it reported.
+		Latest map[string]string
+		Error  error
+	}{
+		Now:     now,
+		Windows: windows,
+		Reports: reports,
+		Latest:  latest,
+		Error:   err,
+	}
+
+	if err := h.Template.ExecuteTemplate(w, "devicez", data); err != nil {
+		gaelog.Errorf(ctx, "Could not execute template: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mtraver/gaelog"
+
+	"github.com/mtraver/environmental-sensor/account"
+	"github.com/mtraver/environmental-sensor/calibration"
+	"github.com/mtraver/environmental-sensor/database"
+	"github.com/mtraver/environmental-sensor/device"
+	"github.com/mtraver/environmental-sensor/export"
+	"github.com/mtraver/environmental-sensor/metric"
+	"github.com/mtraver/environmental-sensor/util"
+)
+
+// exportHandler streams measurement history as a file download. It takes these query
+// parameters:
+//
+//	start   first timestamp to export, RFC 3339 or a date (required)
+//	end     last timestamp to export, RFC 3339 or a date (default no limit)
+//	device  device IDs, comma-separated or repeated (default all devices)
+//	metric  metrics, comma-separated or repeated (default all reported metrics)
+//	format  csv, jsonl, or parquet (default csv)
+//	bucket  aggregate into buckets of this duration, e.g. 1h (default no aggregation)
+//	tz      IANA time zone that timestamps are written and buckets are aligned in (default UTC)
+//	raw     if true, export stored values rather than calibrated values
+//
+// Only measurements from devices that the viewer can see are exported.
+type exportHandler struct {
+	Database     database.Database
+	Registry     device.Registry
+	Calibrations calibration.Store
+}
+
+// exportOptions parses the query parameters of an export request.
+func exportOptions(v url.Values) (export.Options, error) {
+	opts := export.Options{Format: export.CSV, Location: time.UTC}
+
+	if s := v.Get("format"); s != "" {
+		f, err := export.ParseFormat(s)
+		if err != nil {
+			return opts, err
+		}
+		opts.Format = f
+	}
+
+	if s := v.Get("tz"); s != "" {
+		loc, err := time.LoadLocation(s)
+		if err != nil {
+			return opts, fmt.Errorf("bad tz: %v", err)
+		}
+		opts.Location = loc
+	}
+
+	if v.Get("start") == "" {
+		return opts, fmt.Errorf("start is required")
+	}
+	var err error
+	opts.StartTime, err = export.ParseTime(v.Get("start"), opts.Location)
+	if err != nil {
+		return opts, err
+	}
+	if s := v.Get("end"); s != "" {
+		opts.EndTime, err = export.ParseTime(s, opts.Location)
+		if err != nil {
+			return opts, err
+		}
+	}
+
+	if s := v.Get("bucket"); s != "" {
+		opts.Bucket, err = time.ParseDuration(s)
+		if err != nil {
+			return opts, fmt.Errorf("bad bucket: %v", err)
+		}
+	}
+
+	opts.DeviceIDs = util.SplitList(strings.Join(v["device"], ","))
+	for _, m := range util.SplitList(strings.Join(v["metric"], ",")) {
+		opts.Metrics = append(opts.Metrics, metric.Key(m))
+	}
+
+	return opts, opts.Validate()
+}
+
+func (h exportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	opts, err := exportOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	scope, err := account.FromContext(ctx).Scope(ctx, h.Registry)
+	if err != nil {
+		gaelog.Errorf(ctx, "Failed to get devices: %v", err)
+		http.Error(w, "Failed to get devices", http.StatusInternalServerError)
+		return
+	}
+	var ok bool
+	opts.DeviceIDs, ok = scope.Restrict(opts.DeviceIDs)
+	if !ok {
+		http.Error(w, "No devices to export", http.StatusForbidden)
+		return
+	}
+
+	if raw := r.URL.Query().Get("raw"); raw != "true" && raw != "1" {
+		opts.Profiles, err = h.Calibrations.CalibrationProfiles(ctx)
+		if err != nil {
+			gaelog.Errorf(ctx, "Failed to get calibration profiles: %v", err)
+			http.Error(w, "Failed to get calibration profiles", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	filename := "measurements-" + opts.StartTime.In(opts.Location).Format("2006-01-02") + opts.Format.Extension()
+	w.Header().Set("Content-Type", opts.Format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	// Once the body has been started the status can't be changed, so an error partway through
+	// leaves a truncated file.
+	n, err := export.Export(ctx, h.Database, w, opts)
+	if err != nil {
+		gaelog.Errorf(ctx, "Export failed after %d rows: %v", n, err)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mtraver/environmental-sensor/export"
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+func TestExportOptions(t *testing.T) {
+	cases := []struct {
+		name    string
+		query   string
+		want    export.Options
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			query: "start=2018-03-25",
+			want: export.Options{
+				Format:    export.CSV,
+				StartTime: time.Date(2018, time.March, 25, 0, 0, 0, 0, time.UTC),
+				Location:  time.UTC,
+			},
+		},
+		{
+			name:  "everything",
+			query: "start=2018-03-25T01:00:00Z&end=2018-03-26T00:00:00Z&device=foo,%20bar&device=baz&metric=temp&metric=pm25&format=parquet&bucket=1h",
+			want: export.Options{
+				Format:    export.Parquet,
+				StartTime: time.Date(2018, time.March, 25, 1, 0, 0, 0, time.UTC),
+				EndTime:   time.Date(2018, time.March, 26, 0, 0, 0, 0, time.UTC),
+				DeviceIDs: []string{"foo", "bar", "baz"},
+				Metrics:   []metric.Key{metric.Temp, metric.PM25},
+				Bucket:    time.Hour,
+				Location:  time.UTC,
+			},
+		},
+		{name: "no start", query: "format=csv", wantErr: true},
+		{name: "bad start", query: "start=yesterday", wantErr: true},
+		{name: "bad format", query: "start=2018-03-25&format=xml", wantErr: true},
+		{name: "bad bucket", query: "start=2018-03-25&bucket=7h", wantErr: true},
+		{name: "bad tz", query: "start=2018-03-25&tz=Mars/Olympus_Mons", wantErr: true},
+		{name: "bad metric", query: "start=2018-03-25&metric=foo", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v, err := url.ParseQuery(c.query)
+			if err != nil {
+				t.Fatalf("Bad query: %v", err)
+			}
+
+			got, err := exportOptions(v)
+			if c.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			sameLocation := cmp.Comparer(func(a, b *time.Location) bool { return a.String() == b.String() })
+			if diff := cmp.Diff(c.want, got, sameLocation); diff != "" {
+				t.Errorf("Unexpected options (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
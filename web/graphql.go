@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/handler/extension"
@@ -15,6 +16,11 @@ import (
 func graphQLHandler(resolver *graph.Resolver) *handler.Server {
 	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}))
 
+	// Subscriptions are served over WebSockets. The keepalive keeps idle connections from being
+	// closed by proxies.
+	srv.AddTransport(transport.Websocket{
+		KeepAlivePingInterval: 10 * time.Second,
+	})
 	srv.AddTransport(transport.Options{})
 	srv.AddTransport(transport.GET{})
 	srv.AddTransport(transport.POST{})
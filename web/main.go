@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"html/template"
 	"log"
@@ -12,8 +13,14 @@ import (
 	"time"
 
 	"cloud.google.com/go/compute/metadata"
+	"cloud.google.com/go/pubsub/v2"
 	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/mtraver/environmental-sensor/alert"
+	"github.com/mtraver/environmental-sensor/broker"
+	"github.com/mtraver/environmental-sensor/device"
 	"github.com/mtraver/environmental-sensor/graph"
+	"github.com/mtraver/environmental-sensor/ingest"
+	"github.com/mtraver/environmental-sensor/routing"
 	"github.com/mtraver/environmental-sensor/util"
 	"github.com/mtraver/environmental-sensor/web/db"
 	"github.com/mtraver/envtools"
@@ -23,16 +30,6 @@ import (
 const (
 	datastoreKind = "measurement"
 
-	// A comma-separated string of device IDs to ignore. Incoming measurements
-	// will be checked for a device ID matching any of the strings specified in
-	// this env var.
-	ignoredDevicesEnvVar = "IGNORED_DEVICES"
-
-	// A comma-separated string of Pub/Sub "source" attributes to ignore. Incoming
-	// Pub/Sub messages will be checked for a "source" attribute matching any of
-	// the strings specified in this env var.
-	ignoredSourcesEnvVar = "IGNORED_SOURCES"
-
 	// awsRoleARNEnvVar is the name of the env var that should contain the ARN of the
 	// AWS role that we'll assume and use to authenticate with AWS IoT to fetch the
 	// list of devices.
@@ -40,6 +37,41 @@ const (
 
 	awsRegionEnvVar = "AWS_REGION"
 
+	// liveMeasurementsTopicEnvVar is the name of the env var that may contain the ID of a Pub/Sub
+	// topic used to relay live measurements between instances, so that GraphQL subscribers see
+	// measurements received by any instance. If it's not set then subscribers only see measurements
+	// received by the instance they're connected to, which is fine if there's only one instance.
+	liveMeasurementsTopicEnvVar = "LIVE_MEASUREMENTS_TOPIC"
+
+	// alertChannelsEnvVar is the name of the env var that may contain a comma-separated list of
+	// named alert notification channels of the form name=URL. See alert.ParseChannels for the
+	// supported URLs. Alert rules refer to channels by name.
+	alertChannelsEnvVar = "ALERT_CHANNELS"
+
+	// oidcIssuerEnvVar is the name of the env var that may contain the URL of the OIDC provider
+	// that users sign in with, e.g. "https://accounts.google.com". If it's not set then no one can
+	// sign in, and callers only see public devices. The other OIDC env vars are required if it's set.
+	oidcIssuerEnvVar       = "OIDC_ISSUER"
+	oidcClientIDEnvVar     = "OIDC_CLIENT_ID"
+	oidcClientSecretEnvVar = "OIDC_CLIENT_SECRET"
+
+	// oidcRedirectURLEnvVar is the name of the env var that contains the URL of /auth/callback as
+	// registered with the OIDC provider, e.g. "https://example.com/auth/callback".
+	oidcRedirectURLEnvVar = "OIDC_REDIRECT_URL"
+
+	// pushHMACSecretEnvVar is the name of the env var that may contain the shared secret with
+	// which generic webhooks sign the requests they make to /push-handlers/webhook. If it's not
+	// set then that route isn't served.
+	pushHMACSecretEnvVar = "PUSH_HMAC_SECRET"
+
+	// adminEmailsEnvVar is the name of the env var that may contain a comma-separated list of the
+	// email addresses of users who can see and edit every device and use the debug pages.
+	adminEmailsEnvVar = "ADMIN_EMAILS"
+
+	// debugDisableAuthEnvVar controls whether every request is treated as coming from an admin.
+	// This is used for local development.
+	debugDisableAuthEnvVar = "DEBUG_DISABLE_AUTH"
+
 	// debugServeClientEnvVar controls whether the client is served from the Go web server
 	// along with the backend. This is used for local development.
 	debugServeClientEnvVar = "DEBUG_SERVE_CLIENT"
@@ -47,6 +79,12 @@ const (
 	// debugGraphQLPlaygroundEnvVar controls whether we serve the GraphQL playground.
 	debugGraphQLPlaygroundEnvVar = "DEBUG_GQL_PLAYGROUND"
 	graphQLPlaygroundURL         = "/debug/graphql"
+
+	// How often devices are synced from AWS IoT into the device registry.
+	deviceSyncInterval = time.Hour
+
+	// How often absence alert rules are evaluated.
+	alertAbsenceInterval = time.Minute
 )
 
 func main() {
@@ -72,18 +110,6 @@ func main() {
 		log.Printf("On GCE and $%s is not set. Fetching devices will probably fail.", awsRoleARNEnvVar)
 	}
 
-	ignoredDevices := stringListToSet(os.Getenv(ignoredDevicesEnvVar))
-	if len(ignoredDevices) > 0 {
-		log.Printf("%s is set to %q. Will ignore devices with IDs: %v",
-			ignoredDevicesEnvVar, os.Getenv(ignoredDevicesEnvVar), slices.Collect(maps.Keys(ignoredDevices)))
-	}
-
-	ignoredSources := stringListToSet(os.Getenv(ignoredSourcesEnvVar))
-	if len(ignoredSources) > 0 {
-		log.Printf("%s is set to %q. Will ignore messages with \"source\" attribute equal to any of these strings: %v",
-			ignoredSourcesEnvVar, os.Getenv(ignoredSourcesEnvVar), slices.Collect(maps.Keys(ignoredSources)))
-	}
-
 	// The path to the templates is relative to go.mod, as that's how they are placed in the Docker image.
 	templates := template.Must(template.New("index.html").Option("missingkey=error").ParseGlob("web/templates/*"))
 
@@ -92,6 +118,41 @@ func main() {
 		log.Fatalf("Failed to make datastore DB: %v", err)
 	}
 
+	var fanout broker.Fanout
+	if topic := os.Getenv(liveMeasurementsTopicEnvVar); topic != "" {
+		ctx := context.Background()
+
+		client, err := pubsub.NewClient(ctx, projectID)
+		if err != nil {
+			log.Fatalf("Failed to make Pub/Sub client: %v", err)
+		}
+
+		// The subscription isn't deleted on exit. It expires on its own once it's unused.
+		fanout, err = broker.NewPubSubFanout(ctx, client, topic)
+		if err != nil {
+			log.Fatalf("Failed to make live measurement fan-out: %v", err)
+		}
+		log.Printf("Relaying live measurements between instances using Pub/Sub topic %q", topic)
+	}
+
+	liveBroker := broker.New(fanout)
+	go func() {
+		if err := liveBroker.Run(context.Background()); err != nil {
+			log.Printf("Live measurement fan-out stopped: %v", err)
+		}
+	}()
+
+	alertChannels, err := alert.ParseChannels(os.Getenv(alertChannelsEnvVar))
+	if err != nil {
+		log.Fatalf("Failed to parse $%s: %v", alertChannelsEnvVar, err)
+	}
+	if len(alertChannels) > 0 {
+		log.Printf("Alert notification channels: %v", slices.Sorted(maps.Keys(alertChannels)))
+	}
+
+	alerts := alert.NewEvaluator(database, database, database, alertChannels, alert.DefaultCacheTTL)
+	go checkAbsence(context.Background(), alerts)
+
 	influxDB := db.NewInfluxDB(envtools.MustGetenv("INFLUXDB_SERVER"), envtools.MustGetenv("INFLUXDB_TOKEN"), envtools.MustGetenv("INFLUXDB_ORG"), envtools.MustGetenv("INFLUXDB_BUCKET"))
 
 	mux := http.NewServeMux()
@@ -109,37 +170,114 @@ func main() {
 		})
 	}
 
+	awsRegion := envtools.MustGetenv(awsRegionEnvVar)
+	go syncDevices(context.Background(), database, roleARN, awsRegion)
+
+	auth := authenticator{
+		Accounts: database,
+		Admins:   util.SplitList(os.Getenv(adminEmailsEnvVar)),
+		Disabled: envtools.IsTruthy(debugDisableAuthEnvVar),
+	}
+	if auth.Disabled {
+		log.Printf("Treating every request as coming from an admin because %s is set", debugDisableAuthEnvVar)
+	}
+
+	if issuer := os.Getenv(oidcIssuerEnvVar); issuer != "" {
+		login, err := newLoginHandler(context.Background(), issuer, envtools.MustGetenv(oidcClientIDEnvVar),
+			envtools.MustGetenv(oidcClientSecretEnvVar), envtools.MustGetenv(oidcRedirectURLEnvVar), database)
+		if err != nil {
+			log.Fatalf("Failed to set up sign-in with %s: %v", issuer, err)
+		}
+		mux.Handle("/auth/", login)
+		log.Printf("Users sign in with %s", issuer)
+	} else {
+		log.Printf("$%s is not set. No one can sign in, so only public devices are visible.", oidcIssuerEnvVar)
+	}
+
 	gqlHandler := graphQLHandler(&graph.Resolver{
-		Database:       database,
-		AWSRegion:      envtools.MustGetenv(awsRegionEnvVar),
-		AWSRoleARN:     roleARN,
-		IgnoredDevices: ignoredDevices,
+		Database:      database,
+		Broker:        liveBroker,
+		Registry:      database,
+		AlertStore:    database,
+		AlertChannels: alertChannels,
+		Calibrations:  database,
+		Accounts:      database,
+		Routing:       database,
+		AWSRegion:     awsRegion,
+		AWSRoleARN:    roleARN,
 	})
-	mux.Handle("/query", gqlHandler)
+	mux.Handle("/query", auth.Wrap(withUnitPreferences(gqlHandler)))
 	if envtools.IsTruthy(debugGraphQLPlaygroundEnvVar) {
 		log.Printf("Serving GraphQL playground at %s because %s is set", graphQLPlaygroundURL, debugGraphQLPlaygroundEnvVar)
 		mux.Handle(graphQLPlaygroundURL, playground.Handler("GraphQL playground", "/query"))
 	}
 
-	mux.Handle("/debug/uploadz", uploadzHandler{
+	mux.Handle("/debug/uploadz", auth.Wrap(requireAdmin(uploadzHandler{
 		DelayedUploadsDur: 48 * time.Hour,
 		Database:          database,
 		Template:          templates,
-	})
+	})))
 
-	mux.Handle("/debug/cachez", cachezHandler{
+	mux.Handle("/debug/devicez", auth.Wrap(requireAdmin(devicezHandler{
 		Database: database,
+		Registry: database,
 		Template: templates,
-	})
+	})))
 
-	mux.Handle("/push-handlers/telemetry", pushHandler{
-		PubSubToken:    envtools.MustGetenv("PUBSUB_VERIFICATION_TOKEN"),
-		PubSubAudience: envtools.MustGetenv("PUBSUB_AUDIENCE"),
-		Database:       database,
-		InfluxDB:       influxDB,
-		IgnoredDevices: ignoredDevices,
-		IgnoredSources: ignoredSources,
-	})
+	mux.Handle("/export", auth.Wrap(exportHandler{
+		Database:     database,
+		Registry:     database,
+		Calibrations: database,
+	}))
+
+	mux.Handle("/debug/cachez", auth.Wrap(requireAdmin(cachezHandler{
+		Database: database,
+		Template: templates,
+	})))
+
+	pipeline := ingest.Pipeline{
+		Database:  database,
+		Dedupe:    database,
+		Broker:    liveBroker,
+		Alerts:    alerts,
+		InfluxDB:  influxDB,
+		Router:    routing.NewRouter(database, routing.DefaultCacheTTL),
+		MaxAge:    ingest.DefaultMaxAge,
+		MaxFuture: ingest.DefaultMaxFuture,
+	}
+	rejected := newRejections()
+
+	mux.Handle("/debug/rejectz", auth.Wrap(requireAdmin(rejectzHandler{
+		Rejections: rejected,
+		Quarantine: database,
+		Pipeline:   pipeline,
+		Template:   templates,
+	})))
+
+	// Every push route shares the handler and differs only in how senders authenticate.
+	push := pushHandler{
+		Pipeline:   pipeline,
+		Rejections: rejected,
+		Quarantine: database,
+	}
+
+	push.Auth = pubSubAuth{
+		Token:    envtools.MustGetenv("PUBSUB_VERIFICATION_TOKEN"),
+		Audience: envtools.MustGetenv("PUBSUB_AUDIENCE"),
+	}
+	mux.Handle("/push-handlers/telemetry", push)
+
+	// The importer's topic has its own Pub/Sub subscription, which pushes here.
+	mux.Handle("/push-handlers/import", push.forImport())
+
+	push.Auth = deviceTokenAuth{Registry: database}
+	mux.Handle("/push-handlers/device", push)
+
+	if secret := os.Getenv(pushHMACSecretEnvVar); secret != "" {
+		push.Auth = hmacAuth{Secret: []byte(secret)}
+		mux.Handle("/push-handlers/webhook", push)
+		log.Printf("Accepting HMAC-signed measurements at /push-handlers/webhook because %s is set", pushHMACSecretEnvVar)
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -151,6 +289,41 @@ func main() {
 	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), gaelog.Wrap(stripTrailingSlash(mux))))
 }
 
+// syncDevices registers AWS IoT things in the device registry every deviceSyncInterval until ctx is done.
+func syncDevices(ctx context.Context, reg device.Registry, roleARN, region string) {
+	for {
+		things, err := device.GetDevicesAWS(ctx, roleARN, region)
+		if err != nil {
+			log.Printf("Failed to get devices from AWS IoT: %v", err)
+		} else if changed, err := device.SyncAWS(ctx, reg, things); err != nil {
+			log.Printf("Failed to sync devices from AWS IoT: %v", err)
+		} else if len(changed) > 0 {
+			log.Printf("Synced %d devices from AWS IoT", len(changed))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(deviceSyncInterval):
+		}
+	}
+}
+
+// checkAbsence evaluates absence alert rules every alertAbsenceInterval until ctx is done.
+func checkAbsence(ctx context.Context, alerts *alert.Evaluator) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(alertAbsenceInterval):
+		}
+
+		if err := alerts.CheckAbsence(ctx); err != nil {
+			log.Printf("Failed to evaluate absence alerts: %v", err)
+		}
+	}
+}
+
 func noCache(h http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
@@ -166,11 +339,3 @@ func stripTrailingSlash(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
-
-func stringListToSet(s string) map[string]struct{} {
-	items := util.FilterInPlace(strings.Split(s, ","), func(v string) bool {
-		return v != ""
-	})
-
-	return util.SliceToSet(items)
-}
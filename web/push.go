@@ -5,16 +5,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"strings"
 	"time"
 
-	"github.com/mtraver/environmental-sensor/database"
+	"github.com/mtraver/environmental-sensor/ingest"
 	mpb "github.com/mtraver/environmental-sensor/measurementpb"
 	mpbutil "github.com/mtraver/environmental-sensor/measurementpbutil"
-	"github.com/mtraver/environmental-sensor/web/db"
+	"github.com/mtraver/environmental-sensor/quarantine"
 	"github.com/mtraver/gaelog"
-	"google.golang.org/api/idtoken"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -32,54 +31,48 @@ type pushRequest struct {
 	Subscription string
 }
 
-// pushHandler handles Pub/Sub push deliveries from the AWS Lambda function (originating from AWS IoT Core).
-type pushHandler struct {
-	PubSubToken    string
-	PubSubAudience string
-	Database       database.Database
-	InfluxDB       *db.InfluxDB
-	IgnoredDevices map[string]struct{}
-	IgnoredSources map[string]struct{}
-}
+// maxPushBodyBytes limits the size of push requests. Measurements are much smaller.
+const maxPushBodyBytes = 1 << 20
 
-// authenticate validates the JWT signed by Pub/Sub.
-func (h pushHandler) authenticate(ctx context.Context, r *http.Request) error {
-	// Verify the token provided as a param in the URL requested by Pub/Sub.
-	if token, ok := r.URL.Query()["token"]; !ok || len(token) != 1 || token[0] != h.PubSubToken {
-		return errors.New("Bad token")
-	}
+// pushHandler handles Pub/Sub push deliveries from the AWS Lambda function (originating from AWS
+// IoT Core), and requests in the same form from other senders, depending on its Auth.
+type pushHandler struct {
+	Auth pushAuthenticator
 
-	// Get the Pub/Sub-generated JWT from the "Authorization" header.
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" || len(strings.Split(authHeader, " ")) != 2 {
-		return errors.New("Missing Authorization header")
-	}
-	token := strings.Split(authHeader, " ")[1]
+	// Pipeline ingests measurements. Its Router is given each message's "source" attribute.
+	Pipeline ingest.Pipeline
 
-	// Decode and verify the JWT.
-	payload, err := idtoken.Validate(ctx, token, h.PubSubAudience)
-	if err != nil {
-		return fmt.Errorf("Invalid JWT: %w", err)
-	}
-	if payload.Issuer != "accounts.google.com" && payload.Issuer != "https://accounts.google.com" {
-		return errors.New("Wrong issuer")
-	}
+	// Rejections counts the measurements that fail validation. It may be nil.
+	Rejections *rejections
 
-	return nil
+	// Quarantine keeps messages that can't be decoded or fail validation. If it's nil they're
+	// dropped.
+	Quarantine quarantine.Store
 }
 
-func (h pushHandler) shouldIgnoreID(deviceID string) bool {
-	_, ok := h.IgnoredDevices[deviceID]
-	return ok
-}
+// authenticate authenticates r with h.Auth. If it fails it writes the error response and returns
+// false.
+func (h pushHandler) authenticate(w http.ResponseWriter, r *http.Request, body []byte) (pushCaller, bool) {
+	ctx := r.Context()
 
-func (h pushHandler) shouldIgnoreSource(src string) bool {
-	if src == "" {
-		return false
+	caller, err := h.Auth.Authenticate(r, body)
+	switch {
+	case errors.Is(err, errPushUnauthenticated):
+		gaelog.Criticalf(ctx, "Authentication failed: %v", err)
+		w.Header().Set("WWW-Authenticate", h.Auth.Challenge())
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return caller, false
+	case errors.Is(err, errPushForbidden):
+		gaelog.Criticalf(ctx, "Authentication failed: %v", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return caller, false
+	case err != nil:
+		gaelog.Errorf(ctx, "Failed to authenticate request: %v", err)
+		http.Error(w, "Failed to authenticate request", http.StatusInternalServerError)
+		return caller, false
 	}
 
-	_, ok := h.IgnoredSources[src]
-	return ok
+	return caller, true
 }
 
 func (h pushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -90,63 +83,114 @@ func (h pushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
 
-	if err := h.authenticate(ctx, r); err != nil {
-		gaelog.Criticalf(ctx, "Authentication failed: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	// Some authenticators sign the body, so it's read before authenticating.
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPushBodyBytes))
+	if err != nil {
+		gaelog.Criticalf(ctx, "Could not read body: %v", err)
+		http.Error(w, fmt.Sprintf("Could not read body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	caller, ok := h.authenticate(w, r, body)
+	if !ok {
 		return
 	}
 
 	var msg pushRequest
-	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+	if err := json.Unmarshal(body, &msg); err != nil {
 		gaelog.Criticalf(ctx, "Could not decode body: %v", err)
 		http.Error(w, fmt.Sprintf("Could not decode body: %v", err), http.StatusBadRequest)
 		return
 	}
 
-	if h.shouldIgnoreSource(msg.Message.Attributes["source"]) {
-		gaelog.Infof(ctx, "Got message from source %q, so it will not be saved. Ignored sources: %v",
-			msg.Message.Attributes["source"], h.IgnoredSources)
-		w.WriteHeader(http.StatusOK)
-		return
+	entry := quarantine.Entry{
+		Received:   time.Now().UTC(),
+		MessageID:  msg.Message.ID,
+		Attributes: quarantine.NewAttributes(msg.Message.Attributes),
+		Payload:    msg.Message.Data,
 	}
 
 	m := &mpb.Measurement{}
 	if err := proto.Unmarshal(msg.Message.Data, m); err != nil {
 		gaelog.Criticalf(ctx, "Failed to unmarshal protobuf: %v\n", err)
+
+		// Once the message is quarantined there's no need for Pub/Sub to deliver it again.
+		entry.Reason = fmt.Sprintf("failed to unmarshal protobuf: %v", err)
+		if h.quarantine(ctx, entry) {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
 		http.Error(w, fmt.Sprintf("Failed to unmarshal protobuf: %v", err), http.StatusBadRequest)
 		return
 	}
 
-	if err := mpbutil.Validate(m); err != nil {
-		gaelog.Errorf(ctx, "%v", err)
-
-		// Pub/Sub will only stop re-trying the message if it receives a status 200.
-		// The docs say that any of 200, 201, 202, 204, or 102 will have this effect
-		// (https://cloud.google.com/pubsub/docs/push), but the local emulator
-		// doesn't respect anything other than 200, so return 200 just to be safe.
-		// TODO(mtraver) I'd rather return e.g. 202 (http.StatusAccepted) to
-		// indicate that it was successfully received but not that all is ok.
-		w.WriteHeader(http.StatusOK)
+	if !caller.mayPush(m.GetDeviceId()) {
+		gaelog.Criticalf(ctx, "Caller may not push measurements from device %q", m.GetDeviceId())
+		http.Error(w, fmt.Sprintf("May not push measurements from device %q", m.GetDeviceId()), http.StatusForbidden)
 		return
 	}
 
-	// If the device ID contains one of the strings set to be ignored then we won't save this measurement to the database.
-	if h.shouldIgnoreID(m.GetDeviceId()) {
-		gaelog.Infof(ctx, "Got measurement from device with ID %q, so it will not be saved. Ignored IDs: %v  Measurement: %+v",
-			m.GetDeviceId(), h.IgnoredDevices, m)
-		w.WriteHeader(http.StatusOK)
-		return
+	ctx = ingest.WithSource(ctx, msg.Message.Attributes["source"])
+	if err := h.ingest(ctx, m); errors.Is(err, ingest.ErrInvalid) {
+		entry.Reason = err.Error()
+		entry.DeviceID = m.GetDeviceId()
+		h.quarantine(ctx, entry)
+	}
+
+	// Pub/Sub will only stop re-trying the message if it receives a status 200.
+	// The docs say that any of 200, 201, 202, 204, or 102 will have this effect
+	// (https://cloud.google.com/pubsub/docs/push), but the local emulator
+	// doesn't respect anything other than 200, so return 200 just to be safe.
+	// TODO(mtraver) I'd rather return e.g. 202 (http.StatusAccepted) to
+	// indicate that it was successfully received but not that all is ok.
+	w.WriteHeader(http.StatusOK)
+}
+
+// forImport returns a copy of h for the route that the importer's Pub/Sub subscription pushes
+// to. Imported measurements are historical, so they may be of any age. It's the route that
+// exempts them from the age limit, not anything in the message, so other senders can't exempt
+// their own measurements.
+func (h pushHandler) forImport() pushHandler {
+	h.Pipeline.MaxAge = 0
+	return h
+}
+
+// quarantine stores e in the quarantine, if there is one. It reports whether e was stored.
+func (h pushHandler) quarantine(ctx context.Context, e quarantine.Entry) bool {
+	if h.Quarantine == nil {
+		return false
 	}
 
-	if err := h.Database.Save(ctx, m); err != nil {
-		gaelog.Errorf(ctx, "Failed to save measurement: %v\n", err)
+	if _, err := h.Quarantine.PutQuarantined(ctx, e); err != nil {
+		gaelog.Errorf(ctx, "Failed to quarantine message: %v", err)
+		return false
 	}
+	return true
+}
 
-	if h.InfluxDB != nil {
-		if err := h.InfluxDB.Save(ctx, m); err != nil {
-			gaelog.Errorf(ctx, "Failed to save measurement to InfluxDB: %v\n", err)
+// ingest passes m to the pipeline, logs the outcome, and returns the pipeline's error.
+// Redelivering m won't change the outcome of anything other than a failure to save it, and
+// Pub/Sub can't tell us how many times it has tried, so the caller always acknowledges the
+// message.
+func (h pushHandler) ingest(ctx context.Context, m *mpb.Measurement) error {
+	err := h.Pipeline.Ingest(ctx, m)
+
+	var verr mpbutil.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		h.Rejections.Record(m.GetDeviceId(), verr)
+		for _, e := range verr {
+			gaelog.Errorf(ctx, "Invalid measurement from device %q: %v", m.GetDeviceId(), e)
 		}
+	case errors.Is(err, ingest.ErrInvalid):
+		gaelog.Errorf(ctx, "%v", err)
+	case errors.Is(err, ingest.ErrIgnored):
+		// The pipeline logs which routing rules dropped it.
+	case errors.Is(err, ingest.ErrDuplicate):
+		gaelog.Infof(ctx, "Got duplicate measurement %q, so it will not be saved again", ingest.DedupeKey(m))
+	case err != nil:
+		gaelog.Errorf(ctx, "%v", err)
 	}
 
-	w.WriteHeader(http.StatusOK)
+	return err
 }
@@ -1,119 +1,26 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/mtraver/environmental-sensor/importer"
+	"github.com/mtraver/environmental-sensor/ingest"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/routing"
+	"github.com/mtraver/environmental-sensor/testutil"
+	"github.com/mtraver/environmental-sensor/web/db"
+	"google.golang.org/protobuf/proto"
+	wpb "google.golang.org/protobuf/types/known/wrapperspb"
 )
 
-func TestShouldIgnoreID(t *testing.T) {
-	cases := []struct {
-		name     string
-		ignored  map[string]struct{}
-		deviceID string
-		want     bool
-	}{
-		{
-			name:     "empty",
-			ignored:  map[string]struct{}{},
-			deviceID: "orange",
-			want:     false,
-		},
-		{
-			name:     "empty_str",
-			ignored:  map[string]struct{}{"": struct{}{}},
-			deviceID: "orange",
-			want:     false,
-		},
-		{
-			name:     "allow",
-			ignored:  map[string]struct{}{"kiwi": struct{}{}},
-			deviceID: "orange",
-			want:     false,
-		},
-		{
-			name:     "allow_multiple",
-			ignored:  map[string]struct{}{"strawberry": struct{}{}, "blueberry": struct{}{}},
-			deviceID: "orange",
-			want:     false,
-		},
-		{
-			name:     "ignore",
-			ignored:  map[string]struct{}{"orange": struct{}{}},
-			deviceID: "orange",
-			want:     true,
-		},
-		{
-			name:     "ignore_multiple",
-			ignored:  map[string]struct{}{"kiwi": struct{}{}, "strawberry": struct{}{}, "orange": struct{}{}},
-			deviceID: "orange",
-			want:     true,
-		},
-	}
-
-	for _, c := range cases {
-		t.Run(c.name, func(t *testing.T) {
-			h := pushHandler{IgnoredDevices: c.ignored}
-			got := h.shouldIgnoreID(c.deviceID)
-			if got != c.want {
-				t.Errorf("got %v, want %v", got, c.want)
-			}
-		})
-	}
-}
-
-func TestShouldIgnoreSource(t *testing.T) {
-	cases := []struct {
-		name    string
-		ignored map[string]struct{}
-		source  string
-		want    bool
-	}{
-		{
-			name:    "empty",
-			ignored: map[string]struct{}{},
-			source:  "AWS",
-			want:    false,
-		},
-		{
-			name:    "empty_str",
-			ignored: map[string]struct{}{"": struct{}{}},
-			source:  "AWS",
-			want:    false,
-		},
-		{
-			name:    "allow",
-			ignored: map[string]struct{}{"my_source": struct{}{}},
-			source:  "AWS",
-			want:    false,
-		},
-		{
-			name:    "allow_multiple",
-			ignored: map[string]struct{}{"my_source": struct{}{}, "my_src_2": struct{}{}},
-			source:  "AWS",
-			want:    false,
-		},
-		{
-			name:    "ignore",
-			ignored: map[string]struct{}{"AWS": struct{}{}},
-			source:  "AWS",
-			want:    true,
-		},
-	}
-
-	for _, c := range cases {
-		t.Run(c.name, func(t *testing.T) {
-			h := pushHandler{IgnoredSources: c.ignored}
-			got := h.shouldIgnoreSource(c.source)
-			if got != c.want {
-				t.Errorf("got %v, want %v", got, c.want)
-			}
-		})
-	}
-}
-
 func TestUnmarshalPushRequest(t *testing.T) {
 	// This example request comes from https://cloud.google.com/pubsub/docs/push#receive_push
 	req := `{
@@ -151,3 +58,164 @@ func TestUnmarshalPushRequest(t *testing.T) {
 		t.Fatalf("mismatch (-got +want):\n%s", diff)
 	}
 }
+
+func TestPushHandlerCountsRejections(t *testing.T) {
+	ctx := context.Background()
+	database := db.NewMemoryDB()
+	h := pushHandler{
+		Pipeline:   ingest.Pipeline{Database: database},
+		Rejections: newRejections(),
+	}
+
+	hot := testutil.FullyPopulatedMeasurementProto()
+	hot.Temp = wpb.Float(5000)
+	hot.Rh = wpb.Float(-1)
+
+	unset := testutil.FullyPopulatedMeasurementProto()
+	unset.DeviceId = "bar"
+	unset.Timestamp = nil
+	unset.Temp = wpb.Float(5000)
+
+	for _, m := range []*mpb.Measurement{testutil.FullyPopulatedMeasurementProto(), hot, unset} {
+		h.ingest(ctx, m)
+	}
+
+	got := h.Rejections.Stats()
+	want := rejectionStats{
+		Since: got.Since,
+		Total: 2,
+		Fields: []rejectionCount{
+			{Name: "temp", Count: 2},
+			{Name: "rh", Count: 1},
+			{Name: "timestamp", Count: 1},
+		},
+		Devices: []rejectionCount{
+			{Name: "bar", Count: 1},
+			{Name: "foo", Count: 1},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected stats (-want +got):\n%s", diff)
+	}
+}
+
+func TestPushHandlerRouting(t *testing.T) {
+	ctx := context.Background()
+	database := db.NewMemoryDB()
+	influx := db.NewMemoryDB()
+
+	for _, r := range []routing.Rule{
+		{Name: "drop test", Source: "test", Action: routing.Drop, Enabled: true},
+		{Name: "moved", DevicePattern: "foo", Action: routing.Rename, RenameTo: "bar", Enabled: true},
+		{Name: "influx only", DevicePattern: "baz", Action: routing.Route, Sinks: []ingest.Sink{ingest.SinkInfluxDB}, Enabled: true},
+	} {
+		if _, err := database.PutRoutingRule(ctx, r); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	h := pushHandler{
+		Auth:     hmacAuth{Secret: testPushSecret, now: func() time.Time { return testPushNow }},
+		Pipeline: ingest.Pipeline{Database: database, InfluxDB: influx, Router: routing.NewRouter(database, 0)},
+	}
+
+	push := func(deviceID, source string) {
+		t.Helper()
+
+		m := testutil.FullyPopulatedMeasurementProto()
+		m.DeviceId = deviceID
+		data, err := proto.Marshal(m)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		body, err := json.Marshal(pushRequest{Message: pubSubMessage{Data: data, Attributes: map[string]string{"source": source}}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, signedRequest(body, testPushNow))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+		}
+	}
+
+	push("qux", "test")
+	push("foo", "AWS")
+	push("baz", "AWS")
+
+	latest := func(store *db.MemoryDB) []string {
+		t.Helper()
+
+		got, err := store.Latest(ctx, []string{"foo", "bar", "baz", "qux"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return slices.Sorted(maps.Keys(got))
+	}
+
+	if diff := cmp.Diff([]string{"bar"}, latest(database)); diff != "" {
+		t.Errorf("Unexpected devices in database (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"bar", "baz"}, latest(influx)); diff != "" {
+		t.Errorf("Unexpected devices in InfluxDB (-want +got):\n%s", diff)
+	}
+}
+
+func TestPushHandlerAgeLimit(t *testing.T) {
+	ctx := context.Background()
+
+	// testutil's measurements are from long ago.
+	data, err := proto.Marshal(testutil.FullyPopulatedMeasurementProto())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	body, err := json.Marshal(pushRequest{Message: pubSubMessage{Data: data, Attributes: map[string]string{"source": importer.SourceAttribute}}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		name      string
+		handler   func(pushHandler) pushHandler
+		wantSaved bool
+	}{
+		// Claiming to be the importer doesn't exempt a measurement from the age limit.
+		{"webhook", func(h pushHandler) pushHandler { return h }, false},
+		{"import", pushHandler.forImport, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			database := db.NewMemoryDB()
+			h := tc.handler(pushHandler{
+				Auth:       hmacAuth{Secret: testPushSecret, now: func() time.Time { return testPushNow }},
+				Pipeline:   ingest.Pipeline{Database: database, MaxAge: ingest.DefaultMaxAge, MaxFuture: ingest.DefaultMaxFuture},
+				Rejections: newRejections(),
+				Quarantine: database,
+			})
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, signedRequest(body, testPushNow))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+			}
+
+			got, err := database.Latest(ctx, []string{"foo"})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if _, saved := got["foo"]; saved != tc.wantSaved {
+				t.Errorf("got saved %t, want %t", saved, tc.wantSaved)
+			}
+
+			quarantined, err := database.RecentlyQuarantined(ctx, 10)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if wantQuarantined := !tc.wantSaved; (len(quarantined) == 1) != wantQuarantined {
+				t.Errorf("got %d quarantined, want quarantined %t", len(quarantined), wantQuarantined)
+			}
+		})
+	}
+}
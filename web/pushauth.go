@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/device"
+	"google.golang.org/api/idtoken"
+)
+
+const (
+	// pushTimestampHeader and pushSignatureHeader carry the time at which an HMAC-signed push
+	// request was signed, in Unix seconds, and its signature as returned by signPush.
+	pushTimestampHeader = "X-Push-Timestamp"
+	pushSignatureHeader = "X-Push-Signature"
+
+	// defaultPushMaxSkew is how far the timestamp of an HMAC-signed push request may be from
+	// now, so that captured requests can't be replayed later.
+	defaultPushMaxSkew = 5 * time.Minute
+)
+
+var (
+	// errPushUnauthenticated means that a push request didn't prove who sent it. The handler
+	// responds with 401 Unauthorized.
+	errPushUnauthenticated = errors.New("unauthenticated")
+
+	// errPushForbidden means that a push request came from a sender who isn't allowed to push.
+	// The handler responds with 403 Forbidden.
+	errPushForbidden = errors.New("forbidden")
+)
+
+// pushCaller is who sent a push request.
+type pushCaller struct {
+	// DeviceIDs are the device IDs whose measurements the caller may push. If it's empty then
+	// the caller may push measurements from any device.
+	DeviceIDs []string
+}
+
+// mayPush reports whether the caller may push measurements from the given device.
+func (c pushCaller) mayPush(deviceID string) bool {
+	return len(c.DeviceIDs) == 0 || slices.Contains(c.DeviceIDs, deviceID)
+}
+
+// pushAuthenticator authenticates the requests made to a push handler route. Errors that wrap
+// errPushUnauthenticated or errPushForbidden are the caller's fault; any other error means that
+// the request couldn't be checked.
+type pushAuthenticator interface {
+	// Authenticate checks r, whose body has already been read into body, and returns who sent it.
+	Authenticate(r *http.Request, body []byte) (pushCaller, error)
+
+	// Challenge returns the value of the WWW-Authenticate header sent with 401 responses.
+	Challenge() string
+}
+
+// bearerToken returns the bearer token in r's Authorization header.
+func bearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token, ok && token != ""
+}
+
+// pubSubAuth authenticates Pub/Sub push deliveries, which carry a static verification token as a
+// URL param and a Google-signed JWT as a bearer token.
+type pubSubAuth struct {
+	Token    string
+	Audience string
+
+	// validate validates the JWT. If it's nil then idtoken.Validate is used.
+	validate func(ctx context.Context, token, audience string) (*idtoken.Payload, error)
+}
+
+func (a pubSubAuth) Authenticate(r *http.Request, body []byte) (pushCaller, error) {
+	// Verify the token provided as a param in the URL requested by Pub/Sub.
+	if token, ok := r.URL.Query()["token"]; !ok || len(token) != 1 || subtle.ConstantTimeCompare([]byte(token[0]), []byte(a.Token)) != 1 {
+		return pushCaller{}, fmt.Errorf("%w: bad token", errPushUnauthenticated)
+	}
+
+	// Get the Pub/Sub-generated JWT from the "Authorization" header.
+	token, ok := bearerToken(r)
+	if !ok {
+		return pushCaller{}, fmt.Errorf("%w: missing Authorization header", errPushUnauthenticated)
+	}
+
+	// Decode and verify the JWT.
+	validate := a.validate
+	if validate == nil {
+		validate = idtoken.Validate
+	}
+	payload, err := validate(r.Context(), token, a.Audience)
+	if err != nil {
+		return pushCaller{}, fmt.Errorf("%w: invalid JWT: %v", errPushUnauthenticated, err)
+	}
+	if payload.Issuer != "accounts.google.com" && payload.Issuer != "https://accounts.google.com" {
+		return pushCaller{}, fmt.Errorf("%w: wrong issuer %q", errPushForbidden, payload.Issuer)
+	}
+
+	return pushCaller{}, nil
+}
+
+func (a pubSubAuth) Challenge() string {
+	return "Bearer"
+}
+
+// signPush returns the signature of an HMAC-signed push request with the given timestamp and
+// body: "sha256=" followed by the hex-encoded HMAC-SHA256 of the timestamp, a period, and the
+// body.
+func signPush(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// hmacAuth authenticates push requests from generic webhooks that sign them with a shared
+// secret. Anyone with the secret may push measurements from any device.
+type hmacAuth struct {
+	Secret []byte
+
+	// MaxSkew is how far a request's timestamp may be from now. If it's zero then
+	// defaultPushMaxSkew is used.
+	MaxSkew time.Duration
+
+	// now returns the current time. If it's nil then time.Now is used.
+	now func() time.Time
+}
+
+func (a hmacAuth) Authenticate(r *http.Request, body []byte) (pushCaller, error) {
+	ts := r.Header.Get(pushTimestampHeader)
+	sig := r.Header.Get(pushSignatureHeader)
+	if ts == "" || sig == "" {
+		return pushCaller{}, fmt.Errorf("%w: missing %s or %s header", errPushUnauthenticated, pushTimestampHeader, pushSignatureHeader)
+	}
+
+	secs, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return pushCaller{}, fmt.Errorf("%w: bad %s header %q", errPushUnauthenticated, pushTimestampHeader, ts)
+	}
+
+	now := time.Now()
+	if a.now != nil {
+		now = a.now()
+	}
+	maxSkew := a.MaxSkew
+	if maxSkew == 0 {
+		maxSkew = defaultPushMaxSkew
+	}
+	if skew := now.Sub(time.Unix(secs, 0)).Abs(); skew > maxSkew {
+		return pushCaller{}, fmt.Errorf("%w: timestamp is %v from now", errPushUnauthenticated, skew.Round(time.Second))
+	}
+
+	if !hmac.Equal([]byte(sig), []byte(signPush(a.Secret, ts, body))) {
+		return pushCaller{}, fmt.Errorf("%w: bad signature", errPushUnauthenticated)
+	}
+
+	return pushCaller{}, nil
+}
+
+func (a hmacAuth) Challenge() string {
+	return "HMAC-SHA256"
+}
+
+// deviceTokenAuth authenticates push requests from devices that send their push token, made by
+// device.NewPushToken, as a bearer token. A device may only push its own measurements.
+type deviceTokenAuth struct {
+	Registry device.Registry
+}
+
+func (a deviceTokenAuth) Authenticate(r *http.Request, body []byte) (pushCaller, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return pushCaller{}, fmt.Errorf("%w: missing Authorization header", errPushUnauthenticated)
+	}
+
+	id, ok := device.ParsePushToken(token)
+	if !ok {
+		return pushCaller{}, fmt.Errorf("%w: not a push token", errPushUnauthenticated)
+	}
+
+	d, err := a.Registry.Device(r.Context(), id)
+	if errors.Is(err, device.ErrNotFound) {
+		return pushCaller{}, fmt.Errorf("%w: bad push token", errPushUnauthenticated)
+	} else if err != nil {
+		return pushCaller{}, err
+	}
+
+	// Devices without a push token never match, since no token hashes to the empty string.
+	hash := device.HashPushToken(token)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(d.PushTokenHash)) != 1 {
+		return pushCaller{}, fmt.Errorf("%w: bad push token", errPushUnauthenticated)
+	}
+
+	return pushCaller{DeviceIDs: d.DeviceIDs()}, nil
+}
+
+func (a deviceTokenAuth) Challenge() string {
+	return "Bearer"
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mtraver/environmental-sensor/device"
+	"github.com/mtraver/environmental-sensor/ingest"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	"github.com/mtraver/environmental-sensor/testutil"
+	"github.com/mtraver/environmental-sensor/web/db"
+	"google.golang.org/api/idtoken"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	testPushSecret = []byte("secret")
+	testPushNow    = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+)
+
+// pushBody returns the body of a push request carrying m.
+func pushBody(t *testing.T, m *mpb.Measurement) []byte {
+	t.Helper()
+
+	data, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	b, err := json.Marshal(pushRequest{Message: pubSubMessage{ID: "1", Data: data}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return b
+}
+
+// signedRequest returns a push request with the given body signed at ts.
+func signedRequest(body []byte, ts time.Time) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/push-handlers/webhook", bytes.NewReader(body))
+	sec := strconv.FormatInt(ts.Unix(), 10)
+	r.Header.Set(pushTimestampHeader, sec)
+	r.Header.Set(pushSignatureHeader, signPush(testPushSecret, sec, body))
+	return r
+}
+
+func TestPubSubAuth(t *testing.T) {
+	a := pubSubAuth{
+		Token:    "token",
+		Audience: "aud",
+		validate: func(ctx context.Context, token, audience string) (*idtoken.Payload, error) {
+			if audience != "aud" {
+				t.Errorf("got audience %q, want %q", audience, "aud")
+			}
+			switch token {
+			case "google":
+				return &idtoken.Payload{Issuer: "https://accounts.google.com"}, nil
+			case "other":
+				return &idtoken.Payload{Issuer: "https://example.com"}, nil
+			}
+			return nil, errors.New("bad JWT")
+		},
+	}
+
+	cases := []struct {
+		name    string
+		target  string
+		auth    string
+		wantErr error
+	}{
+		{"ok", "/?token=token", "Bearer google", nil},
+		{"no_token", "/", "Bearer google", errPushUnauthenticated},
+		{"wrong_token", "/?token=nope", "Bearer google", errPushUnauthenticated},
+		{"two_tokens", "/?token=token&token=token", "Bearer google", errPushUnauthenticated},
+		{"no_jwt", "/?token=token", "", errPushUnauthenticated},
+		{"bad_jwt", "/?token=token", "Bearer spam", errPushUnauthenticated},
+		{"wrong_issuer", "/?token=token", "Bearer other", errPushForbidden},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tc.target, nil)
+			if tc.auth != "" {
+				r.Header.Set("Authorization", tc.auth)
+			}
+
+			caller, err := a.Authenticate(r, nil)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+			if err == nil && !caller.mayPush("foo") {
+				t.Error("Pub/Sub should be able to push measurements from any device")
+			}
+		})
+	}
+}
+
+func TestHMACAuth(t *testing.T) {
+	a := hmacAuth{Secret: testPushSecret, now: func() time.Time { return testPushNow }}
+	body := []byte(`{"message": {}}`)
+
+	cases := []struct {
+		name    string
+		req     func() *http.Request
+		wantErr bool
+	}{
+		{
+			name: "ok",
+			req:  func() *http.Request { return signedRequest(body, testPushNow) },
+		},
+		{
+			name: "within_skew",
+			req:  func() *http.Request { return signedRequest(body, testPushNow.Add(-4*time.Minute)) },
+		},
+		{
+			name:    "too_old",
+			req:     func() *http.Request { return signedRequest(body, testPushNow.Add(-6*time.Minute)) },
+			wantErr: true,
+		},
+		{
+			name:    "too_new",
+			req:     func() *http.Request { return signedRequest(body, testPushNow.Add(6*time.Minute)) },
+			wantErr: true,
+		},
+		{
+			name: "unsigned",
+			req: func() *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+			},
+			wantErr: true,
+		},
+		{
+			name: "bad_timestamp",
+			req: func() *http.Request {
+				r := signedRequest(body, testPushNow)
+				r.Header.Set(pushTimestampHeader, "yesterday")
+				return r
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong_secret",
+			req: func() *http.Request {
+				r := signedRequest(body, testPushNow)
+				r.Header.Set(pushSignatureHeader, signPush([]byte("nope"), strconv.FormatInt(testPushNow.Unix(), 10), body))
+				return r
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := a.Authenticate(tc.req(), body)
+			if tc.wantErr && !errors.Is(err, errPushUnauthenticated) {
+				t.Fatalf("got error %v, want %v", err, errPushUnauthenticated)
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+
+	// The signature covers the body.
+	if _, err := a.Authenticate(signedRequest(body, testPushNow), []byte("spam")); !errors.Is(err, errPushUnauthenticated) {
+		t.Errorf("got error %v for altered body, want %v", err, errPushUnauthenticated)
+	}
+}
+
+// registerWithPushToken registers a device and gives it a push token, which it returns.
+func registerWithPushToken(t *testing.T, reg device.Registry, d device.Device) string {
+	t.Helper()
+	ctx := context.Background()
+
+	d, err := reg.PutDevice(ctx, d)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	token, hash, err := device.NewPushToken(d.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	d.PushTokenHash = hash
+	if _, err := reg.PutDevice(ctx, d); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return token
+}
+
+func TestDeviceTokenAuth(t *testing.T) {
+	database := db.NewMemoryDB()
+	token := registerWithPushToken(t, database, device.Device{DeviceID: "foo", Aliases: []string{"old-foo"}})
+
+	noToken, err := database.PutDevice(context.Background(), device.Device{DeviceID: "bar"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	id, _ := device.ParsePushToken(token)
+
+	a := deviceTokenAuth{Registry: database}
+
+	cases := []struct {
+		name          string
+		auth          string
+		wantDeviceIDs []string
+		wantErr       bool
+	}{
+		{name: "ok", auth: "Bearer " + token, wantDeviceIDs: []string{"foo", "old-foo"}},
+		{name: "missing", auth: "", wantErr: true},
+		{name: "not_push_token", auth: "Bearer est_spam", wantErr: true},
+		{name: "wrong_secret", auth: "Bearer edp_" + id + ".spam", wantErr: true},
+		{name: "unknown_device", auth: "Bearer edp_nope.spam", wantErr: true},
+		{name: "device_without_token", auth: "Bearer edp_" + noToken.ID + ".spam", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/push-handlers/device", nil)
+			if tc.auth != "" {
+				r.Header.Set("Authorization", tc.auth)
+			}
+
+			caller, err := a.Authenticate(r, nil)
+			if tc.wantErr {
+				if !errors.Is(err, errPushUnauthenticated) {
+					t.Fatalf("got error %v, want %v", err, errPushUnauthenticated)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantDeviceIDs, caller.DeviceIDs); diff != "" {
+				t.Errorf("Unexpected device IDs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPushHandlerAuth(t *testing.T) {
+	database := db.NewMemoryDB()
+	token := registerWithPushToken(t, database, device.Device{DeviceID: "foo"})
+
+	h := pushHandler{Pipeline: ingest.Pipeline{Database: database}}
+	hmacHandler, deviceHandler := h, h
+	hmacHandler.Auth = hmacAuth{Secret: testPushSecret, now: func() time.Time { return testPushNow }}
+	deviceHandler.Auth = deviceTokenAuth{Registry: database}
+
+	foo := pushBody(t, testutil.FullyPopulatedMeasurementProto())
+	bar := testutil.FullyPopulatedMeasurementProto()
+	bar.DeviceId = "bar"
+
+	withToken := func(body []byte, token string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/push-handlers/device", bytes.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		return r
+	}
+
+	cases := []struct {
+		name          string
+		handler       pushHandler
+		req           *http.Request
+		wantCode      int
+		wantChallenge string
+	}{
+		{"hmac_ok", hmacHandler, signedRequest(foo, testPushNow), http.StatusOK, ""},
+		{"hmac_stale", hmacHandler, signedRequest(foo, testPushNow.Add(-time.Hour)), http.StatusUnauthorized, "HMAC-SHA256"},
+		{"device_ok", deviceHandler, withToken(foo, token), http.StatusOK, ""},
+		{"device_bad_token", deviceHandler, withToken(foo, "spam"), http.StatusUnauthorized, "Bearer"},
+		{"device_other_device", deviceHandler, withToken(pushBody(t, bar), token), http.StatusForbidden, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tc.handler.ServeHTTP(rec, tc.req)
+
+			if rec.Code != tc.wantCode {
+				t.Errorf("got status %d, want %d", rec.Code, tc.wantCode)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != tc.wantChallenge {
+				t.Errorf("got WWW-Authenticate %q, want %q", got, tc.wantChallenge)
+			}
+		})
+	}
+}
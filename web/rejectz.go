@@ -0,0 +1,238 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mtraver/gaelog"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/mtraver/environmental-sensor/ingest"
+	mpb "github.com/mtraver/environmental-sensor/measurementpb"
+	mpbutil "github.com/mtraver/environmental-sensor/measurementpbutil"
+	"github.com/mtraver/environmental-sensor/quarantine"
+)
+
+// rejections counts the measurements that failed validation since the server started, by field
+// and by device.
+type rejections struct {
+	mu      sync.Mutex
+	since   time.Time
+	total   int
+	fields  map[string]int
+	devices map[string]int
+}
+
+func newRejections() *rejections {
+	return &rejections{
+		since:   time.Now().UTC(),
+		fields:  make(map[string]int),
+		devices: make(map[string]int),
+	}
+}
+
+// Record counts a measurement from the given device that failed validation with errs.
+func (r *rejections) Record(deviceID string, errs mpbutil.ValidationError) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.total++
+	r.devices[deviceID]++
+
+	// Count each field once per measurement, even if it has more than one problem.
+	seen := make(map[string]bool)
+	for _, e := range errs {
+		if !seen[e.Field] {
+			seen[e.Field] = true
+			r.fields[e.Field]++
+		}
+	}
+}
+
+// rejectionCount is the number of rejected measurements with a problem with a field, or from a
+// device.
+type rejectionCount struct {
+	Name  string
+	Count int
+}
+
+type rejectionStats struct {
+	Since   time.Time
+	Total   int
+	Fields  []rejectionCount
+	Devices []rejectionCount
+}
+
+func sortedCounts(m map[string]int) []rejectionCount {
+	counts := make([]rejectionCount, 0, len(m))
+	for _, name := range slices.Sorted(maps.Keys(m)) {
+		counts = append(counts, rejectionCount{Name: name, Count: m[name]})
+	}
+	slices.SortStableFunc(counts, func(a, b rejectionCount) int {
+		return cmp.Compare(b.Count, a.Count)
+	})
+	return counts
+}
+
+// Stats returns the counts, with the most common fields and devices first.
+func (r *rejections) Stats() rejectionStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return rejectionStats{
+		Since:   r.since,
+		Total:   r.total,
+		Fields:  sortedCounts(r.fields),
+		Devices: sortedCounts(r.devices),
+	}
+}
+
+// rejectzLimit is the number of quarantined messages shown on the page.
+const rejectzLimit = 100
+
+// quarantinedMessage is a quarantined message, decoded if possible, for display.
+type quarantinedMessage struct {
+	quarantine.Entry
+	Measurement string
+}
+
+// rejectzHandler renders a page displaying how many measurements failed validation and why,
+// and the most recently quarantined messages. Quarantined messages can be reprocessed, e.g.
+// after a bug that rejected them is fixed, or deleted.
+type rejectzHandler struct {
+	Rejections *rejections
+	Quarantine quarantine.Store
+	Pipeline   ingest.Pipeline
+	Template   *template.Template
+}
+
+func (h rejectzHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method == http.MethodPost {
+		h.act(w, r)
+		return
+	}
+
+	entries, err := h.Quarantine.RecentlyQuarantined(ctx, rejectzLimit)
+	if err != nil {
+		gaelog.Errorf(ctx, "Error fetching data: %v", err)
+	}
+
+	messages := make([]quarantinedMessage, len(entries))
+	for i, e := range entries {
+		messages[i] = quarantinedMessage{Entry: e}
+		if m, err := decodeQuarantined(e); err == nil {
+			messages[i].Measurement = mpbutil.String(m)
+		}
+	}
+
+	data := struct {
+		Stats       rejectionStats
+		Limit       int
+		Quarantined []quarantinedMessage
+		Result      string
+		Error       error
+	}{
+		Stats:       h.Rejections.Stats(),
+		Limit:       rejectzLimit,
+		Quarantined: messages,
+		Result:      r.URL.Query().Get("result"),
+		Error:       err,
+	}
+
+	if err := h.Template.ExecuteTemplate(w, "rejectz", data); err != nil {
+		gaelog.Errorf(ctx, "Could not execute template: %v", err)
+	}
+}
+
+// act reprocesses or deletes a quarantined message and redirects back to the page, saying what
+// happened.
+func (h rejectzHandler) act(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.FormValue("id")
+
+	var result string
+	var err error
+	switch r.FormValue("action") {
+	case "reprocess":
+		result, err = h.reprocess(ctx, id)
+	case "delete":
+		err = h.Quarantine.DeleteQuarantined(ctx, id)
+		result = fmt.Sprintf("Deleted %s.", id)
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, quarantine.ErrNotFound) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		gaelog.Errorf(ctx, "Failed to %s quarantined message %s: %v", r.FormValue("action"), id, err)
+		http.Error(w, fmt.Sprintf("Failed to %s quarantined message", r.FormValue("action")), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/debug/rejectz?"+url.Values{"result": {result}}.Encode(), http.StatusSeeOther)
+}
+
+func decodeQuarantined(e quarantine.Entry) (*mpb.Measurement, error) {
+	m := &mpb.Measurement{}
+	if err := proto.Unmarshal(e.Payload, m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal protobuf: %v", err)
+	}
+	return m, nil
+}
+
+// reprocess passes the quarantined message with the given ID to the pipeline again. It's given
+// the source that the message was pushed with, so that routing rules apply to it as they would
+// have, and the time that it was received, so that it isn't rejected as too old just for having
+// been quarantined for a while. If it's accepted then it's removed from the quarantine, and if
+// it's rejected again then its reason is updated. It returns a description of the outcome. An error means that the message couldn't be
+// reprocessed and is still quarantined.
+func (h rejectzHandler) reprocess(ctx context.Context, id string) (string, error) {
+	e, err := h.Quarantine.Quarantined(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	m, ingestErr := decodeQuarantined(e)
+	if ingestErr == nil {
+		e.DeviceID = m.GetDeviceId()
+		ingestCtx := ingest.WithReceived(ingest.WithSource(ctx, e.Attribute("source")), e.Received)
+		ingestErr = h.Pipeline.Ingest(ingestCtx, m)
+	}
+
+	switch {
+	case m == nil, errors.Is(ingestErr, ingest.ErrInvalid):
+		e.Reason = ingestErr.Error()
+		if _, err := h.Quarantine.PutQuarantined(ctx, e); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s was rejected again: %v", id, ingestErr), nil
+	case ingestErr != nil && !errors.Is(ingestErr, ingest.ErrIgnored) && !errors.Is(ingestErr, ingest.ErrDuplicate):
+		return "", ingestErr
+	}
+
+	if err := h.Quarantine.DeleteQuarantined(ctx, id); err != nil {
+		return "", err
+	}
+	if ingestErr != nil {
+		return fmt.Sprintf("%s was reprocessed: %v", id, ingestErr), nil
+	}
+	return fmt.Sprintf("%s was reprocessed and saved.", id), nil
+}
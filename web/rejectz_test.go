@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mtraver/environmental-sensor/database"
+	"github.com/mtraver/environmental-sensor/ingest"
+	"github.com/mtraver/environmental-sensor/quarantine"
+	"github.com/mtraver/environmental-sensor/routing"
+	"github.com/mtraver/environmental-sensor/testutil"
+	"github.com/mtraver/environmental-sensor/web/db"
+	"google.golang.org/protobuf/proto"
+	tspb "google.golang.org/protobuf/types/known/timestamppb"
+	wpb "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestRejectzHandler(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryDB()
+	if _, err := store.PutRoutingRule(ctx, routing.Rule{Name: "test", Source: "test", Action: routing.Drop, Enabled: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	h := rejectzHandler{
+		Rejections: newRejections(),
+		Quarantine: store,
+		Pipeline:   ingest.Pipeline{Database: store, Router: routing.NewRouter(store, 0)},
+		Template:   template.Must(template.New("").ParseGlob("templates/*")),
+	}
+
+	quarantined := func(m proto.Message, payload []byte, attrs map[string]string) string {
+		t.Helper()
+		if m != nil {
+			var err error
+			if payload, err = proto.Marshal(m); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		e, err := store.PutQuarantined(ctx, quarantine.Entry{Received: time.Now(), Reason: "test", Attributes: quarantine.NewAttributes(attrs), Payload: payload})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return e.ID
+	}
+
+	hot := testutil.FullyPopulatedMeasurementProto()
+	hot.Temp = wpb.Float(5000)
+
+	fromTest := testutil.FullyPopulatedMeasurementProto()
+	fromTest.DeviceId = "bar"
+
+	valid := quarantined(testutil.FullyPopulatedMeasurementProto(), nil, nil)
+	dropped := quarantined(fromTest, nil, map[string]string{"source": "test"})
+	invalid := quarantined(hot, nil, nil)
+	garbage := quarantined(nil, []byte("spam"), nil)
+
+	post := func(action, id string) *httptest.ResponseRecorder {
+		form := url.Values{"action": {action}, "id": {id}}
+		req := httptest.NewRequest(http.MethodPost, "/debug/rejectz", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	get := httptest.NewRecorder()
+	h.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/debug/rejectz", nil))
+	if get.Code != http.StatusOK {
+		t.Fatalf("GET: got status %d, want %d", get.Code, http.StatusOK)
+	}
+	for _, id := range []string{valid, dropped, invalid, garbage} {
+		if !strings.Contains(get.Body.String(), id) {
+			t.Errorf("GET: page doesn't list %s", id)
+		}
+	}
+
+	// A measurement that's valid now is saved and removed from the quarantine.
+	if rec := post("reprocess", valid); rec.Code != http.StatusSeeOther {
+		t.Fatalf("reprocess valid: got status %d, want %d", rec.Code, http.StatusSeeOther)
+	}
+	if _, err := store.Quarantined(ctx, valid); !errors.Is(err, quarantine.ErrNotFound) {
+		t.Errorf("reprocess valid: got error %v, want %v", err, quarantine.ErrNotFound)
+	}
+	page, err := store.Query(ctx, database.Query{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(page.Measurements) != 1 {
+		t.Errorf("reprocess valid: %d measurements saved, want 1", len(page.Measurements))
+	}
+
+	// Routing rules match on the source that the message was pushed with, so one from a dropped
+	// source is removed from the quarantine without being saved.
+	if rec := post("reprocess", dropped); rec.Code != http.StatusSeeOther {
+		t.Fatalf("reprocess dropped: got status %d, want %d", rec.Code, http.StatusSeeOther)
+	}
+	if _, err := store.Quarantined(ctx, dropped); !errors.Is(err, quarantine.ErrNotFound) {
+		t.Errorf("reprocess dropped: got error %v, want %v", err, quarantine.ErrNotFound)
+	}
+	if page, err = store.Query(ctx, database.Query{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(page.Measurements) != 1 {
+		t.Errorf("reprocess dropped: %d measurements saved, want 1", len(page.Measurements))
+	}
+
+	// Those that are still rejected stay quarantined, with the new reason.
+	for _, id := range []string{invalid, garbage} {
+		if rec := post("reprocess", id); rec.Code != http.StatusSeeOther {
+			t.Fatalf("reprocess %s: got status %d, want %d", id, rec.Code, http.StatusSeeOther)
+		}
+		e, err := store.Quarantined(ctx, id)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if e.Reason == "test" {
+			t.Errorf("reprocess %s: reason wasn't updated", id)
+		}
+	}
+
+	if rec := post("delete", garbage); rec.Code != http.StatusSeeOther {
+		t.Fatalf("delete: got status %d, want %d", rec.Code, http.StatusSeeOther)
+	}
+	if _, err := store.Quarantined(ctx, garbage); !errors.Is(err, quarantine.ErrNotFound) {
+		t.Errorf("delete: got error %v, want %v", err, quarantine.ErrNotFound)
+	}
+
+	if rec := post("reprocess", garbage); rec.Code != http.StatusNotFound {
+		t.Errorf("reprocess deleted: got status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := post("spam", invalid); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown action: got status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRejectzReprocessOld(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryDB()
+	h := rejectzHandler{
+		Quarantine: store,
+		Pipeline:   ingest.Pipeline{Database: store, MaxAge: ingest.DefaultMaxAge, MaxFuture: ingest.DefaultMaxFuture},
+	}
+
+	// The measurement was quarantined long enough ago that it's too old to be accepted now, but
+	// it was recent when it was received.
+	received := time.Now().Add(-2 * ingest.DefaultMaxAge)
+	m := testutil.FullyPopulatedMeasurementProto()
+	m.Timestamp = tspb.New(received.Add(-time.Minute))
+	m.UploadTimestamp = nil
+	payload, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	e, err := store.PutQuarantined(ctx, quarantine.Entry{Received: received, Reason: "test", Payload: payload})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := h.reprocess(ctx, e.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := store.Quarantined(ctx, e.ID); !errors.Is(err, quarantine.ErrNotFound) {
+		t.Errorf("got error %v, want %v", err, quarantine.ErrNotFound)
+	}
+	got, err := store.Latest(ctx, []string{"foo"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := got["foo"]; !ok {
+		t.Error("The reprocessed measurement wasn't saved")
+	}
+}
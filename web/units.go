@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/mtraver/environmental-sensor/graph"
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+// unitsCookie is the name of the cookie that holds the user's preferred units as a
+// comma-separated list of unit IDs, e.g. "fahrenheit,mg_per_m3". See metric.ParsePreferences.
+const unitsCookie = "units"
+
+// unitPreferences returns the preferred units of the user making r. If the cookie is missing or
+// malformed then there are no preferences and values are given in the units they're stored in.
+func unitPreferences(r *http.Request) metric.Preferences {
+	c, err := r.Cookie(unitsCookie)
+	if err != nil {
+		return nil
+	}
+
+	p, err := metric.ParsePreferences(c.Value)
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+// withUnitPreferences makes the preferred units of the user making each request available to
+// GraphQL resolvers.
+func withUnitPreferences(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := graph.WithUnitPreferences(r.Context(), unitPreferences(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
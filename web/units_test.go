@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mtraver/environmental-sensor/metric"
+)
+
+func TestUnitPreferences(t *testing.T) {
+	cases := []struct {
+		name   string
+		cookie *http.Cookie
+		want   metric.Preferences
+	}{
+		{"no cookie", nil, nil},
+		{"valid", &http.Cookie{Name: unitsCookie, Value: "fahrenheit,mg_per_m3"}, metric.Preferences{metric.Fahrenheit, metric.MilligramsPerCubicMeter}},
+		{"malformed", &http.Cookie{Name: unitsCookie, Value: "fahrenheit,furlongs"}, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/query", nil)
+			if c.cookie != nil {
+				r.AddCookie(c.cookie)
+			}
+
+			if diff := cmp.Diff(c.want, unitPreferences(r)); diff != "" {
+				t.Errorf("Unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}